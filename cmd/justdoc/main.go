@@ -1,52 +1,503 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"flag"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/rashpile/pako-justdoc/internal/api"
+	"github.com/rashpile/pako-justdoc/internal/backup"
+	"github.com/rashpile/pako-justdoc/internal/certs"
+	"github.com/rashpile/pako-justdoc/internal/cli"
+	"github.com/rashpile/pako-justdoc/internal/config"
 	"github.com/rashpile/pako-justdoc/internal/storage"
+	"go.etcd.io/bbolt"
 )
 
 func main() {
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		switch args[0] {
+		case "restore":
+			restore(args[1:])
+			return
+		case "reencrypt":
+			reencrypt(args[1:])
+			return
+		case "compact":
+			compact(args[1:])
+			return
+		case "check":
+			check(args[1:])
+			return
+		case "config":
+			os.Exit(configCommand(args[1:]))
+		default:
+			if cli.IsCommand(args[0]) {
+				os.Exit(runClient(args[0], args[1:]))
+			}
+			fmt.Fprintf(os.Stderr, "Unknown command %q\n", args[0])
+			usage()
+			os.Exit(2)
+		}
 	}
+	serve(args)
+}
 
-	dbPath := os.Getenv("DB_PATH")
-	if dbPath == "" {
-		dbPath = "justdoc.db"
+// shareLinks signs share links with the configured secret, or with a random
+// one that lasts until the server stops
+func shareLinks(cfg *config.Config) *api.ShareLinks {
+	secret := []byte(cfg.Auth.ShareSecret)
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			log.Fatalf("Failed to generate share secret: %v", err)
+		}
+		if len(cfg.Auth.APIKeys) > 0 || len(cfg.Auth.ClientPrincipals) > 0 {
+			log.Printf("No share secret configured; share links stop working on restart")
+		}
 	}
+	return api.NewShareLinks(secret, time.Duration(cfg.Auth.ShareMaxAge))
+}
+
+// serve runs the server until SIGINT or SIGTERM
+func serve(args []string) {
+	cfg := loadConfig(args, 0)
 
 	// Initialize storage
-	store, err := storage.NewBoltStorage(dbPath)
+	store, err := openStorage(cfg, 0)
 	if err != nil {
-		log.Fatalf("Failed to open database: %v", err)
+		log.Fatalf("Failed to open storage: %v", err)
 	}
 	defer func() {
 		_ = store.Close()
 	}()
 
+	// Scheduled snapshots
+	if cfg.Backup.Dir != "" {
+		b, ok := store.(storage.Backuper)
+		if !ok {
+			log.Fatalf("Storage backend does not support backups")
+		}
+		go scheduleBackups(b, cfg.Backup.Dir, time.Duration(cfg.Backup.Interval), cfg.Backup.Keep)
+	}
+
 	// Initialize API
-	handler := api.NewHandler(store)
-	router := api.NewRouter(handler)
+	shares := shareLinks(cfg)
+	handler := api.NewHandler(store,
+		api.WithMaxBodySize(int64(cfg.MaxBodySize)),
+		api.WithMaxAttachmentSize(int64(cfg.MaxAttachmentSize)),
+		api.WithShareLinks(shares),
+		api.WithNormalizedChannels(cfg.NormalizeChannels...),
+	)
+	var h http.Handler = api.NewRouter(handler)
+	h = api.Authenticate(h, api.AuthOptions{
+		APIKeys:          cfg.Auth.APIKeys,
+		ClientPrincipals: cfg.Auth.ClientPrincipals,
+		ShareLinks:       shares,
+	})
+	h = api.CORS(h, api.CORSOptions{
+		Origins: cfg.CORS.Origins,
+		Methods: cfg.CORS.Methods,
+		Headers: cfg.CORS.Headers,
+		MaxAge:  time.Duration(cfg.CORS.MaxAge),
+	})
+
+	srv := &http.Server{
+		Addr:              cfg.Listen,
+		Handler:           h,
+		ReadHeaderTimeout: time.Duration(cfg.Timeouts.ReadHeader),
+		ReadTimeout:       time.Duration(cfg.Timeouts.Read),
+		WriteTimeout:      time.Duration(cfg.Timeouts.Write),
+		IdleTimeout:       time.Duration(cfg.Timeouts.Idle),
+	}
+	var protocols http.Protocols
+	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(cfg.HTTP2)
+	protocols.SetUnencryptedHTTP2(cfg.H2C)
+	srv.Protocols = &protocols
+	if cfg.TLS.Enabled() {
+		srv.TLSConfig, err = tlsConfig(cfg)
+		if err != nil {
+			log.Fatalf("Failed to configure TLS: %v", err)
+		}
+	}
 
 	// Graceful shutdown
+	done := make(chan struct{})
 	go func() {
-		sigCh := make(chan os.Signal, 1)
-		signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
-		<-sigCh
+		defer close(done)
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		<-ctx.Done()
+		stop()
 		fmt.Println("\nShutting down...")
-		_ = store.Close()
-		os.Exit(0)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Timeouts.Shutdown))
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Printf("Shutdown: %v", err)
+		}
 	}()
 
 	// Start server
-	fmt.Printf("JustDoc starting on port %s...\n", port)
-	log.Fatal(http.ListenAndServe(":"+port, router))
+	if srv.TLSConfig != nil {
+		fmt.Printf("JustDoc listening on %s (TLS)...\n", cfg.Listen)
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		fmt.Printf("JustDoc listening on %s...\n", cfg.Listen)
+		err = srv.ListenAndServe()
+	}
+	if err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	<-done
+	saveMemorySnapshot(store, cfg.Storage.MemorySnapshot)
+}
+
+// tlsConfig loads the server certificate, generating a self-signed one
+// first in development mode, and the client CAs for mutual TLS
+func tlsConfig(cfg *config.Config) (*tls.Config, error) {
+	certFile, keyFile := cfg.TLS.Files()
+	if cfg.TLS.SelfSigned {
+		var hosts []string
+		if host, _, err := net.SplitHostPort(cfg.Listen); err == nil && host != "" {
+			hosts = append(hosts, host)
+		}
+		created, err := certs.EnsureSelfSigned(certFile, keyFile, hosts)
+		if err != nil {
+			return nil, err
+		}
+		if created {
+			fmt.Printf("Generated self-signed certificate %s\n", certFile)
+		}
+	}
+
+	reloader, err := certs.NewReloader(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	tc := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+	if cfg.TLS.ClientCAFile != "" {
+		tc.ClientCAs, err = certs.LoadCertPool(cfg.TLS.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		tc.ClientAuth = tls.RequireAndVerifyClientCert
+		if cfg.TLS.ClientAuth == "optional" {
+			tc.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
+	return tc, nil
+}
+
+// loadConfig loads and validates the configuration, exiting on errors.
+// It returns the configuration and checks that at most maxArgs positional
+// arguments remain.
+func loadConfig(args []string, maxArgs int) *config.Config {
+	cfg, rest := loadConfigArgs(args)
+	if len(rest) > maxArgs {
+		fmt.Fprintf(os.Stderr, "Unexpected argument %q\n", rest[maxArgs])
+		os.Exit(2)
+	}
+	return cfg
+}
+
+// loadConfigArgs is loadConfig returning the positional arguments
+func loadConfigArgs(args []string) (*config.Config, []string) {
+	cfg, rest, err := config.Load(args, os.Getenv, os.Stderr)
+	if err == flag.ErrHelp {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration: %v\n", err)
+		os.Exit(2)
+	}
+	if err := cfg.Validate(); err != nil {
+		printConfigErrors(err)
+		os.Exit(1)
+	}
+	return cfg, rest
+}
+
+func printConfigErrors(err error) {
+	fmt.Fprintln(os.Stderr, "Invalid configuration:")
+	for _, line := range strings.Split(err.Error(), "\n") {
+		fmt.Fprintf(os.Stderr, "  %s\n", line)
+	}
+}
+
+// configCommand runs "justdoc config print", which writes the effective
+// configuration with secrets redacted and exits with status 1 if it is
+// invalid
+func configCommand(args []string) int {
+	if len(args) == 0 || args[0] != "print" {
+		fmt.Fprintln(os.Stderr, "Usage: justdoc config print [flags]")
+		return 2
+	}
+	cfg, rest, err := config.Load(args[1:], os.Getenv, os.Stderr)
+	if err == flag.ErrHelp {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration: %v\n", err)
+		return 2
+	}
+	if len(rest) > 0 {
+		fmt.Fprintf(os.Stderr, "Unexpected argument %q\n", rest[0])
+		return 2
+	}
+	if err := cfg.Print(os.Stdout); err != nil {
+		log.Printf("Failed to print configuration: %v", err)
+		return 1
+	}
+	if err := cfg.Validate(); err != nil {
+		printConfigErrors(err)
+		return 1
+	}
+	return 0
+}
+
+// openStorage opens the configured backend: "bolt" stores data in a
+// single file, "sqlite" in an SQLite database, "file" as JSON files under
+// a directory, "memory" keeps it in memory only. A non-zero timeout makes
+// opening a bolt file locked by another process fail with bbolt.ErrTimeout.
+func openStorage(cfg *config.Config, timeout time.Duration) (storage.Storage, error) {
+	s := cfg.Storage
+	switch s.Backend {
+	case "bolt":
+		opts, err := boltOptions(s)
+		if err != nil {
+			return nil, err
+		}
+		if timeout > 0 {
+			opts = append(opts, storage.WithTimeout(timeout))
+		}
+		return storage.NewBoltStorage(s.Path, opts...)
+	case "sqlite":
+		return storage.NewSQLiteStorage(s.SQLitePath)
+	case "file":
+		return storage.NewFileStorage(s.DataDir)
+	case "memory":
+		fmt.Println("Using in-memory storage, data is lost on shutdown")
+		return storage.NewMemoryStorage(), nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q (want bolt, sqlite, file or memory)", s.Backend)
+	}
+}
+
+// saveMemorySnapshot writes in-memory data to path, if set, as a database
+// file that can be opened later with the bolt backend
+func saveMemorySnapshot(store storage.Storage, path string) {
+	mem, ok := store.(*storage.MemoryStorage)
+	if path == "" || !ok {
+		return
+	}
+	if err := backup.WriteFile(mem, path); err != nil {
+		log.Printf("Failed to write memory snapshot: %v", err)
+		return
+	}
+	fmt.Printf("Memory snapshot written to %s\n", path)
+}
+
+// boltOptions returns the compression and encryption options
+func boltOptions(s config.Storage) ([]storage.BoltOption, error) {
+	opts := []storage.BoltOption{storage.WithCompression(s.CompressMinSize)}
+
+	keys, err := encryptionKeys(s)
+	if err != nil {
+		return nil, err
+	}
+	if keys != nil {
+		opts = append(opts, storage.WithEncryption(keys))
+	}
+	return opts, nil
+}
+
+// encryptionKeys reads the keyring given inline or in a key file; it
+// returns nil if neither is set
+func encryptionKeys(s config.Storage) (*storage.Keyring, error) {
+	spec := s.EncryptionKeys
+	if s.EncryptionKeyFile != "" {
+		data, err := os.ReadFile(s.EncryptionKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		spec = string(data)
+	}
+	if spec == "" {
+		return nil, nil
+	}
+	return storage.ParseKeyring(spec)
+}
+
+// scheduleBackups writes a snapshot to dir every interval, keeping the newest ones
+func scheduleBackups(b storage.Backuper, dir string, interval time.Duration, keep int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		path, err := backup.Snapshot(b, dir, keep)
+		if err != nil {
+			log.Printf("Backup failed: %v", err)
+			continue
+		}
+		log.Printf("Backup written to %s", path)
+	}
+}
+
+// restore replaces the bolt database with a snapshot
+func restore(args []string) {
+	cfg, args := loadConfigArgs(args)
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: justdoc restore [flags] <snapshot>")
+		os.Exit(2)
+	}
+	if err := requireBolt(cfg, "restore"); err != nil {
+		log.Fatal(err)
+	}
+	dst := cfg.Storage.Path
+	if err := backup.Restore(args[0], dst); err != nil {
+		log.Fatalf("Restore failed: %v", err)
+	}
+	fmt.Printf("Restored %s from %s\n", dst, args[0])
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: justdoc [command] [flags]")
+	fmt.Fprintln(os.Stderr, "\nWithout a command, runs the server. Server flags:")
+	config.Usage(os.Stderr)
+	fmt.Fprintln(os.Stderr, "\nMaintenance commands (server stopped), taking the same flags:")
+	fmt.Fprintln(os.Stderr, "  justdoc restore <snapshot>\n  justdoc reencrypt\n  justdoc compact\n  justdoc check\n  justdoc config print")
+	fmt.Fprintln(os.Stderr, "\nClient commands:")
+	cli.Usage(os.Stderr)
+}
+
+// runClient runs a client subcommand until it finishes or is interrupted
+func runClient(name string, args []string) int {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	return cli.Run(ctx, name, args, cli.Env{
+		Stdin:  os.Stdin,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+		OpenStorage: func() (storage.Storage, error) {
+			cfg, _, err := config.Load(nil, os.Getenv, os.Stderr)
+			if err == nil {
+				err = cfg.Validate()
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid configuration: %w", err)
+			}
+			return openStorageOffline(cfg, "")
+		},
+	})
+}
+
+// openStorageOffline opens the configured backend while the server is
+// stopped; endpoint names the online alternative in the in-use error
+func openStorageOffline(cfg *config.Config, endpoint string) (storage.Storage, error) {
+	if cfg.Storage.Backend == "memory" {
+		return nil, fmt.Errorf("the memory storage backend has no data to open offline")
+	}
+	store, err := openStorage(cfg, time.Second)
+	if err == bbolt.ErrTimeout {
+		path := cfg.Storage.Path
+		if endpoint != "" {
+			return nil, fmt.Errorf("%s is in use, stop the server or use %s", path, endpoint)
+		}
+		return nil, fmt.Errorf("%s is in use, stop the server first", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid storage configuration: %w", err)
+	}
+	return store, nil
+}
+
+// requireBolt rejects maintenance commands that only work on bolt files
+func requireBolt(cfg *config.Config, command string) error {
+	if cfg.Storage.Backend != "bolt" {
+		return fmt.Errorf("justdoc %s requires the bolt storage backend, not %q", command, cfg.Storage.Backend)
+	}
+	return nil
+}
+
+// openBoltOffline is openStorageOffline for maintenance commands that need
+// the bolt backend
+func openBoltOffline(cfg *config.Config, command, endpoint string) (*storage.BoltStorage, error) {
+	if err := requireBolt(cfg, command); err != nil {
+		return nil, err
+	}
+	store, err := openStorageOffline(cfg, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	return store.(*storage.BoltStorage), nil
+}
+
+// openOffline is openBoltOffline, exiting on failure
+func openOffline(cfg *config.Config, command, endpoint string) *storage.BoltStorage {
+	store, err := openBoltOffline(cfg, command, endpoint)
+	if err != nil {
+		log.Fatalf("Failed to open storage: %v", err)
+	}
+	return store
+}
+
+// reencrypt rewrites the bolt database documents with the current key while
+// the server is stopped; use POST /_/reencrypt while it is running
+func reencrypt(args []string) {
+	cfg := loadConfig(args, 0)
+	store := openOffline(cfg, "reencrypt", "POST /_/reencrypt")
+	defer func() { _ = store.Close() }()
+
+	n, err := store.Reencrypt()
+	if err != nil {
+		log.Fatalf("Re-encryption failed after %d documents: %v", n, err)
+	}
+	fmt.Printf("Re-encrypted %d documents\n", n)
+}
+
+// compact shrinks the bolt database while the server is stopped;
+// use POST /_/compact while it is running
+func compact(args []string) {
+	cfg := loadConfig(args, 0)
+	store := openOffline(cfg, "compact", "POST /_/compact")
+	defer func() { _ = store.Close() }()
+
+	before, after, err := store.Compact()
+	if err != nil {
+		log.Fatalf("Compaction failed: %v", err)
+	}
+	fmt.Printf("Compacted %s from %d to %d bytes\n", cfg.Storage.Path, before, after)
+}
+
+// check verifies the integrity of the bolt database and exits with
+// status 1 if problems are found
+func check(args []string) {
+	cfg := loadConfig(args, 0)
+	store := openOffline(cfg, "check", "")
+	report, err := store.Check()
+	_ = store.Close()
+	if err != nil {
+		log.Fatalf("Check failed: %v", err)
+	}
+
+	for _, problem := range report.Errors {
+		fmt.Println(problem)
+	}
+	fmt.Printf("Checked %d channels, %d documents: %d problems\n", report.Channels, report.Documents, len(report.Errors))
+	if len(report.Errors) > 0 {
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rashpile/pako-justdoc/internal/config"
+	"github.com/rashpile/pako-justdoc/internal/storage"
+)
+
+func TestOpenStorageOffline_UsesConfiguredBackend(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.Default()
+	cfg.Storage.Backend = "file"
+	cfg.Storage.DataDir = filepath.Join(dir, "data")
+	cfg.Storage.Path = filepath.Join(dir, "justdoc.db")
+
+	store, err := openStorageOffline(cfg, "")
+	if err != nil {
+		t.Fatalf("openStorageOffline failed: %v", err)
+	}
+	if _, ok := store.(*storage.FileStorage); !ok {
+		t.Fatalf("Expected file storage, got %T", store)
+	}
+	if _, err := store.PutDocument("c", "d", []byte(`{"a":1}`)); err != nil {
+		t.Fatalf("PutDocument failed: %v", err)
+	}
+	_ = store.Close()
+
+	if _, err := os.Stat(filepath.Join(cfg.Storage.DataDir, "c", "d.json")); err != nil {
+		t.Errorf("Expected document in the data dir: %v", err)
+	}
+	if _, err := os.Stat(cfg.Storage.Path); !os.IsNotExist(err) {
+		t.Errorf("Expected no bolt file to be created, got %v", err)
+	}
+}
+
+func TestOpenStorageOffline_RejectsMemory(t *testing.T) {
+	cfg := config.Default()
+	cfg.Storage.Backend = "memory"
+	if _, err := openStorageOffline(cfg, ""); err == nil {
+		t.Error("Expected the memory backend to be rejected")
+	}
+}
+
+func TestOpenBoltOffline_RejectsOtherBackends(t *testing.T) {
+	for _, backend := range []string{"file", "sqlite", "memory"} {
+		cfg := config.Default()
+		cfg.Storage.Backend = backend
+		cfg.Storage.DataDir = t.TempDir()
+		cfg.Storage.SQLitePath = filepath.Join(t.TempDir(), "justdoc.sqlite")
+		_, err := openBoltOffline(cfg, "compact", "")
+		if err == nil || !strings.Contains(err.Error(), "requires the bolt storage backend") {
+			t.Errorf("%s: expected bolt-only error, got %v", backend, err)
+		}
+	}
+}
+
+func TestOpenBoltOffline_InUse(t *testing.T) {
+	cfg := config.Default()
+	cfg.Storage.Path = filepath.Join(t.TempDir(), "justdoc.db")
+	held, err := storage.NewBoltStorage(cfg.Storage.Path)
+	if err != nil {
+		t.Fatalf("NewBoltStorage failed: %v", err)
+	}
+	defer func() { _ = held.Close() }()
+
+	_, err = openBoltOffline(cfg, "compact", "POST /_/compact")
+	if err == nil || !strings.Contains(err.Error(), "stop the server or use POST /_/compact") {
+		t.Errorf("Expected in-use error, got %v", err)
+	}
+}
@@ -0,0 +1,156 @@
+package api
+
+import (
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/rashpile/pako-justdoc/internal/model"
+	"github.com/rashpile/pako-justdoc/internal/storage"
+)
+
+// MaxAttachmentSize is the default maximum attachment size (1MB)
+const MaxAttachmentSize = 1024 * 1024
+
+// defaultAttachmentType is stored for attachments sent without a Content-Type
+const defaultAttachmentType = "application/octet-stream"
+
+// PutAttachment handles PUT /{channel}/{document}/_attachments/{name}
+// The body is stored as is with its Content-Type; the document must exist.
+func (h *Handler) PutAttachment(w http.ResponseWriter, r *http.Request) {
+	channel, document, name, ok := attachmentNames(w, r)
+	if !ok {
+		return
+	}
+
+	contentType := defaultAttachmentType
+	if v := r.Header.Get("Content-Type"); v != "" {
+		mediaType, params, err := mime.ParseMediaType(v)
+		if err != nil {
+			writeError(w, http.StatusUnsupportedMediaType, model.ErrCodeUnsupportedMediaType, "Invalid content type "+v)
+			return
+		}
+		contentType = mime.FormatMediaType(mediaType, params)
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxAttachmentSize)
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		if err.Error() == "http: request body too large" {
+			writeError(w, http.StatusRequestEntityTooLarge, model.ErrCodePayloadTooLarge, "Attachment exceeds "+formatSize(h.maxAttachmentSize)+" limit")
+			return
+		}
+		writeError(w, http.StatusBadRequest, model.ErrCodeInvalidOperation, "Failed to read request body")
+		return
+	}
+
+	created, err := h.storage.PutAttachment(channel, document, name, contentType, data)
+	if err == storage.ErrNotFound {
+		writeError(w, http.StatusNotFound, model.ErrCodeNotFound, "Document not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to store attachment")
+		return
+	}
+
+	status := "updated"
+	statusCode := http.StatusOK
+	if created {
+		status = "created"
+		statusCode = http.StatusCreated
+	}
+	w.Header().Set("ETag", etag(data))
+	writeJSON(w, statusCode, model.AttachmentResponse{
+		Status:     status,
+		Channel:    channel,
+		Document:   document,
+		Attachment: model.AttachmentMeta(storage.NewAttachment(name, contentType, data).AttachmentMeta),
+	})
+}
+
+// GetAttachment handles GET /{channel}/{document}/_attachments/{name}
+// Attachments are served with the type they were stored with, but
+// sandboxed so an HTML attachment can't run scripts on the API's origin.
+func (h *Handler) GetAttachment(w http.ResponseWriter, r *http.Request) {
+	channel, document, name, ok := attachmentNames(w, r)
+	if !ok {
+		return
+	}
+
+	a, err := h.storage.GetAttachment(channel, document, name)
+	if err == storage.ErrNotFound {
+		writeError(w, http.StatusNotFound, model.ErrCodeNotFound, "Attachment not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+		return
+	}
+
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	writeDocument(w, r, a.Data, etag(a.Data), a.ContentType)
+}
+
+// DeleteAttachment handles DELETE /{channel}/{document}/_attachments/{name}
+func (h *Handler) DeleteAttachment(w http.ResponseWriter, r *http.Request) {
+	channel, document, name, ok := attachmentNames(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.storage.DeleteAttachment(channel, document, name)
+	if err == storage.ErrNotFound {
+		writeError(w, http.StatusNotFound, model.ErrCodeNotFound, "Attachment not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to delete attachment")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListAttachments handles GET /{channel}/{document}/_attachments
+// It lists the attachments of a document without their content.
+func (h *Handler) ListAttachments(w http.ResponseWriter, r *http.Request) {
+	channel := r.PathValue("channel")
+	document := r.PathValue("document")
+
+	if !model.IsValidName(channel) || !model.IsValidName(document) {
+		writeError(w, http.StatusBadRequest, model.ErrCodeInvalidName, "Invalid channel or document name")
+		return
+	}
+
+	metas, err := h.storage.ListAttachments(channel, document)
+	if err == storage.ErrNotFound {
+		writeError(w, http.StatusNotFound, model.ErrCodeNotFound, "Document not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+		return
+	}
+
+	resp := model.AttachmentsResponse{Channel: channel, Document: document, Attachments: make([]model.AttachmentMeta, len(metas))}
+	for i, a := range metas {
+		resp.Attachments[i] = model.AttachmentMeta(a)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// attachmentNames returns the names in an attachment path. If a name is
+// invalid, it writes the error response and returns false.
+func attachmentNames(w http.ResponseWriter, r *http.Request) (channel, document, name string, ok bool) {
+	channel, document, name = r.PathValue("channel"), r.PathValue("document"), r.PathValue("name")
+	if !model.IsValidName(channel) || !model.IsValidName(document) {
+		writeError(w, http.StatusBadRequest, model.ErrCodeInvalidName, "Invalid channel or document name")
+		return "", "", "", false
+	}
+	if !model.IsValidAttachmentName(name) {
+		writeError(w, http.StatusBadRequest, model.ErrCodeInvalidName, "Invalid attachment name")
+		return "", "", "", false
+	}
+	return channel, document, name, true
+}
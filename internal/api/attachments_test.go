@@ -0,0 +1,180 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rashpile/pako-justdoc/internal/model"
+	"github.com/rashpile/pako-justdoc/internal/storage"
+)
+
+func TestAttachments(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+	router := NewRouter(handler)
+
+	do := func(method, url, contentType string, body []byte, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, bytes.NewReader(body))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00")
+
+	// The document must exist
+	if w := do(http.MethodPut, "/app/settings/_attachments/logo.png", "image/png", png); w.Code != http.StatusNotFound {
+		t.Fatalf("Expected status %d without a document, got %d: %s", http.StatusNotFound, w.Code, w.Body.String())
+	}
+	postDocument(t, handler, "app", "settings", `{"logo": "_attachments/logo.png"}`)
+
+	w := do(http.MethodPut, "/app/settings/_attachments/logo.png", "image/png", png)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var resp model.AttachmentResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if resp.Status != "created" || resp.Attachment.Name != "logo.png" || resp.Attachment.ContentType != "image/png" ||
+		resp.Attachment.Size != len(png) || !strings.HasPrefix(resp.Attachment.Digest, "sha256:") {
+		t.Errorf("Unexpected response %+v", resp)
+	}
+	if w := do(http.MethodPut, "/app/settings/_attachments/logo.png", "image/png", png); w.Code != http.StatusOK {
+		t.Errorf("Expected status %d when replacing, got %d", http.StatusOK, w.Code)
+	}
+
+	w = do(http.MethodGet, "/app/settings/_attachments/logo.png", "", nil)
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), png) {
+		t.Fatalf("Expected the attachment, got %d: %q", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "image/png" {
+		t.Errorf("Expected Content-Type image/png, got %q", ct)
+	}
+	if w.Header().Get("X-Content-Type-Options") != "nosniff" || w.Header().Get("Content-Security-Policy") != "sandbox" {
+		t.Errorf("Expected attachment to be sandboxed, got headers %v", w.Header())
+	}
+	tag := w.Header().Get("ETag")
+	if w := do(http.MethodGet, "/app/settings/_attachments/logo.png", "", nil, "If-None-Match", tag); w.Code != http.StatusNotModified {
+		t.Errorf("Expected status %d with a matching ETag, got %d", http.StatusNotModified, w.Code)
+	}
+
+	w = do(http.MethodGet, "/app/settings/_attachments", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d listing attachments, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var list model.AttachmentsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if list.Channel != "app" || list.Document != "settings" || len(list.Attachments) != 1 || list.Attachments[0] != resp.Attachment {
+		t.Errorf("Unexpected attachment list %+v", list)
+	}
+
+	// Attachments are listed in the export metadata
+	w = do(http.MethodGet, "/app/_export", "", nil)
+	if !strings.Contains(w.Body.String(), `"attachments":[{"name":"logo.png","content_type":"image/png"`) {
+		t.Errorf("Expected attachment in export metadata, got %s", w.Body.String())
+	}
+
+	if w := do(http.MethodDelete, "/app/settings/_attachments/logo.png", "", nil); w.Code != http.StatusNoContent {
+		t.Errorf("Expected status %d, got %d: %s", http.StatusNoContent, w.Code, w.Body.String())
+	}
+	if w := do(http.MethodGet, "/app/settings/_attachments/logo.png", "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d after delete, got %d", http.StatusNotFound, w.Code)
+	}
+	if w := do(http.MethodDelete, "/app/settings/_attachments/logo.png", "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d deleting twice, got %d", http.StatusNotFound, w.Code)
+	}
+	if w := do(http.MethodGet, "/app/settings/_attachments", "", nil); w.Body.String() != `{"channel":"app","document":"settings","attachments":[]}`+"\n" {
+		t.Errorf("Expected an empty attachment list, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestAttachments_RemovedWithDocument(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+	router := NewRouter(handler)
+
+	postDocument(t, handler, "app", "settings", `{}`)
+	if _, err := handler.storage.PutAttachment("app", "settings", "notes.txt", "text/plain", []byte("hi")); err != nil {
+		t.Fatalf("PutAttachment failed: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodDelete, "/app/settings", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	postDocument(t, handler, "app", "settings", `{}`)
+	if _, err := handler.storage.GetAttachment("app", "settings", "notes.txt"); err != storage.ErrNotFound {
+		t.Errorf("Expected attachment to be removed with the document, got %v", err)
+	}
+}
+
+func TestAttachments_Errors(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+	handler.maxAttachmentSize = 8
+	router := NewRouter(handler)
+	postDocument(t, handler, "app", "settings", `{}`)
+
+	tests := []struct {
+		name        string
+		method      string
+		url         string
+		contentType string
+		body        string
+		wantStatus  int
+		wantCode    string
+	}{
+		{"too large", http.MethodPut, "/app/settings/_attachments/big.bin", "", "123456789", http.StatusRequestEntityTooLarge, model.ErrCodePayloadTooLarge},
+		{"malformed content type", http.MethodPut, "/app/settings/_attachments/a.txt", "text/plain;;", "x", http.StatusUnsupportedMediaType, model.ErrCodeUnsupportedMediaType},
+		{"hidden name", http.MethodPut, "/app/settings/_attachments/.hidden", "", "x", http.StatusBadRequest, model.ErrCodeInvalidName},
+		{"invalid document", http.MethodGet, "/app/my.doc/_attachments/a.txt", "", "", http.StatusBadRequest, model.ErrCodeInvalidName},
+		{"unknown action", http.MethodGet, "/app/settings/_files/a.txt", "", "", http.StatusNotFound, model.ErrCodeNotFound},
+		{"missing attachment", http.MethodGet, "/app/settings/_attachments/a.txt", "", "", http.StatusNotFound, model.ErrCodeNotFound},
+		{"list invalid document", http.MethodGet, "/app/my.doc/_attachments", "", "", http.StatusBadRequest, model.ErrCodeInvalidName},
+		{"list missing document", http.MethodGet, "/app/missing/_attachments", "", "", http.StatusNotFound, model.ErrCodeNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), `"`+tt.wantCode+`"`) {
+				t.Errorf("Expected error %s, got %s", tt.wantCode, w.Body.String())
+			}
+		})
+	}
+
+	// Without a Content-Type attachments are stored as octet streams
+	req := httptest.NewRequest(http.MethodPut, "/app/settings/_attachments/data", strings.NewReader("x"))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	a, err := handler.storage.GetAttachment("app", "settings", "data")
+	if err != nil || a.ContentType != "application/octet-stream" {
+		t.Errorf("Expected an octet stream, got %q (%v): %s", a.ContentType, err, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), `"status":"created"`) {
+		t.Errorf("Expected created response, got %s", w.Body.String())
+	}
+}
@@ -0,0 +1,26 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/rashpile/pako-justdoc/internal/model"
+	"github.com/rashpile/pako-justdoc/internal/storage"
+)
+
+// Backup handles GET /_/backup
+// Streams a consistent snapshot of the whole database without blocking writers
+func (h *Handler) Backup(w http.ResponseWriter, r *http.Request) {
+	b, ok := h.storage.(storage.Backuper)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, model.ErrCodeNotImplemented, "Storage backend does not support backups")
+		return
+	}
+
+	name := "justdoc-" + time.Now().UTC().Format("20060102T150405Z") + ".db"
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	w.WriteHeader(http.StatusOK)
+	// Status is already sent; a failed backup shows up as a truncated file
+	_, _ = b.Backup(w)
+}
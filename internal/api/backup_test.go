@@ -0,0 +1,45 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rashpile/pako-justdoc/internal/storage"
+)
+
+func TestBackup(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	postDocument(t, handler, "app", "settings", `{"theme": "dark"}`)
+
+	req := httptest.NewRequest(http.MethodGet, "/_/backup", nil)
+	w := httptest.NewRecorder()
+	handler.Backup(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if cd := w.Header().Get("Content-Disposition"); !strings.Contains(cd, ".db") {
+		t.Errorf("Expected attachment filename, got %q", cd)
+	}
+
+	path := filepath.Join(t.TempDir(), "backup.db")
+	if err := os.WriteFile(path, w.Body.Bytes(), 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	store, err := storage.NewBoltStorage(path)
+	if err != nil {
+		t.Fatalf("Failed to open backup: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	data, err := store.GetDocument("app", "settings")
+	if err != nil || string(data) != `{"theme": "dark"}` {
+		t.Errorf("Expected document in backup, got %q (%v)", data, err)
+	}
+}
@@ -0,0 +1,218 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/rashpile/pako-justdoc/internal/format"
+	"github.com/rashpile/pako-justdoc/internal/model"
+	"github.com/rashpile/pako-justdoc/internal/storage"
+)
+
+// batchError aborts a batch and describes the operation that caused it
+type batchError struct {
+	index      int
+	statusCode int
+	code       string
+	message    string
+	violations []model.SchemaViolation
+}
+
+func (e *batchError) Error() string {
+	return e.message
+}
+
+// Batch handles POST /_/batch
+func (h *Handler) Batch(w http.ResponseWriter, r *http.Request) {
+	data, ok := h.readJSONBody(w, r)
+	if !ok {
+		return
+	}
+
+	var ops []model.BatchOperation
+	if err := json.Unmarshal(data, &ops); err != nil {
+		writeError(w, http.StatusBadRequest, model.ErrCodeInvalidJSON, "Batch body must be an array of operations")
+		return
+	}
+	if len(ops) == 0 {
+		writeError(w, http.StatusBadRequest, model.ErrCodeInvalidOperation, "Batch contains no operations")
+		return
+	}
+
+	results := make([]model.BatchResult, len(ops))
+	for i, op := range ops {
+		results[i] = model.BatchResult{
+			Op:       op.Op,
+			Channel:  op.Channel,
+			Document: op.Document,
+			Status:   model.BatchStatusAborted,
+		}
+	}
+
+	// Check operations and load schemas and settings before opening the
+	// write transaction
+	schemas := make(map[string]*model.Schema)
+	normalize := make(map[string]bool)
+	for i, op := range ops {
+		if berr := checkBatchOperation(op); berr != nil {
+			berr.index = i
+			writeBatchError(w, results, berr)
+			return
+		}
+		if _, ok := schemas[op.Channel]; ok {
+			continue
+		}
+		schema, err := h.channelSchema(op.Channel)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "internal_error", "Failed to load channel schema")
+			return
+		}
+		schemas[op.Channel] = schema
+		if normalize[op.Channel], err = h.normalizes(op.Channel); err != nil {
+			writeError(w, http.StatusInternalServerError, "internal_error", "Failed to load channel settings")
+			return
+		}
+	}
+
+	applied := make([]model.BatchResult, len(ops))
+	err := h.storage.Batch(func(tx storage.Tx) error {
+		for i, op := range ops {
+			result, berr := applyBatchOperation(tx, op, schemas[op.Channel], normalize[op.Channel])
+			if berr != nil {
+				berr.index = i
+				return berr
+			}
+			applied[i] = result
+		}
+		return nil
+	})
+
+	var berr *batchError
+	if errors.As(err, &berr) {
+		writeBatchError(w, results, berr)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to commit batch")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, model.BatchResponse{
+		Status:  "committed",
+		Results: applied,
+	})
+}
+
+// checkBatchOperation validates an operation without touching storage
+func checkBatchOperation(op model.BatchOperation) *batchError {
+	if !model.IsValidName(op.Channel) || !model.IsValidName(op.Document) {
+		return &batchError{statusCode: http.StatusBadRequest, code: model.ErrCodeInvalidName, message: "Invalid channel or document name"}
+	}
+	switch op.Op {
+	case model.BatchOpPut, model.BatchOpPatch:
+		if len(op.Value) == 0 {
+			return &batchError{statusCode: http.StatusBadRequest, code: model.ErrCodeInvalidOperation, message: "Operation requires a value"}
+		}
+	case model.BatchOpDelete:
+		if len(op.Value) != 0 {
+			return &batchError{statusCode: http.StatusBadRequest, code: model.ErrCodeInvalidOperation, message: "Delete operation takes no value"}
+		}
+	default:
+		return &batchError{statusCode: http.StatusBadRequest, code: model.ErrCodeInvalidOperation, message: "Unknown operation " + op.Op}
+	}
+	return nil
+}
+
+// applyBatchOperation performs a single operation inside the batch
+// transaction. With normalize set, documents are stored as canonical JSON.
+func applyBatchOperation(tx storage.Tx, op model.BatchOperation, schema *model.Schema, normalize bool) (model.BatchResult, *batchError) {
+	result := model.BatchResult{Op: op.Op, Channel: op.Channel, Document: op.Document}
+
+	current, err := tx.GetDocument(op.Channel, op.Document)
+	if err != nil && err != storage.ErrNotFound {
+		return result, &batchError{statusCode: http.StatusInternalServerError, code: "internal_error", message: "Failed to read document"}
+	}
+	exists := err == nil
+	if !exists && op.Op == model.BatchOpPut && (model.IsReservedName(op.Channel) || model.IsReservedName(op.Document)) {
+		return result, &batchError{statusCode: http.StatusBadRequest, code: model.ErrCodeInvalidName, message: reservedNameMessage}
+	}
+
+	if op.IfMatch != "" {
+		currentTag := ""
+		if exists {
+			currentTag = etag(current)
+		}
+		if !etagMatches(op.IfMatch, currentTag) {
+			return result, &batchError{statusCode: http.StatusPreconditionFailed, code: model.ErrCodePreconditionFailed, message: "Document does not match If-Match"}
+		}
+	}
+
+	if op.Op == model.BatchOpDelete {
+		if !exists {
+			return result, &batchError{statusCode: http.StatusNotFound, code: model.ErrCodeNotFound, message: "Document not found"}
+		}
+		if err := tx.DeleteDocument(op.Channel, op.Document); err != nil {
+			return result, &batchError{statusCode: http.StatusInternalServerError, code: "internal_error", message: "Failed to delete document"}
+		}
+		result.Status = model.BatchStatusDeleted
+		return result, nil
+	}
+
+	data := []byte(op.Value)
+	if op.Op == model.BatchOpPatch {
+		if !exists {
+			return result, &batchError{statusCode: http.StatusNotFound, code: model.ErrCodeNotFound, message: "Document not found"}
+		}
+		data, err = mergePatch(current, op.Value)
+		if err != nil {
+			return result, &batchError{statusCode: http.StatusBadRequest, code: model.ErrCodeInvalidJSON, message: "Failed to apply merge patch"}
+		}
+	}
+	if normalize {
+		if data, err = format.Canonicalize(data); err != nil {
+			return result, &batchError{statusCode: http.StatusBadRequest, code: model.ErrCodeInvalidJSON, message: "Document can't be normalized: " + err.Error()}
+		}
+	}
+
+	if schema != nil {
+		violations, err := schema.Validate(data)
+		if err != nil {
+			return result, &batchError{statusCode: http.StatusInternalServerError, code: "internal_error", message: "Failed to validate document"}
+		}
+		if violations != nil {
+			return result, &batchError{
+				statusCode: http.StatusBadRequest,
+				code:       model.ErrCodeSchemaViolation,
+				message:    "Document does not match the channel schema",
+				violations: violations,
+			}
+		}
+	}
+
+	created, err := tx.PutDocument(op.Channel, op.Document, data)
+	if err != nil {
+		return result, &batchError{statusCode: http.StatusInternalServerError, code: "internal_error", message: "Failed to store document"}
+	}
+	result.Status = model.BatchStatusUpdated
+	if created {
+		result.Status = model.BatchStatusCreated
+	}
+	result.ETag = etag(data)
+	return result, nil
+}
+
+func writeBatchError(w http.ResponseWriter, results []model.BatchResult, berr *batchError) {
+	failed := &results[berr.index]
+	failed.Status = model.BatchStatusFailed
+	failed.Error = berr.code
+	failed.Message = berr.message
+	failed.Violations = berr.violations
+
+	writeJSON(w, berr.statusCode, model.BatchResponse{
+		Status:  "aborted",
+		Error:   berr.code,
+		Message: berr.message,
+		Results: results,
+	})
+}
@@ -0,0 +1,193 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rashpile/pako-justdoc/internal/model"
+)
+
+func postBatch(t *testing.T, handler *Handler, body string) (*httptest.ResponseRecorder, model.BatchResponse) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/_/batch", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	handler.Batch(w, req)
+
+	var resp model.BatchResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	return w, resp
+}
+
+func TestBatch_Commit(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	postDocument(t, handler, "app", "manifest", `{"items": ["a"], "title": "x"}`)
+	postDocument(t, handler, "items", "old", `{}`)
+
+	w, resp := postBatch(t, handler, `[
+		{"op": "patch", "channel": "app", "document": "manifest", "value": {"items": ["a", "b"], "title": null}},
+		{"op": "put", "channel": "items", "document": "b", "value": {"id": "b"}},
+		{"op": "delete", "channel": "items", "document": "old"}
+	]`)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if resp.Status != "committed" {
+		t.Errorf("Expected status 'committed', got %q", resp.Status)
+	}
+
+	wantStatus := []string{model.BatchStatusUpdated, model.BatchStatusCreated, model.BatchStatusDeleted}
+	for i, want := range wantStatus {
+		if resp.Results[i].Status != want {
+			t.Errorf("Result %d: expected status %q, got %q", i, want, resp.Results[i].Status)
+		}
+	}
+
+	data, err := handler.storage.GetDocument("app", "manifest")
+	if err != nil {
+		t.Fatalf("GetDocument failed: %v", err)
+	}
+	if string(data) != `{"items":["a","b"]}` {
+		t.Errorf("Expected patched manifest, got %s", data)
+	}
+	if resp.Results[0].ETag != etag(data) {
+		t.Errorf("Expected result ETag %s, got %s", etag(data), resp.Results[0].ETag)
+	}
+}
+
+func TestBatch_AbortsOnFailure(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	postDocument(t, handler, "app", "manifest", `{"v": 1}`)
+
+	w, resp := postBatch(t, handler, `[
+		{"op": "put", "channel": "app", "document": "manifest", "value": {"v": 2}},
+		{"op": "delete", "channel": "app", "document": "missing"},
+		{"op": "put", "channel": "app", "document": "other", "value": {}}
+	]`)
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+	if resp.Status != "aborted" || resp.Error != model.ErrCodeNotFound {
+		t.Errorf("Expected aborted batch with not_found, got %q / %q", resp.Status, resp.Error)
+	}
+
+	wantStatus := []string{model.BatchStatusAborted, model.BatchStatusFailed, model.BatchStatusAborted}
+	for i, want := range wantStatus {
+		if resp.Results[i].Status != want {
+			t.Errorf("Result %d: expected status %q, got %q", i, want, resp.Results[i].Status)
+		}
+	}
+
+	data, _ := handler.storage.GetDocument("app", "manifest")
+	if string(data) != `{"v": 1}` {
+		t.Errorf("Expected manifest unchanged, got %s", data)
+	}
+	if _, err := handler.storage.GetDocument("app", "other"); err == nil {
+		t.Error("Expected other not to be stored")
+	}
+}
+
+func TestBatch_IfMatch(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	postDocument(t, handler, "app", "manifest", `{"v": 1}`)
+	current := etag([]byte(`{"v": 1}`))
+
+	w, resp := postBatch(t, handler, `[
+		{"op": "put", "channel": "app", "document": "manifest", "value": {"v": 2}, "if_match": "\"stale\""}
+	]`)
+	if w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("Expected status %d, got %d", http.StatusPreconditionFailed, w.Code)
+	}
+	if resp.Results[0].Error != model.ErrCodePreconditionFailed {
+		t.Errorf("Expected error %q, got %q", model.ErrCodePreconditionFailed, resp.Results[0].Error)
+	}
+
+	body, _ := json.Marshal([]model.BatchOperation{{
+		Op: model.BatchOpPut, Channel: "app", Document: "manifest", Value: json.RawMessage(`{"v": 2}`), IfMatch: current,
+	}})
+	if w, _ := postBatch(t, handler, string(body)); w.Code != http.StatusOK {
+		t.Errorf("Expected status %d with matching ETag, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+}
+
+func TestBatch_InvalidOperations(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	tests := []struct {
+		name string
+		body string
+		code string
+	}{
+		{"not an array", `{"op": "put"}`, model.ErrCodeInvalidJSON},
+		{"empty", `[]`, model.ErrCodeInvalidOperation},
+		{"unknown op", `[{"op": "move", "channel": "a", "document": "b"}]`, model.ErrCodeInvalidOperation},
+		{"put without value", `[{"op": "put", "channel": "a", "document": "b"}]`, model.ErrCodeInvalidOperation},
+		{"invalid name", `[{"op": "delete", "channel": "a.b", "document": "b"}]`, model.ErrCodeInvalidName},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, resp := postBatch(t, handler, tt.body)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+			}
+			if resp.Error != tt.code {
+				t.Errorf("Expected error %q, got %q", tt.code, resp.Error)
+			}
+		})
+	}
+}
+
+func TestBatch_SchemaViolation(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	putSchema(t, handler, "myapp", testSchema)
+
+	w, resp := postBatch(t, handler, `[
+		{"op": "put", "channel": "myapp", "document": "settings", "value": {"theme": "blue"}}
+	]`)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	if len(resp.Results[0].Violations) == 0 {
+		t.Error("Expected violations in failed result")
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		doc, patch, want string
+	}{
+		{`{"a": "b"}`, `{"a": "c"}`, `{"a":"c"}`},
+		{`{"a": "b"}`, `{"b": "c"}`, `{"a":"b","b":"c"}`},
+		{`{"a": "b"}`, `{"a": null}`, `{}`},
+		{`{"a": {"b": "c", "d": 1.50}}`, `{"a": {"b": null}}`, `{"a":{"d":1.50}}`},
+		{`{"a": [1, 2]}`, `{"a": [3]}`, `{"a":[3]}`},
+		{`["a"]`, `{"a": "<b>"}`, `{"a":"<b>"}`},
+		{`{"a": "b"}`, `["c"]`, `["c"]`},
+	}
+
+	for _, tt := range tests {
+		got, err := mergePatch([]byte(tt.doc), []byte(tt.patch))
+		if err != nil {
+			t.Fatalf("mergePatch(%s, %s) failed: %v", tt.doc, tt.patch, err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("mergePatch(%s, %s) = %s, want %s", tt.doc, tt.patch, got, tt.want)
+		}
+	}
+}
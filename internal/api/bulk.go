@@ -0,0 +1,113 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/rashpile/pako-justdoc/internal/model"
+)
+
+// maxBulkBytes bounds the documents a bulk read copies out of its read
+// transaction; larger requests are rejected before anything is sent
+var maxBulkBytes = 32 * 1024 * 1024
+
+// errBulkTooLarge ends a bulk read that exceeds maxBulkBytes
+var errBulkTooLarge = errors.New("bulk read too large")
+
+// BulkGetDocuments handles GET /{channel}/_bulk?names=a,b,c
+//
+// Documents are copied out of a single read transaction, so they form a
+// consistent snapshot, and streamed as {"documents": {"a": {...}, ...},
+// "not_found": ["c"]} once it has ended, so a slow client never holds the
+// transaction open. Requests for more than maxBulkBytes of documents are
+// rejected.
+func (h *Handler) BulkGetDocuments(w http.ResponseWriter, r *http.Request) {
+	channel := r.PathValue("channel")
+
+	if !model.IsValidName(channel) {
+		writeError(w, http.StatusBadRequest, model.ErrCodeInvalidName, "Invalid channel name")
+		return
+	}
+
+	names := parseNames(r.URL.Query()["names"])
+	if len(names) == 0 {
+		writeError(w, http.StatusBadRequest, model.ErrCodeInvalidName, "No document names given")
+		return
+	}
+	for _, name := range names {
+		if !model.IsValidName(name) {
+			writeError(w, http.StatusBadRequest, model.ErrCodeInvalidName, "Invalid document name "+name)
+			return
+		}
+	}
+
+	var docs []docEntry
+	size := 0
+	err := h.storage.ViewDocuments(channel, names, func(name string, data []byte) error {
+		size += len(data)
+		if size > maxBulkBytes {
+			return errBulkTooLarge
+		}
+		docs = append(docs, docEntry{name: name, data: bytes.Clone(data)})
+		return nil
+	})
+	if err == errBulkTooLarge {
+		writeError(w, http.StatusRequestEntityTooLarge, model.ErrCodePayloadTooLarge,
+			"Requested documents exceed "+formatSize(int64(maxBulkBytes))+" limit")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to read documents")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	notFound := make([]string, 0)
+	first := true
+	_, _ = w.Write([]byte(`{"documents":{`))
+	for _, e := range docs {
+		if e.data == nil {
+			notFound = append(notFound, e.name)
+			continue
+		}
+		key, _ := json.Marshal(e.name)
+		if !first {
+			key = append([]byte{','}, key...)
+		}
+		first = false
+		if _, err := w.Write(append(key, ':')); err != nil {
+			return
+		}
+		if _, err := w.Write(e.data); err != nil {
+			return
+		}
+	}
+
+	tail, _ := json.Marshal(notFound)
+	_, _ = w.Write([]byte(`},"not_found":`))
+	_, _ = w.Write(tail)
+	_, _ = w.Write([]byte("}\n"))
+}
+
+// parseNames splits comma-separated name lists, dropping empty entries
+// and duplicates while keeping the first-seen order
+func parseNames(values []string) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, v := range values {
+		for _, name := range strings.Split(v, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" || seen[name] {
+				continue
+			}
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
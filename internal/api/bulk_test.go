@@ -0,0 +1,209 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rashpile/pako-justdoc/internal/model"
+	"github.com/rashpile/pako-justdoc/internal/storage"
+)
+
+func TestBulkGetDocuments(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	postDocument(t, handler, "app", "a", `{"id": "a"}`)
+	postDocument(t, handler, "app", "b", `[1, 2]`)
+
+	req := httptest.NewRequest(http.MethodGet, "/app/_bulk?names=a,missing&names=b,a", nil)
+	req.SetPathValue("channel", "app")
+	w := httptest.NewRecorder()
+	handler.BulkGetDocuments(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Documents map[string]json.RawMessage `json:"documents"`
+		NotFound  []string                   `json:"not_found"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse response %q: %v", w.Body.String(), err)
+	}
+
+	if len(resp.Documents) != 2 {
+		t.Errorf("Expected 2 documents, got %d", len(resp.Documents))
+	}
+	if string(resp.Documents["a"]) != `{"id": "a"}` || string(resp.Documents["b"]) != `[1, 2]` {
+		t.Errorf("Unexpected documents: %s", w.Body.String())
+	}
+	if len(resp.NotFound) != 1 || resp.NotFound[0] != "missing" {
+		t.Errorf("Expected not_found [missing], got %v", resp.NotFound)
+	}
+}
+
+func TestBulkGetDocuments_MissingChannel(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	req := httptest.NewRequest(http.MethodGet, "/app/_bulk?names=a", nil)
+	req.SetPathValue("channel", "app")
+	w := httptest.NewRecorder()
+	handler.BulkGetDocuments(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	want := `{"documents":{},"not_found":["a"]}` + "\n"
+	if w.Body.String() != want {
+		t.Errorf("Expected %q, got %q", want, w.Body.String())
+	}
+}
+
+func TestBulkGetDocuments_InvalidNames(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	for _, query := range []string{"", "?names=", "?names=a,b.c"} {
+		req := httptest.NewRequest(http.MethodGet, "/app/_bulk"+query, nil)
+		req.SetPathValue("channel", "app")
+		w := httptest.NewRecorder()
+		handler.BulkGetDocuments(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Query %q: expected status %d, got %d", query, http.StatusBadRequest, w.Code)
+		}
+		var resp model.ErrorResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Error != model.ErrCodeInvalidName {
+			t.Errorf("Query %q: expected invalid_name error, got %s", query, w.Body.String())
+		}
+	}
+}
+
+func TestPostDocument_BulkNameReserved(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+	router := NewRouter(handler)
+
+	req := httptest.NewRequest(http.MethodPost, "/app/_bulk", strings.NewReader(`{"a": 1}`))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	if _, err := handler.storage.GetDocument("app", "_bulk"); err == nil {
+		t.Error("Expected _bulk not to be stored")
+	}
+}
+
+func TestBulkGetDocuments_TooLarge(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+	defer func(n int) { maxBulkBytes = n }(maxBulkBytes)
+	maxBulkBytes = 24
+
+	for _, name := range []string{"a", "b", "c"} {
+		postDocument(t, handler, "app", name, `{"id": "`+name+`"}`)
+	}
+
+	for names, want := range map[string]int{
+		"a,b":   http.StatusOK,
+		"a,x,c": http.StatusOK,
+		"a,b,c": http.StatusRequestEntityTooLarge,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/app/_bulk?names="+names, nil)
+		req.SetPathValue("channel", "app")
+		w := httptest.NewRecorder()
+		handler.BulkGetDocuments(w, req)
+
+		if w.Code != want {
+			t.Errorf("%s: expected status %d, got %d: %s", names, want, w.Code, w.Body.String())
+		}
+		if want == http.StatusRequestEntityTooLarge {
+			var resp model.ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Error != model.ErrCodePayloadTooLarge {
+				t.Errorf("%s: expected %q error, got %s", names, model.ErrCodePayloadTooLarge, w.Body.String())
+			}
+		}
+	}
+}
+
+func TestBulkGetDocuments_StalledReaderDoesNotBlockCompact(t *testing.T) {
+	// All documents are read before the first write
+	expectCompactNotBlocked(t, "/app/_bulk?names=a,b", 1, (*Handler).BulkGetDocuments)
+}
+
+// stallingWriter is a ResponseWriter whose client stops reading: after
+// allow writes, Write blocks until release is closed
+type stallingWriter struct {
+	header  http.Header
+	allow   int
+	stalled chan struct{}
+	release chan struct{}
+}
+
+func (w *stallingWriter) Header() http.Header { return w.header }
+func (w *stallingWriter) WriteHeader(int)     {}
+func (w *stallingWriter) Write(p []byte) (int, error) {
+	if w.allow > 0 {
+		w.allow--
+		return len(p), nil
+	}
+	if w.stalled != nil {
+		close(w.stalled)
+		w.stalled = nil
+	}
+	<-w.release
+	return len(p), nil
+}
+
+// expectCompactNotBlocked serves path from a bolt-backed handler to a
+// client that stops reading after allow writes, and checks that Compact
+// still completes meanwhile
+func expectCompactNotBlocked(t *testing.T, path string, allow int, serve func(*Handler, http.ResponseWriter, *http.Request)) {
+	t.Helper()
+	store, err := storage.NewBoltStorage(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+	handler := NewHandler(store)
+	postDocument(t, handler, "app", "a", `{"id": "a"}`)
+	postDocument(t, handler, "app", "b", `{"id": "b"}`)
+
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.SetPathValue("channel", "app")
+	stalled := make(chan struct{})
+	w := &stallingWriter{header: make(http.Header), allow: allow, stalled: stalled, release: make(chan struct{})}
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		serve(handler, w, req)
+	}()
+	defer func() {
+		close(w.release)
+		<-served
+	}()
+	<-stalled
+
+	compacted := make(chan error, 1)
+	go func() {
+		_, _, err := store.Compact()
+		compacted <- err
+	}()
+	select {
+	case err := <-compacted:
+		if err != nil {
+			t.Errorf("Compact failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Compact is blocked by a stalled reader")
+	}
+}
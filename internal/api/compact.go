@@ -0,0 +1,30 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/rashpile/pako-justdoc/internal/model"
+	"github.com/rashpile/pako-justdoc/internal/storage"
+)
+
+// Compact handles POST /_/compact
+// Rewrites the database file to reclaim space; other requests wait until it is done
+func (h *Handler) Compact(w http.ResponseWriter, r *http.Request) {
+	c, ok := h.storage.(storage.Compacter)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, model.ErrCodeNotImplemented, "Storage backend does not support compaction")
+		return
+	}
+
+	before, after, err := c.Compact()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to compact database")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, model.CompactResponse{
+		Status:     "compacted",
+		SizeBefore: before,
+		SizeAfter:  after,
+	})
+}
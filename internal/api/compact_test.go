@@ -0,0 +1,50 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/rashpile/pako-justdoc/internal/model"
+	"github.com/rashpile/pako-justdoc/internal/storage"
+)
+
+func TestCompact(t *testing.T) {
+	store, err := storage.NewBoltStorage(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+	handler := NewHandler(store)
+	_, _ = store.PutDocument("myapp", "settings", []byte(`{"theme": "dark"}`))
+
+	w := httptest.NewRecorder()
+	handler.Compact(w, httptest.NewRequest(http.MethodPost, "/_/compact", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp model.CompactResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if resp.Status != "compacted" || resp.SizeBefore == 0 || resp.SizeAfter == 0 {
+		t.Errorf("Unexpected response %+v", resp)
+	}
+
+	if data, err := store.GetDocument("myapp", "settings"); err != nil || string(data) != `{"theme": "dark"}` {
+		t.Errorf("Expected document after compaction, got %q (%v)", data, err)
+	}
+}
+
+func TestCompact_NotSupported(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	w := httptest.NewRecorder()
+	handler.Compact(w, httptest.NewRequest(http.MethodPost, "/_/compact", nil))
+	if w.Code != http.StatusNotImplemented {
+		t.Errorf("Expected 501, got %d", w.Code)
+	}
+}
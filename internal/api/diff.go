@@ -0,0 +1,386 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rashpile/pako-justdoc/internal/model"
+	"github.com/rashpile/pako-justdoc/internal/storage"
+)
+
+// maxLCSCells bounds the work spent aligning two arrays; larger arrays are
+// compared index by index
+const maxLCSCells = 1 << 20
+
+// DiffDocuments handles GET /{channel}/{document}/_diff
+// It returns the JSON Patch that turns the from document into the to
+// document. Both default to the document in the path and may name another
+// document of the same channel or "channel/document", with an "@N" suffix
+// for a previous revision; a bare "@N" is a revision of the path document.
+func (h *Handler) DiffDocuments(w http.ResponseWriter, r *http.Request) {
+	channel := r.PathValue("channel")
+	document := r.PathValue("document")
+
+	if !model.IsValidName(channel) || !model.IsValidName(document) {
+		writeError(w, http.StatusBadRequest, model.ErrCodeInvalidName, "Invalid channel or document name")
+		return
+	}
+
+	var docs [2][]byte
+	for i, param := range []string{"from", "to"} {
+		c, d, revision, ok := documentRef(channel, document, r.URL.Query().Get(param))
+		if !ok {
+			writeError(w, http.StatusBadRequest, model.ErrCodeInvalidName, "Invalid "+param+" document: want a name or channel/document, optionally followed by @revision")
+			return
+		}
+		data, err := h.loadDocument(c, d, revision)
+		if err == storage.ErrNotFound {
+			ref := c + "/" + d
+			if revision != 0 {
+				ref += "@" + strconv.Itoa(revision)
+			}
+			writeError(w, http.StatusNotFound, model.ErrCodeNotFound, "Document not found: "+ref)
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+			return
+		}
+		docs[i] = data
+	}
+
+	ops, err := jsonDiff(docs[0], docs[1])
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json-patch+json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(ops)
+}
+
+// documentRef resolves a from/to parameter relative to the path document.
+// The revision is 0 for the current version; names never contain "@".
+func documentRef(channel, document, ref string) (string, string, int, bool) {
+	revision := 0
+	if name, rev, ok := strings.Cut(ref, "@"); ok {
+		n, err := strconv.Atoi(rev)
+		if err != nil || n < 1 {
+			return "", "", 0, false
+		}
+		ref, revision = name, n
+	}
+	if ref == "" {
+		return channel, document, revision, true
+	}
+	if c, d, ok := strings.Cut(ref, "/"); ok {
+		channel, ref = c, d
+	}
+	return channel, ref, revision, model.IsValidName(channel) && model.IsValidName(ref)
+}
+
+// jsonDiff returns the JSON Patch that turns document a into document b.
+// Object members are compared by key and arrays are aligned on their
+// longest common subsequence, so an insertion doesn't turn into a
+// replacement of every following item.
+func jsonDiff(a, b []byte) ([]model.PatchOperation, error) {
+	va, err := decodeDiffJSON(a)
+	if err != nil {
+		return nil, err
+	}
+	vb, err := decodeDiffJSON(b)
+	if err != nil {
+		return nil, err
+	}
+	d := differ{ops: []model.PatchOperation{}}
+	d.diff("", va, vb)
+	return d.ops, d.err
+}
+
+// decodeDiffJSON decodes a document for diffing. Numbers are replaced by
+// values carrying their comparison key, so aligning arrays compares keys
+// instead of parsing the same numbers over and over.
+func decodeDiffJSON(data []byte) (interface{}, error) {
+	v, err := decodeJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	return keyNumbers(v), nil
+}
+
+func keyNumbers(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, e := range t {
+			t[k] = keyNumbers(e)
+		}
+	case []interface{}:
+		for i, e := range t {
+			t[i] = keyNumbers(e)
+		}
+	case json.Number:
+		return number{text: t, key: numberKey(t)}
+	}
+	return v
+}
+
+// number is a decoded JSON number; equal values have equal keys
+type number struct {
+	text json.Number
+	key  string
+}
+
+// MarshalJSON writes the number as it appeared in the document
+func (n number) MarshalJSON() ([]byte, error) {
+	return []byte(n.text), nil
+}
+
+// maxExponentDigits bounds the exponents numberKey normalizes; numbers
+// with longer ones are keyed by their text
+const maxExponentDigits = 9
+
+// numberKey returns the digits of n without leading or trailing zeros
+// and its decimal exponent, so 1, 1.0 and 10e-1 share a key. The
+// exponent is never expanded, which keeps values like 1e1000000 cheap.
+func numberKey(n json.Number) string {
+	s := string(n)
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	exp := 0
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		e := s[i+1:]
+		s = s[:i]
+		negative := strings.HasPrefix(e, "-")
+		e = strings.TrimLeft(strings.TrimLeft(e, "+-"), "0")
+		if len(e) > maxExponentDigits {
+			return string(n)
+		}
+		if e != "" {
+			exp, _ = strconv.Atoi(e)
+		}
+		if negative {
+			exp = -exp
+		}
+	}
+	digits := s
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		digits = s[:i] + s[i+1:]
+		exp -= len(s) - i - 1
+	}
+	digits = strings.TrimLeft(digits, "0")
+	if digits == "" {
+		return "0"
+	}
+	trimmed := strings.TrimRight(digits, "0")
+	exp += len(digits) - len(trimmed)
+	return sign + trimmed + "e" + strconv.Itoa(exp)
+}
+
+type differ struct {
+	ops []model.PatchOperation
+	err error
+}
+
+func (d *differ) add(op, path string, v interface{}) {
+	p := model.PatchOperation{Op: op, Path: path}
+	if op != model.PatchOpRemove {
+		data, err := encodeJSON(v)
+		if err != nil && d.err == nil {
+			d.err = err
+		}
+		p.Value = data
+	}
+	d.ops = append(d.ops, p)
+}
+
+func (d *differ) diff(path string, a, b interface{}) {
+	switch av := a.(type) {
+	case map[string]interface{}:
+		if bv, ok := b.(map[string]interface{}); ok {
+			d.diffObjects(path, av, bv)
+			return
+		}
+	case []interface{}:
+		if bv, ok := b.([]interface{}); ok {
+			d.diffArrays(path, av, bv)
+			return
+		}
+	}
+	if !jsonEqual(a, b) {
+		d.add(model.PatchOpReplace, path, b)
+	}
+}
+
+func (d *differ) diffObjects(path string, a, b map[string]interface{}) {
+	for _, key := range sortedKeys(a) {
+		if bv, ok := b[key]; ok {
+			d.diff(path+"/"+escapePointer(key), a[key], bv)
+		} else {
+			d.add(model.PatchOpRemove, path+"/"+escapePointer(key), nil)
+		}
+	}
+	for _, key := range sortedKeys(b) {
+		if _, ok := a[key]; !ok {
+			d.add(model.PatchOpAdd, path+"/"+escapePointer(key), b[key])
+		}
+	}
+}
+
+// diffArrays emits operations in order, tracking the index each one applies
+// to after the previous operations. A removal directly followed by an
+// insertion is diffed in place instead.
+func (d *differ) diffArrays(path string, a, b []interface{}) {
+	steps := alignArrays(a, b)
+	pos := 0
+	for k := 0; k < len(steps); k++ {
+		s := steps[k]
+		switch {
+		case s.keep:
+			pos++
+		case s.remove && k+1 < len(steps) && steps[k+1].insert:
+			d.diff(path+"/"+strconv.Itoa(pos), a[s.i], b[steps[k+1].j])
+			pos++
+			k++
+		case s.remove:
+			d.add(model.PatchOpRemove, path+"/"+strconv.Itoa(pos), nil)
+		default:
+			d.add(model.PatchOpAdd, path+"/"+strconv.Itoa(pos), b[s.j])
+			pos++
+		}
+	}
+}
+
+// alignStep is one step of an edit script over array items i of a and j of b
+type alignStep struct {
+	keep, remove, insert bool
+	i, j                 int
+}
+
+// alignArrays returns an edit script turning a into b. Common prefixes and
+// suffixes are matched directly; the rest is aligned on the longest common
+// subsequence when small enough and item by item otherwise.
+func alignArrays(a, b []interface{}) []alignStep {
+	var prefix, suffix int
+	for prefix < len(a) && prefix < len(b) && jsonEqual(a[prefix], b[prefix]) {
+		prefix++
+	}
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && jsonEqual(a[len(a)-1-suffix], b[len(b)-1-suffix]) {
+		suffix++
+	}
+
+	var steps []alignStep
+	for i := 0; i < prefix; i++ {
+		steps = append(steps, alignStep{keep: true, i: i, j: i})
+	}
+	ma, mb := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	if len(ma)*len(mb) <= maxLCSCells {
+		steps = append(steps, lcsSteps(ma, mb, prefix)...)
+	} else {
+		for k := 0; k < len(ma) || k < len(mb); k++ {
+			if k < len(ma) {
+				steps = append(steps, alignStep{remove: true, i: prefix + k})
+			}
+			if k < len(mb) {
+				steps = append(steps, alignStep{insert: true, j: prefix + k})
+			}
+		}
+	}
+	for k := suffix; k > 0; k-- {
+		steps = append(steps, alignStep{keep: true, i: len(a) - k, j: len(b) - k})
+	}
+	return steps
+}
+
+// lcsSteps aligns a and b on their longest common subsequence; offset is
+// added to the indexes of the returned steps
+func lcsSteps(a, b []interface{}, offset int) []alignStep {
+	// lengths[i][j] is the LCS length of a[i:] and b[j:]
+	lengths := make([][]int, len(a)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if jsonEqual(a[i], b[j]) {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else {
+				lengths[i][j] = max(lengths[i+1][j], lengths[i][j+1])
+			}
+		}
+	}
+
+	var steps []alignStep
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && jsonEqual(a[i], b[j]):
+			steps = append(steps, alignStep{keep: true, i: offset + i, j: offset + j})
+			i++
+			j++
+		case j == len(b) || i < len(a) && lengths[i+1][j] >= lengths[i][j+1]:
+			steps = append(steps, alignStep{remove: true, i: offset + i})
+			i++
+		default:
+			steps = append(steps, alignStep{insert: true, j: offset + j})
+			j++
+		}
+	}
+	return steps
+}
+
+// jsonEqual compares values decoded by decodeDiffJSON; numbers are equal
+// when they have the same value, so 1 equals 1.0
+func jsonEqual(a, b interface{}) bool {
+	switch av := a.(type) {
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for k, v := range av {
+			w, ok := bv[k]
+			if !ok || !jsonEqual(v, w) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !jsonEqual(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	case number:
+		bv, ok := b.(number)
+		return ok && av.key == bv.key
+	default:
+		return a == b
+	}
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// pointerEscaper escapes a key for use as a JSON Pointer reference token
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+func escapePointer(key string) string {
+	return pointerEscaper.Replace(key)
+}
@@ -0,0 +1,225 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rashpile/pako-justdoc/internal/model"
+)
+
+func TestJSONDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{"equal", `{"a":1,"b":[1,2]}`, `{"b":[1,2],"a":1}`, `[]`},
+		{"numbers by value", `{"a":1}`, `{"a":1.0}`, `[]`},
+		{"numbers by exponent", `[100,0.5,-0,1.5e3,0.001]`, `[1e2,5E-1,0,1500.00,10e-4]`, `[]`},
+		{"huge exponents", `[1e1000000,2]`, `[10e999999,3]`, `[{"op":"replace","path":"/1","value":3}]`},
+		{"number text kept", `{"a":1}`, `{"a":1.50e+2}`, `[{"op":"replace","path":"/a","value":1.50e+2}]`},
+		{"replace value", `{"a":1}`, `{"a":"x"}`, `[{"op":"replace","path":"/a","value":"x"}]`},
+		{"add and remove keys", `{"a":1,"b":2}`, `{"b":2,"c":null}`,
+			`[{"op":"remove","path":"/a"},{"op":"add","path":"/c","value":null}]`},
+		{"nested", `{"a":{"b":{"c":1}}}`, `{"a":{"b":{"c":2}}}`, `[{"op":"replace","path":"/a/b/c","value":2}]`},
+		{"escaped keys", `{"a/b":1,"m~n":1}`, `{"a/b":2,"m~n":2}`,
+			`[{"op":"replace","path":"/a~1b","value":2},{"op":"replace","path":"/m~0n","value":2}]`},
+		{"array insert", `[1,2,3]`, `[1,9,2,3]`, `[{"op":"add","path":"/1","value":9}]`},
+		{"array remove", `[1,2,3]`, `[1,3]`, `[{"op":"remove","path":"/1"}]`},
+		{"array item changed", `[{"id":1,"v":"a"},{"id":2}]`, `[{"id":1,"v":"b"},{"id":2}]`,
+			`[{"op":"replace","path":"/0/v","value":"b"}]`},
+		{"type change", `{"a":[1]}`, `{"a":{"0":1}}`, `[{"op":"replace","path":"/a","value":{"0":1}}]`},
+		{"root", `1`, `2`, `[{"op":"replace","path":"","value":2}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ops, err := jsonDiff([]byte(tt.a), []byte(tt.b))
+			if err != nil {
+				t.Fatalf("jsonDiff: %v", err)
+			}
+			got, _ := json.Marshal(ops)
+			if string(got) != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestNumberKey(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		equal bool
+	}{
+		{"1", "1.0", true},
+		{"0", "-0.0e5", true},
+		{"-12.5", "-125e-1", true},
+		{"0.000120", "1.2E-4", true},
+		{"1e+0005", "100000", true},
+		{"1e1000000", "1e+1000000", true},
+		{"1", "-1", false},
+		{"1e5", "1e-5", false},
+		{"12", "21", false},
+		{"1e1000000", "1e1000001", false},
+	}
+	for _, tt := range tests {
+		if got := numberKey(json.Number(tt.a)) == numberKey(json.Number(tt.b)); got != tt.equal {
+			t.Errorf("%s == %s: expected %v, got %v", tt.a, tt.b, tt.equal, got)
+		}
+	}
+}
+
+func TestJSONDiff_HugeExponents(t *testing.T) {
+	// Reversed arrays are aligned with the full LCS table; comparing each
+	// pair must not expand the exponents
+	var a, b []string
+	for i := 0; i < 500; i++ {
+		a = append(a, "1e100000"+strconv.Itoa(i))
+		b = append([]string{a[i]}, b...)
+	}
+	start := time.Now()
+	if _, err := jsonDiff([]byte("["+strings.Join(a, ",")+"]"), []byte("["+strings.Join(b, ",")+"]")); err != nil {
+		t.Fatalf("jsonDiff: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Diff took %v", elapsed)
+	}
+}
+
+func TestJSONDiff_Applies(t *testing.T) {
+	// Applying the patch to the first document must give the second
+	tests := [][2]string{
+		{`[1,2,3,4,5,6]`, `[6,5,4,3,2,1]`},
+		{`[1,2,3,4,5,6]`, `[2,4,6,7]`},
+		{`["a","b","c"]`, `[]`},
+		{`[]`, `["a",{"b":[1,2]},"c"]`},
+		{`{"list":[{"a":1},{"b":2},{"c":3}],"x":true}`, `{"list":[{"b":2},{"a":1,"z":0},{"c":3},{"d":4}]}`},
+		{`{"a":[[1,2],[3,4]]}`, `{"a":[[1,3],[4],[5]],"b":"new"}`},
+	}
+	for i, tt := range tests {
+		ops, err := jsonDiff([]byte(tt[0]), []byte(tt[1]))
+		if err != nil {
+			t.Fatalf("%d: jsonDiff: %v", i, err)
+		}
+		doc, _ := decodeDiffJSON([]byte(tt[0]))
+		for _, op := range ops {
+			doc = applyPatchOp(t, doc, op)
+		}
+		want, _ := decodeDiffJSON([]byte(tt[1]))
+		if !jsonEqual(doc, want) {
+			got, _ := encodeJSON(doc)
+			t.Errorf("%d: patch %v gives %s, want %s", i, ops, got, tt[1])
+		}
+	}
+}
+
+// applyPatchOp applies an add, remove or replace operation
+func applyPatchOp(t *testing.T, doc interface{}, op model.PatchOperation) interface{} {
+	t.Helper()
+	var value interface{}
+	if op.Value != nil {
+		value, _ = decodeDiffJSON(op.Value)
+	}
+	if op.Path == "" {
+		return value
+	}
+	tokens := strings.Split(op.Path[1:], "/")
+	for i, tok := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(tok)
+	}
+	var apply func(node interface{}, tokens []string) interface{}
+	apply = func(node interface{}, tokens []string) interface{} {
+		last := len(tokens) == 1
+		switch n := node.(type) {
+		case map[string]interface{}:
+			switch {
+			case !last:
+				n[tokens[0]] = apply(n[tokens[0]], tokens[1:])
+			case op.Op == model.PatchOpRemove:
+				delete(n, tokens[0])
+			default:
+				n[tokens[0]] = value
+			}
+			return n
+		case []interface{}:
+			idx, err := strconv.Atoi(tokens[0])
+			if err != nil || idx > len(n) {
+				t.Fatalf("bad index in %s", op.Path)
+			}
+			switch {
+			case !last:
+				n[idx] = apply(n[idx], tokens[1:])
+			case op.Op == model.PatchOpRemove:
+				n = append(n[:idx], n[idx+1:]...)
+			case op.Op == model.PatchOpAdd:
+				n = append(n[:idx], append([]interface{}{value}, n[idx:]...)...)
+			default:
+				n[idx] = value
+			}
+			return n
+		}
+		t.Fatalf("path %s does not exist", op.Path)
+		return nil
+	}
+	return apply(doc, tokens)
+}
+
+func TestDiffDocuments(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+	router := NewRouter(handler)
+
+	postDocument(t, handler, "app", "settings", `{"theme":"dark","size":1}`)
+	postDocument(t, handler, "app", "staging", `{"theme":"light","size":1}`)
+	postDocument(t, handler, "prod", "settings", `{"theme":"dark"}`)
+	postDocument(t, handler, "app", "history", `{"theme":"dark"}`)
+	postDocument(t, handler, "app", "history", `{"theme":"dark","size":2}`)
+
+	tests := []struct {
+		name   string
+		url    string
+		status int
+		want   string
+	}{
+		{"same document", "/app/settings/_diff", http.StatusOK, `[]`},
+		{"from same channel", "/app/settings/_diff?from=staging", http.StatusOK,
+			`[{"op":"replace","path":"/theme","value":"dark"}]`},
+		{"to other channel", "/app/settings/_diff?to=prod/settings", http.StatusOK,
+			`[{"op":"remove","path":"/size"}]`},
+		{"from and to", "/app/settings/_diff?from=prod/settings&to=staging", http.StatusOK,
+			`[{"op":"replace","path":"/theme","value":"light"},{"op":"add","path":"/size","value":1}]`},
+		{"from revision", "/app/history/_diff?from=@1", http.StatusOK,
+			`[{"op":"add","path":"/size","value":2}]`},
+		{"to other revision", "/app/settings/_diff?to=app/history@1", http.StatusOK,
+			`[{"op":"remove","path":"/size"}]`},
+		{"missing document", "/app/settings/_diff?from=nope", http.StatusNotFound, ""},
+		{"missing revision", "/app/settings/_diff?from=@2", http.StatusNotFound, ""},
+		{"invalid reference", "/app/settings/_diff?from=a/b/c", http.StatusBadRequest, ""},
+		{"invalid revision", "/app/settings/_diff?from=settings@0", http.StatusBadRequest, ""},
+		{"unknown action", "/app/settings/_other", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+			if tt.want == "" {
+				return
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/json-patch+json" {
+				t.Errorf("Expected JSON Patch content type, got %q", ct)
+			}
+			if got := strings.TrimSpace(w.Body.String()); got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// etag returns the strong entity tag for a stored document
+func etag(data []byte) string {
+	return etagFromDigest(sha256.Sum256(data))
+}
+
+// etagFromDigest returns the entity tag for a document with the given SHA-256
+func etagFromDigest(sum [sha256.Size]byte) string {
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// representationTag returns the entity tag of a representation derived from
+// a stored document, such as "yaml" or "gzip": the stored document's tag
+// with the representation appended, so that caches never serve one
+// representation for another
+func representationTag(tag, representation string) string {
+	if representation == "" {
+		return tag
+	}
+	return strings.TrimSuffix(tag, `"`) + "-" + representation + `"`
+}
+
+// storedTag returns the tag of the stored document a representation tag
+// was derived from. Document tags are hex, so a dash starts the suffix.
+func storedTag(tag string) string {
+	if i := strings.LastIndexByte(tag, '-'); i >= 0 && strings.HasSuffix(tag, `"`) {
+		return tag[:i] + `"`
+	}
+	return tag
+}
+
+// etagMatches reports whether an If-Match value is satisfied by the current
+// entity tag. An empty current tag means the document doesn't exist. Tags
+// of every representation of the document match, so the ETag of any GET
+// can be used to update it.
+func etagMatches(ifMatch, current string) bool {
+	if current == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(ifMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || storedTag(candidate) == current {
+			return true
+		}
+	}
+	return false
+}
+
+// etagListed reports whether an If-None-Match value lists the entity tag
+// of a representation
+func etagListed(ifNoneMatch, tag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -2,24 +2,74 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
 
+	"github.com/rashpile/pako-justdoc/internal/format"
 	"github.com/rashpile/pako-justdoc/internal/model"
 	"github.com/rashpile/pako-justdoc/internal/storage"
 )
 
-// MaxBodySize is the maximum allowed request body size (10MB)
+// MaxBodySize is the default maximum request body size (10MB)
 const MaxBodySize = 10 * 1024 * 1024
 
 // Handler handles HTTP requests for the document API
 type Handler struct {
-	storage storage.Storage
+	storage           storage.Storage
+	schemas           *schemaCache
+	maxBodySize       int64
+	maxAttachmentSize int64
+	shares            *ShareLinks
+	normalize         map[string]bool
+}
+
+// HandlerOption configures a Handler
+type HandlerOption func(*Handler)
+
+// WithMaxBodySize sets the maximum request body and document size
+func WithMaxBodySize(n int64) HandlerOption {
+	return func(h *Handler) {
+		h.maxBodySize = n
+	}
+}
+
+// WithMaxAttachmentSize sets the maximum attachment size
+func WithMaxAttachmentSize(n int64) HandlerOption {
+	return func(h *Handler) {
+		h.maxAttachmentSize = n
+	}
+}
+
+// WithShareLinks enables creating share links signed by s
+func WithShareLinks(s *ShareLinks) HandlerOption {
+	return func(h *Handler) {
+		h.shares = s
+	}
+}
+
+// WithNormalizedChannels stores the documents written to the named
+// channels, or to all channels if one is "*", as canonical JSON unless
+// the channel settings say otherwise
+func WithNormalizedChannels(channels ...string) HandlerOption {
+	return func(h *Handler) {
+		h.normalize = make(map[string]bool, len(channels))
+		for _, c := range channels {
+			h.normalize[c] = true
+		}
+	}
 }
 
 // NewHandler creates a new Handler with the given storage
-func NewHandler(s storage.Storage) *Handler {
-	return &Handler{storage: s}
+func NewHandler(s storage.Storage, opts ...HandlerOption) *Handler {
+	h := &Handler{storage: s, schemas: newSchemaCache(), maxBodySize: MaxBodySize, maxAttachmentSize: MaxAttachmentSize}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
 }
 
 // PostDocument handles POST /{channel}/{document}
@@ -33,28 +83,39 @@ func (h *Handler) PostDocument(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Limit body size
-	r.Body = http.MaxBytesReader(w, r.Body, MaxBodySize)
-
-	// Read body
-	data, err := io.ReadAll(r.Body)
+	// Read the body, converting other formats to JSON
+	data, ok := h.readDocumentBody(w, r)
+	if !ok {
+		return
+	}
+	normalize, err := h.normalizes(channel)
 	if err != nil {
-		if err.Error() == "http: request body too large" {
-			writeError(w, http.StatusRequestEntityTooLarge, model.ErrCodePayloadTooLarge, "Request body exceeds 10MB limit")
-			return
-		}
-		writeError(w, http.StatusBadRequest, model.ErrCodeInvalidJSON, "Failed to read request body")
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to load channel settings")
+		return
+	}
+	data, err = normalizeDocument(data, normalize)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, model.ErrCodeInvalidJSON, "Document can't be normalized: "+err.Error())
 		return
 	}
 
-	// Validate JSON
-	if !json.Valid(data) {
-		writeError(w, http.StatusBadRequest, model.ErrCodeInvalidJSON, "Invalid JSON body")
+	// Validate against channel schema
+	violations, err := h.validateDocument(channel, data)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to validate document")
+		return
+	}
+	if violations != nil {
+		writeSchemaViolation(w, violations)
 		return
 	}
 
 	// Store document
-	created, err := h.storage.PutDocument(channel, document, data)
+	created, err := h.putDocument(channel, document, data)
+	if err == errReservedName {
+		writeError(w, http.StatusBadRequest, model.ErrCodeInvalidName, reservedNameMessage)
+		return
+	}
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to store document")
 		return
@@ -75,7 +136,35 @@ func (h *Handler) PostDocument(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// errReservedName rejects creating a document under a reserved name
+var errReservedName = errors.New("reserved name")
+
+const reservedNameMessage = "Names starting with an underscore are reserved for existing documents"
+
+// putDocument stores a document like Storage.PutDocument. A document with
+// a reserved channel or document name is only written if it already
+// exists, checked in the same transaction.
+func (h *Handler) putDocument(channel, document string, data []byte) (bool, error) {
+	if !model.IsReservedName(channel) && !model.IsReservedName(document) {
+		return h.storage.PutDocument(channel, document, data)
+	}
+	var created bool
+	err := h.storage.Batch(func(tx storage.Tx) error {
+		if _, err := tx.GetDocument(channel, document); err == storage.ErrNotFound {
+			return errReservedName
+		} else if err != nil {
+			return err
+		}
+		var err error
+		created, err = tx.PutDocument(channel, document, data)
+		return err
+	})
+	return created, err
+}
+
 // GetDocument handles GET /{channel}/{document}
+// JSON documents are re-indented with ?pretty=true, and ?revision=N returns
+// a previous version.
 func (h *Handler) GetDocument(w http.ResponseWriter, r *http.Request) {
 	channel := r.PathValue("channel")
 	document := r.PathValue("document")
@@ -85,8 +174,38 @@ func (h *Handler) GetDocument(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, model.ErrCodeInvalidName, "Invalid channel or document name")
 		return
 	}
+	revision, ok := revisionParam(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, model.ErrCodeInvalidOperation, "revision must be a positive number")
+		return
+	}
+
+	mediaType, ok := responseFormat(r)
+	if !ok {
+		writeError(w, http.StatusNotAcceptable, model.ErrCodeNotAcceptable, "Documents can be returned as "+strings.Join(responseFormats, ", "))
+		return
+	}
+	w.Header().Add("Vary", "Accept")
+	if mediaType != format.JSON {
+		h.getConvertedDocument(w, r, mediaType, channel, document, revision)
+		return
+	}
+	pretty, ok := prettyParam(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, model.ErrCodeInvalidOperation, "pretty must be true or false")
+		return
+	}
+
+	// Serve compressed documents as stored to clients that accept them
+	if getter, ok := h.storage.(storage.EncodedGetter); ok && !pretty && revision == 0 {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if acceptsGzip(r) {
+			h.getEncodedDocument(w, r, getter, channel, document)
+			return
+		}
+	}
 
-	data, err := h.storage.GetDocument(channel, document)
+	data, err := h.loadDocument(channel, document, revision)
 	if err == storage.ErrNotFound {
 		writeError(w, http.StatusNotFound, model.ErrCodeNotFound, "Document not found")
 		return
@@ -96,11 +215,137 @@ func (h *Handler) GetDocument(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
+	tag := etag(data)
+	if pretty {
+		data = indentDocument(data)
+		tag = representationTag(tag, "pretty")
+	}
+	writeDocument(w, r, data, tag, format.JSON)
+}
+
+// DeleteDocument handles DELETE /{channel}/{document}
+// An If-Match header makes the delete conditional on the current ETag.
+func (h *Handler) DeleteDocument(w http.ResponseWriter, r *http.Request) {
+	h.applyDocumentOperation(w, r, model.BatchOperation{
+		Op:       model.BatchOpDelete,
+		Channel:  r.PathValue("channel"),
+		Document: r.PathValue("document"),
+		IfMatch:  r.Header.Get("If-Match"),
+	})
+}
+
+// PatchDocument handles PATCH /{channel}/{document}
+// The body is an RFC 7386 JSON merge patch applied to the stored document.
+// An If-Match header makes the update conditional on the current ETag.
+func (h *Handler) PatchDocument(w http.ResponseWriter, r *http.Request) {
+	if !model.IsValidName(r.PathValue("channel")) || !model.IsValidName(r.PathValue("document")) {
+		writeError(w, http.StatusBadRequest, model.ErrCodeInvalidName, "Invalid channel or document name")
+		return
+	}
+	patch, ok := h.readJSONBody(w, r)
+	if !ok {
+		return
+	}
+	h.applyDocumentOperation(w, r, model.BatchOperation{
+		Op:       model.BatchOpPatch,
+		Channel:  r.PathValue("channel"),
+		Document: r.PathValue("document"),
+		Value:    patch,
+		IfMatch:  r.Header.Get("If-Match"),
+	})
+}
+
+// applyDocumentOperation runs a single batch operation in its own
+// transaction, so the precondition check and the write are atomic
+func (h *Handler) applyDocumentOperation(w http.ResponseWriter, r *http.Request, op model.BatchOperation) {
+	if berr := checkBatchOperation(op); berr != nil {
+		writeOperationError(w, berr)
+		return
+	}
+	schema, err := h.channelSchema(op.Channel)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to load channel schema")
+		return
+	}
+	normalize, err := h.normalizes(op.Channel)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to load channel settings")
+		return
+	}
+
+	var result model.BatchResult
+	err = h.storage.Batch(func(tx storage.Tx) error {
+		var berr *batchError
+		if result, berr = applyBatchOperation(tx, op, schema, normalize); berr != nil {
+			return berr
+		}
+		return nil
+	})
+	var berr *batchError
+	if errors.As(err, &berr) {
+		writeOperationError(w, berr)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to store document")
+		return
+	}
+
+	if result.ETag != "" {
+		w.Header().Set("ETag", result.ETag)
+	}
+	writeJSON(w, http.StatusOK, model.SuccessResponse{
+		Status:   result.Status,
+		Channel:  op.Channel,
+		Document: op.Document,
+	})
+}
+
+// writeOperationError writes a failed single-document operation as an error response
+func writeOperationError(w http.ResponseWriter, berr *batchError) {
+	writeJSON(w, berr.statusCode, model.ErrorResponse{
+		Error:      berr.code,
+		Message:    berr.message,
+		Violations: berr.violations,
+	})
+}
+
+// writeDocument writes a document with its ETag, or 304 Not Modified if
+// the request's If-None-Match already has it
+func writeDocument(w http.ResponseWriter, r *http.Request, data []byte, tag, contentType string) {
+	w.Header().Set("ETag", tag)
+	if inm := r.Header.Get("If-None-Match"); inm != "" && etagListed(inm, tag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
 	w.WriteHeader(http.StatusOK)
 	_, _ = w.Write(data)
 }
 
+// getEncodedDocument writes a document without decoding it, with
+// Content-Encoding set if it is stored compressed. A compressed response
+// has its own ETag, derived from that of the plain document so that it can
+// be used with If-Match too.
+func (h *Handler) getEncodedDocument(w http.ResponseWriter, r *http.Request, getter storage.EncodedGetter, channel, document string) {
+	doc, err := getter.GetDocumentEncoded(channel, document)
+	if err == storage.ErrNotFound {
+		writeError(w, http.StatusNotFound, model.ErrCodeNotFound, "Document not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+		return
+	}
+
+	tag := etag(doc.Data)
+	if doc.Encoding != "" {
+		tag = representationTag(etagFromDigest(doc.Digest), doc.Encoding)
+		w.Header().Set("Content-Encoding", doc.Encoding)
+	}
+	writeDocument(w, r, doc.Data, tag, format.JSON)
+}
+
 // ListDocuments handles GET /{channel}/
 func (h *Handler) ListDocuments(w http.ResponseWriter, r *http.Request) {
 	channel := r.PathValue("channel")
@@ -138,6 +383,73 @@ func (h *Handler) ListChannels(w http.ResponseWriter, r *http.Request) {
 	_ = json.NewEncoder(w).Encode(channels)
 }
 
+// readJSONBody reads a size-limited request body and checks that it is
+// valid JSON. On failure it writes the error response and returns false.
+func (h *Handler) readJSONBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	data, ok := h.readBody(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	// Validate JSON
+	if !json.Valid(data) {
+		writeError(w, http.StatusBadRequest, model.ErrCodeInvalidJSON, "Invalid JSON body")
+		return nil, false
+	}
+	return data, true
+}
+
+// readBody reads a size-limited request body. On failure it writes the
+// error response and returns false.
+func (h *Handler) readBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	// Limit body size
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxBodySize)
+
+	// Read body
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		if err.Error() == "http: request body too large" {
+			writeError(w, http.StatusRequestEntityTooLarge, model.ErrCodePayloadTooLarge, "Request body exceeds "+formatSize(h.maxBodySize)+" limit")
+			return nil, false
+		}
+		writeError(w, http.StatusBadRequest, model.ErrCodeInvalidJSON, "Failed to read request body")
+		return nil, false
+	}
+	return data, true
+}
+
+// acceptsGzip reports whether the Accept-Encoding header allows gzip
+func acceptsGzip(r *http.Request) bool {
+	for _, header := range r.Header.Values("Accept-Encoding") {
+		for _, coding := range strings.Split(header, ",") {
+			name, params, _ := strings.Cut(coding, ";")
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name != "gzip" && name != "*" {
+				continue
+			}
+			// gzip;q=0 explicitly refuses it
+			if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+				q, err := strconv.ParseFloat(v, 64)
+				return err == nil && q > 0
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// formatSize formats a byte count for error messages, e.g. "10MB"
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<20 && n%(1<<20) == 0:
+		return fmt.Sprintf("%dMB", n>>20)
+	case n >= 1<<10 && n%(1<<10) == 0:
+		return fmt.Sprintf("%dKB", n>>10)
+	default:
+		return fmt.Sprintf("%d bytes", n)
+	}
+}
+
 func writeError(w http.ResponseWriter, statusCode int, errCode, message string) {
 	writeJSON(w, statusCode, model.ErrorResponse{
 		Error:   errCode,
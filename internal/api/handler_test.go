@@ -2,11 +2,13 @@ package api
 
 import (
 	"bytes"
+	"compress/gzip"
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
-	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 
@@ -14,25 +16,13 @@ import (
 	"github.com/rashpile/pako-justdoc/internal/storage"
 )
 
-// setupTestHandler creates a handler with a temporary bbolt database
+// setupTestHandler creates a handler with an in-memory storage
 func setupTestHandler(t *testing.T) (*Handler, func()) {
 	t.Helper()
-	tmpDir, err := os.MkdirTemp("", "justdoc-api-test-*")
-	if err != nil {
-		t.Fatalf("Failed to create temp dir: %v", err)
-	}
-
-	dbPath := filepath.Join(tmpDir, "test.db")
-	store, err := storage.NewBoltStorage(dbPath)
-	if err != nil {
-		_ = os.RemoveAll(tmpDir)
-		t.Fatalf("Failed to create storage: %v", err)
-	}
-
+	store := storage.NewMemoryStorage()
 	handler := NewHandler(store)
 	cleanup := func() {
 		_ = store.Close()
-		_ = os.RemoveAll(tmpDir)
 	}
 
 	return handler, cleanup
@@ -486,3 +476,231 @@ func TestListChannels_Empty_ReturnsEmptyArray(t *testing.T) {
 		t.Errorf("Expected JSON '[]', got %q", body)
 	}
 }
+
+func TestGetDocument_ETag(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	_, _ = handler.storage.PutDocument("myapp", "settings", []byte(`{"theme": "dark"}`))
+
+	req := httptest.NewRequest(http.MethodGet, "/myapp/settings", nil)
+	req.SetPathValue("channel", "myapp")
+	req.SetPathValue("document", "settings")
+	w := httptest.NewRecorder()
+	handler.GetDocument(w, req)
+
+	tag := w.Header().Get("ETag")
+	if tag == "" || tag[0] != '"' {
+		t.Fatalf("Expected a strong ETag, got %q", tag)
+	}
+
+	// Changing the document changes the ETag
+	_, _ = handler.storage.PutDocument("myapp", "settings", []byte(`{"theme": "light"}`))
+	w = httptest.NewRecorder()
+	handler.GetDocument(w, req)
+	if w.Header().Get("ETag") == tag {
+		t.Error("Expected ETag to change after update")
+	}
+}
+
+func TestGetDocument_Gzip(t *testing.T) {
+	store, err := storage.NewBoltStorage(filepath.Join(t.TempDir(), "test.db"), storage.WithCompression(64))
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+	handler := NewHandler(store)
+
+	doc := `{"text": "` + strings.Repeat("compressible ", 100) + `"}`
+	_, _ = store.PutDocument("myapp", "large", []byte(doc))
+	_, _ = store.PutDocument("myapp", "small", []byte(`{"a": 1}`))
+
+	get := func(document, acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/myapp/"+document, nil)
+		req.SetPathValue("channel", "myapp")
+		req.SetPathValue("document", document)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		w := httptest.NewRecorder()
+		handler.GetDocument(w, req)
+		return w
+	}
+
+	plain := get("large", "")
+	if plain.Body.String() != doc || plain.Header().Get("Content-Encoding") != "" {
+		t.Fatalf("Expected plain document without Accept-Encoding")
+	}
+
+	gz := get("large", "br, gzip")
+	if gz.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Expected Content-Encoding gzip, got %q", gz.Header().Get("Content-Encoding"))
+	}
+	if tag := gz.Header().Get("ETag"); tag != representationTag(plain.Header().Get("ETag"), "gzip") {
+		t.Errorf("Expected a gzip ETag derived from the plain one, got %q", tag)
+	}
+	if vary := gz.Header().Values("Vary"); !slices.Contains(vary, "Accept-Encoding") {
+		t.Errorf("Expected Vary: Accept-Encoding, got %v", vary)
+	}
+	zr, err := gzip.NewReader(gz.Body)
+	if err != nil {
+		t.Fatalf("Invalid gzip body: %v", err)
+	}
+	body, _ := io.ReadAll(zr)
+	if string(body) != doc {
+		t.Errorf("Decompressed body does not match the document")
+	}
+
+	// Refused gzip and uncompressed documents are served plain
+	if w := get("large", "gzip;q=0"); w.Header().Get("Content-Encoding") != "" || w.Body.String() != doc {
+		t.Errorf("Expected plain document with gzip;q=0")
+	}
+	if w := get("small", "gzip"); w.Header().Get("Content-Encoding") != "" || w.Body.String() != `{"a": 1}` {
+		t.Errorf("Expected small document served plain")
+	}
+	if w := get("missing", "gzip"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404, got %d", w.Code)
+	}
+}
+
+func TestGetDocument_IfNoneMatch(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	_, _ = handler.storage.PutDocument("myapp", "settings", []byte(`{"theme": "dark"}`))
+
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/myapp/settings", nil)
+		req.SetPathValue("channel", "myapp")
+		req.SetPathValue("document", "settings")
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		handler.GetDocument(w, req)
+		return w
+	}
+
+	tag := get("").Header().Get("ETag")
+	w := get(tag)
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("Expected empty 304, got %d with %q", w.Code, w.Body.String())
+	}
+	if w.Header().Get("ETag") != tag {
+		t.Errorf("Expected ETag on 304 response")
+	}
+
+	_, _ = handler.storage.PutDocument("myapp", "settings", []byte(`{"theme": "light"}`))
+	if w := get(tag); w.Code != http.StatusOK || w.Body.String() != `{"theme": "light"}` {
+		t.Errorf("Expected changed document, got %d with %q", w.Code, w.Body.String())
+	}
+}
+
+func TestPatchDocument(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+	router := NewRouter(handler)
+
+	_, _ = handler.storage.PutDocument("myapp", "settings", []byte(`{"theme": "dark", "lang": "en"}`))
+	tag := etag([]byte(`{"theme": "dark", "lang": "en"}`))
+
+	patch := func(body, ifMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPatch, "/myapp/settings", strings.NewReader(body))
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := patch(`{"lang": null}`, `"stale"`); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected 412 for stale If-Match, got %d", w.Code)
+	}
+
+	w := patch(`{"lang": null, "size": 12}`, tag)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp model.SuccessResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Status != "updated" {
+		t.Errorf("Expected status updated, got %q", resp.Status)
+	}
+	data, _ := handler.storage.GetDocument("myapp", "settings")
+	if string(data) != `{"size":12,"theme":"dark"}` {
+		t.Errorf("Unexpected patched document %s", data)
+	}
+	if w.Header().Get("ETag") != etag(data) {
+		t.Errorf("Expected ETag of the patched document")
+	}
+
+	if w := patch(`{"a": 1}`, ""); w.Code != http.StatusOK {
+		t.Errorf("Expected unconditional patch to succeed, got %d", w.Code)
+	}
+	if w := patch(`{not json`, ""); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for invalid JSON, got %d", w.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodPatch, "/myapp/missing", strings.NewReader(`{}`))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for missing document, got %d", w.Code)
+	}
+}
+
+func TestPatchDocument_SchemaViolation(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+	router := NewRouter(handler)
+
+	putSchema(t, handler, "myapp", `{"type": "object", "properties": {"theme": {"enum": ["dark", "light"]}}}`)
+	_, _ = handler.storage.PutDocument("myapp", "settings", []byte(`{"theme": "dark"}`))
+
+	req := httptest.NewRequest(http.MethodPatch, "/myapp/settings", strings.NewReader(`{"theme": "blue"}`))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400, got %d", w.Code)
+	}
+	var resp model.ErrorResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Error != model.ErrCodeSchemaViolation || len(resp.Violations) == 0 {
+		t.Errorf("Expected schema violations, got %+v", resp)
+	}
+}
+
+func TestDeleteDocument(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+	router := NewRouter(handler)
+
+	_, _ = handler.storage.PutDocument("myapp", "settings", []byte(`{}`))
+
+	del := func(document, ifMatch string) int {
+		req := httptest.NewRequest(http.MethodDelete, "/myapp/"+document, nil)
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := del("settings", `"stale"`); code != http.StatusPreconditionFailed {
+		t.Errorf("Expected 412, got %d", code)
+	}
+	if code := del("settings", etag([]byte(`{}`))); code != http.StatusOK {
+		t.Errorf("Expected 200, got %d", code)
+	}
+	if _, err := handler.storage.GetDocument("myapp", "settings"); err != storage.ErrNotFound {
+		t.Errorf("Expected document to be deleted")
+	}
+	if code := del("settings", ""); code != http.StatusNotFound {
+		t.Errorf("Expected 404, got %d", code)
+	}
+	if code := del("bad.name", ""); code != http.StatusBadRequest {
+		t.Errorf("Expected 400, got %d", code)
+	}
+}
@@ -0,0 +1,201 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rashpile/pako-justdoc/internal/model"
+)
+
+// AuthOptions configures Authenticate
+type AuthOptions struct {
+	// APIKeys are the accepted API keys
+	APIKeys []string
+	// ClientPrincipals maps verified client certificate identities to
+	// principal names
+	ClientPrincipals map[string]string
+	// ShareLinks verifies the token query parameter of share links
+	ShareLinks *ShareLinks
+}
+
+// APIKeyPrincipal is the principal of requests authenticated by API key
+const APIKeyPrincipal = "api-key"
+
+type principalKey struct{}
+
+// Principal returns the principal a request was authenticated as, or ""
+// if authentication is disabled
+func Principal(r *http.Request) string {
+	p, _ := r.Context().Value(principalKey{}).(string)
+	return p
+}
+
+// Authenticate rejects requests that carry neither one of the API keys,
+// given as a bearer token, an X-API-Key header or a basic auth password
+// (so browsers can open the editor), nor a verified client certificate
+// for a mapped identity. A valid share link token in the token query
+// parameter grants reading its document and viewer page; an invalid or
+// expired one is rejected outright. Routes marked public, such as the OpenAPI spec
+// and static assets, are exempt.
+// With no keys and no principals, next is returned unchanged.
+func Authenticate(next http.Handler, opts AuthOptions) http.Handler {
+	if len(opts.APIKeys) == 0 && len(opts.ClientPrincipals) == 0 {
+		return next
+	}
+	// Compare digests so the comparison time doesn't depend on key length
+	sums := make([][sha256.Size]byte, len(opts.APIKeys))
+	for i, key := range opts.APIKeys {
+		sums[i] = sha256.Sum256([]byte(key))
+	}
+
+	public := publicPrefixes()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isPublic(public, r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		principal := certPrincipal(r, opts.ClientPrincipals)
+		if principal == "" && len(sums) > 0 {
+			sum := sha256.Sum256([]byte(requestKey(r)))
+			match := 0
+			for i := range sums {
+				match |= subtle.ConstantTimeCompare(sum[:], sums[i][:])
+			}
+			if match == 1 {
+				principal = APIKeyPrincipal
+			}
+		}
+		if token := r.URL.Query().Get("token"); principal == "" && token != "" && opts.ShareLinks != nil {
+			if !opts.ShareLinks.allows(r, token) {
+				writeError(w, http.StatusUnauthorized, model.ErrCodeUnauthorized, "The share link is invalid or has expired")
+				return
+			}
+			principal = SharePrincipal
+		}
+		if principal == "" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="justdoc"`)
+			writeError(w, http.StatusUnauthorized, model.ErrCodeUnauthorized, "A valid API key or client certificate is required")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, principal)))
+	})
+}
+
+// certPrincipal returns the principal mapped to the verified client
+// certificate of a request, or ""
+func certPrincipal(r *http.Request, principals map[string]string) string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(principals) == 0 {
+		return ""
+	}
+	for _, identity := range certIdentities(r.TLS.VerifiedChains[0][0]) {
+		if p, ok := principals[identity]; ok {
+			return p
+		}
+	}
+	return ""
+}
+
+// certIdentities lists the names a certificate identifies, common name first
+func certIdentities(cert *x509.Certificate) []string {
+	var ids []string
+	if cert.Subject.CommonName != "" {
+		ids = append(ids, cert.Subject.CommonName)
+	}
+	ids = append(ids, cert.DNSNames...)
+	ids = append(ids, cert.EmailAddresses...)
+	for _, u := range cert.URIs {
+		ids = append(ids, u.String())
+	}
+	return ids
+}
+
+// requestKey returns the API key sent with a request, or ""
+func requestKey(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if _, password, ok := r.BasicAuth(); ok {
+		return password
+	}
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+// CORSOptions configures cross-origin requests
+type CORSOptions struct {
+	// Origins are the allowed origins; "*" allows any, but only for
+	// requests without credentials
+	Origins []string
+	Methods []string
+	Headers []string
+	MaxAge  time.Duration
+}
+
+// CORS adds cross-origin headers for allowed origins and answers preflight
+// requests. It must wrap Authenticate, since browsers send preflights
+// without credentials. With no origins, next is returned unchanged.
+func CORS(next http.Handler, opts CORSOptions) http.Handler {
+	if len(opts.Origins) == 0 {
+		return next
+	}
+	methods := strings.Join(opts.Methods, ", ")
+	headers := strings.Join(opts.Headers, ", ")
+	maxAge := strconv.Itoa(int(opts.MaxAge.Seconds()))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		allow, credentials := allowedOrigin(opts.Origins, origin)
+		if origin == "" || allow == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h := w.Header()
+		h.Add("Vary", "Origin")
+		h.Set("Access-Control-Allow-Origin", allow)
+		if credentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+		h.Set("Access-Control-Expose-Headers", "ETag")
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+			h.Set("Access-Control-Allow-Methods", methods)
+			h.Set("Access-Control-Allow-Headers", headers)
+			h.Set("Access-Control-Max-Age", maxAge)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allowedOrigin returns the Access-Control-Allow-Origin value for origin
+// and whether the browser may send credentials with the request. Listed
+// origins are echoed with credentials; "*" is answered literally and
+// without them, so arbitrary sites can't make authenticated requests.
+func allowedOrigin(allowed []string, origin string) (string, bool) {
+	wildcard := false
+	for _, o := range allowed {
+		if o == "*" {
+			wildcard = true
+		} else if strings.EqualFold(o, origin) {
+			return origin, true
+		}
+	}
+	if wildcard {
+		return "*", false
+	}
+	return "", false
+}
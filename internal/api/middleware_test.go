@@ -0,0 +1,235 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rashpile/pako-justdoc/internal/model"
+	"github.com/rashpile/pako-justdoc/internal/storage"
+)
+
+func TestAuthenticate(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+	router := Authenticate(NewRouter(handler), AuthOptions{APIKeys: []string{"old-key", "new-key"}})
+
+	tests := []struct {
+		name   string
+		path   string
+		header map[string]string
+		basic  string
+		want   int
+	}{
+		{name: "missing", path: "/", want: http.StatusUnauthorized},
+		{name: "wrong bearer", path: "/", header: map[string]string{"Authorization": "Bearer nope"}, want: http.StatusUnauthorized},
+		{name: "bearer", path: "/", header: map[string]string{"Authorization": "Bearer new-key"}, want: http.StatusOK},
+		{name: "second key", path: "/", header: map[string]string{"Authorization": "Bearer old-key"}, want: http.StatusOK},
+		{name: "header", path: "/", header: map[string]string{"X-API-Key": "new-key"}, want: http.StatusOK},
+		{name: "basic password", path: "/", basic: "new-key", want: http.StatusOK},
+		{name: "prefix of key", path: "/", header: map[string]string{"X-API-Key": "new"}, want: http.StatusUnauthorized},
+		{name: "openapi is public", path: "/openapi.json", want: http.StatusOK},
+		{name: "static is public", path: "/_/static/editor.css", want: http.StatusOK},
+		{name: "editor is protected", path: "/_/edit/app/doc", want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			if tt.basic != "" {
+				req.SetBasicAuth("anyone", tt.basic)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Fatalf("expected status %d, got %d: %s", tt.want, w.Code, w.Body.String())
+			}
+			if tt.want != http.StatusUnauthorized {
+				return
+			}
+			if got := w.Header().Get("WWW-Authenticate"); got != `Basic realm="justdoc"` {
+				t.Errorf("unexpected WWW-Authenticate %q", got)
+			}
+			var resp model.ErrorResponse
+			_ = json.Unmarshal(w.Body.Bytes(), &resp)
+			if resp.Error != model.ErrCodeUnauthorized {
+				t.Errorf("expected error %q, got %q", model.ErrCodeUnauthorized, resp.Error)
+			}
+		})
+	}
+}
+
+func TestAuthenticate_ClientCertificate(t *testing.T) {
+	var got string
+	h := Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = Principal(r)
+	}), AuthOptions{
+		APIKeys:          []string{"key"},
+		ClientPrincipals: map[string]string{"backup-job": "backup", "spiffe://svc/web": "web"},
+	})
+
+	request := func(cert *x509.Certificate, key string) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if cert != nil {
+			req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		}
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		got = ""
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := request(&x509.Certificate{Subject: pkix.Name{CommonName: "backup-job"}}, ""); code != http.StatusOK || got != "backup" {
+		t.Errorf("common name: got %d, principal %q", code, got)
+	}
+	web, _ := url.Parse("spiffe://svc/web")
+	if code := request(&x509.Certificate{Subject: pkix.Name{CommonName: "x"}, URIs: []*url.URL{web}}, ""); code != http.StatusOK || got != "web" {
+		t.Errorf("URI name: got %d, principal %q", code, got)
+	}
+	if code := request(&x509.Certificate{Subject: pkix.Name{CommonName: "stranger"}}, ""); code != http.StatusUnauthorized {
+		t.Errorf("unmapped certificate: expected 401, got %d", code)
+	}
+	if code := request(&x509.Certificate{Subject: pkix.Name{CommonName: "stranger"}}, "key"); code != http.StatusOK || got != APIKeyPrincipal {
+		t.Errorf("API key with unmapped certificate: got %d, principal %q", code, got)
+	}
+}
+
+func TestAuthenticate_Disabled(t *testing.T) {
+	w := httptest.NewRecorder()
+	Authenticate(http.NotFoundHandler(), AuthOptions{}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected the request to pass through, got %d", w.Code)
+	}
+}
+
+func TestCORS(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+	router := CORS(Authenticate(NewRouter(handler), AuthOptions{APIKeys: []string{"key"}}), CORSOptions{
+		Origins: []string{"https://app.example.com"},
+		Methods: []string{"GET", "POST"},
+		Headers: []string{"Authorization", "Content-Type"},
+		MaxAge:  time.Minute,
+	})
+
+	t.Run("preflight", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodOptions, "/app/doc", nil)
+		req.Header.Set("Origin", "https://app.example.com")
+		req.Header.Set("Access-Control-Request-Method", "POST")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("expected 204, got %d", w.Code)
+		}
+		for name, want := range map[string]string{
+			"Access-Control-Allow-Origin":  "https://app.example.com",
+			"Access-Control-Allow-Methods": "GET, POST",
+			"Access-Control-Allow-Headers": "Authorization, Content-Type",
+			"Access-Control-Max-Age":       "60",
+		} {
+			if got := w.Header().Get(name); got != want {
+				t.Errorf("%s: expected %q, got %q", name, want, got)
+			}
+		}
+	})
+
+	t.Run("simple request", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Origin", "https://app.example.com")
+		req.Header.Set("Authorization", "Bearer key")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", w.Code)
+		}
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+			t.Errorf("unexpected Access-Control-Allow-Origin %q", got)
+		}
+		if got := w.Header().Get("Access-Control-Expose-Headers"); !strings.Contains(got, "ETag") {
+			t.Errorf("expected ETag to be exposed, got %q", got)
+		}
+	})
+
+	t.Run("other origin", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodOptions, "/app/doc", nil)
+		req.Header.Set("Origin", "https://evil.example.com")
+		req.Header.Set("Access-Control-Request-Method", "POST")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" {
+			t.Errorf("expected no CORS headers, got origin %q", got)
+		}
+	})
+}
+
+func TestCORS_Wildcard(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+	router := CORS(Authenticate(NewRouter(handler), AuthOptions{APIKeys: []string{"key"}}), CORSOptions{
+		Origins: []string{"*", "https://app.example.com"},
+		Methods: []string{"GET"},
+	})
+
+	tests := []struct {
+		origin      string
+		allow       string
+		credentials string
+	}{
+		{"https://evil.example.com", "*", ""},
+		{"https://app.example.com", "https://app.example.com", "true"},
+	}
+	for _, tt := range tests {
+		for _, method := range []string{http.MethodOptions, http.MethodGet} {
+			req := httptest.NewRequest(method, "/", nil)
+			req.Header.Set("Origin", tt.origin)
+			req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+			req.Header.Set("Authorization", "Bearer key")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.allow {
+				t.Errorf("%s %s: expected Access-Control-Allow-Origin %q, got %q", method, tt.origin, tt.allow, got)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Credentials"); got != tt.credentials {
+				t.Errorf("%s %s: expected Access-Control-Allow-Credentials %q, got %q", method, tt.origin, tt.credentials, got)
+			}
+		}
+	}
+}
+
+func TestWithMaxBodySize(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	defer func() { _ = store.Close() }()
+	handler := NewHandler(store, WithMaxBodySize(16))
+
+	req := httptest.NewRequest(http.MethodPost, "/app/doc", strings.NewReader(`{"value": "more than sixteen bytes"}`))
+	req.SetPathValue("channel", "app")
+	req.SetPathValue("document", "doc")
+	w := httptest.NewRecorder()
+	handler.PostDocument(w, req)
+
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413, got %d", w.Code)
+	}
+	var resp model.ErrorResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Message != "Request body exceeds 16 bytes limit" {
+		t.Errorf("unexpected message %q", resp.Message)
+	}
+}
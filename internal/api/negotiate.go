@@ -0,0 +1,155 @@
+package api
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/rashpile/pako-justdoc/internal/format"
+	"github.com/rashpile/pako-justdoc/internal/model"
+	"github.com/rashpile/pako-justdoc/internal/storage"
+)
+
+// responseFormats are the formats documents can be returned in, in order of
+// preference when Accept allows several equally
+var responseFormats = []string{format.JSON, format.YAML, format.MsgPack, format.CBOR}
+
+// formatNames name the formats in error messages
+var formatNames = map[string]string{
+	format.YAML:    "YAML",
+	format.MsgPack: "MessagePack",
+	format.CBOR:    "CBOR",
+}
+
+// formatTags name the formats in the ETags of converted documents
+var formatTags = map[string]string{
+	format.YAML:    "yaml",
+	format.MsgPack: "msgpack",
+	format.CBOR:    "cbor",
+}
+
+// readDocumentBody reads a document body, converting YAML, MessagePack and
+// CBOR to canonical JSON. Bodies without a Content-Type, or with a JSON or
+// form type as sent by curl -d, must be JSON. On failure it writes the error
+// response and returns false.
+func (h *Handler) readDocumentBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	mediaType, ok := requestFormat(r)
+	if !ok {
+		writeError(w, http.StatusUnsupportedMediaType, model.ErrCodeUnsupportedMediaType,
+			"Unsupported content type "+r.Header.Get("Content-Type")+"; send JSON, YAML, MessagePack or CBOR")
+		return nil, false
+	}
+	if mediaType == format.JSON {
+		return h.readJSONBody(w, r)
+	}
+
+	body, ok := h.readBody(w, r)
+	if !ok {
+		return nil, false
+	}
+	data, err := format.ToJSON(mediaType, body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, model.ErrCodeInvalidJSON, "Invalid "+formatNames[mediaType]+" body: "+err.Error())
+		return nil, false
+	}
+	// Binary formats can be smaller than the JSON they convert to
+	if int64(len(data)) > h.maxBodySize {
+		writeError(w, http.StatusRequestEntityTooLarge, model.ErrCodePayloadTooLarge, "Document exceeds "+formatSize(h.maxBodySize)+" limit")
+		return nil, false
+	}
+	return data, true
+}
+
+// requestFormat returns the format of a document body from its
+// Content-Type, or false if it isn't one the API accepts
+func requestFormat(r *http.Request) (string, bool) {
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		return format.JSON, true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", false
+	}
+	switch {
+	case mediaType == format.JSON, mediaType == "text/json", strings.HasSuffix(mediaType, "+json"),
+		mediaType == "text/plain", mediaType == "application/x-www-form-urlencoded":
+		return format.JSON, true
+	}
+	mediaType = format.MediaType(mediaType)
+	return mediaType, mediaType != ""
+}
+
+// responseFormat returns the format to return a document in, picking the
+// one the Accept header rates highest, or false if it allows none. Without
+// an Accept header documents are returned as JSON.
+func responseFormat(r *http.Request) (string, bool) {
+	accept := strings.Join(r.Header.Values("Accept"), ",")
+	if strings.TrimSpace(accept) == "" {
+		return format.JSON, true
+	}
+	best, bestQuality := "", 0.0
+	for _, mediaType := range responseFormats {
+		if q := acceptQuality(accept, mediaType); q > bestQuality {
+			best, bestQuality = mediaType, q
+		}
+	}
+	return best, best != ""
+}
+
+// acceptQuality returns the quality an Accept header gives a media type,
+// taken from the most specific range that matches it
+func acceptQuality(accept, mediaType string) float64 {
+	quality, specificity := 0.0, -1
+	for _, mediaRange := range strings.Split(accept, ",") {
+		name, params, _ := strings.Cut(mediaRange, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		s := -1
+		switch {
+		case name == mediaType, format.MediaType(name) == mediaType && mediaType != format.JSON:
+			s = 2
+		case name == "application/*":
+			s = 1
+		case name == "*/*":
+			s = 0
+		}
+		if s <= specificity {
+			continue
+		}
+		specificity, quality = s, 1
+		for _, param := range strings.Split(params, ";") {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				q, err := strconv.ParseFloat(v, 64)
+				if err != nil {
+					q = 0
+				}
+				quality = q
+			}
+		}
+	}
+	return quality
+}
+
+// getConvertedDocument writes a document converted from JSON to another
+// format. The ETag is derived from that of the JSON document, so it differs
+// per format but can be used with If-Match too.
+func (h *Handler) getConvertedDocument(w http.ResponseWriter, r *http.Request, mediaType, channel, document string, revision int) {
+	data, err := h.loadDocument(channel, document, revision)
+	if err == storage.ErrNotFound {
+		writeError(w, http.StatusNotFound, model.ErrCodeNotFound, "Document not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+		return
+	}
+
+	converted, err := format.FromJSON(mediaType, data)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to convert document")
+		return
+	}
+	writeDocument(w, r, converted, representationTag(etag(data), formatTags[mediaType]), mediaType)
+}
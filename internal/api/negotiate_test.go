@@ -0,0 +1,220 @@
+package api
+
+import (
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rashpile/pako-justdoc/internal/model"
+)
+
+func TestPostDocument_Formats(t *testing.T) {
+	// {"b":[true,null],"a":1.50}
+	msgpack, _ := hex.DecodeString("82a16292c3c0a161ca3fc00000")
+	cbor, _ := hex.DecodeString("a2616282f5f66161f93e00")
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        string
+	}{
+		{name: "yaml", contentType: "application/yaml", body: "b: [true, ~]\na: 1.50\n", want: `{"a":1.5,"b":[true,null]}`},
+		{name: "yaml alias", contentType: "text/yaml; charset=utf-8", body: "b: [true, ~]\na: 1.50\n", want: `{"a":1.5,"b":[true,null]}`},
+		{name: "msgpack", contentType: "application/msgpack", body: string(msgpack), want: `{"a":1.5,"b":[true,null]}`},
+		{name: "cbor", contentType: "application/cbor", body: string(cbor), want: `{"a":1.5,"b":[true,null]}`},
+		// JSON is stored as sent
+		{name: "json", contentType: "application/json", body: `{"b": [true, null], "a": 1.50}`, want: `{"b": [true, null], "a": 1.50}`},
+		{name: "form", contentType: "application/x-www-form-urlencoded", body: `{"a":1}`, want: `{"a":1}`},
+		{name: "merge patch", contentType: "application/merge-patch+json", body: `{"a":1}`, want: `{"a":1}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, cleanup := setupTestHandler(t)
+			defer cleanup()
+
+			req := httptest.NewRequest(http.MethodPost, "/myapp/settings", strings.NewReader(tt.body))
+			req.SetPathValue("channel", "myapp")
+			req.SetPathValue("document", "settings")
+			req.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+			handler.PostDocument(w, req)
+
+			if w.Code != http.StatusCreated {
+				t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+			}
+			data, err := handler.storage.GetDocument("myapp", "settings")
+			if err != nil {
+				t.Fatalf("GetDocument failed: %v", err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("Expected stored %s, got %s", tt.want, data)
+			}
+		})
+	}
+}
+
+func TestPostDocument_FormatErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantStatus  int
+		wantCode    string
+	}{
+		{name: "unsupported", contentType: "application/xml", body: "<a/>", wantStatus: http.StatusUnsupportedMediaType, wantCode: model.ErrCodeUnsupportedMediaType},
+		{name: "malformed", contentType: "application/json;;", body: `{}`, wantStatus: http.StatusUnsupportedMediaType, wantCode: model.ErrCodeUnsupportedMediaType},
+		{name: "bad yaml", contentType: "application/yaml", body: "a: [1", wantStatus: http.StatusBadRequest, wantCode: model.ErrCodeInvalidJSON},
+		{name: "truncated msgpack", contentType: "application/msgpack", body: "\x92\xc0", wantStatus: http.StatusBadRequest, wantCode: model.ErrCodeInvalidJSON},
+		{name: "too large once converted", contentType: "application/msgpack", body: "\xdc\x00\x1e" + strings.Repeat("\xc0", 30), wantStatus: http.StatusRequestEntityTooLarge, wantCode: model.ErrCodePayloadTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, cleanup := setupTestHandler(t)
+			defer cleanup()
+			// 30 nulls are 33 bytes of MessagePack but 151 of JSON
+			handler.maxBodySize = 100
+
+			req := httptest.NewRequest(http.MethodPost, "/myapp/settings", strings.NewReader(tt.body))
+			req.SetPathValue("channel", "myapp")
+			req.SetPathValue("document", "settings")
+			req.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+			handler.PostDocument(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), `"`+tt.wantCode+`"`) {
+				t.Errorf("Expected error %s, got %s", tt.wantCode, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestGetDocument_Accept(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	doc := `{"theme": "dark", "size": 14}`
+	_, _ = handler.storage.PutDocument("myapp", "settings", []byte(doc))
+
+	get := func(accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/myapp/settings", nil)
+		req.SetPathValue("channel", "myapp")
+		req.SetPathValue("document", "settings")
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		w := httptest.NewRecorder()
+		handler.GetDocument(w, req)
+		return w
+	}
+
+	plain := get("")
+	tests := []struct {
+		accept      string
+		contentType string
+		body        string
+		tag         string
+	}{
+		{accept: "*/*", contentType: "application/json", body: doc},
+		{accept: "application/json, application/yaml", contentType: "application/json", body: doc},
+		{accept: "application/yaml", contentType: "application/yaml", body: "theme: dark\nsize: 14\n", tag: "yaml"},
+		{accept: "application/x-yaml", contentType: "application/yaml", body: "theme: dark\nsize: 14\n", tag: "yaml"},
+		{accept: "application/json;q=0.5, application/yaml", contentType: "application/yaml", body: "theme: dark\nsize: 14\n", tag: "yaml"},
+		{accept: "application/*;q=0.2, application/msgpack;q=0.9", contentType: "application/msgpack", body: "\x82\xa5theme\xa4dark\xa4size\x0e", tag: "msgpack"},
+		{accept: "application/cbor", contentType: "application/cbor", body: "\xa2\x65theme\x64dark\x64size\x0e", tag: "cbor"},
+		{accept: "text/html, */*;q=0.1", contentType: "application/json", body: doc},
+	}
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			w := get(tt.accept)
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+			}
+			if got := w.Header().Get("Content-Type"); got != tt.contentType {
+				t.Errorf("Expected Content-Type %s, got %s", tt.contentType, got)
+			}
+			if w.Body.String() != tt.body {
+				t.Errorf("Expected body %q, got %q", tt.body, w.Body.String())
+			}
+			if got, want := w.Header().Get("ETag"), representationTag(plain.Header().Get("ETag"), tt.tag); got != want {
+				t.Errorf("Expected ETag %s, got %s", want, got)
+			}
+			if w.Header().Get("Vary") != "Accept" {
+				t.Errorf("Expected Vary: Accept, got %q", w.Header().Get("Vary"))
+			}
+		})
+	}
+
+	for _, accept := range []string{"text/html", "application/xml", "application/json;q=0, */*;q=0"} {
+		if w := get(accept); w.Code != http.StatusNotAcceptable {
+			t.Errorf("%s: expected status %d, got %d", accept, http.StatusNotAcceptable, w.Code)
+		}
+	}
+}
+
+func TestGetDocument_AcceptIfNoneMatch(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	_, _ = handler.storage.PutDocument("myapp", "settings", []byte(`{"a": 1}`))
+
+	req := httptest.NewRequest(http.MethodGet, "/myapp/settings", nil)
+	req.SetPathValue("channel", "myapp")
+	req.SetPathValue("document", "settings")
+	req.Header.Set("Accept", "application/cbor")
+	w := httptest.NewRecorder()
+	handler.GetDocument(w, req)
+
+	req.Header.Set("If-None-Match", w.Header().Get("ETag"))
+	w = httptest.NewRecorder()
+	handler.GetDocument(w, req)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("Expected status %d, got %d", http.StatusNotModified, w.Code)
+	}
+}
+
+func TestGetDocument_RepresentationETags(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+	router := NewRouter(handler)
+
+	_, _ = handler.storage.PutDocument("myapp", "settings", []byte(`{"a": 1}`))
+
+	do := func(method, url string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, strings.NewReader(`{"a": 2}`))
+		for i := 0; i < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	jsonTag := do(http.MethodGet, "/myapp/settings").Header().Get("ETag")
+	yamlTag := do(http.MethodGet, "/myapp/settings", "Accept", "application/yaml").Header().Get("ETag")
+	prettyTag := do(http.MethodGet, "/myapp/settings?pretty=true").Header().Get("ETag")
+	if jsonTag == yamlTag || jsonTag == prettyTag || yamlTag == prettyTag {
+		t.Fatalf("Expected a different ETag per representation, got %s, %s and %s", jsonTag, yamlTag, prettyTag)
+	}
+
+	// The tag of one representation doesn't validate a cached copy of another
+	if w := do(http.MethodGet, "/myapp/settings", "Accept", "application/yaml", "If-None-Match", jsonTag); w.Code != http.StatusOK {
+		t.Errorf("Expected status %d for another representation's tag, got %d", http.StatusOK, w.Code)
+	}
+	if w := do(http.MethodGet, "/myapp/settings", "Accept", "application/yaml", "If-None-Match", yamlTag); w.Code != http.StatusNotModified {
+		t.Errorf("Expected status %d for the YAML tag, got %d", http.StatusNotModified, w.Code)
+	}
+
+	// Any of them can be used to update the document
+	if w := do(http.MethodPatch, "/myapp/settings", "If-Match", yamlTag); w.Code != http.StatusOK {
+		t.Fatalf("Expected If-Match with the YAML tag to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodPatch, "/myapp/settings", "If-Match", prettyTag); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected a stale pretty tag to fail with %d, got %d", http.StatusPreconditionFailed, w.Code)
+	}
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/rashpile/pako-justdoc/internal/format"
+)
+
+// normalizes reports whether documents written to channel are stored as
+// canonical JSON, according to the channel settings
+func (h *Handler) normalizes(channel string) (bool, error) {
+	settings, err := h.channelSettings(channel)
+	return settings.Normalize, err
+}
+
+// normalizeDocument returns data as canonical JSON (RFC 8785) if normalize
+// is set, and unchanged otherwise. Canonical JSON has sorted keys, no
+// whitespace and numbers formatted like JavaScript, so equal documents are
+// stored byte for byte the same and get the same ETag.
+func normalizeDocument(data []byte, normalize bool) ([]byte, error) {
+	if !normalize {
+		return data, nil
+	}
+	return format.Canonicalize(data)
+}
+
+// prettyParam reads the pretty query parameter, reporting false if it
+// isn't a boolean
+func prettyParam(r *http.Request) (pretty, ok bool) {
+	v := r.URL.Query().Get("pretty")
+	if v == "" {
+		return false, true
+	}
+	pretty, err := strconv.ParseBool(v)
+	return pretty, err == nil
+}
+
+// indentDocument re-indents a stored JSON document for reading
+func indentDocument(data []byte) []byte {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, data, "", "  "); err != nil {
+		return data
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
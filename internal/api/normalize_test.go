@@ -0,0 +1,101 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rashpile/pako-justdoc/internal/storage"
+)
+
+func TestNormalizedChannels(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	defer func() { _ = store.Close() }()
+	handler := NewHandler(store, WithNormalizedChannels("app"))
+
+	// Equal documents are stored the same however they are written
+	postDocument(t, handler, "app", "a", "{\n  \"b\": [1.0, 1e2],\n  \"a\": \"x\"\n}")
+	postDocument(t, handler, "app", "b", `{"a":"x","b":[1,100]}`)
+	postDocument(t, handler, "other", "a", `{"b": 1.0, "a": "x"}`)
+	_, _ = postBatch(t, handler, `[{"op": "put", "channel": "app", "document": "c", "value": {"z": 0.50, "a": {"y": 1, "x": 2}}}]`)
+	_, _ = postBatch(t, handler, `[{"op": "patch", "channel": "app", "document": "b", "value": {"c": 2E0}}]`)
+	body := `{"name": "d", "doc": {"b": 1, "a": 2}}` + "\n"
+	if w, _ := importChannel(t, handler, "app", "", "application/x-ndjson", []byte(body)); w.Code != http.StatusOK {
+		t.Fatalf("Import failed with status %d: %s", w.Code, w.Body.String())
+	}
+
+	tests := []struct {
+		channel  string
+		document string
+		want     string
+	}{
+		{"app", "a", `{"a":"x","b":[1,100]}`},
+		{"app", "b", `{"a":"x","b":[1,100],"c":2}`},
+		{"app", "c", `{"a":{"x":2,"y":1},"z":0.5}`},
+		{"app", "d", `{"a":2,"b":1}`},
+		{"other", "a", `{"b": 1.0, "a": "x"}`},
+	}
+	for _, tt := range tests {
+		data, err := store.GetDocument(tt.channel, tt.document)
+		if err != nil {
+			t.Fatalf("GetDocument %s/%s failed: %v", tt.channel, tt.document, err)
+		}
+		if string(data) != tt.want {
+			t.Errorf("%s/%s: expected %s, got %s", tt.channel, tt.document, tt.want, data)
+		}
+	}
+}
+
+func TestNormalizedChannels_All(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	defer func() { _ = store.Close() }()
+	handler := NewHandler(store, WithNormalizedChannels("*"))
+
+	postDocument(t, handler, "any", "doc", `{"b": 1, "a": 2}`)
+	if data, _ := store.GetDocument("any", "doc"); string(data) != `{"a":2,"b":1}` {
+		t.Errorf("Expected normalized document, got %s", data)
+	}
+
+	// Documents that have no canonical form are rejected
+	w := postDocument(t, handler, "any", "dup", `{"a": 1, "a": 2}`)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "normalized") {
+		t.Errorf("Expected status %d for duplicate keys, got %d: %s", http.StatusBadRequest, w.Code, w.Body.String())
+	}
+	_, resp := postBatch(t, handler, `[{"op": "put", "channel": "any", "document": "big", "value": [1e999]}]`)
+	if resp.Status != "aborted" {
+		t.Errorf("Expected batch with an out of range number to abort, got %q", resp.Status)
+	}
+}
+
+func TestGetDocument_Pretty(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	_, _ = handler.storage.PutDocument("myapp", "settings", []byte(`{"theme":"dark","sizes":[1,2]}`))
+
+	get := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/myapp/settings"+query, nil)
+		req.SetPathValue("channel", "myapp")
+		req.SetPathValue("document", "settings")
+		w := httptest.NewRecorder()
+		handler.GetDocument(w, req)
+		return w
+	}
+
+	plain := get("")
+	pretty := get("?pretty=true")
+	want := "{\n  \"theme\": \"dark\",\n  \"sizes\": [\n    1,\n    2\n  ]\n}\n"
+	if pretty.Body.String() != want {
+		t.Errorf("Expected indented document %q, got %q", want, pretty.Body.String())
+	}
+	if tag := pretty.Header().Get("ETag"); tag != representationTag(plain.Header().Get("ETag"), "pretty") {
+		t.Errorf("Expected a pretty ETag derived from the plain one, got %q", tag)
+	}
+	if w := get("?pretty=false"); w.Body.String() != plain.Body.String() {
+		t.Errorf("Expected pretty=false to return the document as stored, got %q", w.Body.String())
+	}
+	if w := get("?pretty=yes"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for an invalid pretty value, got %d", http.StatusBadRequest, w.Code)
+	}
+}
@@ -1,374 +1,435 @@
 package api
 
-import "net/http"
-
-// OpenAPISpec is the OpenAPI 3.0 specification for JustDoc API
-const OpenAPISpec = `{
-  "openapi": "3.0.3",
-  "info": {
-    "title": "JustDoc API",
-    "description": "Simple JSON document storage API for frontend developers",
-    "version": "1.0.0",
-    "contact": {
-      "name": "JustDoc"
-    },
-    "license": {
-      "name": "MIT"
-    }
-  },
-  "servers": [
-    {
-      "url": "/",
-      "description": "Current server"
-    }
-  ],
-  "paths": {
-    "/": {
-      "get": {
-        "summary": "List all channels",
-        "description": "Returns a list of all channels with document counts",
-        "operationId": "listChannels",
-        "tags": ["Channels"],
-        "responses": {
-          "200": {
-            "description": "List of channels retrieved successfully",
-            "content": {
-              "application/json": {
-                "schema": {
-                  "type": "array",
-                  "items": {
-                    "$ref": "#/components/schemas/ChannelInfo"
-                  }
-                },
-                "example": [
-                  {
-                    "name": "app-config",
-                    "document_count": 3
-                  },
-                  {
-                    "name": "user-data",
-                    "document_count": 12
-                  }
-                ]
-              }
-            }
-          }
-        }
-      }
-    },
-    "/{channel}/": {
-      "get": {
-        "summary": "List documents in a channel",
-        "description": "Returns a list of all document names in the specified channel",
-        "operationId": "listDocuments",
-        "tags": ["Channels"],
-        "parameters": [
-          {
-            "name": "channel",
-            "in": "path",
-            "required": true,
-            "description": "Channel name (alphanumeric, hyphens, underscores, max 128 chars)",
-            "schema": {
-              "type": "string",
-              "pattern": "^[a-zA-Z0-9_-]{1,128}$"
-            }
-          }
-        ],
-        "responses": {
-          "200": {
-            "description": "List of documents retrieved successfully",
-            "content": {
-              "application/json": {
-                "schema": {
-                  "type": "array",
-                  "items": {
-                    "type": "string"
-                  }
-                },
-                "example": ["config", "settings", "user-preferences"]
-              }
-            }
-          },
-          "400": {
-            "description": "Invalid channel name",
-            "content": {
-              "application/json": {
-                "schema": {
-                  "$ref": "#/components/schemas/ErrorResponse"
-                },
-                "example": {
-                  "error": "invalid_name",
-                  "message": "Invalid channel name"
-                }
-              }
-            }
-          },
-          "404": {
-            "description": "Channel not found",
-            "content": {
-              "application/json": {
-                "schema": {
-                  "$ref": "#/components/schemas/ErrorResponse"
-                },
-                "example": {
-                  "error": "not_found",
-                  "message": "Channel not found"
-                }
-              }
-            }
-          }
-        }
-      }
-    },
-    "/{channel}/{document}": {
-      "get": {
-        "summary": "Retrieve a document",
-        "description": "Retrieves a stored JSON document from the specified channel",
-        "operationId": "getDocument",
-        "tags": ["Documents"],
-        "parameters": [
-          {
-            "name": "channel",
-            "in": "path",
-            "required": true,
-            "description": "Channel name (alphanumeric, hyphens, underscores, max 128 chars)",
-            "schema": {
-              "type": "string",
-              "pattern": "^[a-zA-Z0-9_-]{1,128}$"
-            }
-          },
-          {
-            "name": "document",
-            "in": "path",
-            "required": true,
-            "description": "Document name (alphanumeric, hyphens, underscores, max 128 chars)",
-            "schema": {
-              "type": "string",
-              "pattern": "^[a-zA-Z0-9_-]{1,128}$"
-            }
-          }
-        ],
-        "responses": {
-          "200": {
-            "description": "Document retrieved successfully",
-            "content": {
-              "application/json": {
-                "schema": {
-                  "type": "object",
-                  "additionalProperties": true
-                }
-              }
-            }
-          },
-          "400": {
-            "description": "Invalid channel or document name",
-            "content": {
-              "application/json": {
-                "schema": {
-                  "$ref": "#/components/schemas/ErrorResponse"
-                },
-                "example": {
-                  "error": "invalid_name",
-                  "message": "Invalid channel or document name"
-                }
-              }
-            }
-          },
-          "404": {
-            "description": "Document not found",
-            "content": {
-              "application/json": {
-                "schema": {
-                  "$ref": "#/components/schemas/ErrorResponse"
-                },
-                "example": {
-                  "error": "not_found",
-                  "message": "Document not found"
-                }
-              }
-            }
-          }
-        }
-      },
-      "post": {
-        "summary": "Store or update a document",
-        "description": "Stores a JSON document in the specified channel. Creates the channel if it doesn't exist. Returns 201 for new documents, 200 for updates.",
-        "operationId": "postDocument",
-        "tags": ["Documents"],
-        "parameters": [
-          {
-            "name": "channel",
-            "in": "path",
-            "required": true,
-            "description": "Channel name (alphanumeric, hyphens, underscores, max 128 chars)",
-            "schema": {
-              "type": "string",
-              "pattern": "^[a-zA-Z0-9_-]{1,128}$"
-            }
-          },
-          {
-            "name": "document",
-            "in": "path",
-            "required": true,
-            "description": "Document name (alphanumeric, hyphens, underscores, max 128 chars)",
-            "schema": {
-              "type": "string",
-              "pattern": "^[a-zA-Z0-9_-]{1,128}$"
-            }
-          }
-        ],
-        "requestBody": {
-          "required": true,
-          "description": "JSON document to store (max 10MB)",
-          "content": {
-            "application/json": {
-              "schema": {
-                "type": "object",
-                "additionalProperties": true
-              }
-            }
-          }
-        },
-        "responses": {
-          "200": {
-            "description": "Document updated successfully",
-            "content": {
-              "application/json": {
-                "schema": {
-                  "$ref": "#/components/schemas/SuccessResponse"
-                },
-                "example": {
-                  "status": "updated",
-                  "channel": "myapp",
-                  "document": "settings"
-                }
-              }
-            }
-          },
-          "201": {
-            "description": "Document created successfully",
-            "content": {
-              "application/json": {
-                "schema": {
-                  "$ref": "#/components/schemas/SuccessResponse"
-                },
-                "example": {
-                  "status": "created",
-                  "channel": "myapp",
-                  "document": "settings"
-                }
-              }
-            }
-          },
-          "400": {
-            "description": "Invalid request (bad JSON or invalid name)",
-            "content": {
-              "application/json": {
-                "schema": {
-                  "$ref": "#/components/schemas/ErrorResponse"
-                },
-                "examples": {
-                  "invalid_json": {
-                    "value": {
-                      "error": "invalid_json",
-                      "message": "Invalid JSON body"
-                    }
-                  },
-                  "invalid_name": {
-                    "value": {
-                      "error": "invalid_name",
-                      "message": "Invalid channel or document name"
-                    }
-                  }
-                }
-              }
-            }
-          },
-          "413": {
-            "description": "Payload too large (exceeds 10MB)",
-            "content": {
-              "application/json": {
-                "schema": {
-                  "$ref": "#/components/schemas/ErrorResponse"
-                },
-                "example": {
-                  "error": "payload_too_large",
-                  "message": "Request body exceeds 10MB limit"
-                }
-              }
-            }
-          }
-        }
-      }
-    }
-  },
-  "components": {
-    "schemas": {
-      "ChannelInfo": {
-        "type": "object",
-        "required": ["name", "document_count"],
-        "properties": {
-          "name": {
-            "type": "string",
-            "description": "Channel name"
-          },
-          "document_count": {
-            "type": "integer",
-            "description": "Number of documents in the channel"
-          }
-        }
-      },
-      "SuccessResponse": {
-        "type": "object",
-        "required": ["status", "channel", "document"],
-        "properties": {
-          "status": {
-            "type": "string",
-            "enum": ["created", "updated"],
-            "description": "Operation result"
-          },
-          "channel": {
-            "type": "string",
-            "description": "Channel name"
-          },
-          "document": {
-            "type": "string",
-            "description": "Document name"
-          }
-        }
-      },
-      "ErrorResponse": {
-        "type": "object",
-        "required": ["error", "message"],
-        "properties": {
-          "error": {
-            "type": "string",
-            "enum": ["invalid_json", "invalid_name", "not_found", "payload_too_large"],
-            "description": "Error code"
-          },
-          "message": {
-            "type": "string",
-            "description": "Human-readable error message"
-          }
-        }
-      }
-    }
-  },
-  "tags": [
-    {
-      "name": "Channels",
-      "description": "Channel and document listing operations"
-    },
-    {
-      "name": "Documents",
-      "description": "Document storage operations"
-    }
-  ]
-}`
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rashpile/pako-justdoc/internal/format"
+	"github.com/rashpile/pako-justdoc/internal/model"
+)
+
+// SpecVersion is the version of the API described by the OpenAPI spec.
+// Bump the minor version when endpoints or fields are added and the major
+// version for incompatible changes.
+const SpecVersion = "1.8.0"
+
+var (
+	specOnce sync.Once
+	specJSON []byte
+)
+
+// OpenAPISpec returns the OpenAPI 3.0 specification generated from the
+// routes and the model types
+func OpenAPISpec() []byte {
+	specOnce.Do(func() {
+		data, err := json.MarshalIndent(buildSpec(apiRoutes()), "", "  ")
+		if err != nil {
+			panic(err)
+		}
+		specJSON = append(data, '\n')
+	})
+	return specJSON
+}
 
 // OpenAPI serves the OpenAPI specification
 func OpenAPI(w http.ResponseWriter, _ *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	_, _ = w.Write([]byte(OpenAPISpec))
+	_, _ = w.Write(OpenAPISpec())
+}
+
+type spec struct {
+	OpenAPI    string                           `json:"openapi"`
+	Info       specInfo                         `json:"info"`
+	Servers    []specServer                     `json:"servers"`
+	Security   []map[string][]string            `json:"security"`
+	Paths      map[string]map[string]*operation `json:"paths"`
+	Components components                       `json:"components"`
+	Tags       []specTag                        `json:"tags"`
+}
+
+type specInfo struct {
+	Title       string            `json:"title"`
+	Description string            `json:"description"`
+	Version     string            `json:"version"`
+	Contact     map[string]string `json:"contact"`
+	License     map[string]string `json:"license"`
+}
+
+type specServer struct {
+	URL         string `json:"url"`
+	Description string `json:"description"`
+}
+
+type specTag struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type components struct {
+	SecuritySchemes map[string]securityScheme `json:"securitySchemes"`
+	Parameters      map[string]*parameter     `json:"parameters"`
+	Responses       map[string]*response      `json:"responses"`
+	Schemas         map[string]*schema        `json:"schemas"`
+}
+
+type securityScheme struct {
+	Type        string `json:"type"`
+	Scheme      string `json:"scheme,omitempty"`
+	In          string `json:"in,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// operation documents one method of a path
+type operation struct {
+	Summary     string                 `json:"summary"`
+	Description string                 `json:"description,omitempty"`
+	OperationID string                 `json:"operationId"`
+	Tags        []string               `json:"tags"`
+	Security    *[]map[string][]string `json:"security,omitempty"`
+	Parameters  []*parameter           `json:"parameters,omitempty"`
+	RequestBody *requestBody           `json:"requestBody,omitempty"`
+	Responses   map[string]*response   `json:"responses"`
+}
+
+type parameter struct {
+	Ref         string  `json:"$ref,omitempty"`
+	Name        string  `json:"name,omitempty"`
+	In          string  `json:"in,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Description string  `json:"description,omitempty"`
+	Schema      *schema `json:"schema,omitempty"`
+	Example     any     `json:"example,omitempty"`
+}
+
+type requestBody struct {
+	Required    bool                  `json:"required"`
+	Description string                `json:"description,omitempty"`
+	Content     map[string]*mediaType `json:"content"`
+}
+
+type response struct {
+	Ref         string                `json:"$ref,omitempty"`
+	Description string                `json:"description,omitempty"`
+	Headers     map[string]*header    `json:"headers,omitempty"`
+	Content     map[string]*mediaType `json:"content,omitempty"`
+}
+
+type header struct {
+	Description string  `json:"description"`
+	Schema      *schema `json:"schema"`
+}
+
+type mediaType struct {
+	Schema  *schema `json:"schema"`
+	Example any     `json:"example,omitempty"`
+}
+
+type schema struct {
+	Ref                  string     `json:"$ref,omitempty"`
+	Type                 string     `json:"type,omitempty"`
+	Format               string     `json:"format,omitempty"`
+	Description          string     `json:"description,omitempty"`
+	Enum                 []string   `json:"enum,omitempty"`
+	Pattern              string     `json:"pattern,omitempty"`
+	Default              any        `json:"default,omitempty"`
+	Items                *schema    `json:"items,omitempty"`
+	Required             []string   `json:"required,omitempty"`
+	Properties           properties `json:"properties,omitempty"`
+	AdditionalProperties any        `json:"additionalProperties,omitempty"`
+}
+
+// properties keeps object properties in struct field order
+type properties []property
+
+type property struct {
+	name   string
+	schema *schema
+}
+
+func (p properties) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, prop := range p {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, _ := json.Marshal(prop.name)
+		value, err := json.Marshal(prop.schema)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// specBuilder collects the component schemas referenced by operations
+type specBuilder struct {
+	schemas map[string]*schema
+}
+
+// buildSpec generates the specification for the given routes
+func buildSpec(rs []route) *spec {
+	b := &specBuilder{schemas: make(map[string]*schema)}
+	s := &spec{
+		OpenAPI: "3.0.3",
+		Info: specInfo{
+			Title:       "JustDoc API",
+			Description: "Simple JSON document storage API for frontend developers",
+			Version:     SpecVersion,
+			Contact:     map[string]string{"name": "JustDoc"},
+			License:     map[string]string{"name": "MIT"},
+		},
+		Servers: []specServer{{URL: "/", Description: "Current server"}},
+		Security: []map[string][]string{
+			{},
+			{"bearerAuth": {}},
+			{"apiKeyHeader": {}},
+			{"basicAuth": {}},
+		},
+		Paths: make(map[string]map[string]*operation),
+		Components: components{
+			SecuritySchemes: map[string]securityScheme{
+				"bearerAuth": {
+					Type:        "http",
+					Scheme:      "bearer",
+					Description: "API key sent as a bearer token. Required on every non-public endpoint when the server has API keys or client principals configured; otherwise requests fail with 401 unauthorized.",
+				},
+				"apiKeyHeader": {Type: "apiKey", In: "header", Name: "X-API-Key"},
+				"basicAuth": {
+					Type:        "http",
+					Scheme:      "basic",
+					Description: "API key sent as the password; the user name is ignored",
+				},
+				"shareToken": {
+					Type: "apiKey", In: "query", Name: "token",
+					Description: "Token of a share link created with POST /_/share; grants reading one document and its viewer page until it expires",
+				},
+			},
+			Parameters: map[string]*parameter{
+				"Channel":  pathParam("channel", "Channel name (alphanumeric, hyphens, underscores, max 128 chars); new channels can't start with an underscore"),
+				"Document": pathParam("document", "Document name (alphanumeric, hyphens, underscores, max 128 chars); new documents can't start with an underscore"),
+				"Attachment": {
+					Name:        "name",
+					In:          "path",
+					Required:    true,
+					Description: "Attachment name (alphanumeric, hyphens, underscores and dots, not starting with a dot, max 128 chars)",
+					Schema:      &schema{Type: "string", Pattern: model.AttachmentNamePattern},
+				},
+			},
+			Responses: map[string]*response{
+				"Unauthorized":  b.errorResponse("Authentication is configured and the request has no valid API key or client certificate"),
+				"InternalError": b.errorResponse("Storage or server failure"),
+			},
+		},
+		Tags: []specTag{
+			{Name: "Channels", Description: "Channel and document listing operations"},
+			{Name: "Documents", Description: "Document storage operations"},
+			{Name: "Schemas", Description: "Per-channel JSON Schema validation"},
+			{Name: "Attachments", Description: "Binary files stored alongside documents"},
+			{Name: "Admin", Description: "Database maintenance operations"},
+			{Name: "UI", Description: "Browser user interface and its assets"},
+		},
+	}
+
+	for _, rt := range rs {
+		op := rt.doc(b)
+		if rt.public {
+			op.Security = &[]map[string][]string{}
+		} else if rt.shared {
+			security := append(slices.Clone(s.Security), map[string][]string{"shareToken": {}})
+			op.Security = &security
+		}
+		if !rt.public {
+			op.Responses["401"] = &response{Ref: "#/components/responses/Unauthorized"}
+		}
+		if _, ok := op.Responses["500"]; !ok && !rt.public {
+			op.Responses["500"] = &response{Ref: "#/components/responses/InternalError"}
+		}
+
+		path := rt.specPath()
+		if s.Paths[path] == nil {
+			s.Paths[path] = make(map[string]*operation)
+		}
+		s.Paths[path][strings.ToLower(rt.method)] = op
+	}
+
+	if e, ok := b.schemas["ErrorResponse"]; ok {
+		for _, p := range e.Properties {
+			if p.name == "error" {
+				p.schema.Enum = model.ErrorCodes
+			}
+		}
+	}
+	s.Components.Schemas = b.schemas
+	return s
+}
+
+var (
+	rawMessageType = reflect.TypeOf(json.RawMessage(nil))
+	timeType       = reflect.TypeOf(time.Time{})
+)
+
+// ref returns the schema of v's type. Named structs become components
+// and are referenced; json, doc and enum struct tags describe fields.
+func (b *specBuilder) ref(v any) *schema {
+	return b.schemaOf(reflect.TypeOf(v))
+}
+
+func (b *specBuilder) schemaOf(t reflect.Type) *schema {
+	switch t {
+	case rawMessageType:
+		return &schema{}
+	case timeType:
+		return &schema{Type: "string", Format: "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return b.schemaOf(t.Elem())
+	case reflect.String:
+		return &schema{Type: "string"}
+	case reflect.Bool:
+		return &schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &schema{Type: "array", Items: b.schemaOf(t.Elem())}
+	case reflect.Map:
+		s := &schema{Type: "object", AdditionalProperties: true}
+		if elem := b.schemaOf(t.Elem()); elem.Type != "" || elem.Ref != "" {
+			s.AdditionalProperties = elem
+		}
+		return s
+	case reflect.Struct:
+		return b.structRef(t)
+	default:
+		return &schema{}
+	}
+}
+
+func (b *specBuilder) structRef(t reflect.Type) *schema {
+	ref := &schema{Ref: "#/components/schemas/" + t.Name()}
+	if _, ok := b.schemas[t.Name()]; ok {
+		return ref
+	}
+	s := &schema{Type: "object"}
+	b.schemas[t.Name()] = s
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		prop := b.schemaOf(f.Type)
+		if doc := f.Tag.Get("doc"); doc != "" && prop.Ref == "" {
+			prop.Description = doc
+		}
+		if enum := f.Tag.Get("enum"); enum != "" {
+			prop.Enum = strings.Split(enum, ",")
+		}
+		s.Properties = append(s.Properties, property{name: name, schema: prop})
+		if !strings.Contains(opts, "omitempty") && !strings.Contains(opts, "omitzero") {
+			s.Required = append(s.Required, name)
+		}
+	}
+	return ref
+}
+
+// jsonResponse describes a JSON response with v's schema
+func (b *specBuilder) jsonResponse(description string, v any) *response {
+	return &response{
+		Description: description,
+		Content:     map[string]*mediaType{"application/json": {Schema: b.ref(v)}},
+	}
+}
+
+// errorResponse describes an ErrorResponse
+func (b *specBuilder) errorResponse(description string) *response {
+	return b.jsonResponse(description, model.ErrorResponse{})
+}
+
+// withExample sets the example of every media type of r
+func withExample(r *response, example any) *response {
+	for _, m := range r.Content {
+		m.Example = example
+	}
+	return r
+}
+
+// withHeader adds a response header
+func withHeader(r *response, name, description string) *response {
+	if r.Headers == nil {
+		r.Headers = make(map[string]*header)
+	}
+	r.Headers[name] = &header{Description: description, Schema: &schema{Type: "string"}}
+	return r
+}
+
+// documentSchema is any JSON document
+func documentSchema() *schema {
+	return &schema{Type: "object", AdditionalProperties: true}
+}
+
+// documentContent is a document in each format it can be sent or returned in
+func documentContent() map[string]*mediaType {
+	return map[string]*mediaType{
+		format.JSON:    {Schema: documentSchema()},
+		format.YAML:    {Schema: &schema{Type: "string"}, Example: "theme: dark\nfont_size: 14\n"},
+		format.MsgPack: {Schema: binarySchema()},
+		format.CBOR:    {Schema: binarySchema()},
+	}
+}
+
+func binarySchema() *schema {
+	return &schema{Type: "string", Format: "binary"}
+}
+
+func pathParam(name, description string) *parameter {
+	return &parameter{
+		Name:        name,
+		In:          "path",
+		Required:    true,
+		Description: description,
+		Schema:      &schema{Type: "string", Pattern: model.NamePattern},
+	}
+}
+
+func componentParam(name string) *parameter {
+	return &parameter{Ref: "#/components/parameters/" + name}
+}
+
+func queryParam(name, description string, s *schema) *parameter {
+	return &parameter{Name: name, In: "query", Description: description, Schema: s}
+}
+
+func headerParam(name, description string) *parameter {
+	return &parameter{Name: name, In: "header", Description: description, Schema: &schema{Type: "string"}}
+}
+
+// enumSchema is a string schema with allowed values and a default
+func enumSchema(def string, values ...string) *schema {
+	return &schema{Type: "string", Enum: values, Default: def}
 }
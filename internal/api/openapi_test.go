@@ -0,0 +1,169 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the OpenAPI spec in docs/openapi.json")
+
+// specFile is the generated spec kept in the repository, so changes to the
+// API show up in review
+const specFile = "../../docs/openapi.json"
+
+var pathParamRe = regexp.MustCompile(`\{([^}]+)\}`)
+
+func TestOpenAPI_RoutesDocumented(t *testing.T) {
+	ids := make(map[string]string)
+	for _, rt := range apiRoutes() {
+		name := rt.method + " " + rt.pattern
+		if rt.doc == nil {
+			t.Errorf("%s has no documentation", name)
+			continue
+		}
+		op := rt.doc(&specBuilder{schemas: make(map[string]*schema)})
+		if op.Summary == "" || op.OperationID == "" || len(op.Tags) == 0 {
+			t.Errorf("%s needs a summary, operation ID and tag", name)
+		}
+		if prev, dup := ids[op.OperationID]; dup {
+			t.Errorf("%s reuses operation ID %q of %s", name, op.OperationID, prev)
+		}
+		ids[op.OperationID] = name
+
+		hasSuccess := false
+		for code := range op.Responses {
+			hasSuccess = hasSuccess || code[0] == '2'
+		}
+		if !hasSuccess {
+			t.Errorf("%s documents no success response", name)
+		}
+	}
+}
+
+func TestOpenAPI_PathsMatchRouter(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+	mux := NewRouter(handler)
+
+	var s map[string]any
+	if err := json.Unmarshal(OpenAPISpec(), &s); err != nil {
+		t.Fatalf("spec is not valid JSON: %v", err)
+	}
+	params := s["components"].(map[string]any)["parameters"].(map[string]any)
+
+	for _, rt := range apiRoutes() {
+		path := rt.specPath()
+		op, ok := s["paths"].(map[string]any)[path].(map[string]any)[strings.ToLower(rt.method)].(map[string]any)
+		if !ok {
+			t.Errorf("%s %s missing from spec", rt.method, path)
+			continue
+		}
+
+		// Every path template parameter is declared
+		declared := make(map[string]bool)
+		for _, p := range asSlice(op["parameters"]) {
+			p := p.(map[string]any)
+			if ref, ok := p["$ref"].(string); ok {
+				p = params[strings.TrimPrefix(ref, "#/components/parameters/")].(map[string]any)
+			}
+			if p["in"] == "path" {
+				declared[p["name"].(string)] = true
+			}
+		}
+		for _, m := range pathParamRe.FindAllStringSubmatch(path, -1) {
+			if !declared[m[1]] {
+				t.Errorf("%s %s doesn't declare path parameter %q", rt.method, path, m[1])
+			}
+		}
+
+		// A request for the documented path reaches this route
+		concrete := pathParamRe.ReplaceAllString(path, "x")
+		_, pattern := mux.Handler(httptest.NewRequest(rt.method, concrete, nil))
+		if pattern != rt.method+" "+rt.pattern {
+			t.Errorf("%s %s is routed to %q", rt.method, concrete, pattern)
+		}
+	}
+}
+
+func TestOpenAPI_RefsResolve(t *testing.T) {
+	var s map[string]any
+	if err := json.Unmarshal(OpenAPISpec(), &s); err != nil {
+		t.Fatalf("spec is not valid JSON: %v", err)
+	}
+	for _, ref := range regexp.MustCompile(`"\$ref":\s*"#/([^"]+)"`).FindAllStringSubmatch(string(OpenAPISpec()), -1) {
+		var node any = s
+		for _, part := range strings.Split(ref[1], "/") {
+			m, _ := node.(map[string]any)
+			node = m[part]
+		}
+		if node == nil {
+			t.Errorf("unresolved reference #/%s", ref[1])
+		}
+	}
+}
+
+func TestOpenAPI_Schemas(t *testing.T) {
+	s := buildSpec(apiRoutes())
+
+	meta := s.Components.Schemas["ExportMeta"]
+	if meta == nil || strings.Join(meta.Required, ",") != "size" {
+		t.Errorf("expected ExportMeta to require only size, got %+v", meta)
+	}
+	status := s.Components.Schemas["SuccessResponse"].Properties[0]
+	if status.name != "status" || strings.Join(status.schema.Enum, ",") != "created,updated,deleted" {
+		t.Errorf("unexpected SuccessResponse.status %+v", status.schema)
+	}
+	for _, p := range s.Components.Schemas["ErrorResponse"].Properties {
+		if p.name == "error" && !strings.Contains(strings.Join(p.schema.Enum, ","), "internal_error") {
+			t.Errorf("ErrorResponse.error enum misses internal_error: %v", p.schema.Enum)
+		}
+	}
+
+	get := s.Paths["/{channel}/{document}"]["get"]
+	if get.Responses["500"] == nil || get.Responses["401"] == nil {
+		t.Error("expected default 401 and 500 responses")
+	}
+	if op := s.Paths["/openapi.json"]["get"]; op.Security == nil || len(*op.Security) != 0 || op.Responses["401"] != nil {
+		t.Error("expected /openapi.json to be public")
+	}
+}
+
+func TestOpenAPI_Served(t *testing.T) {
+	w := httptest.NewRecorder()
+	OpenAPI(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("unexpected response %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	if !bytes.Equal(w.Body.Bytes(), OpenAPISpec()) {
+		t.Error("served spec differs from OpenAPISpec")
+	}
+}
+
+// TestOpenAPI_UpToDate fails when docs/openapi.json is stale. Regenerate
+// it with: go test ./internal/api -run OpenAPI_UpToDate -update
+func TestOpenAPI_UpToDate(t *testing.T) {
+	if *update {
+		if err := os.WriteFile(specFile, OpenAPISpec(), 0644); err != nil {
+			t.Fatalf("failed to write spec: %v", err)
+		}
+	}
+	data, err := os.ReadFile(specFile)
+	if err != nil {
+		t.Fatalf("failed to read spec: %v", err)
+	}
+	if !bytes.Equal(data, OpenAPISpec()) {
+		t.Errorf("%s is out of date; run go test ./internal/api -run OpenAPI_UpToDate -update", specFile)
+	}
+}
+
+func asSlice(v any) []any {
+	s, _ := v.([]any)
+	return s
+}
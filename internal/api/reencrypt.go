@@ -0,0 +1,34 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/rashpile/pako-justdoc/internal/model"
+	"github.com/rashpile/pako-justdoc/internal/storage"
+)
+
+// Reencrypt handles POST /_/reencrypt
+// Rewrites every document not encrypted with the current key while the
+// server keeps serving requests
+func (h *Handler) Reencrypt(w http.ResponseWriter, r *http.Request) {
+	re, ok := h.storage.(storage.Reencrypter)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, model.ErrCodeNotImplemented, "Storage backend does not support encryption")
+		return
+	}
+
+	n, err := re.Reencrypt()
+	if err == storage.ErrEncryptionDisabled {
+		writeError(w, http.StatusNotImplemented, model.ErrCodeNotImplemented, "Encryption is not configured")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to re-encrypt documents")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, model.ReencryptResponse{
+		Status:    "reencrypted",
+		Documents: n,
+	})
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/rashpile/pako-justdoc/internal/model"
+	"github.com/rashpile/pako-justdoc/internal/storage"
+)
+
+func TestReencrypt(t *testing.T) {
+	keys, err := storage.ParseKeyring("k1:" + base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	if err != nil {
+		t.Fatalf("ParseKeyring failed: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "test.db")
+
+	plain, err := storage.NewBoltStorage(path)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	_, _ = plain.PutDocument("myapp", "settings", []byte(`{"theme": "dark"}`))
+	_ = plain.Close()
+
+	store, err := storage.NewBoltStorage(path, storage.WithEncryption(keys))
+	if err != nil {
+		t.Fatalf("Failed to open storage: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+	handler := NewHandler(store)
+
+	w := httptest.NewRecorder()
+	handler.Reencrypt(w, httptest.NewRequest(http.MethodPost, "/_/reencrypt", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp model.ReencryptResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if resp.Status != "reencrypted" || resp.Documents != 1 {
+		t.Errorf("Unexpected response %+v", resp)
+	}
+}
+
+func TestReencrypt_NotConfigured(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	w := httptest.NewRecorder()
+	handler.Reencrypt(w, httptest.NewRequest(http.MethodPost, "/_/reencrypt", nil))
+	if w.Code != http.StatusNotImplemented {
+		t.Errorf("Expected 501 for in-memory storage, got %d", w.Code)
+	}
+
+	store, err := storage.NewBoltStorage(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	w = httptest.NewRecorder()
+	NewHandler(store).Reencrypt(w, httptest.NewRequest(http.MethodPost, "/_/reencrypt", nil))
+	if w.Code != http.StatusNotImplemented {
+		t.Errorf("Expected 501 without keys, got %d", w.Code)
+	}
+}
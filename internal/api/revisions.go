@@ -0,0 +1,58 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/rashpile/pako-justdoc/internal/model"
+	"github.com/rashpile/pako-justdoc/internal/storage"
+)
+
+// ListRevisions handles GET /{channel}/{document}/_revisions
+// It lists the current version of a document and the previous versions the
+// storage keeps, newest first.
+func (h *Handler) ListRevisions(w http.ResponseWriter, r *http.Request) {
+	channel := r.PathValue("channel")
+	document := r.PathValue("document")
+
+	if !model.IsValidName(channel) || !model.IsValidName(document) {
+		writeError(w, http.StatusBadRequest, model.ErrCodeInvalidName, "Invalid channel or document name")
+		return
+	}
+
+	revisions, err := h.storage.ListRevisions(channel, document)
+	if err == storage.ErrNotFound {
+		writeError(w, http.StatusNotFound, model.ErrCodeNotFound, "Document not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+		return
+	}
+
+	resp := model.RevisionsResponse{Channel: channel, Document: document, Revisions: make([]model.RevisionMeta, len(revisions))}
+	for i, rev := range revisions {
+		resp.Revisions[i] = model.RevisionMeta(rev)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// revisionParam returns the ?revision= of a request, 0 for the current
+// version, or false if it isn't a positive number
+func revisionParam(r *http.Request) (int, bool) {
+	v := r.URL.Query().Get("revision")
+	if v == "" {
+		return 0, true
+	}
+	revision, err := strconv.Atoi(v)
+	return revision, err == nil && revision > 0
+}
+
+// loadDocument retrieves a version of a document, the current one if
+// revision is 0
+func (h *Handler) loadDocument(channel, document string, revision int) ([]byte, error) {
+	if revision == 0 {
+		return h.storage.GetDocument(channel, document)
+	}
+	return h.storage.GetRevision(channel, document, revision)
+}
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rashpile/pako-justdoc/internal/format"
+	"github.com/rashpile/pako-justdoc/internal/model"
+)
+
+func TestListRevisions(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+	router := NewRouter(handler)
+
+	for _, body := range []string{`{"v":1}`, `{"v":2}`, `{"v":3}`} {
+		postDocument(t, handler, "app", "settings", body)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/app/settings/_revisions", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp model.RevisionsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if resp.Channel != "app" || resp.Document != "settings" || len(resp.Revisions) != 3 {
+		t.Fatalf("Unexpected response %+v", resp)
+	}
+	for i, rev := range resp.Revisions {
+		if rev.Revision != 3-i || rev.Modified.IsZero() {
+			t.Errorf("Revision %d: got %+v", i, rev)
+		}
+	}
+
+	for _, tt := range []struct {
+		url    string
+		status int
+	}{
+		{"/app/missing/_revisions", http.StatusNotFound},
+		{"/app/my.doc/_revisions", http.StatusBadRequest},
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.url, nil))
+		if w.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.url, tt.status, w.Code)
+		}
+	}
+}
+
+func TestGetDocument_Revision(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+	router := NewRouter(handler)
+
+	postDocument(t, handler, "app", "settings", `{"theme":"dark"}`)
+	postDocument(t, handler, "app", "settings", `{"theme":"light"}`)
+
+	get := func(url, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	tests := []struct {
+		name   string
+		url    string
+		accept string
+		status int
+		want   string
+	}{
+		{"current", "/app/settings", "", http.StatusOK, `{"theme":"light"}`},
+		{"previous", "/app/settings?revision=1", "", http.StatusOK, `{"theme":"dark"}`},
+		{"current by number", "/app/settings?revision=2", "", http.StatusOK, `{"theme":"light"}`},
+		{"previous as YAML", "/app/settings?revision=1", format.YAML, http.StatusOK, "theme: dark"},
+		{"not kept", "/app/settings?revision=3", "", http.StatusNotFound, ""},
+		{"zero", "/app/settings?revision=0", "", http.StatusBadRequest, ""},
+		{"not a number", "/app/settings?revision=latest", "", http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := get(tt.url, tt.accept)
+			if w.Code != tt.status {
+				t.Fatalf("Expected status %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+			if got := strings.TrimSpace(w.Body.String()); tt.want != "" && got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+
+	// A previous version has the ETag of its content
+	if tag := get("/app/settings?revision=1", "").Header().Get("ETag"); tag != etag([]byte(`{"theme":"dark"}`)) {
+		t.Errorf("Unexpected ETag %q", tag)
+	}
+}
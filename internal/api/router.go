@@ -1,16 +1,40 @@
 package api
 
-import "net/http"
+import (
+	"net/http"
+
+	"github.com/rashpile/pako-justdoc/internal/model"
+)
 
 // NewRouter creates a new HTTP router with the document API routes
 func NewRouter(h *Handler) *http.ServeMux {
 	mux := http.NewServeMux()
-	mux.HandleFunc("GET /openapi.json", OpenAPI)
-	mux.HandleFunc("GET /_/static/", ServeStatic)
-	mux.HandleFunc("GET /_/edit/{channel}/{document}", h.EditorUI)
-	mux.HandleFunc("GET /", h.ListChannels)
-	mux.HandleFunc("GET /{channel}/", h.ListDocuments)
-	mux.HandleFunc("GET /{channel}/{document}", h.GetDocument)
-	mux.HandleFunc("POST /{channel}/{document}", h.PostDocument)
+	actions := make(map[string]map[string]func(*Handler, http.ResponseWriter, *http.Request))
+	for _, rt := range apiRoutes() {
+		key := rt.method + " " + rt.pattern
+		if rt.action == "" {
+			handle := rt.handle
+			mux.HandleFunc(key, func(w http.ResponseWriter, r *http.Request) {
+				handle(h, w, r)
+			})
+			continue
+		}
+		// Routes sharing an {action} pattern are registered once and
+		// dispatched on the action segment
+		byAction, ok := actions[key]
+		if !ok {
+			byAction = make(map[string]func(*Handler, http.ResponseWriter, *http.Request))
+			actions[key] = byAction
+			mux.HandleFunc(key, func(w http.ResponseWriter, r *http.Request) {
+				handle, ok := byAction[r.PathValue("action")]
+				if !ok {
+					writeError(w, http.StatusNotFound, model.ErrCodeNotFound, "Not found")
+					return
+				}
+				handle(h, w, r)
+			})
+		}
+		byAction[rt.action] = rt.handle
+	}
 	return mux
 }
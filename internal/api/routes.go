@@ -0,0 +1,888 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rashpile/pako-justdoc/internal/model"
+	"github.com/rashpile/pako-justdoc/internal/storage"
+)
+
+// route is an endpoint registered by NewRouter and documented in the
+// OpenAPI spec
+type route struct {
+	method  string
+	pattern string
+	// path is the OpenAPI path when it differs from the pattern
+	path string
+	// action is the {action} segment the route handles. Literal segments
+	// such as _diff would conflict with the UI routes under /_/, so these
+	// routes share a pattern and NewRouter dispatches on the action.
+	action string
+	handle func(h *Handler, w http.ResponseWriter, r *http.Request)
+	// public routes don't require authentication
+	public bool
+	// shared routes also accept the token of a share link; see
+	// ShareLinks.allows
+	shared bool
+	doc    func(b *specBuilder) *operation
+}
+
+// specPath returns the path of the route in the OpenAPI spec
+func (rt route) specPath() string {
+	if rt.path != "" {
+		return rt.path
+	}
+	return rt.pattern
+}
+
+// handlerFunc adapts a function that doesn't need the Handler
+func handlerFunc(f http.HandlerFunc) func(*Handler, http.ResponseWriter, *http.Request) {
+	return func(_ *Handler, w http.ResponseWriter, r *http.Request) {
+		f(w, r)
+	}
+}
+
+const (
+	ifMatchDescription = `ETag the document must currently have, from any of its representations ("*" matches any existing document)`
+	sizeLimitNote      = " (max 10MB by default, see MAX_BODY_SIZE)"
+	attachmentPath     = "/{channel}/{document}/_attachments/{name}"
+	attachmentPattern  = "/{channel}/{document}/{action}/{name}"
+	actionPattern      = "/{channel}/{document}/{action}"
+)
+
+// apiRoutes lists every endpoint of the API. More specific patterns take
+// precedence in ServeMux, so the order only affects the documentation.
+func apiRoutes() []route {
+	return []route{
+		{
+			method: "GET", pattern: "/openapi.json", public: true,
+			handle: handlerFunc(OpenAPI),
+			doc: func(b *specBuilder) *operation {
+				return &operation{
+					Summary:     "OpenAPI specification",
+					Description: "Returns this specification, generated from the server routes",
+					OperationID: "openAPI",
+					Tags:        []string{"Admin"},
+					Responses: map[string]*response{
+						"200": {Description: "OpenAPI 3.0 document", Content: map[string]*mediaType{
+							"application/json": {Schema: &schema{Type: "object", AdditionalProperties: true}},
+						}},
+					},
+				}
+			},
+		},
+		{
+			method: "GET", pattern: "/_/static/{file}", public: true,
+			handle: handlerFunc(ServeStatic),
+			doc: func(b *specBuilder) *operation {
+				return &operation{
+					Summary:     "Editor assets",
+					Description: "Serves the stylesheets and scripts of the browser UI",
+					OperationID: "serveStatic",
+					Tags:        []string{"UI"},
+					Parameters: []*parameter{{
+						Name: "file", In: "path", Required: true,
+						Description: "Asset file name",
+						Schema:      &schema{Type: "string"},
+						Example:     "editor.js",
+					}},
+					Responses: map[string]*response{
+						"200": {Description: "Asset file", Content: map[string]*mediaType{
+							"text/css":                 {Schema: &schema{Type: "string"}},
+							"text/javascript":          {Schema: &schema{Type: "string"}},
+							"application/octet-stream": {Schema: binarySchema()},
+						}},
+						"404": {Description: "No such asset"},
+					},
+				}
+			},
+		},
+		{
+			method: "GET", pattern: "/_/docs", public: true,
+			handle: handlerFunc(DocsUI),
+			doc: func(b *specBuilder) *operation {
+				return &operation{
+					Summary: "API explorer",
+					Description: "Returns an HTML page that renders this specification and can send requests from the browser. " +
+						"The page is public; requests made from it use the API key entered on the page.",
+					OperationID: "docsUI",
+					Tags:        []string{"UI"},
+					Responses: map[string]*response{
+						"200": {Description: "Explorer page", Content: map[string]*mediaType{
+							"text/html": {Schema: &schema{Type: "string"}},
+						}},
+					},
+				}
+			},
+		},
+		{
+			method: "GET", pattern: "/_/{$}", path: "/_/",
+			handle: (*Handler).ChannelsUI,
+			doc: func(b *specBuilder) *operation {
+				return &operation{
+					Summary:     "Channel browser",
+					Description: "Returns an HTML page listing all channels with their document counts",
+					OperationID: "channelsUI",
+					Tags:        []string{"UI"},
+					Responses: map[string]*response{
+						"200": {Description: "Channel list page", Content: map[string]*mediaType{
+							"text/html": {Schema: &schema{Type: "string"}},
+						}},
+					},
+				}
+			},
+		},
+		{
+			method: "GET", pattern: "/_/browse/{channel}",
+			handle: (*Handler).BrowseUI,
+			doc: func(b *specBuilder) *operation {
+				return &operation{
+					Summary:     "Document browser",
+					Description: "Returns an HTML page listing the documents of a channel with their size and modification time. A channel that doesn't exist is shown empty.",
+					OperationID: "browseUI",
+					Tags:        []string{"UI"},
+					Parameters:  []*parameter{componentParam("Channel")},
+					Responses: map[string]*response{
+						"200": {Description: "Document list page", Content: map[string]*mediaType{
+							"text/html": {Schema: &schema{Type: "string"}},
+						}},
+						"400": {Description: "Invalid channel name", Content: map[string]*mediaType{
+							"text/plain": {Schema: &schema{Type: "string"}},
+						}},
+					},
+				}
+			},
+		},
+		{
+			method: "GET", pattern: "/_/edit/{channel}/{document}",
+			handle: (*Handler).EditorUI,
+			doc: func(b *specBuilder) *operation {
+				return &operation{
+					Summary:     "Document editor",
+					Description: "Returns an HTML page for viewing and editing the document in a browser",
+					OperationID: "editorUI",
+					Tags:        []string{"UI"},
+					Parameters:  []*parameter{componentParam("Channel"), componentParam("Document")},
+					Responses: map[string]*response{
+						"200": {Description: "Editor page", Content: map[string]*mediaType{
+							"text/html": {Schema: &schema{Type: "string"}},
+						}},
+						"400": {Description: "Invalid channel or document name", Content: map[string]*mediaType{
+							"text/plain": {Schema: &schema{Type: "string"}},
+						}},
+					},
+				}
+			},
+		},
+		{
+			method: "GET", pattern: "/_/view/{channel}/{document}", shared: true,
+			handle: (*Handler).ViewUI,
+			doc: func(b *specBuilder) *operation {
+				return &operation{
+					Summary:     "Read-only document viewer",
+					Description: "Returns an HTML page showing the document as a collapsible tree. Opened through a share link, it passes the link's token on when loading the document.",
+					OperationID: "viewUI",
+					Tags:        []string{"UI"},
+					Parameters: []*parameter{
+						componentParam("Channel"),
+						componentParam("Document"),
+						queryParam("token", "Share link token", &schema{Type: "string"}),
+					},
+					Responses: map[string]*response{
+						"200": {Description: "Viewer page", Content: map[string]*mediaType{
+							"text/html": {Schema: &schema{Type: "string"}},
+						}},
+						"400": {Description: "Invalid channel or document name", Content: map[string]*mediaType{
+							"text/plain": {Schema: &schema{Type: "string"}},
+						}},
+					},
+				}
+			},
+		},
+		{
+			method: "POST", pattern: "/_/share",
+			handle: (*Handler).CreateShareLink,
+			doc: func(b *specBuilder) *operation {
+				return &operation{
+					Summary: "Create a share link",
+					Description: "Signs a link to the read-only viewer of a document. Its token grants reading the document and its viewer page until it expires, " +
+						"even when authentication is enabled. Links can't be revoked individually; changing auth.share_secret invalidates all of them.",
+					OperationID: "createShareLink",
+					Tags:        []string{"Documents"},
+					RequestBody: &requestBody{
+						Required: true,
+						Content: map[string]*mediaType{"application/json": {
+							Schema:  b.ref(model.ShareRequest{}),
+							Example: model.ShareRequest{Channel: "myapp", Document: "settings", ExpiresIn: "72h"},
+						}},
+					},
+					Responses: map[string]*response{
+						"201": b.jsonResponse("Share link created", model.ShareResponse{}),
+						"400": b.errorResponse("Invalid name, permission or expires_in"),
+						"404": b.errorResponse("Document not found"),
+						"413": b.errorResponse("Payload too large"),
+						"501": b.errorResponse("Share links are not enabled"),
+					},
+				}
+			},
+		},
+		{
+			method: "GET", pattern: "/_/backup",
+			handle: (*Handler).Backup,
+			doc: func(b *specBuilder) *operation {
+				return &operation{
+					Summary:     "Download a database snapshot",
+					Description: "Streams a consistent snapshot of the whole database file. Writers are not blocked while the snapshot is taken.",
+					OperationID: "backup",
+					Tags:        []string{"Admin"},
+					Responses: map[string]*response{
+						"200": {Description: "Database snapshot", Content: map[string]*mediaType{
+							"application/octet-stream": {Schema: binarySchema()},
+						}},
+						"501": b.errorResponse("Storage backend does not support backups"),
+					},
+				}
+			},
+		},
+		{
+			method: "POST", pattern: "/_/batch",
+			handle: (*Handler).Batch,
+			doc: func(b *specBuilder) *operation {
+				return &operation{
+					Summary:     "Apply several operations atomically",
+					Description: "Applies put, patch (RFC 7386 JSON merge patch) and delete operations across channels in a single transaction. Either all operations are committed or none are. Each operation may carry an if_match precondition with the document ETag.",
+					OperationID: "batch",
+					Tags:        []string{"Documents"},
+					RequestBody: &requestBody{
+						Required: true,
+						Content: map[string]*mediaType{"application/json": {
+							Schema: b.ref([]model.BatchOperation{}),
+							Example: []map[string]any{
+								{"op": "patch", "channel": "myapp", "document": "manifest", "value": map[string]any{"items": []string{"item1"}}, "if_match": `"1f0c2b7a9d3e4f5a6b7c8d9e0f1a2b3c"`},
+								{"op": "put", "channel": "items", "document": "item1", "value": map[string]any{"title": "First"}},
+								{"op": "delete", "channel": "items", "document": "item0"},
+							},
+						}},
+					},
+					Responses: map[string]*response{
+						"200": b.jsonResponse("All operations committed", model.BatchResponse{}),
+						"400": b.jsonResponse("Invalid operation or schema violation; nothing was committed", model.BatchResponse{}),
+						"404": b.jsonResponse("Patched or deleted document not found; nothing was committed", model.BatchResponse{}),
+						"412": b.jsonResponse("An if_match precondition failed; nothing was committed", model.BatchResponse{}),
+						"413": b.errorResponse("Payload too large"),
+						"500": b.jsonResponse("Storage failure; nothing was committed", model.BatchResponse{}),
+					},
+				}
+			},
+		},
+		{
+			method: "POST", pattern: "/_/compact",
+			handle: (*Handler).Compact,
+			doc: func(b *specBuilder) *operation {
+				return &operation{
+					Summary:     "Compact the database file",
+					Description: "Copies live data into a fresh database file and swaps it in, reclaiming space left by deleted and overwritten documents. Other requests wait until compaction finishes.",
+					OperationID: "compact",
+					Tags:        []string{"Admin"},
+					Responses: map[string]*response{
+						"200": b.jsonResponse("Database compacted", model.CompactResponse{}),
+						"501": b.errorResponse("Storage backend does not support compaction"),
+					},
+				}
+			},
+		},
+		{
+			method: "POST", pattern: "/_/reencrypt",
+			handle: (*Handler).Reencrypt,
+			doc: func(b *specBuilder) *operation {
+				return &operation{
+					Summary:     "Re-encrypt documents with the current key",
+					Description: "Rewrites every document that is stored in plain form or encrypted with an older key, using the first configured encryption key. The server keeps serving requests while documents are rewritten in chunks.",
+					OperationID: "reencrypt",
+					Tags:        []string{"Admin"},
+					Responses: map[string]*response{
+						"200": b.jsonResponse("Documents re-encrypted", model.ReencryptResponse{}),
+						"501": b.errorResponse("Encryption is not configured or not supported by the storage backend"),
+					},
+				}
+			},
+		},
+		{
+			method: "GET", pattern: "/",
+			handle: (*Handler).ListChannels,
+			doc: func(b *specBuilder) *operation {
+				return &operation{
+					Summary:     "List all channels",
+					Description: "Returns a list of all channels with document counts",
+					OperationID: "listChannels",
+					Tags:        []string{"Channels"},
+					Responses: map[string]*response{
+						"200": withExample(b.jsonResponse("List of channels retrieved successfully", []storage.ChannelInfo{}), []storage.ChannelInfo{
+							{Name: "app-config", DocumentCount: 3},
+							{Name: "user-data", DocumentCount: 12},
+						}),
+					},
+				}
+			},
+		},
+		{
+			method: "GET", pattern: "/{channel}/",
+			handle: (*Handler).ListDocuments,
+			doc: func(b *specBuilder) *operation {
+				return &operation{
+					Summary:     "List documents in a channel",
+					Description: "Returns a list of all document names in the specified channel",
+					OperationID: "listDocuments",
+					Tags:        []string{"Channels"},
+					Parameters:  []*parameter{componentParam("Channel")},
+					Responses: map[string]*response{
+						"200": withExample(b.jsonResponse("List of documents retrieved successfully", []string{}),
+							[]string{"config", "settings", "user-preferences"}),
+						"400": withExample(b.errorResponse("Invalid channel name"),
+							model.ErrorResponse{Error: model.ErrCodeInvalidName, Message: "Invalid channel name"}),
+						"404": withExample(b.errorResponse("Channel not found"),
+							model.ErrorResponse{Error: model.ErrCodeNotFound, Message: "Channel not found"}),
+					},
+				}
+			},
+		},
+		{
+			method: "GET", pattern: "/{channel}/_bulk",
+			handle: (*Handler).BulkGetDocuments,
+			doc: func(b *specBuilder) *operation {
+				names := queryParam("names", "Comma-separated document names; may be repeated", &schema{Type: "string"})
+				names.Required = true
+				names.Example = "settings,profile"
+				return &operation{
+					Summary:     "Retrieve several documents",
+					Description: "Returns the named documents of a channel read from a single consistent snapshot. Missing documents (or a missing channel) are listed in not_found. Requests for more than 32MB of documents are rejected.",
+					OperationID: "bulkGetDocuments",
+					Tags:        []string{"Documents"},
+					Parameters:  []*parameter{componentParam("Channel"), names},
+					Responses: map[string]*response{
+						"200": withExample(b.jsonResponse("Documents retrieved successfully", model.BulkResponse{}), map[string]any{
+							"documents": map[string]any{"settings": map[string]any{"theme": "dark"}},
+							"not_found": []string{"profile"},
+						}),
+						"400": b.errorResponse("Invalid channel or document name, or no names given"),
+						"413": withExample(b.errorResponse("Requested documents are too large"),
+							model.ErrorResponse{Error: model.ErrCodePayloadTooLarge, Message: "Requested documents exceed 32MB limit"}),
+					},
+				}
+			},
+		},
+		{
+			method: "GET", pattern: "/{channel}/_export",
+			handle: (*Handler).ExportChannel,
+			doc: func(b *specBuilder) *operation {
+				return &operation{
+					Summary:     "Export a channel",
+					Description: "Streams every document of the channel as NDJSON (one {name, doc, meta} record per line, documents compacted) or as a tar.gz archive of name.json files.",
+					OperationID: "exportChannel",
+					Tags:        []string{"Channels"},
+					Parameters: []*parameter{
+						componentParam("Channel"),
+						queryParam("format", "Export format", enumSchema("ndjson", "ndjson", "tar")),
+					},
+					Responses: map[string]*response{
+						"200": {Description: "Channel export stream", Content: map[string]*mediaType{
+							"application/x-ndjson": {Schema: b.ref(model.ExportRecord{})},
+							"application/gzip":     {Schema: binarySchema()},
+						}},
+						"400": b.errorResponse("Invalid channel name or format"),
+						"404": b.errorResponse("Channel not found"),
+					},
+				}
+			},
+		},
+		{
+			method: "POST", pattern: "/{channel}/_import",
+			handle: (*Handler).ImportChannel,
+			doc: func(b *specBuilder) *operation {
+				return &operation{
+					Summary:     "Import documents into a channel",
+					Description: "Imports an NDJSON or tar.gz export. Documents are committed in chunks; when an import fails, the counts report what was committed before the failing document.",
+					OperationID: "importChannel",
+					Tags:        []string{"Channels"},
+					Parameters: []*parameter{
+						componentParam("Channel"),
+						queryParam("mode", "What to do with documents that already exist",
+							enumSchema(model.ImportModeOverwrite, model.ImportModeOverwrite, model.ImportModeSkip, model.ImportModeFail)),
+					},
+					RequestBody: &requestBody{
+						Required:    true,
+						Description: "Export stream; each document is limited" + sizeLimitNote,
+						Content: map[string]*mediaType{
+							"application/x-ndjson": {Schema: b.ref(model.ExportRecord{})},
+							"application/gzip":     {Schema: binarySchema()},
+						},
+					},
+					Responses: map[string]*response{
+						"200": b.jsonResponse("Import completed", model.ImportResponse{}),
+						"400": b.jsonResponse("Invalid record, name or schema violation", model.ImportResponse{}),
+						"409": b.jsonResponse("Document already exists (mode=fail)", model.ImportResponse{}),
+						"413": b.jsonResponse("A document is too large", model.ImportResponse{}),
+						"500": b.jsonResponse("Storage failure", model.ImportResponse{}),
+					},
+				}
+			},
+		},
+		{
+			method: "GET", pattern: "/{channel}/_schema",
+			handle: (*Handler).GetSchema,
+			doc: func(b *specBuilder) *operation {
+				return &operation{
+					Summary:     "Retrieve a channel schema",
+					Description: "Returns the JSON Schema (draft 2020-12) attached to the channel",
+					OperationID: "getSchema",
+					Tags:        []string{"Schemas"},
+					Parameters:  []*parameter{componentParam("Channel")},
+					Responses: map[string]*response{
+						"200": {Description: "Schema retrieved successfully", Content: map[string]*mediaType{
+							"application/schema+json": {Schema: documentSchema()},
+						}},
+						"400": b.errorResponse("Invalid channel name"),
+						"404": withExample(b.errorResponse("Channel has no schema"),
+							model.ErrorResponse{Error: model.ErrCodeNotFound, Message: "Schema not found"}),
+					},
+				}
+			},
+		},
+		{
+			method: "PUT", pattern: "/{channel}/_schema",
+			handle: (*Handler).PutSchema,
+			doc: func(b *specBuilder) *operation {
+				return &operation{
+					Summary:     "Attach a schema to a channel",
+					Description: "Attaches a JSON Schema (draft 2020-12) to the channel, replacing any existing one. Documents written to the channel afterwards must validate against it. Schemas that reference anything outside themselves, such as file: or http: URLs, are rejected.",
+					OperationID: "putSchema",
+					Tags:        []string{"Schemas"},
+					Parameters:  []*parameter{componentParam("Channel")},
+					RequestBody: &requestBody{
+						Required: true,
+						Content: map[string]*mediaType{"application/schema+json": {
+							Schema: documentSchema(),
+							Example: map[string]any{
+								"type":       "object",
+								"required":   []string{"theme"},
+								"properties": map[string]any{"theme": map[string]any{"type": "string"}},
+							},
+						}},
+					},
+					Responses: map[string]*response{
+						"204": {Description: "Schema stored successfully"},
+						"400": withExample(b.errorResponse("Invalid JSON or invalid JSON Schema"),
+							model.ErrorResponse{Error: model.ErrCodeInvalidSchema, Message: "Invalid JSON Schema"}),
+						"413": b.errorResponse("Payload too large"),
+					},
+				}
+			},
+		},
+		{
+			method: "DELETE", pattern: "/{channel}/_schema",
+			handle: (*Handler).DeleteSchema,
+			doc: func(b *specBuilder) *operation {
+				return &operation{
+					Summary:     "Remove a channel schema",
+					Description: "Removes the JSON Schema attached to the channel. Existing documents are not affected.",
+					OperationID: "deleteSchema",
+					Tags:        []string{"Schemas"},
+					Parameters:  []*parameter{componentParam("Channel")},
+					Responses: map[string]*response{
+						"204": {Description: "Schema removed successfully"},
+						"400": b.errorResponse("Invalid channel name"),
+						"404": b.errorResponse("Channel has no schema"),
+					},
+				}
+			},
+		},
+		{
+			method: "GET", pattern: "/{channel}/_settings",
+			handle: (*Handler).GetSettings,
+			doc: func(b *specBuilder) *operation {
+				return &operation{
+					Summary:     "Retrieve channel settings",
+					Description: "Returns the settings of the channel. Channels without stored settings report the server defaults (NORMALIZE_CHANNELS).",
+					OperationID: "getSettings",
+					Tags:        []string{"Channels"},
+					Parameters:  []*parameter{componentParam("Channel")},
+					Responses: map[string]*response{
+						"200": withExample(b.jsonResponse("Channel settings", model.ChannelSettings{}), model.ChannelSettings{Normalize: true}),
+						"400": b.errorResponse("Invalid channel name"),
+					},
+				}
+			},
+		},
+		{
+			method: "PUT", pattern: "/{channel}/_settings",
+			handle: (*Handler).PutSettings,
+			doc: func(b *specBuilder) *operation {
+				return &operation{
+					Summary: "Store channel settings",
+					Description: "Stores the settings of the channel, replacing the server defaults for it. " +
+						"They apply to documents written afterwards; existing documents are not rewritten.",
+					OperationID: "putSettings",
+					Tags:        []string{"Channels"},
+					Parameters:  []*parameter{componentParam("Channel")},
+					RequestBody: &requestBody{
+						Required: true,
+						Content: map[string]*mediaType{"application/json": {
+							Schema:  b.ref(model.ChannelSettings{}),
+							Example: model.ChannelSettings{Normalize: true},
+						}},
+					},
+					Responses: map[string]*response{
+						"204": {Description: "Settings stored successfully"},
+						"400": withExample(b.errorResponse("Invalid channel name, invalid JSON or unknown setting"),
+							model.ErrorResponse{Error: model.ErrCodeInvalidOperation, Message: `Invalid channel settings: json: unknown field "normalise"`}),
+						"413": b.errorResponse("Payload too large"),
+					},
+				}
+			},
+		},
+		{
+			method: "DELETE", pattern: "/{channel}/_settings",
+			handle: (*Handler).DeleteSettings,
+			doc: func(b *specBuilder) *operation {
+				return &operation{
+					Summary:     "Remove channel settings",
+					Description: "Removes the stored settings of the channel, which goes back to the server defaults. Existing documents are not affected.",
+					OperationID: "deleteSettings",
+					Tags:        []string{"Channels"},
+					Parameters:  []*parameter{componentParam("Channel")},
+					Responses: map[string]*response{
+						"204": {Description: "Settings removed successfully"},
+						"400": b.errorResponse("Invalid channel name"),
+						"404": b.errorResponse("Channel has no stored settings"),
+					},
+				}
+			},
+		},
+		{
+			method: "GET", pattern: "/{channel}/{document}", shared: true,
+			handle: (*Handler).GetDocument,
+			doc: func(b *specBuilder) *operation {
+				ok := &response{Description: "Document retrieved successfully", Content: documentContent()}
+				withHeader(ok, "ETag", "Entity tag of the returned representation, usable in If-Match and batch if_match preconditions. "+
+					"Converted, pretty and gzip responses get the stored document's tag with a suffix such as -yaml, -pretty or -gzip.")
+				withHeader(ok, "Content-Encoding", "gzip when the document is stored compressed and the request accepts gzip")
+				return &operation{
+					Summary: "Retrieve a document",
+					Description: "Retrieves a stored JSON document from the specified channel. " +
+						"The Accept header can ask for it as YAML, MessagePack or CBOR instead; JSON is returned without one.",
+					OperationID: "getDocument",
+					Tags:        []string{"Documents"},
+					Parameters: []*parameter{
+						componentParam("Channel"),
+						componentParam("Document"),
+						headerParam("If-None-Match", "Return 304 Not Modified if the document still has one of these ETags"),
+						queryParam("pretty", "Re-indent a JSON document for reading", &schema{Type: "boolean", Default: false}),
+						queryParam("revision", "Return this previous version instead of the current one, as listed by the revisions endpoint", &schema{Type: "integer"}),
+						queryParam("token", "Share link token, granting access without an API key", &schema{Type: "string"}),
+					},
+					Responses: map[string]*response{
+						"200": ok,
+						"304": {Description: "Document has not changed since the ETag in If-None-Match"},
+						"400": withExample(b.errorResponse("Invalid channel or document name, or pretty or revision value"),
+							model.ErrorResponse{Error: model.ErrCodeInvalidName, Message: "Invalid channel or document name"}),
+						"404": withExample(b.errorResponse("Document or revision not found"),
+							model.ErrorResponse{Error: model.ErrCodeNotFound, Message: "Document not found"}),
+						"406": withExample(b.errorResponse("Accept allows none of the document formats"),
+							model.ErrorResponse{Error: model.ErrCodeNotAcceptable, Message: "Documents can be returned as application/json, application/yaml, application/msgpack, application/cbor"}),
+					},
+				}
+			},
+		},
+		{
+			method: "POST", pattern: "/{channel}/{document}",
+			handle: (*Handler).PostDocument,
+			doc: func(b *specBuilder) *operation {
+				return &operation{
+					Summary: "Store or update a document",
+					Description: "Stores a JSON document in the specified channel. Creates the channel if it doesn't exist. Returns 201 for new documents, 200 for updates. " +
+						"YAML, MessagePack and CBOR bodies are converted to canonical JSON (RFC 8785) before they are stored, " +
+						"as are all documents written to channels listed in normalize_channels.",
+					OperationID: "postDocument",
+					Tags:        []string{"Documents"},
+					Parameters:  []*parameter{componentParam("Channel"), componentParam("Document")},
+					RequestBody: &requestBody{
+						Required:    true,
+						Description: "Document to store" + sizeLimitNote,
+						Content:     documentContent(),
+					},
+					Responses: map[string]*response{
+						"200": withExample(b.jsonResponse("Document updated successfully", model.SuccessResponse{}),
+							model.SuccessResponse{Status: "updated", Channel: "myapp", Document: "settings"}),
+						"201": withExample(b.jsonResponse("Document created successfully", model.SuccessResponse{}),
+							model.SuccessResponse{Status: "created", Channel: "myapp", Document: "settings"}),
+						"400": withExample(b.errorResponse("Invalid request (bad JSON, invalid name or schema violation)"),
+							model.ErrorResponse{
+								Error:      model.ErrCodeSchemaViolation,
+								Message:    "Document does not match the channel schema",
+								Violations: []model.SchemaViolation{{Location: "/theme", Message: "value must be one of 'dark', 'light'"}},
+							}),
+						"413": withExample(b.errorResponse("Payload too large"),
+							model.ErrorResponse{Error: model.ErrCodePayloadTooLarge, Message: "Request body exceeds 10MB limit"}),
+						"415": withExample(b.errorResponse("Unsupported content type"),
+							model.ErrorResponse{Error: model.ErrCodeUnsupportedMediaType, Message: "Unsupported content type application/xml; send JSON, YAML, MessagePack or CBOR"}),
+					},
+				}
+			},
+		},
+		{
+			method: "PATCH", pattern: "/{channel}/{document}",
+			handle: (*Handler).PatchDocument,
+			doc: func(b *specBuilder) *operation {
+				ok := withExample(b.jsonResponse("Document updated", model.SuccessResponse{}),
+					model.SuccessResponse{Status: "updated", Channel: "myapp", Document: "settings"})
+				withHeader(ok, "ETag", "Entity tag of the updated document")
+				return &operation{
+					Summary:     "Update a document with a merge patch",
+					Description: "Applies an RFC 7386 JSON merge patch to a stored document. Members set to null are removed. The result is validated against the channel schema.",
+					OperationID: "patchDocument",
+					Tags:        []string{"Documents"},
+					Parameters: []*parameter{
+						componentParam("Channel"),
+						componentParam("Document"),
+						headerParam("If-Match", ifMatchDescription),
+					},
+					RequestBody: &requestBody{
+						Required:    true,
+						Description: "JSON merge patch" + sizeLimitNote,
+						Content: map[string]*mediaType{
+							"application/merge-patch+json": {Schema: documentSchema()},
+							"application/json":             {Schema: documentSchema()},
+						},
+					},
+					Responses: map[string]*response{
+						"200": ok,
+						"400": b.errorResponse("Invalid patch, invalid name or schema violation"),
+						"404": b.errorResponse("Document not found"),
+						"412": b.errorResponse("Document does not match If-Match"),
+						"413": b.errorResponse("Payload too large"),
+					},
+				}
+			},
+		},
+		{
+			method: "DELETE", pattern: "/{channel}/{document}",
+			handle: (*Handler).DeleteDocument,
+			doc: func(b *specBuilder) *operation {
+				return &operation{
+					Summary:     "Delete a document",
+					Description: "Removes a document and its attachments from the channel",
+					OperationID: "deleteDocument",
+					Tags:        []string{"Documents"},
+					Parameters: []*parameter{
+						componentParam("Channel"),
+						componentParam("Document"),
+						headerParam("If-Match", ifMatchDescription),
+					},
+					Responses: map[string]*response{
+						"200": withExample(b.jsonResponse("Document deleted", model.SuccessResponse{}),
+							model.SuccessResponse{Status: "deleted", Channel: "myapp", Document: "settings"}),
+						"400": b.errorResponse("Invalid channel or document name"),
+						"404": b.errorResponse("Document not found"),
+						"412": b.errorResponse("Document does not match If-Match"),
+					},
+				}
+			},
+		},
+		{
+			method: "GET", pattern: actionPattern, path: "/{channel}/{document}/_diff", action: "_diff",
+			handle: (*Handler).DiffDocuments,
+			doc: func(b *specBuilder) *operation {
+				ref := "Document to compare: a name in the same channel or channel/document, optionally followed by @revision for a previous version; " +
+					"defaults to the document in the path, and a bare @revision is a version of it"
+				return &operation{
+					Summary: "Compare two documents",
+					Description: "Returns the RFC 6902 JSON Patch that turns the from document into the to document. " +
+						"Objects are compared by key and arrays are aligned on their longest common subsequence; numbers compare by value.",
+					OperationID: "diffDocuments",
+					Tags:        []string{"Documents"},
+					Parameters: []*parameter{
+						componentParam("Channel"),
+						componentParam("Document"),
+						{Name: "from", In: "query", Description: ref, Schema: &schema{Type: "string"}, Example: "settings-staging"},
+						{Name: "to", In: "query", Description: ref, Schema: &schema{Type: "string"}, Example: "@3"},
+					},
+					Responses: map[string]*response{
+						"200": {Description: "JSON Patch; empty when the documents are equal", Content: map[string]*mediaType{
+							"application/json-patch+json": {
+								Schema: &schema{Type: "array", Items: b.ref(model.PatchOperation{})},
+								Example: []model.PatchOperation{
+									{Op: model.PatchOpReplace, Path: "/theme", Value: json.RawMessage(`"light"`)},
+									{Op: model.PatchOpAdd, Path: "/plugins/1", Value: json.RawMessage(`"search"`)},
+									{Op: model.PatchOpRemove, Path: "/beta"},
+								},
+							},
+						}},
+						"400": b.errorResponse("Invalid channel, document, from or to name"),
+						"404": b.errorResponse("A compared document doesn't exist"),
+					},
+				}
+			},
+		},
+		{
+			method: "GET", pattern: actionPattern, path: "/{channel}/{document}/_revisions", action: "_revisions",
+			handle: (*Handler).ListRevisions,
+			doc: func(b *specBuilder) *operation {
+				return &operation{
+					Summary: "List document revisions",
+					Description: "Lists the current version of the document and the previous versions kept by the storage, newest first. " +
+						"Revisions count up from 1 with every write; the last " + strconv.Itoa(storage.MaxRevisions) + " previous versions are kept " +
+						"and deleting the document discards them. Use ?revision= to retrieve a version and @revision in the diff endpoint to compare it.",
+					OperationID: "listRevisions",
+					Tags:        []string{"Documents"},
+					Parameters:  []*parameter{componentParam("Channel"), componentParam("Document")},
+					Responses: map[string]*response{
+						"200": withExample(b.jsonResponse("Revisions of the document", model.RevisionsResponse{}),
+							model.RevisionsResponse{Channel: "myapp", Document: "settings", Revisions: []model.RevisionMeta{
+								{Revision: 3, Modified: time.Date(2025, 1, 15, 10, 30, 0, 0, time.UTC)},
+								{Revision: 2, Modified: time.Date(2025, 1, 14, 9, 0, 0, 0, time.UTC)},
+								{Revision: 1, Modified: time.Date(2025, 1, 10, 8, 15, 0, 0, time.UTC)},
+							}}),
+						"400": b.errorResponse("Invalid channel or document name"),
+						"404": b.errorResponse("Document not found"),
+					},
+				}
+			},
+		},
+		{
+			method: "GET", pattern: actionPattern, path: "/{channel}/{document}/_attachments", action: "_attachments",
+			handle: (*Handler).ListAttachments,
+			doc: func(b *specBuilder) *operation {
+				return &operation{
+					Summary:     "List binary attachments",
+					Description: "Lists the attachments of the document, sorted by name, without their content.",
+					OperationID: "listAttachments",
+					Tags:        []string{"Attachments"},
+					Parameters:  []*parameter{componentParam("Channel"), componentParam("Document")},
+					Responses: map[string]*response{
+						"200": withExample(b.jsonResponse("Attachments of the document", model.AttachmentsResponse{}),
+							model.AttachmentsResponse{Channel: "myapp", Document: "settings", Attachments: []model.AttachmentMeta{{
+								Name:        "logo.png",
+								ContentType: "image/png",
+								Size:        5120,
+								Digest:      "sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+							}}}),
+						"400": b.errorResponse("Invalid channel or document name"),
+						"404": b.errorResponse("Document not found"),
+					},
+				}
+			},
+		},
+		{
+			method: "PUT", pattern: attachmentPattern, path: attachmentPath, action: "_attachments",
+			handle: (*Handler).PutAttachment,
+			doc: func(b *specBuilder) *operation {
+				meta := model.AttachmentMeta{
+					Name:        "logo.png",
+					ContentType: "image/png",
+					Size:        5120,
+					Digest:      "sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+				}
+				return &operation{
+					Summary: "Store a binary attachment",
+					Description: "Stores the body as is as an attachment of the document, with its Content-Type (application/octet-stream if none). " +
+						"Replaces an existing attachment with the same name. Attachments are listed by GET /{channel}/{document}/_attachments, " +
+						"kept when the document is updated and removed when it is deleted.",
+					OperationID: "putAttachment",
+					Tags:        []string{"Attachments"},
+					Parameters:  []*parameter{componentParam("Channel"), componentParam("Document"), componentParam("Attachment")},
+					RequestBody: &requestBody{
+						Required:    true,
+						Description: "Attachment content (max 1MB by default, see MAX_ATTACHMENT_SIZE)",
+						Content:     map[string]*mediaType{"*/*": {Schema: binarySchema()}},
+					},
+					Responses: map[string]*response{
+						"200": withHeader(withExample(b.jsonResponse("Attachment replaced", model.AttachmentResponse{}),
+							model.AttachmentResponse{Status: "updated", Channel: "myapp", Document: "settings", Attachment: meta}),
+							"ETag", "Entity tag of the stored attachment"),
+						"201": withHeader(withExample(b.jsonResponse("Attachment created", model.AttachmentResponse{}),
+							model.AttachmentResponse{Status: "created", Channel: "myapp", Document: "settings", Attachment: meta}),
+							"ETag", "Entity tag of the stored attachment"),
+						"400": b.errorResponse("Invalid channel, document or attachment name"),
+						"404": b.errorResponse("Document not found"),
+						"413": withExample(b.errorResponse("Attachment too large"),
+							model.ErrorResponse{Error: model.ErrCodePayloadTooLarge, Message: "Attachment exceeds 1MB limit"}),
+						"415": b.errorResponse("Malformed Content-Type"),
+					},
+				}
+			},
+		},
+		{
+			method: "GET", pattern: attachmentPattern, path: attachmentPath, action: "_attachments",
+			handle: (*Handler).GetAttachment,
+			doc: func(b *specBuilder) *operation {
+				ok := &response{Description: "Attachment content, with the Content-Type it was stored with", Content: map[string]*mediaType{
+					"*/*": {Schema: binarySchema()},
+				}}
+				withHeader(ok, "ETag", "Entity tag of the attachment")
+				return &operation{
+					Summary:     "Retrieve a binary attachment",
+					Description: "Returns an attachment of the document as stored. Responses are sandboxed with Content-Security-Policy and nosniff, so HTML attachments can't run scripts.",
+					OperationID: "getAttachment",
+					Tags:        []string{"Attachments"},
+					Parameters: []*parameter{
+						componentParam("Channel"),
+						componentParam("Document"),
+						componentParam("Attachment"),
+						headerParam("If-None-Match", "Return 304 Not Modified if the attachment still has one of these ETags"),
+					},
+					Responses: map[string]*response{
+						"200": ok,
+						"304": {Description: "Attachment has not changed since the ETag in If-None-Match"},
+						"400": b.errorResponse("Invalid channel, document or attachment name"),
+						"404": b.errorResponse("Attachment not found"),
+					},
+				}
+			},
+		},
+		{
+			method: "DELETE", pattern: attachmentPattern, path: attachmentPath, action: "_attachments",
+			handle: (*Handler).DeleteAttachment,
+			doc: func(b *specBuilder) *operation {
+				return &operation{
+					Summary:     "Delete a binary attachment",
+					Description: "Removes an attachment of the document. Deleting the document removes all of its attachments.",
+					OperationID: "deleteAttachment",
+					Tags:        []string{"Attachments"},
+					Parameters:  []*parameter{componentParam("Channel"), componentParam("Document"), componentParam("Attachment")},
+					Responses: map[string]*response{
+						"204": {Description: "Attachment removed"},
+						"400": b.errorResponse("Invalid channel, document or attachment name"),
+						"404": b.errorResponse("Attachment not found"),
+					},
+				}
+			},
+		},
+	}
+}
+
+// publicPrefixes returns the paths of public routes; patterns ending in
+// a slash or a wildcard match every path below them
+func publicPrefixes() []string {
+	var prefixes []string
+	for _, rt := range apiRoutes() {
+		if rt.public {
+			prefix, _, _ := strings.Cut(rt.pattern, "{")
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes
+}
+
+// isPublic reports whether a request path matches one of the public prefixes
+func isPublic(prefixes []string, path string) bool {
+	for _, p := range prefixes {
+		if path == p || strings.HasSuffix(p, "/") && strings.HasPrefix(path, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+
+	"github.com/rashpile/pako-justdoc/internal/model"
+	"github.com/rashpile/pako-justdoc/internal/storage"
+)
+
+// schemaCache keeps compiled channel schemas so documents aren't validated
+// against a schema that is recompiled on every write
+type schemaCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedSchema
+}
+
+type cachedSchema struct {
+	raw    []byte
+	schema *model.Schema
+}
+
+func newSchemaCache() *schemaCache {
+	return &schemaCache{entries: make(map[string]cachedSchema)}
+}
+
+// get returns the compiled form of raw, compiling it if the cached
+// entry for the channel is missing or stale
+func (c *schemaCache) get(channel string, raw []byte) (*model.Schema, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[channel]; ok && bytes.Equal(e.raw, raw) {
+		return e.schema, nil
+	}
+	schema, err := model.CompileSchema(raw)
+	if err != nil {
+		return nil, err
+	}
+	c.entries[channel] = cachedSchema{raw: raw, schema: schema}
+	return schema, nil
+}
+
+// channelSchema returns the compiled schema of a channel,
+// or nil if the channel has no schema
+func (h *Handler) channelSchema(channel string) (*model.Schema, error) {
+	raw, err := h.storage.GetSchema(channel)
+	if err == storage.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return h.schemas.get(channel, raw)
+}
+
+// validateDocument checks data against the channel schema, if any.
+// Returns the violations found, or nil when the document is valid or the
+// channel has no schema.
+func (h *Handler) validateDocument(channel string, data []byte) ([]model.SchemaViolation, error) {
+	schema, err := h.channelSchema(channel)
+	if err != nil || schema == nil {
+		return nil, err
+	}
+	return schema.Validate(data)
+}
+
+// GetSchema handles GET /{channel}/_schema
+func (h *Handler) GetSchema(w http.ResponseWriter, r *http.Request) {
+	channel := r.PathValue("channel")
+
+	if !model.IsValidName(channel) {
+		writeError(w, http.StatusBadRequest, model.ErrCodeInvalidName, "Invalid channel name")
+		return
+	}
+
+	data, err := h.storage.GetSchema(channel)
+	if err == storage.ErrNotFound {
+		writeError(w, http.StatusNotFound, model.ErrCodeNotFound, "Schema not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/schema+json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
+
+// PutSchema handles PUT /{channel}/_schema
+func (h *Handler) PutSchema(w http.ResponseWriter, r *http.Request) {
+	channel := r.PathValue("channel")
+
+	if !model.IsValidName(channel) {
+		writeError(w, http.StatusBadRequest, model.ErrCodeInvalidName, "Invalid channel name")
+		return
+	}
+
+	data, ok := h.readJSONBody(w, r)
+	if !ok {
+		return
+	}
+	if _, err := model.CompileSchema(data); err != nil {
+		writeError(w, http.StatusBadRequest, model.ErrCodeInvalidSchema, "Invalid JSON Schema: "+err.Error())
+		return
+	}
+
+	if err := h.storage.PutSchema(channel, data); err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to store schema")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteSchema handles DELETE /{channel}/_schema
+func (h *Handler) DeleteSchema(w http.ResponseWriter, r *http.Request) {
+	channel := r.PathValue("channel")
+
+	if !model.IsValidName(channel) {
+		writeError(w, http.StatusBadRequest, model.ErrCodeInvalidName, "Invalid channel name")
+		return
+	}
+
+	err := h.storage.DeleteSchema(channel)
+	if err == storage.ErrNotFound {
+		writeError(w, http.StatusNotFound, model.ErrCodeNotFound, "Schema not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to delete schema")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeSchemaViolation(w http.ResponseWriter, violations []model.SchemaViolation) {
+	writeJSON(w, http.StatusBadRequest, model.ErrorResponse{
+		Error:      model.ErrCodeSchemaViolation,
+		Message:    "Document does not match the channel schema",
+		Violations: violations,
+	})
+}
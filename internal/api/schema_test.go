@@ -0,0 +1,249 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rashpile/pako-justdoc/internal/model"
+)
+
+const testSchema = `{
+	"type": "object",
+	"required": ["theme"],
+	"properties": {
+		"theme": {"type": "string", "enum": ["dark", "light"]}
+	}
+}`
+
+func putSchema(t *testing.T, handler *Handler, channel, schema string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPut, "/"+channel+"/_schema", strings.NewReader(schema))
+	req.SetPathValue("channel", channel)
+	w := httptest.NewRecorder()
+	handler.PutSchema(w, req)
+	return w
+}
+
+func postDocument(t *testing.T, handler *Handler, channel, document, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/"+channel+"/"+document, strings.NewReader(body))
+	req.SetPathValue("channel", channel)
+	req.SetPathValue("document", document)
+	w := httptest.NewRecorder()
+	handler.PostDocument(w, req)
+	return w
+}
+
+func TestPutSchema_GetSchema(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	if w := putSchema(t, handler, "myapp", testSchema); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusNoContent, w.Code, w.Body.String())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/myapp/_schema", nil)
+	req.SetPathValue("channel", "myapp")
+	w := httptest.NewRecorder()
+	handler.GetSchema(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if w.Body.String() != testSchema {
+		t.Errorf("Expected stored schema, got %q", w.Body.String())
+	}
+}
+
+func TestPutSchema_InvalidSchema(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	w := putSchema(t, handler, "myapp", `{"type": 42}`)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	var resp model.ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if resp.Error != model.ErrCodeInvalidSchema {
+		t.Errorf("Expected error code %q, got %q", model.ErrCodeInvalidSchema, resp.Error)
+	}
+}
+
+func TestPutSchema_ExternalRef(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	path := filepath.Join(t.TempDir(), "secret.json")
+	if err := os.WriteFile(path, []byte(`{"title": "top-secret-content"}`), 0o600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	for _, ref := range []string{"file://" + filepath.ToSlash(path), "http://127.0.0.1:1/schema.json"} {
+		w := putSchema(t, handler, "myapp", `{"$ref": "`+ref+`"}`)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d, got %d", ref, http.StatusBadRequest, w.Code)
+		}
+		var resp model.ErrorResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to parse response: %v", err)
+		}
+		if resp.Error != model.ErrCodeInvalidSchema {
+			t.Errorf("%s: expected error code %q, got %q", ref, model.ErrCodeInvalidSchema, resp.Error)
+		}
+		if strings.Contains(resp.Message, "top-secret") || strings.Contains(resp.Message, ref) {
+			t.Errorf("%s: error message reveals the reference: %q", ref, resp.Message)
+		}
+	}
+}
+
+func TestDeleteSchema(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	putSchema(t, handler, "myapp", testSchema)
+
+	for _, want := range []int{http.StatusNoContent, http.StatusNotFound} {
+		req := httptest.NewRequest(http.MethodDelete, "/myapp/_schema", nil)
+		req.SetPathValue("channel", "myapp")
+		w := httptest.NewRecorder()
+		handler.DeleteSchema(w, req)
+		if w.Code != want {
+			t.Errorf("Expected status %d, got %d", want, w.Code)
+		}
+	}
+
+	// Documents are no longer validated
+	if w := postDocument(t, handler, "myapp", "settings", `{"theme": 1}`); w.Code != http.StatusCreated {
+		t.Errorf("Expected status %d, got %d", http.StatusCreated, w.Code)
+	}
+}
+
+func TestPostDocument_SchemaViolation(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	putSchema(t, handler, "myapp", testSchema)
+
+	w := postDocument(t, handler, "myapp", "settings", `{"theme": "blue"}`)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	var resp model.ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if resp.Error != model.ErrCodeSchemaViolation {
+		t.Errorf("Expected error code %q, got %q", model.ErrCodeSchemaViolation, resp.Error)
+	}
+	if len(resp.Violations) != 1 || resp.Violations[0].Location != "/theme" {
+		t.Errorf("Expected a single violation at /theme, got %+v", resp.Violations)
+	}
+
+	// Rejected document must not be stored
+	if _, err := handler.storage.GetDocument("myapp", "settings"); err == nil {
+		t.Error("Expected rejected document not to be stored")
+	}
+
+	if w := postDocument(t, handler, "myapp", "settings", `{"theme": "dark"}`); w.Code != http.StatusCreated {
+		t.Errorf("Expected status %d for valid document, got %d", http.StatusCreated, w.Code)
+	}
+}
+
+// TestPostDocument_ReservedNames checks that documents cannot be written
+// under names whose URLs are shadowed by channel and admin endpoints
+func TestPostDocument_ReservedNames(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+	router := NewRouter(handler)
+
+	for _, path := range []string{"/myapp/_schema", "/_/docs", "/_/backup", "/_/browse"} {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{"a": 1}`))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("POST %s: expected status %d, got %d", path, http.StatusBadRequest, w.Code)
+			continue
+		}
+		var resp model.ErrorResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to parse response: %v", err)
+		}
+		if resp.Error != model.ErrCodeInvalidName {
+			t.Errorf("POST %s: expected error code %q, got %q", path, model.ErrCodeInvalidName, resp.Error)
+		}
+	}
+
+	channels, err := handler.storage.ListChannels()
+	if err != nil {
+		t.Fatalf("ListChannels failed: %v", err)
+	}
+	if len(channels) != 0 {
+		t.Errorf("Expected nothing to be stored, got %+v", channels)
+	}
+}
+
+// TestLegacyReservedNames checks that documents stored under names that
+// were valid before underscores were reserved stay readable and writable
+func TestLegacyReservedNames(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+	router := NewRouter(handler)
+
+	for _, path := range []string{"/_old/doc", "/app/_legacy"} {
+		ch, doc, _ := strings.Cut(path[1:], "/")
+		if _, err := handler.storage.PutDocument(ch, doc, []byte(`{"v": 1}`)); err != nil {
+			t.Fatalf("PutDocument failed: %v", err)
+		}
+	}
+
+	tests := []struct {
+		method, path, body string
+		want               int
+	}{
+		{http.MethodGet, "/_old/doc", "", http.StatusOK},
+		{http.MethodGet, "/app/_legacy", "", http.StatusOK},
+		{http.MethodPost, "/_old/doc", `{"v": 2}`, http.StatusOK},
+		{http.MethodPatch, "/app/_legacy", `{"v": 2}`, http.StatusOK},
+		{http.MethodPost, "/_old/new", `{"v": 1}`, http.StatusBadRequest},
+		{http.MethodPost, "/app/_new", `{"v": 1}`, http.StatusBadRequest},
+		{http.MethodDelete, "/_old/doc", "", http.StatusOK},
+		{http.MethodDelete, "/app/_legacy", "", http.StatusOK},
+		{http.MethodPost, "/app/_legacy", `{"v": 1}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s %s: expected status %d, got %d: %s", tt.method, tt.path, tt.want, w.Code, w.Body.String())
+		}
+	}
+
+	if _, err := handler.storage.PutDocument("app", "_legacy", []byte(`{"v": 1}`)); err != nil {
+		t.Fatalf("PutDocument failed: %v", err)
+	}
+	w, _ := postBatch(t, handler, `[{"op": "put", "channel": "app", "document": "_legacy", "value": {"v": 3}}]`)
+	if w.Code != http.StatusOK {
+		t.Errorf("Batch update of legacy document: expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	w, _ = postBatch(t, handler, `[{"op": "put", "channel": "app", "document": "_other", "value": {"v": 1}}]`)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Batch create under reserved name: expected status %d, got %d: %s", http.StatusBadRequest, w.Code, w.Body.String())
+	}
+
+	names, err := handler.storage.ListDocuments("app")
+	if err != nil || strings.Join(names, ",") != "_legacy" {
+		t.Errorf("Expected only _legacy in app, got %v (%v)", names, err)
+	}
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"github.com/rashpile/pako-justdoc/internal/model"
+	"github.com/rashpile/pako-justdoc/internal/storage"
+)
+
+// channelSettings returns the settings of a channel: the stored ones, or
+// the server defaults if none are stored
+func (h *Handler) channelSettings(channel string) (model.ChannelSettings, error) {
+	raw, err := h.storage.GetSettings(channel)
+	if err == storage.ErrNotFound {
+		return model.ChannelSettings{Normalize: h.normalize["*"] || h.normalize[channel]}, nil
+	}
+	if err != nil {
+		return model.ChannelSettings{}, err
+	}
+	var settings model.ChannelSettings
+	err = json.Unmarshal(raw, &settings)
+	return settings, err
+}
+
+// GetSettings handles GET /{channel}/_settings
+// Channels without stored settings report the server defaults.
+func (h *Handler) GetSettings(w http.ResponseWriter, r *http.Request) {
+	channel := r.PathValue("channel")
+
+	if !model.IsValidName(channel) {
+		writeError(w, http.StatusBadRequest, model.ErrCodeInvalidName, "Invalid channel name")
+		return
+	}
+
+	settings, err := h.channelSettings(channel)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+		return
+	}
+	writeJSON(w, http.StatusOK, settings)
+}
+
+// PutSettings handles PUT /{channel}/_settings
+// The settings replace the server defaults for the channel.
+func (h *Handler) PutSettings(w http.ResponseWriter, r *http.Request) {
+	channel := r.PathValue("channel")
+
+	if !model.IsValidName(channel) {
+		writeError(w, http.StatusBadRequest, model.ErrCodeInvalidName, "Invalid channel name")
+		return
+	}
+
+	data, ok := h.readJSONBody(w, r)
+	if !ok {
+		return
+	}
+	var settings model.ChannelSettings
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&settings); err != nil {
+		writeError(w, http.StatusBadRequest, model.ErrCodeInvalidOperation, "Invalid channel settings: "+err.Error())
+		return
+	}
+	data, err := json.Marshal(settings)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+		return
+	}
+
+	if err := h.storage.PutSettings(channel, data); err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to store settings")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteSettings handles DELETE /{channel}/_settings
+// The channel goes back to the server defaults.
+func (h *Handler) DeleteSettings(w http.ResponseWriter, r *http.Request) {
+	channel := r.PathValue("channel")
+
+	if !model.IsValidName(channel) {
+		writeError(w, http.StatusBadRequest, model.ErrCodeInvalidName, "Invalid channel name")
+		return
+	}
+
+	err := h.storage.DeleteSettings(channel)
+	if err == storage.ErrNotFound {
+		writeError(w, http.StatusNotFound, model.ErrCodeNotFound, "Settings not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to delete settings")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rashpile/pako-justdoc/internal/model"
+	"github.com/rashpile/pako-justdoc/internal/storage"
+)
+
+func TestChannelSettings(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	defer func() { _ = store.Close() }()
+	handler := NewHandler(store, WithNormalizedChannels("defaults"))
+	router := NewRouter(handler)
+
+	do := func(method, url, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, url, strings.NewReader(body)))
+		return w
+	}
+	settings := func(channel string) model.ChannelSettings {
+		t.Helper()
+		w := do(http.MethodGet, "/"+channel+"/_settings", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET settings: expected status 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var s model.ChannelSettings
+		if err := json.Unmarshal(w.Body.Bytes(), &s); err != nil {
+			t.Fatalf("Failed to parse settings: %v", err)
+		}
+		return s
+	}
+
+	// Channels without stored settings follow NORMALIZE_CHANNELS
+	if !settings("defaults").Normalize || settings("app").Normalize {
+		t.Fatal("Expected the configured defaults")
+	}
+
+	if w := do(http.MethodPut, "/app/_settings", `{"normalize": true}`); w.Code != http.StatusNoContent {
+		t.Fatalf("PUT settings: expected status 204, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodPut, "/defaults/_settings", `{"normalize": false}`); w.Code != http.StatusNoContent {
+		t.Fatalf("PUT settings: expected status 204, got %d: %s", w.Code, w.Body.String())
+	}
+	if !settings("app").Normalize || settings("defaults").Normalize {
+		t.Fatal("Expected stored settings to override the defaults")
+	}
+
+	postDocument(t, handler, "app", "doc", `{"b": 1, "a": 2}`)
+	postDocument(t, handler, "defaults", "doc", `{"b": 1, "a": 2}`)
+	if data, _ := store.GetDocument("app", "doc"); string(data) != `{"a":2,"b":1}` {
+		t.Errorf("Expected normalized document, got %s", data)
+	}
+	if data, _ := store.GetDocument("defaults", "doc"); string(data) != `{"b": 1, "a": 2}` {
+		t.Errorf("Expected document stored as sent, got %s", data)
+	}
+
+	// Deleting the settings restores the defaults
+	if w := do(http.MethodDelete, "/defaults/_settings", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("DELETE settings: expected status 204, got %d", w.Code)
+	}
+	if !settings("defaults").Normalize {
+		t.Error("Expected the default after deleting the settings")
+	}
+	if w := do(http.MethodDelete, "/defaults/_settings", ""); w.Code != http.StatusNotFound {
+		t.Errorf("DELETE settings again: expected status 404, got %d", w.Code)
+	}
+
+	for _, tt := range []struct {
+		name, url, body string
+	}{
+		{"unknown setting", "/app/_settings", `{"normalise": true}`},
+		{"wrong type", "/app/_settings", `{"normalize": "yes"}`},
+		{"invalid JSON", "/app/_settings", `{`},
+		{"invalid channel", "/my.app/_settings", `{}`},
+	} {
+		if w := do(http.MethodPut, tt.url, tt.body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", tt.name, w.Code)
+		}
+	}
+	if !settings("app").Normalize {
+		t.Error("Expected rejected settings to leave the stored ones alone")
+	}
+}
@@ -0,0 +1,166 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rashpile/pako-justdoc/internal/model"
+)
+
+// DefaultShareLifetime is the lifetime of share links that don't ask for one
+const DefaultShareLifetime = 24 * time.Hour
+
+// SharePrincipal is the principal of requests authenticated by a share link
+const SharePrincipal = "share"
+
+// ShareLinks signs and verifies share tokens. A token embeds the channel,
+// document, permission and expiry it grants, followed by an HMAC-SHA256 of
+// them, so links need no server-side state and can't be altered.
+type ShareLinks struct {
+	secret []byte
+	maxAge time.Duration
+	now    func() time.Time
+}
+
+// NewShareLinks returns share links signed with secret whose lifetime is
+// at most maxAge
+func NewShareLinks(secret []byte, maxAge time.Duration) *ShareLinks {
+	return &ShareLinks{secret: secret, maxAge: maxAge, now: time.Now}
+}
+
+// shareClaims is the signed payload of a share token
+type shareClaims struct {
+	Channel    string `json:"c"`
+	Document   string `json:"d"`
+	Permission string `json:"p"`
+	Expires    int64  `json:"exp"`
+}
+
+var tokenEncoding = base64.RawURLEncoding
+
+// sign returns the token for claims
+func (s *ShareLinks) sign(c shareClaims) string {
+	payload, _ := json.Marshal(c)
+	return tokenEncoding.EncodeToString(payload) + "." + tokenEncoding.EncodeToString(s.mac(payload))
+}
+
+// verify returns the claims of an authentic, unexpired token
+func (s *ShareLinks) verify(token string) (shareClaims, bool) {
+	var c shareClaims
+	encoded, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return c, false
+	}
+	payload, err := tokenEncoding.DecodeString(encoded)
+	if err != nil {
+		return c, false
+	}
+	mac, err := tokenEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(mac, s.mac(payload)) {
+		return c, false
+	}
+	if json.Unmarshal(payload, &c) != nil || s.now().Unix() >= c.Expires {
+		return c, false
+	}
+	return c, true
+}
+
+func (s *ShareLinks) mac(payload []byte) []byte {
+	m := hmac.New(sha256.New, s.secret)
+	m.Write(payload)
+	return m.Sum(nil)
+}
+
+// allows reports whether token grants the request: a read of the shared
+// document itself or of its viewer page
+func (s *ShareLinks) allows(r *http.Request, token string) bool {
+	c, ok := s.verify(token)
+	if !ok || c.Permission != model.PermissionRead {
+		return false
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/_/view")
+	return path == "/"+c.Channel+"/"+c.Document
+}
+
+// CreateShareLink handles POST /_/share
+// It signs a link granting read access to one document until it expires,
+// even when authentication is enabled.
+func (h *Handler) CreateShareLink(w http.ResponseWriter, r *http.Request) {
+	if h.shares == nil {
+		writeError(w, http.StatusNotImplemented, model.ErrCodeNotImplemented, "Share links are not enabled")
+		return
+	}
+	data, ok := h.readJSONBody(w, r)
+	if !ok {
+		return
+	}
+
+	var req model.ShareRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		writeError(w, http.StatusBadRequest, model.ErrCodeInvalidJSON, "Share request must be an object")
+		return
+	}
+	if !model.IsValidName(req.Channel) || !model.IsValidName(req.Document) {
+		writeError(w, http.StatusBadRequest, model.ErrCodeInvalidName, "Invalid channel or document name")
+		return
+	}
+	if req.Permission == "" {
+		req.Permission = model.PermissionRead
+	}
+	if req.Permission != model.PermissionRead {
+		writeError(w, http.StatusBadRequest, model.ErrCodeInvalidOperation, "Unsupported permission: "+req.Permission)
+		return
+	}
+	lifetime := min(DefaultShareLifetime, h.shares.maxAge)
+	if req.ExpiresIn != "" {
+		d, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil || d <= 0 {
+			writeError(w, http.StatusBadRequest, model.ErrCodeInvalidOperation, "expires_in must be a positive duration such as 24h")
+			return
+		}
+		if d > h.shares.maxAge {
+			writeError(w, http.StatusBadRequest, model.ErrCodeInvalidOperation, "expires_in must not exceed "+h.shares.maxAge.String())
+			return
+		}
+		lifetime = d
+	}
+
+	exists := false
+	err := h.storage.ViewDocuments(req.Channel, []string{req.Document}, func(_ string, data []byte) error {
+		exists = data != nil
+		return nil
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "Internal server error")
+		return
+	}
+	if !exists {
+		writeError(w, http.StatusNotFound, model.ErrCodeNotFound, "Document not found")
+		return
+	}
+
+	expires := h.shares.now().Add(lifetime).Truncate(time.Second)
+	token := h.shares.sign(shareClaims{
+		Channel:    req.Channel,
+		Document:   req.Document,
+		Permission: req.Permission,
+		Expires:    expires.Unix(),
+	})
+	writeJSON(w, http.StatusCreated, model.ShareResponse{
+		Token:      token,
+		URL:        "/_/view/" + req.Channel + "/" + req.Document + "?token=" + url.QueryEscape(token),
+		Channel:    req.Channel,
+		Document:   req.Document,
+		Permission: req.Permission,
+		Expires:    expires.UTC(),
+	})
+}
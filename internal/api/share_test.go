@@ -0,0 +1,207 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rashpile/pako-justdoc/internal/model"
+	"github.com/rashpile/pako-justdoc/internal/storage"
+)
+
+var testNow = time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func newTestShareLinks() *ShareLinks {
+	s := NewShareLinks([]byte("test-share-secret-0123456789"), 7*24*time.Hour)
+	s.now = func() time.Time { return testNow }
+	return s
+}
+
+func TestShareLinks_Verify(t *testing.T) {
+	s := newTestShareLinks()
+	claims := shareClaims{Channel: "myapp", Document: "settings", Permission: model.PermissionRead, Expires: testNow.Add(time.Hour).Unix()}
+	token := s.sign(claims)
+	payload, sig, _ := strings.Cut(token, ".")
+
+	other := NewShareLinks([]byte("another-secret-0123456789"), time.Hour)
+	forged, _ := json.Marshal(shareClaims{Channel: "myapp", Document: "secrets", Permission: model.PermissionRead, Expires: claims.Expires})
+
+	tests := []struct {
+		name  string
+		token string
+		want  bool
+	}{
+		{name: "valid", token: token, want: true},
+		{name: "expired", token: s.sign(shareClaims{Channel: "myapp", Document: "settings", Permission: model.PermissionRead, Expires: testNow.Unix()})},
+		{name: "other document", token: tokenEncoding.EncodeToString(forged) + "." + sig},
+		{name: "truncated signature", token: payload + "." + sig[:len(sig)-2]},
+		{name: "other secret", token: other.sign(claims)},
+		{name: "no signature", token: payload},
+		{name: "garbage", token: "not a token"},
+		{name: "empty", token: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := s.verify(tt.token)
+			if ok != tt.want {
+				t.Fatalf("expected valid=%v, got %v", tt.want, ok)
+			}
+			if ok && got != claims {
+				t.Errorf("expected claims %+v, got %+v", claims, got)
+			}
+		})
+	}
+}
+
+func TestCreateShareLink(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	defer store.Close()
+	handler := NewHandler(store, WithShareLinks(newTestShareLinks()))
+	router := NewRouter(handler)
+	postDocument(t, handler, "myapp", "settings", `{"theme": "dark"}`)
+
+	share := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/_/share", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := share(`{"channel": "myapp", "document": "settings"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var resp model.ShareResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if !resp.Expires.Equal(testNow.Add(DefaultShareLifetime)) {
+		t.Errorf("expected expiry %v, got %v", testNow.Add(DefaultShareLifetime), resp.Expires)
+	}
+	if resp.Permission != model.PermissionRead {
+		t.Errorf("expected permission read, got %q", resp.Permission)
+	}
+	if want := "/_/view/myapp/settings?token=" + url.QueryEscape(resp.Token); resp.URL != want {
+		t.Errorf("expected URL %q, got %q", want, resp.URL)
+	}
+	claims, ok := handler.shares.verify(resp.Token)
+	if !ok || claims.Channel != "myapp" || claims.Document != "settings" {
+		t.Errorf("token doesn't grant the document: %+v", claims)
+	}
+
+	w = share(`{"channel": "myapp", "document": "settings", "expires_in": "90m"}`)
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || !resp.Expires.Equal(testNow.Add(90*time.Minute)) {
+		t.Errorf("expected expiry in 90m, got %s", w.Body.String())
+	}
+
+	failures := []struct {
+		name string
+		body string
+		want int
+		code string
+	}{
+		{name: "not an object", body: `[]`, want: http.StatusBadRequest, code: model.ErrCodeInvalidJSON},
+		{name: "invalid name", body: `{"channel": "my app", "document": "settings"}`, want: http.StatusBadRequest, code: model.ErrCodeInvalidName},
+		{name: "write permission", body: `{"channel": "myapp", "document": "settings", "permission": "write"}`, want: http.StatusBadRequest, code: model.ErrCodeInvalidOperation},
+		{name: "bad duration", body: `{"channel": "myapp", "document": "settings", "expires_in": "soon"}`, want: http.StatusBadRequest, code: model.ErrCodeInvalidOperation},
+		{name: "too long", body: `{"channel": "myapp", "document": "settings", "expires_in": "200h"}`, want: http.StatusBadRequest, code: model.ErrCodeInvalidOperation},
+		{name: "missing document", body: `{"channel": "myapp", "document": "nope"}`, want: http.StatusNotFound, code: model.ErrCodeNotFound},
+	}
+	for _, tt := range failures {
+		t.Run(tt.name, func(t *testing.T) {
+			w := share(tt.body)
+			if w.Code != tt.want {
+				t.Fatalf("expected status %d, got %d: %s", tt.want, w.Code, w.Body.String())
+			}
+			var errResp model.ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &errResp); err != nil || errResp.Error != tt.code {
+				t.Errorf("expected error %q, got %s", tt.code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestCreateShareLink_NotEnabled(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	req := httptest.NewRequest(http.MethodPost, "/_/share", strings.NewReader(`{"channel": "myapp", "document": "settings"}`))
+	w := httptest.NewRecorder()
+	handler.CreateShareLink(w, req)
+
+	if w.Code != http.StatusNotImplemented {
+		t.Errorf("expected status %d, got %d", http.StatusNotImplemented, w.Code)
+	}
+}
+
+func TestAuthenticate_ShareLink(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	defer store.Close()
+	shares := newTestShareLinks()
+	handler := NewHandler(store, WithShareLinks(shares))
+	postDocument(t, handler, "myapp", "settings", `{"theme": "dark"}`)
+	postDocument(t, handler, "myapp", "secrets", `{"password": "hunter2"}`)
+
+	var principal string
+	router := NewRouter(handler)
+	auth := Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal = Principal(r)
+		router.ServeHTTP(w, r)
+	}), AuthOptions{APIKeys: []string{"key"}, ShareLinks: shares})
+
+	token := url.QueryEscape(shares.sign(shareClaims{Channel: "myapp", Document: "settings", Permission: model.PermissionRead, Expires: testNow.Add(time.Hour).Unix()}))
+	expired := url.QueryEscape(shares.sign(shareClaims{Channel: "myapp", Document: "settings", Permission: model.PermissionRead, Expires: testNow.Add(-time.Hour).Unix()}))
+	write := url.QueryEscape(shares.sign(shareClaims{Channel: "myapp", Document: "settings", Permission: "write", Expires: testNow.Add(time.Hour).Unix()}))
+
+	tests := []struct {
+		name      string
+		method    string
+		path      string
+		want      int
+		challenge bool
+	}{
+		{name: "document", method: http.MethodGet, path: "/myapp/settings?token=" + token, want: http.StatusOK},
+		{name: "head", method: http.MethodHead, path: "/myapp/settings?token=" + token, want: http.StatusOK},
+		{name: "viewer", method: http.MethodGet, path: "/_/view/myapp/settings?token=" + token, want: http.StatusOK},
+		{name: "other document", method: http.MethodGet, path: "/myapp/secrets?token=" + token, want: http.StatusUnauthorized},
+		{name: "editor", method: http.MethodGet, path: "/_/edit/myapp/settings?token=" + token, want: http.StatusUnauthorized},
+		{name: "diff", method: http.MethodGet, path: "/myapp/settings/_diff?to=secrets&token=" + token, want: http.StatusUnauthorized},
+		{name: "write", method: http.MethodPost, path: "/myapp/settings?token=" + token, want: http.StatusUnauthorized},
+		{name: "delete", method: http.MethodDelete, path: "/myapp/settings?token=" + token, want: http.StatusUnauthorized},
+		{name: "expired", method: http.MethodGet, path: "/myapp/settings?token=" + expired, want: http.StatusUnauthorized},
+		{name: "unsupported permission", method: http.MethodGet, path: "/myapp/settings?token=" + write, want: http.StatusUnauthorized},
+		{name: "no token", method: http.MethodGet, path: "/myapp/settings", want: http.StatusUnauthorized, challenge: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			principal = ""
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(`{}`))
+			w := httptest.NewRecorder()
+			auth.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Fatalf("expected status %d, got %d: %s", tt.want, w.Code, w.Body.String())
+			}
+			if tt.want == http.StatusOK && principal != SharePrincipal {
+				t.Errorf("expected principal %q, got %q", SharePrincipal, principal)
+			}
+			// Browsers shouldn't prompt for a password when a link has expired
+			if got := w.Header().Get("WWW-Authenticate") != ""; tt.want == http.StatusUnauthorized && got != tt.challenge {
+				t.Errorf("expected challenge=%v, got %v", tt.challenge, got)
+			}
+		})
+	}
+
+	// API keys still work alongside a token
+	req := httptest.NewRequest(http.MethodGet, "/myapp/secrets?token="+token, nil)
+	req.Header.Set("X-API-Key", "key")
+	w := httptest.NewRecorder()
+	auth.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || principal != APIKeyPrincipal {
+		t.Errorf("expected API key access, got %d as %q", w.Code, principal)
+	}
+}
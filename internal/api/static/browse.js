@@ -0,0 +1,89 @@
+(function() {
+    const filter = document.getElementById('filter');
+    const rows = Array.from(document.querySelectorAll('#items tbody tr'));
+    const empty = document.getElementById('empty');
+    const emptyText = empty.textContent;
+    const dialog = document.getElementById('new-dialog');
+    const form = document.getElementById('new-form');
+    const channelInput = document.getElementById('new-channel');
+    const documentInput = document.getElementById('new-document');
+    const error = document.getElementById('new-error');
+    // Same rule as model.NewNamePattern on the server
+    const validName = new RegExp(NAME_PATTERN);
+
+    // Show modification times in the local time zone
+    document.querySelectorAll('time[datetime]').forEach(t => {
+        t.textContent = new Date(t.getAttribute('datetime')).toLocaleString();
+    });
+
+    // Search-as-you-type filtering
+    function applyFilter() {
+        const query = filter.value.trim().toLowerCase();
+        let visible = 0;
+        rows.forEach(row => {
+            const match = row.dataset.name.toLowerCase().includes(query);
+            row.hidden = !match;
+            if (match) visible++;
+        });
+        empty.textContent = rows.length === 0 ? emptyText : 'No names match "' + filter.value.trim() + '".';
+        empty.hidden = visible > 0;
+    }
+
+    // New document dialog
+    function openDialog() {
+        error.textContent = '';
+        form.reset();
+        dialog.showModal();
+        (channelInput || documentInput).focus();
+    }
+
+    function checkName(kind, name) {
+        if (name === '') return kind + ' name is required';
+        if (!validName.test(name)) return 'Invalid ' + kind.toLowerCase() + ' name "' + name + '"';
+        return '';
+    }
+
+    async function createDocument(e) {
+        e.preventDefault();
+        const channel = channelInput ? channelInput.value.trim() : CHANNEL;
+        const name = documentInput.value.trim();
+        const problem = checkName('Channel', channel) || checkName('Document', name);
+        if (problem) {
+            error.textContent = problem;
+            return;
+        }
+
+        const url = '/' + channel + '/' + name;
+        try {
+            const res = await fetch(url, { method: 'HEAD' });
+            if (res.ok) {
+                error.textContent = 'Document ' + channel + ' / ' + name + ' already exists';
+                return;
+            }
+        } catch (e) {
+            // The editor reports connection problems
+        }
+        location.href = '/_/edit' + url;
+    }
+
+    // Event listeners
+    filter.addEventListener('input', applyFilter);
+    document.getElementById('new-btn').addEventListener('click', openDialog);
+    document.getElementById('cancel-btn').addEventListener('click', () => dialog.close());
+    form.addEventListener('submit', createDocument);
+
+    // "/" focuses the filter, Enter opens the only remaining match
+    document.addEventListener('keydown', function(e) {
+        if (e.key === '/' && document.activeElement !== filter && !dialog.open) {
+            e.preventDefault();
+            filter.focus();
+        }
+    });
+    filter.addEventListener('keydown', function(e) {
+        if (e.key !== 'Enter') return;
+        const visible = rows.filter(row => !row.hidden);
+        if (visible.length === 1) visible[0].querySelector('a').click();
+    });
+
+    applyFilter();
+})();
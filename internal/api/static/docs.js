@@ -0,0 +1,373 @@
+(function() {
+    const specUrl = '/openapi.json';
+    const keyStorage = 'justdoc-api-key';
+    const methods = ['get', 'post', 'put', 'patch', 'delete'];
+    const content = document.getElementById('content');
+    const toc = document.getElementById('toc');
+    const status = document.getElementById('status');
+    const apiKey = document.getElementById('api-key');
+    let spec = null;
+
+    // el builds an element; strings become text nodes so nothing from the
+    // spec or a response is ever parsed as HTML
+    function el(tag, attrs, ...children) {
+        const node = document.createElement(tag);
+        Object.entries(attrs || {}).forEach(([k, v]) => {
+            if (v === undefined || v === null || v === false) return;
+            if (k === 'class') node.className = v;
+            else if (k.startsWith('on')) node.addEventListener(k.slice(2), v);
+            else node.setAttribute(k, v === true ? '' : v);
+        });
+        children.flat().forEach(c => {
+            if (c === undefined || c === null || c === false || c === '') return;
+            node.appendChild(typeof c === 'string' ? document.createTextNode(c) : c);
+        });
+        return node;
+    }
+
+    // References
+    function resolve(obj) {
+        for (let i = 0; obj && obj.$ref && i < 10; i++) {
+            obj = obj.$ref.replace(/^#\//, '').split('/')
+                .map(key => key.replace(/~1/g, '/').replace(/~0/g, '~'))
+                .reduce((o, key) => o && o[key], spec);
+        }
+        return obj || {};
+    }
+
+    function refName(s) {
+        return s && s.$ref ? s.$ref.split('/').pop() : '';
+    }
+
+    // Schemas
+    function typeLabel(s) {
+        const name = refName(s);
+        if (name) return name;
+        s = resolve(s);
+        if (s.type === 'array') return typeLabel(s.items || {}) + '[]';
+        if (s.type === 'object' && !s.properties && typeof s.additionalProperties === 'object') {
+            return 'map<string, ' + typeLabel(s.additionalProperties) + '>';
+        }
+        let label = s.type || 'any';
+        if (s.format) label += ' (' + s.format + ')';
+        return label;
+    }
+
+    // objectOf unwraps arrays and maps down to the schema whose properties
+    // should be listed, if any
+    function objectOf(s) {
+        for (let i = 0; i < 5; i++) {
+            const r = resolve(s);
+            if (r.type === 'array') s = r.items || {};
+            else if (!r.properties && typeof r.additionalProperties === 'object') s = r.additionalProperties;
+            else break;
+        }
+        return s;
+    }
+
+    function renderSchema(s, seen) {
+        const target = objectOf(s);
+        const name = refName(target);
+        const r = resolve(target);
+        if (!r.properties || (name && seen.includes(name))) return null;
+        const inner = name ? seen.concat(name) : seen;
+        const required = r.required || [];
+        return el('ul', { class: 'schema' }, Object.entries(r.properties).map(([key, prop]) => {
+            const p = resolve(prop);
+            return el('li', {},
+                el('code', {}, key), ' ',
+                el('span', { class: 'type' }, typeLabel(prop)),
+                required.includes(key) && el('span', { class: 'required' }, ' required'),
+                p.description && el('div', { class: 'desc' }, p.description),
+                p.enum && el('div', { class: 'enum' }, 'One of: ' + p.enum.map(v => JSON.stringify(v)).join(', ')),
+                renderSchema(prop, inner));
+        }));
+    }
+
+    function exampleFor(s, depth) {
+        if (depth > 6) return null;
+        s = resolve(s);
+        if (s.example !== undefined) return s.example;
+        if (s.default !== undefined) return s.default;
+        if (Array.isArray(s.enum)) return s.enum[0];
+        switch (s.type) {
+        case 'object': {
+            const out = {};
+            Object.entries(s.properties || {}).forEach(([k, v]) => out[k] = exampleFor(v, depth + 1));
+            return out;
+        }
+        case 'array':
+            return [exampleFor(s.items || {}, depth + 1)];
+        case 'string':
+            return s.format === 'date-time' ? new Date().toISOString() : 'string';
+        case 'integer':
+        case 'number':
+            return 0;
+        case 'boolean':
+            return true;
+        }
+        return {};
+    }
+
+    function isBinary(s) {
+        return resolve(s).format === 'binary';
+    }
+
+    function sampleBody(type, media) {
+        if (isBinary(media.schema)) return '';
+        const value = media.example !== undefined ? media.example : exampleFor(media.schema, 0);
+        if (type.includes('ndjson')) return JSON.stringify(value) + '\n';
+        if (type.includes('json')) return JSON.stringify(value, null, 2);
+        return typeof value === 'string' ? value : '';
+    }
+
+    // Documentation
+    function isSecured(op) {
+        const security = op.security !== undefined ? op.security : spec.security;
+        return Array.isArray(security) && security.length > 0;
+    }
+
+    function renderParameters(params) {
+        return el('table', { class: 'params' },
+            el('tr', {}, el('th', {}, 'Name'), el('th', {}, 'In'), el('th', {}, 'Type'), el('th', {}, 'Description')),
+            params.map(p => el('tr', {},
+                el('td', {}, el('code', {}, p.name), p.required && el('span', { class: 'required' }, ' required')),
+                el('td', {}, p.in),
+                el('td', {}, typeLabel(p.schema || {})),
+                el('td', {}, p.description || '',
+                    (p.schema && resolve(p.schema).enum) && el('div', { class: 'enum' },
+                        'One of: ' + resolve(p.schema).enum.join(', '))))));
+    }
+
+    function renderContent(mediaTypes) {
+        return Object.entries(mediaTypes || {}).map(([type, media]) => el('div', { class: 'media' },
+            el('div', {}, el('code', {}, type), ' ', el('span', { class: 'type' }, typeLabel(media.schema || {}))),
+            renderSchema(media.schema || {}, []),
+            media.example !== undefined && el('pre', { class: 'example' }, JSON.stringify(media.example, null, 2))));
+    }
+
+    function renderResponses(responses) {
+        return Object.keys(responses).sort().map(code => {
+            const res = resolve(responses[code]);
+            return el('details', { class: 'response' },
+                el('summary', {}, el('span', { class: 'code code-' + code[0] }, code), ' ', res.description || ''),
+                Object.keys(res.headers || {}).length > 0 && el('div', { class: 'headers' },
+                    Object.entries(res.headers).map(([name, h]) => el('div', {},
+                        el('code', {}, name), ' ', resolve(h).description || ''))),
+                renderContent(res.content));
+        });
+    }
+
+    // Try it out
+    function paramInput(p) {
+        const s = resolve(p.schema || {});
+        const initial = p.example !== undefined ? p.example : s.default;
+        let input;
+        if (Array.isArray(s.enum) || s.type === 'boolean') {
+            const options = Array.isArray(s.enum) ? s.enum : [true, false];
+            input = el('select', {}, !p.required && el('option', { value: '' }, ''),
+                options.map(v => el('option', { value: String(v) }, String(v))));
+        } else {
+            input = el('input', { type: 'text', placeholder: typeLabel(p.schema || {}) });
+        }
+        if (initial !== undefined) input.value = String(initial);
+        return input;
+    }
+
+    function renderTryIt(path, method, op) {
+        const params = (op.parameters || []).map(resolve).map(p => ({ param: p, input: paramInput(p) }));
+        const body = op.requestBody ? resolve(op.requestBody) : null;
+        const types = body ? Object.keys(body.content || {}) : [];
+        const typeSelect = el('select', {}, types.map(t => el('option', { value: t }, t)));
+        const bodyArea = el('div', { class: 'body-input' });
+        const output = el('div', { class: 'result' });
+        const sendBtn = el('button', { type: 'submit' }, 'Send');
+
+        function updateBody() {
+            const type = typeSelect.value;
+            const media = body.content[type] || {};
+            bodyArea.replaceChildren(isBinary(media.schema)
+                ? el('input', { type: 'file' })
+                : el('textarea', { spellcheck: 'false', rows: '8' }, sampleBody(type, media)));
+        }
+
+        async function submit(e) {
+            e.preventDefault();
+            sendBtn.disabled = true;
+            try {
+                await send(path, method, params, body && {
+                    type: typeSelect.value,
+                    input: bodyArea.firstChild
+                }, output);
+            } finally {
+                sendBtn.disabled = false;
+            }
+        }
+
+        if (body) {
+            typeSelect.addEventListener('change', updateBody);
+            updateBody();
+        }
+
+        return el('form', { class: 'try', onsubmit: submit },
+            params.length > 0 && el('div', { class: 'fields' }, params.map(({ param, input }) => el('label', {},
+                el('span', {}, param.name, param.required ? ' *' : '', el('small', {}, ' ' + param.in)), input))),
+            body && el('div', { class: 'fields' }, el('label', {}, el('span', {}, 'Content-Type'), typeSelect), bodyArea),
+            el('div', { class: 'actions' }, sendBtn),
+            output);
+    }
+
+    async function send(path, method, params, body, output) {
+        const query = new URLSearchParams();
+        const headers = new Headers();
+        const missing = [];
+        let url = path;
+        params.forEach(({ param, input }) => {
+            const value = input.value;
+            if (value === '') {
+                if (param.required) missing.push(param.name);
+                return;
+            }
+            if (param.in === 'path') url = url.replace('{' + param.name + '}', encodeURIComponent(value));
+            else if (param.in === 'query') query.append(param.name, value);
+            else if (param.in === 'header') headers.set(param.name, value);
+        });
+        if (missing.length > 0) {
+            output.replaceChildren(el('p', { class: 'error' }, 'Missing required parameters: ' + missing.join(', ')));
+            return;
+        }
+        if (query.toString()) url += '?' + query.toString();
+        if (apiKey.value) headers.set('Authorization', 'Bearer ' + apiKey.value);
+
+        const init = { method: method.toUpperCase(), headers: headers };
+        if (body) {
+            headers.set('Content-Type', body.type);
+            if (body.input.type === 'file') {
+                if (body.input.files.length === 0) {
+                    output.replaceChildren(el('p', { class: 'error' }, 'Choose a file to upload'));
+                    return;
+                }
+                init.body = body.input.files[0];
+            } else {
+                init.body = body.input.value;
+            }
+        }
+
+        output.replaceChildren(el('p', {}, 'Sending ' + init.method + ' ' + url + '...'));
+        const started = performance.now();
+        let res;
+        try {
+            res = await fetch(url, init);
+        } catch (e) {
+            output.replaceChildren(el('p', { class: 'error' }, 'Request failed: ' + e.message));
+            return;
+        }
+        const elapsed = Math.round(performance.now() - started);
+        output.replaceChildren(
+            el('div', { class: 'request' }, el('code', {}, init.method + ' ' + url)),
+            el('div', {}, el('span', { class: 'code code-' + String(res.status)[0] }, res.status + ' ' + res.statusText),
+                ' ', el('small', {}, elapsed + ' ms')),
+            el('pre', { class: 'res-headers' }, Array.from(res.headers.entries()).map(([k, v]) => k + ': ' + v).join('\n')),
+            await renderBody(res));
+    }
+
+    async function renderBody(res) {
+        const type = res.headers.get('Content-Type') || '';
+        if (type.includes('json') && !type.includes('ndjson')) {
+            const text = await res.text();
+            try {
+                return el('pre', { class: 'res-body' }, JSON.stringify(JSON.parse(text), null, 2));
+            } catch (e) {
+                return el('pre', { class: 'res-body' }, text);
+            }
+        }
+        if (type.startsWith('text/') || type.includes('ndjson') || type === '') {
+            return el('pre', { class: 'res-body' }, await res.text());
+        }
+        const blob = await res.blob();
+        const match = /filename="?([^";]+)"?/.exec(res.headers.get('Content-Disposition') || '');
+        return el('p', {}, blob.size + ' bytes of ' + type + ' ',
+            el('a', { href: URL.createObjectURL(blob), download: match ? match[1] : 'download' }, 'Download'));
+    }
+
+    // Page
+    function renderOperation(path, method, op) {
+        const id = op.operationId || method + path;
+        const body = el('div', { class: 'op-body', hidden: true },
+            op.description && el('p', {}, op.description),
+            (op.parameters || []).length > 0 && [el('h4', {}, 'Parameters'), renderParameters(op.parameters.map(resolve))],
+            op.requestBody && [
+                el('h4', {}, 'Request body'),
+                resolve(op.requestBody).description && el('p', {}, resolve(op.requestBody).description),
+                renderContent(resolve(op.requestBody).content)
+            ],
+            el('h4', {}, 'Responses'), renderResponses(op.responses || {}),
+            el('h4', {}, 'Try it out'), renderTryIt(path, method, op));
+        const head = el('div', { class: 'op-head', onclick: () => toggle(section) },
+            el('span', { class: 'method ' + method }, method.toUpperCase()),
+            el('code', { class: 'path' }, path),
+            el('span', { class: 'summary' }, op.summary || ''),
+            isSecured(op) && el('span', { class: 'lock', title: 'Requires an API key when authentication is enabled' }, 'auth'));
+        const section = el('section', { class: 'op', id: id }, head, body);
+        return section;
+    }
+
+    function toggle(section, open) {
+        const body = section.querySelector('.op-body');
+        body.hidden = open === undefined ? !body.hidden : !open;
+        if (!body.hidden) history.replaceState(null, '', '#' + section.id);
+    }
+
+    function render() {
+        document.getElementById('title').textContent = spec.info.title;
+        document.getElementById('version').textContent = 'Version ' + spec.info.version;
+        document.title = spec.info.title + ' - API Explorer';
+
+        const groups = new Map((spec.tags || []).map(t => [t.name, { tag: t, ops: [] }]));
+        Object.entries(spec.paths).forEach(([path, item]) => {
+            methods.filter(m => item[m]).forEach(m => {
+                const name = (item[m].tags || ['Other'])[0];
+                if (!groups.has(name)) groups.set(name, { tag: { name: name }, ops: [] });
+                groups.get(name).ops.push(renderOperation(path, m, item[m]));
+            });
+        });
+
+        const sections = [];
+        const links = [];
+        groups.forEach(({ tag, ops }) => {
+            if (ops.length === 0) return;
+            sections.push(el('h2', { id: 'tag-' + tag.name }, tag.name),
+                tag.description && el('p', { class: 'tag-desc' }, tag.description), ops);
+            links.push(el('a', { href: '#tag-' + tag.name }, tag.name));
+        });
+        content.replaceChildren(el('p', { class: 'intro' }, spec.info.description || ''), sections);
+        toc.replaceChildren(...links);
+
+        const target = location.hash && document.getElementById(decodeURIComponent(location.hash.slice(1)));
+        if (target && target.classList.contains('op')) {
+            toggle(target, true);
+            target.scrollIntoView();
+        }
+    }
+
+    async function loadSpec() {
+        try {
+            const res = await fetch(specUrl);
+            if (!res.ok) throw new Error('HTTP ' + res.status);
+            spec = await res.json();
+            render();
+        } catch (e) {
+            status.textContent = 'Failed to load ' + specUrl + ': ' + e.message;
+            status.className = 'error';
+        }
+    }
+
+    // API key is kept in localStorage and sent as a bearer token
+    apiKey.value = localStorage.getItem(keyStorage) || '';
+    apiKey.addEventListener('input', function() {
+        if (apiKey.value) localStorage.setItem(keyStorage, apiKey.value);
+        else localStorage.removeItem(keyStorage);
+    });
+
+    loadSpec();
+})();
@@ -3,7 +3,39 @@
     const highlight = document.getElementById('highlight');
     const status = document.getElementById('status');
     const saveBtn = document.getElementById('save-btn');
+    const wrapper = document.querySelector('.editor-wrapper');
+    const tree = document.getElementById('tree');
+    const textModeBtn = document.getElementById('text-mode');
+    const treeModeBtn = document.getElementById('tree-mode');
+    const diffPanel = document.getElementById('diff-panel');
+    const diffSource = document.getElementById('diff-source');
+    const diffRef = document.getElementById('diff-ref');
+    const diffRevision = document.getElementById('diff-revision');
+    const diffSummary = document.getElementById('diff-summary');
+    const diffOutput = document.getElementById('diff-output');
+    const gutter = document.getElementById('gutter');
+    const syntaxInfo = document.getElementById('syntax-error');
+    const cursorPos = document.getElementById('cursor-pos');
+    const shareDialog = document.getElementById('share-dialog');
+    const shareExpiry = document.getElementById('share-expiry');
+    const shareUrl = document.getElementById('share-url');
+    const shareCopy = document.getElementById('share-copy');
+    const shareInfo = document.getElementById('share-info');
+    const findBar = document.getElementById('find-bar');
+    const findInput = document.getElementById('find-input');
+    const replaceInput = document.getElementById('replace-input');
+    const findCase = document.getElementById('find-case');
+    const findRegex = document.getElementById('find-regex');
+    const findCount = document.getElementById('find-count');
+    const { parse: parseNodes, serialize, minify } = JSONNodes;
+    const baseTitle = document.title;
     const apiUrl = '/' + CHANNEL + '/' + DOCUMENT;
+    const schemaUrl = '/' + CHANNEL + '/_schema';
+    const modeStorage = 'justdoc-editor-mode';
+    let schema = null;
+    let mode = localStorage.getItem(modeStorage) === 'tree' ? 'tree' : 'text';
+    // savedText is the content as last loaded or saved
+    let savedText = '';
 
     function setStatus(msg, isError) {
         status.textContent = msg;
@@ -27,11 +59,802 @@
 
     function updateHighlight() {
         highlight.innerHTML = highlightJSON(editor.value) + '\n';
+        if (syntaxError) {
+            highlight.appendChild(marker('error-line', syntaxError.line, 1, 0));
+            highlight.appendChild(marker('error-char', syntaxError.line, syntaxError.column, 1));
+        }
+        if (currentMatch) {
+            const pos = lineColumn(editor.value, currentMatch.start);
+            highlight.appendChild(marker('find-match', pos.line, pos.column, currentMatch.end - currentMatch.start));
+        }
+        updateGutter();
+    }
+
+    // marker places a box over the text in the highlight layer; the editor
+    // font is monospace, so columns map to ch units
+    function marker(cls, line, column, width) {
+        const m = el('span', { class: 'marker ' + cls });
+        m.style.top = 'calc(12px + ' + (line - 1) + ' * 1.5em)';
+        m.style.left = 'calc(12px + ' + (column - 1) + 'ch)';
+        if (width) m.style.width = width + 'ch';
+        return m;
     }
 
     function syncScroll() {
         highlight.scrollTop = editor.scrollTop;
         highlight.scrollLeft = editor.scrollLeft;
+        gutter.scrollTop = editor.scrollTop;
+    }
+
+    // Line numbers
+    let gutterLines = 0;
+
+    function updateGutter() {
+        const lines = editor.value.split('\n').length;
+        if (lines === gutterLines) return;
+        gutterLines = lines;
+        gutter.textContent = Array.from({ length: lines }, (_, i) => i + 1).join('\n') + '\n';
+        gutter.scrollTop = editor.scrollTop;
+    }
+
+    // lineColumn converts a text offset to a 1-based line and column
+    function lineColumn(text, offset) {
+        const before = text.slice(0, offset);
+        return {
+            line: before.split('\n').length,
+            column: offset - before.lastIndexOf('\n')
+        };
+    }
+
+    function updateCursor() {
+        const pos = lineColumn(editor.value, editor.selectionStart);
+        cursorPos.textContent = 'Ln ' + pos.line + ', Col ' + pos.column;
+    }
+
+    // Syntax errors. Browsers report the location of a JSON.parse error as
+    // an offset, as a line and column, or not at all.
+    let syntaxError = null;
+    let checkTimer = null;
+
+    function errorOffset(message, text) {
+        let m = /position (\d+)/.exec(message);
+        if (m) return Number(m[1]);
+        m = /line (\d+) column (\d+)/.exec(message);
+        if (m) {
+            const lines = text.split('\n').slice(0, Number(m[1]) - 1);
+            return lines.reduce((n, l) => n + l.length + 1, 0) + Number(m[2]) - 1;
+        }
+        if (/end of (JSON )?(input|data)/i.test(message)) return text.length;
+        return -1;
+    }
+
+    function checkSyntax() {
+        const text = editor.value;
+        syntaxError = null;
+        syntaxInfo.textContent = '';
+        if (text.trim() !== '') {
+            try {
+                JSON.parse(text);
+            } catch (e) {
+                const offset = errorOffset(e.message, text);
+                if (offset >= 0) syntaxError = lineColumn(text, offset);
+                syntaxInfo.textContent = (syntaxError ? 'Line ' + syntaxError.line + ', column ' + syntaxError.column + ': ' : '') + e.message;
+            }
+        }
+        updateHighlight();
+    }
+
+    function scheduleCheck() {
+        clearTimeout(checkTimer);
+        checkTimer = setTimeout(checkSyntax, 300);
+    }
+
+    // textChanged refreshes everything derived from the text
+    function textChanged() {
+        updateHighlight();
+        updateDirty();
+        scheduleCheck();
+        scheduleDiff();
+    }
+
+    // replaceRange replaces part of the text as an undoable edit when the
+    // text editor is visible
+    function replaceRange(start, end, text) {
+        if (!wrapper.hidden) {
+            const active = document.activeElement;
+            editor.focus();
+            editor.setSelectionRange(start, end);
+            const inserted = document.execCommand('insertText', false, text);
+            if (active && active !== editor) active.focus();
+            if (inserted) return;
+        }
+        editor.setRangeText(text, start, end, 'end');
+        currentMatch = null;
+        textChanged();
+    }
+
+    function setText(text) {
+        replaceRange(0, editor.value.length, text);
+        if (mode === 'tree') setMode('tree');
+    }
+
+    // Unsaved changes
+    function isDirty() {
+        return editor.value !== savedText && formatJSON(editor.value) !== formatJSON(savedText);
+    }
+
+    function updateDirty() {
+        document.title = (editor.value !== savedText ? '• ' : '') + baseTitle;
+    }
+
+    // Format, minify and sort keys work on the tree nodes, so numbers and
+    // key order are kept as written
+    function sortKeys(node) {
+        if (node.type === 'object') {
+            node.entries.sort((a, b) => (a.key < b.key ? -1 : a.key > b.key ? 1 : 0));
+            node.entries.forEach(e => sortKeys(e.node));
+        } else if (node.type === 'array') {
+            node.items.forEach(sortKeys);
+        }
+    }
+
+    function transform(fn) {
+        let node;
+        try {
+            node = parseNodes(editor.value.trim() || '{}');
+        } catch (e) {
+            checkSyntax();
+            setStatus('Invalid JSON: ' + e.message, true);
+            return;
+        }
+        setText(fn(node));
+    }
+
+    // Find and replace
+    const MAX_MATCHES = 10000;
+    let currentMatch = null;
+
+    function findPattern() {
+        const query = findInput.value;
+        if (!query) return null;
+        const source = findRegex.checked ? query : query.replace(/[.*+?^${}()|[\]\\]/g, '\\$&');
+        try {
+            return new RegExp(source, findCase.checked ? 'g' : 'gi');
+        } catch (e) {
+            findCount.textContent = 'Invalid regular expression';
+            return null;
+        }
+    }
+
+    function allMatches(re) {
+        const matches = [];
+        const text = editor.value;
+        let m;
+        while (matches.length < MAX_MATCHES && (m = re.exec(text)) !== null) {
+            if (m[0] === '') {
+                re.lastIndex++;
+                continue;
+            }
+            matches.push({ start: m.index, end: m.index + m[0].length });
+        }
+        return matches;
+    }
+
+    // findMatch selects the next (1), previous (-1) or first match at the
+    // cursor (0)
+    function findMatch(direction) {
+        const re = findPattern();
+        if (!re) {
+            if (!findInput.value) findCount.textContent = '';
+            currentMatch = null;
+            updateHighlight();
+            return;
+        }
+        const matches = allMatches(re);
+        if (matches.length === 0) {
+            currentMatch = null;
+            findCount.textContent = 'No matches';
+            updateHighlight();
+            return;
+        }
+        const from = currentMatch ? currentMatch.start : editor.selectionStart;
+        let index;
+        if (direction < 0) {
+            index = matches.findLastIndex(m => m.start < from);
+            if (index < 0) index = matches.length - 1;
+        } else {
+            index = matches.findIndex(m => (direction === 0 ? m.start >= from : m.start > from));
+            if (index < 0) index = 0;
+        }
+        currentMatch = matches[index];
+        editor.setSelectionRange(currentMatch.start, currentMatch.end);
+        findCount.textContent = (index + 1) + ' of ' + matches.length + (matches.length === MAX_MATCHES ? '+' : '');
+        scrollToOffset(currentMatch.start);
+        updateHighlight();
+    }
+
+    function scrollToOffset(offset) {
+        const lineHeight = parseFloat(getComputedStyle(editor).lineHeight);
+        const top = (lineColumn(editor.value, offset).line - 1) * lineHeight;
+        if (top < editor.scrollTop || top > editor.scrollTop + editor.clientHeight - 2 * lineHeight) {
+            editor.scrollTop = Math.max(0, top - editor.clientHeight / 2);
+            syncScroll();
+        }
+    }
+
+    function replaceOne() {
+        const re = findPattern();
+        if (!re) return;
+        if (!currentMatch) {
+            findMatch(0);
+            return;
+        }
+        const start = currentMatch.start;
+        const found = editor.value.slice(start, currentMatch.end);
+        const single = new RegExp(re.source, re.flags.replace('g', ''));
+        const replacement = findRegex.checked ? found.replace(single, replaceInput.value) : replaceInput.value;
+        replaceRange(start, currentMatch.end, replacement);
+        editor.setSelectionRange(start + replacement.length, start + replacement.length);
+        currentMatch = null;
+        findMatch(0);
+    }
+
+    function replaceAll() {
+        const re = findPattern();
+        if (!re) return;
+        const count = allMatches(re).length;
+        if (count === 0) {
+            findCount.textContent = 'No matches';
+            return;
+        }
+        re.lastIndex = 0;
+        setText(editor.value.replace(re, findRegex.checked ? replaceInput.value : () => replaceInput.value));
+        currentMatch = null;
+        findCount.textContent = 'Replaced ' + count + (count === MAX_MATCHES ? '+' : '');
+        updateHighlight();
+    }
+
+    function openFind(replace) {
+        if (mode !== 'text') setMode('text');
+        findBar.hidden = false;
+        const selected = editor.value.slice(editor.selectionStart, editor.selectionEnd);
+        if (selected && !selected.includes('\n')) findInput.value = selected;
+        const input = replace ? replaceInput : findInput;
+        input.focus();
+        input.select();
+        currentMatch = null;
+        findMatch(0);
+    }
+
+    function closeFind() {
+        findBar.hidden = true;
+        currentMatch = null;
+        findCount.textContent = '';
+        updateHighlight();
+        editor.focus();
+    }
+
+    // Tree editor. Documents are parsed into JSONNodes, which keep the key
+    // order and the original text of numbers, so switching modes doesn't
+    // change anything but the indentation.
+    const TYPES = ['object', 'array', 'string', 'number', 'boolean', 'null'];
+    const PAGE_SIZE = 100;
+    const numberRe = /^-?(?:0|[1-9]\d*)(?:\.\d+)?(?:[eE][+-]?\d+)?$/;
+    let root = null;
+    let dragged = null;
+
+    // convert changes the type of a node, keeping a primitive value where
+    // it makes sense
+    function convert(node, type) {
+        const primitive = node.type === 'string' || node.type === 'number' || node.type === 'boolean';
+        const previous = primitive ? String(node.value) : '';
+        delete node.entries;
+        delete node.items;
+        node.type = type;
+        node.value = null;
+        if (type === 'object') node.entries = [];
+        if (type === 'array') node.items = [];
+        if (type === 'string') node.value = previous;
+        if (type === 'number') node.value = numberRe.test(previous) ? previous : '0';
+        if (type === 'boolean') node.value = previous === 'true';
+    }
+
+    function uniqueKey(node) {
+        const keys = new Set(node.entries.map(e => e.key));
+        let key = 'key';
+        for (let n = 2; keys.has(key); n++) key = 'key' + n;
+        return key;
+    }
+
+    function el(tag, attrs, ...children) {
+        const node = document.createElement(tag);
+        Object.entries(attrs || {}).forEach(([k, v]) => {
+            if (k === 'class') node.className = v;
+            else if (k.startsWith('on')) node.addEventListener(k.slice(2), v);
+            else node.setAttribute(k, v);
+        });
+        children.forEach(c => {
+            if (c) node.appendChild(typeof c === 'string' ? document.createTextNode(c) : c);
+        });
+        return node;
+    }
+
+    // syncText writes the tree back into the text editor after every edit
+    function syncText() {
+        editor.value = serialize(root, 0);
+        textChanged();
+    }
+
+    function treeChanged() {
+        syncText();
+        renderTree();
+    }
+
+    function renderTree() {
+        const scroll = tree.scrollTop;
+        tree.replaceChildren(renderNode(root, null, 0, 0));
+        tree.scrollTop = scroll;
+    }
+
+    // renderNode renders a node at position index of its parent (null for
+    // the root) together with its children when expanded
+    function renderNode(node, parent, index, depth) {
+        const container = node.type === 'object' || node.type === 'array';
+        if (node.collapsed === undefined) node.collapsed = depth >= 2;
+        const row = el('div', { class: 'tree-row' });
+        const item = el('div', { class: 'tree-node' }, row);
+
+        // Expand/collapse
+        if (container) {
+            row.appendChild(el('button', {
+                class: 'tree-toggle',
+                title: node.collapsed ? 'Expand' : 'Collapse',
+                onclick: () => {
+                    node.collapsed = !node.collapsed;
+                    item.replaceWith(renderNode(node, parent, index, depth));
+                }
+            }, node.collapsed ? '▸' : '▾'));
+        } else {
+            row.appendChild(el('span', { class: 'tree-toggle' }));
+        }
+
+        // Array items can be dragged by their handle to reorder them
+        if (parent && parent.type === 'array') {
+            const handle = el('span', { class: 'tree-handle', title: 'Drag to reorder' }, '⠇');
+            handle.addEventListener('mousedown', () => { item.draggable = true; });
+            handle.addEventListener('mouseup', () => { item.draggable = false; });
+            item.addEventListener('dragstart', e => {
+                e.stopPropagation();
+                dragged = { parent: parent, index: index };
+                e.dataTransfer.effectAllowed = 'move';
+                e.dataTransfer.setData('text/plain', String(index));
+            });
+            item.addEventListener('dragend', () => { item.draggable = false; dragged = null; });
+            item.addEventListener('dragover', e => {
+                if (!dragged || dragged.parent !== parent) return;
+                e.preventDefault();
+                e.stopPropagation();
+                row.classList.add('drop-target');
+            });
+            item.addEventListener('dragleave', () => row.classList.remove('drop-target'));
+            item.addEventListener('drop', e => {
+                if (!dragged || dragged.parent !== parent) return;
+                e.preventDefault();
+                e.stopPropagation();
+                const [moved] = parent.items.splice(dragged.index, 1);
+                parent.items.splice(index, 0, moved);
+                dragged = null;
+                treeChanged();
+            });
+            row.appendChild(handle);
+            row.appendChild(el('span', { class: 'tree-index' }, String(index)));
+        } else if (parent) {
+            const entry = parent.entries[index];
+            const key = el('input', { class: 'tree-key', spellcheck: 'false', size: String(Math.max(entry.key.length, 1)) });
+            key.value = entry.key;
+            key.addEventListener('input', () => {
+                entry.key = key.value;
+                key.size = Math.max(key.value.length, 1);
+                const duplicate = parent.entries.some(e => e !== entry && e.key === entry.key);
+                key.classList.toggle('invalid', duplicate);
+                key.title = duplicate ? 'Duplicate key' : '';
+                syncText();
+            });
+            row.appendChild(key);
+        } else {
+            row.appendChild(el('span', { class: 'tree-index' }, 'document'));
+        }
+        row.appendChild(el('span', { class: 'tree-colon' }, ':'));
+
+        // Type
+        const type = el('select', { class: 'tree-type', title: 'Type' });
+        TYPES.forEach(t => type.appendChild(el('option', { value: t }, t)));
+        type.value = node.type;
+        type.addEventListener('change', () => {
+            convert(node, type.value);
+            node.collapsed = false;
+            treeChanged();
+        });
+        row.appendChild(type);
+
+        // Value
+        row.appendChild(renderValue(node));
+
+        if (container) {
+            row.appendChild(el('button', {
+                class: 'tree-add',
+                title: node.type === 'object' ? 'Add key' : 'Add item',
+                onclick: () => {
+                    if (node.type === 'object') {
+                        node.entries.push({ key: uniqueKey(node), node: { type: 'string', value: '' } });
+                    } else {
+                        node.items.push({ type: 'string', value: '' });
+                        node.limit = Math.max(node.limit || PAGE_SIZE, node.items.length);
+                    }
+                    node.collapsed = false;
+                    treeChanged();
+                }
+            }, '+'));
+        }
+        if (parent) {
+            row.appendChild(el('button', {
+                class: 'tree-remove',
+                title: 'Remove',
+                onclick: () => {
+                    if (parent.type === 'object') parent.entries.splice(index, 1);
+                    else parent.items.splice(index, 1);
+                    treeChanged();
+                }
+            }, '×'));
+        }
+
+        if (container && !node.collapsed) {
+            item.appendChild(renderChildren(node, depth));
+        }
+        return item;
+    }
+
+    function renderValue(node) {
+        switch (node.type) {
+        case 'object':
+            return el('span', { class: 'tree-summary' }, '{' + node.entries.length + (node.entries.length === 1 ? ' key}' : ' keys}'));
+        case 'array':
+            return el('span', { class: 'tree-summary' }, '[' + node.items.length + (node.items.length === 1 ? ' item]' : ' items]'));
+        case 'boolean': {
+            const select = el('select', { class: 'tree-value json-boolean' },
+                el('option', { value: 'true' }, 'true'), el('option', { value: 'false' }, 'false'));
+            select.value = String(node.value);
+            select.addEventListener('change', () => {
+                node.value = select.value === 'true';
+                syncText();
+            });
+            return select;
+        }
+        case 'null':
+            return el('span', { class: 'tree-value json-null' }, 'null');
+        }
+
+        const input = el('input', { class: 'tree-value json-' + node.type, spellcheck: 'false' });
+        input.value = node.value;
+        input.addEventListener('input', () => {
+            if (node.type === 'number') {
+                const valid = numberRe.test(input.value.trim());
+                input.classList.toggle('invalid', !valid);
+                if (!valid) return;
+                node.value = input.value.trim();
+            } else {
+                node.value = input.value;
+            }
+            syncText();
+        });
+        return input;
+    }
+
+    // renderChildren renders the entries of a container; long arrays and
+    // objects are shown a page at a time
+    function renderChildren(node, depth) {
+        const children = el('div', { class: 'tree-children' });
+        const count = node.type === 'object' ? node.entries.length : node.items.length;
+        const limit = Math.min(count, node.limit || PAGE_SIZE);
+        for (let i = 0; i < limit; i++) {
+            const child = node.type === 'object' ? node.entries[i].node : node.items[i];
+            children.appendChild(renderNode(child, node, i, depth + 1));
+        }
+        if (count > limit) {
+            const more = el('button', {
+                class: 'tree-more',
+                onclick: () => {
+                    node.limit = limit + PAGE_SIZE;
+                    children.replaceWith(renderChildren(node, depth));
+                }
+            }, 'Show ' + Math.min(PAGE_SIZE, count - limit) + ' more of ' + (count - limit));
+            children.appendChild(more);
+        }
+        return children;
+    }
+
+    // Switching modes parses the text, so invalid JSON keeps the text mode
+    function setMode(next) {
+        if (next === 'tree') {
+            try {
+                root = parseNodes(editor.value.trim() || '{}');
+            } catch (e) {
+                checkSyntax();
+                setStatus('Invalid JSON: ' + e.message, true);
+                next = 'text';
+            }
+        }
+        if (next === 'tree') renderTree();
+        mode = next;
+        wrapper.hidden = mode === 'tree';
+        tree.hidden = mode !== 'tree';
+        textModeBtn.classList.toggle('active', mode === 'text');
+        treeModeBtn.classList.toggle('active', mode === 'tree');
+        localStorage.setItem(modeStorage, mode);
+    }
+
+    // Diff panel. The buffer is compared with the stored version, an earlier
+    // revision or another document; both sides are formatted the same way, so only real
+    // changes show up.
+    const CONTEXT_LINES = 3;
+    const MAX_DIFF_CELLS = 4000000;
+    let compared = null;
+    let diffTimer = null;
+
+    function formatJSON(text) {
+        try {
+            return serialize(parseNodes(text.trim() || '{}'), 0);
+        } catch (e) {
+            return text;
+        }
+    }
+
+    // lineDiff returns the lines of a and b marked as kept (' '), removed
+    // ('-') or added ('+'), aligned on their longest common subsequence
+    function lineDiff(a, b) {
+        let prefix = 0;
+        let suffix = 0;
+        while (prefix < a.length && prefix < b.length && a[prefix] === b[prefix]) prefix++;
+        while (suffix < a.length - prefix && suffix < b.length - prefix &&
+            a[a.length - 1 - suffix] === b[b.length - 1 - suffix]) suffix++;
+
+        const out = a.slice(0, prefix).map(text => ({ op: ' ', text: text }));
+        const ma = a.slice(prefix, a.length - suffix);
+        const mb = b.slice(prefix, b.length - suffix);
+        if (ma.length * mb.length > MAX_DIFF_CELLS) {
+            ma.forEach(text => out.push({ op: '-', text: text }));
+            mb.forEach(text => out.push({ op: '+', text: text }));
+        } else {
+            // lengths[i][j] is the LCS length of ma[i:] and mb[j:]
+            const lengths = Array.from({ length: ma.length + 1 }, () => new Uint32Array(mb.length + 1));
+            for (let i = ma.length - 1; i >= 0; i--) {
+                for (let j = mb.length - 1; j >= 0; j--) {
+                    lengths[i][j] = ma[i] === mb[j] ? lengths[i + 1][j + 1] + 1 : Math.max(lengths[i + 1][j], lengths[i][j + 1]);
+                }
+            }
+            let i = 0;
+            let j = 0;
+            while (i < ma.length || j < mb.length) {
+                if (i < ma.length && j < mb.length && ma[i] === mb[j]) {
+                    out.push({ op: ' ', text: ma[i++] });
+                    j++;
+                } else if (j === mb.length || (i < ma.length && lengths[i + 1][j] >= lengths[i][j + 1])) {
+                    out.push({ op: '-', text: ma[i++] });
+                } else {
+                    out.push({ op: '+', text: mb[j++] });
+                }
+            }
+        }
+        a.slice(a.length - suffix).forEach(text => out.push({ op: ' ', text: text }));
+        return out;
+    }
+
+    function renderDiff() {
+        if (compared === null) return;
+        const lines = lineDiff(compared.split('\n'), formatJSON(editor.value).split('\n'));
+        const added = lines.filter(l => l.op === '+').length;
+        const removed = lines.filter(l => l.op === '-').length;
+        diffSummary.textContent = added + removed === 0
+            ? 'No differences'
+            : added + ' line' + (added === 1 ? '' : 's') + ' added, ' + removed + ' removed in the editor';
+
+        // Long runs of unchanged lines are collapsed around the changes
+        const rows = [];
+        let k = 0;
+        while (k < lines.length) {
+            if (lines[k].op !== ' ') {
+                rows.push(el('div', { class: lines[k].op === '+' ? 'diff-add' : 'diff-remove' }, lines[k].op + ' ' + lines[k].text));
+                k++;
+                continue;
+            }
+            let end = k;
+            while (end < lines.length && lines[end].op === ' ') end++;
+            const head = k === 0 ? 0 : CONTEXT_LINES;
+            const tail = end === lines.length ? 0 : CONTEXT_LINES;
+            const hidden = end - k - head - tail;
+            for (let n = k; n < end; n++) {
+                if (hidden > 1 && n === k + head) {
+                    rows.push(el('div', { class: 'diff-skip' }, '⋯ ' + hidden + ' unchanged lines'));
+                    n += hidden - 1;
+                    continue;
+                }
+                rows.push(el('div', { class: 'diff-same' }, '  ' + lines[n].text));
+            }
+            k = end;
+        }
+        diffOutput.replaceChildren(...rows);
+    }
+
+    function scheduleDiff() {
+        if (diffPanel.hidden) return;
+        clearTimeout(diffTimer);
+        diffTimer = setTimeout(renderDiff, 300);
+    }
+
+    // loadRevisions lists the earlier revisions kept for the document,
+    // newest first; the first listed revision is the stored version
+    async function loadRevisions() {
+        const selected = diffRevision.value;
+        diffRevision.replaceChildren();
+        try {
+            const res = await fetch(apiUrl + '/_revisions', { cache: 'no-store' });
+            if (res.status === 404) return;
+            if (!res.ok) throw new Error('HTTP ' + res.status);
+            const body = await res.json();
+            body.revisions.slice(1).forEach(r => {
+                const label = 'Revision ' + r.revision + (r.modified ? ' · ' + new Date(r.modified).toLocaleString() : '');
+                diffRevision.append(el('option', { value: r.revision }, label));
+            });
+            if ([...diffRevision.options].some(o => o.value === selected)) diffRevision.value = selected;
+        } catch (e) {
+            diffSummary.textContent = 'Failed to list revisions: ' + e.message;
+        }
+    }
+
+    async function loadCompared() {
+        let url = apiUrl;
+        if (diffSource.value === 'revision') {
+            await loadRevisions();
+            if (!diffRevision.value) {
+                compared = null;
+                diffSummary.textContent = 'No earlier revisions are kept for this document';
+                diffOutput.replaceChildren();
+                return;
+            }
+            url = apiUrl + '?revision=' + diffRevision.value;
+        } else if (diffSource.value === 'document') {
+            const ref = diffRef.value.trim();
+            const parts = ref.includes('/') ? ref.split('/') : [CHANNEL, ref];
+            const validName = new RegExp(NAME_PATTERN);
+            if (parts.length !== 2 || !parts.every(p => validName.test(p))) {
+                compared = null;
+                diffSummary.textContent = 'Enter a document name or channel/name';
+                diffOutput.replaceChildren();
+                return;
+            }
+            url = '/' + parts[0] + '/' + parts[1];
+        }
+        try {
+            const res = await fetch(url, { cache: 'no-store' });
+            if (res.status === 404) {
+                compared = null;
+                diffSummary.textContent = url === apiUrl ? 'The document has not been saved yet'
+                    : diffSource.value === 'revision' ? 'Revision ' + diffRevision.value + ' is no longer kept'
+                    : 'Document ' + url.slice(1) + ' not found';
+                diffOutput.replaceChildren();
+                return;
+            }
+            if (!res.ok) throw new Error('HTTP ' + res.status);
+            compared = formatJSON(await res.text());
+            renderDiff();
+        } catch (e) {
+            compared = null;
+            diffSummary.textContent = 'Failed to load ' + url + ': ' + e.message;
+        }
+    }
+
+    function toggleDiff() {
+        diffPanel.hidden = !diffPanel.hidden;
+        if (!diffPanel.hidden) loadCompared();
+    }
+
+    // restoreCompared replaces the buffer; saving makes the restore permanent
+    function restoreCompared() {
+        if (compared === null) return;
+        setText(compared);
+        renderDiff();
+        setStatus('Restored in the editor, save to keep it', false);
+    }
+
+    // JSON Schema validation (subset of draft 2020-12; the server
+    // performs the authoritative check)
+    function typeOf(value) {
+        if (value === null) return 'null';
+        if (Array.isArray(value)) return 'array';
+        if (typeof value === 'number' && Number.isInteger(value)) return 'integer';
+        return typeof value;
+    }
+
+    function pointer(path) {
+        return path.map(p => '/' + String(p).replace(/~/g, '~0').replace(/\//g, '~1')).join('');
+    }
+
+    function validateSchema(s, value, path, errors) {
+        if (s === true || s === undefined) return;
+        if (s === false) {
+            errors.push({ location: pointer(path), message: 'false schema' });
+            return;
+        }
+        const add = (msg) => errors.push({ location: pointer(path), message: msg });
+        const type = typeOf(value);
+
+        if (s.type !== undefined) {
+            const types = Array.isArray(s.type) ? s.type : [s.type];
+            const ok = types.some(t => t === type || (t === 'number' && type === 'integer'));
+            if (!ok) {
+                add('got ' + type + ', want ' + types.join(' or '));
+                return;
+            }
+        }
+        if (s.const !== undefined && JSON.stringify(s.const) !== JSON.stringify(value)) {
+            add('value must be ' + JSON.stringify(s.const));
+        }
+        if (Array.isArray(s.enum) && !s.enum.some(e => JSON.stringify(e) === JSON.stringify(value))) {
+            add('value must be one of ' + s.enum.map(e => JSON.stringify(e)).join(', '));
+        }
+
+        if (type === 'string') {
+            if (s.minLength !== undefined && value.length < s.minLength) add('minLength: got ' + value.length + ', want ' + s.minLength);
+            if (s.maxLength !== undefined && value.length > s.maxLength) add('maxLength: got ' + value.length + ', want ' + s.maxLength);
+            if (s.pattern !== undefined) {
+                try {
+                    if (!new RegExp(s.pattern, 'u').test(value)) add('does not match pattern ' + JSON.stringify(s.pattern));
+                } catch (e) { /* unsupported pattern, leave it to the server */ }
+            }
+        }
+        if (type === 'number' || type === 'integer') {
+            if (s.minimum !== undefined && value < s.minimum) add('minimum: got ' + value + ', want ' + s.minimum);
+            if (s.maximum !== undefined && value > s.maximum) add('maximum: got ' + value + ', want ' + s.maximum);
+            if (s.exclusiveMinimum !== undefined && value <= s.exclusiveMinimum) add('exclusiveMinimum: got ' + value + ', want ' + s.exclusiveMinimum);
+            if (s.exclusiveMaximum !== undefined && value >= s.exclusiveMaximum) add('exclusiveMaximum: got ' + value + ', want ' + s.exclusiveMaximum);
+        }
+        if (type === 'array') {
+            if (s.minItems !== undefined && value.length < s.minItems) add('minItems: got ' + value.length + ', want ' + s.minItems);
+            if (s.maxItems !== undefined && value.length > s.maxItems) add('maxItems: got ' + value.length + ', want ' + s.maxItems);
+            const prefix = Array.isArray(s.prefixItems) ? s.prefixItems : [];
+            value.forEach((item, i) => {
+                const itemSchema = i < prefix.length ? prefix[i] : s.items;
+                validateSchema(itemSchema, item, path.concat(i), errors);
+            });
+        }
+        if (type === 'object') {
+            (s.required || []).forEach(key => {
+                if (!(key in value)) add('missing property ' + JSON.stringify(key));
+            });
+            const props = s.properties || {};
+            Object.keys(value).forEach(key => {
+                if (key in props) {
+                    validateSchema(props[key], value[key], path.concat(key), errors);
+                } else if (s.additionalProperties !== undefined) {
+                    if (s.additionalProperties === false) add('additional property ' + JSON.stringify(key) + ' not allowed');
+                    else validateSchema(s.additionalProperties, value[key], path.concat(key), errors);
+                }
+            });
+        }
+        (s.allOf || []).forEach(sub => validateSchema(sub, value, path, errors));
+    }
+
+    function formatViolations(violations) {
+        return violations.map(v => (v.location || '/') + ': ' + v.message).join('; ');
+    }
+
+    async function loadSchema() {
+        try {
+            const res = await fetch(schemaUrl);
+            if (res.ok) schema = await res.json();
+        } catch (e) {
+            schema = null;
+        }
     }
 
     // Load document on page load
@@ -39,13 +862,18 @@
         try {
             const res = await fetch(apiUrl);
             if (res.ok) {
-                const data = await res.json();
-                editor.value = JSON.stringify(data, null, 2);
-                updateHighlight();
+                // Formatted through the tree nodes so that numbers keep
+                // their precision
+                editor.value = serialize(parseNodes(await res.text()), 0);
+                savedText = editor.value;
+                textChanged();
+                setMode(mode);
             } else if (res.status === 404) {
                 // New document - show empty textarea
                 editor.value = '';
-                updateHighlight();
+                savedText = '';
+                textChanged();
+                setMode(mode);
             } else {
                 const err = await res.json();
                 setStatus('Error loading: ' + err.message, true);
@@ -60,14 +888,27 @@
         const content = editor.value.trim();
 
         // Validate JSON
+        let value;
         try {
-            if (content) JSON.parse(content);
+            value = JSON.parse(content || '{}');
         } catch (e) {
+            checkSyntax();
             setStatus('Invalid JSON: ' + e.message, true);
             return;
         }
 
+        // Validate against channel schema
+        if (schema !== null) {
+            const violations = [];
+            validateSchema(schema, value, [], violations);
+            if (violations.length > 0) {
+                setStatus('Schema violation: ' + formatViolations(violations), true);
+                return;
+            }
+        }
+
         saveBtn.disabled = true;
+        const sent = editor.value;
         try {
             const res = await fetch(apiUrl, {
                 method: 'POST',
@@ -76,9 +917,16 @@
             });
             if (res.ok) {
                 setStatus('Saved successfully', false);
+                savedText = sent;
+                updateDirty();
+                if (!diffPanel.hidden) loadCompared();
             } else {
                 const err = await res.json();
-                setStatus('Error: ' + err.message, true);
+                if (err.violations) {
+                    setStatus('Schema violation: ' + formatViolations(err.violations), true);
+                } else {
+                    setStatus('Error: ' + err.message, true);
+                }
             }
         } catch (e) {
             setStatus('Failed to save', true);
@@ -86,19 +934,128 @@
         saveBtn.disabled = false;
     }
 
+    // Share links grant reading the saved document through the read-only
+    // viewer until they expire
+    function openShare() {
+        shareUrl.value = '';
+        shareCopy.disabled = true;
+        shareInfo.className = 'hint';
+        shareInfo.textContent = 'The link shows the saved version of the document, without unsaved changes.';
+        shareDialog.showModal();
+    }
+
+    async function createShareLink() {
+        try {
+            const res = await fetch('/_/share', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ channel: CHANNEL, document: DOCUMENT, expires_in: shareExpiry.value })
+            });
+            const body = await res.json();
+            if (!res.ok) {
+                shareInfo.className = 'hint error';
+                shareInfo.textContent = 'Error: ' + body.message;
+                return;
+            }
+            shareUrl.value = location.origin + body.url;
+            shareCopy.disabled = false;
+            shareInfo.className = 'hint';
+            shareInfo.textContent = 'Anyone with this link can read the saved document until ' + new Date(body.expires).toLocaleString() + '.';
+            shareUrl.select();
+        } catch (e) {
+            shareInfo.className = 'hint error';
+            shareInfo.textContent = 'Failed to create link';
+        }
+    }
+
+    async function copyShareLink() {
+        try {
+            await navigator.clipboard.writeText(shareUrl.value);
+            shareInfo.className = 'hint';
+            shareInfo.textContent = 'Link copied';
+        } catch (e) {
+            shareUrl.select();
+        }
+    }
+
     // Event listeners
     saveBtn.addEventListener('click', saveDocument);
-    editor.addEventListener('input', updateHighlight);
+    editor.addEventListener('input', () => {
+        currentMatch = null;
+        textChanged();
+    });
     editor.addEventListener('scroll', syncScroll);
+    ['input', 'keyup', 'click'].forEach(type => editor.addEventListener(type, updateCursor));
+    document.getElementById('format-btn').addEventListener('click', () => transform(node => serialize(node, 0)));
+    document.getElementById('minify-btn').addEventListener('click', () => transform(minify));
+    document.getElementById('sort-btn').addEventListener('click', () => transform(node => {
+        sortKeys(node);
+        return serialize(node, 0);
+    }));
+    document.getElementById('find-btn').addEventListener('click', () => openFind(false));
+    document.getElementById('find-next').addEventListener('click', () => findMatch(1));
+    document.getElementById('find-prev').addEventListener('click', () => findMatch(-1));
+    document.getElementById('replace-one').addEventListener('click', replaceOne);
+    document.getElementById('replace-all').addEventListener('click', replaceAll);
+    document.getElementById('find-close').addEventListener('click', closeFind);
+    findInput.addEventListener('input', () => {
+        currentMatch = null;
+        findMatch(0);
+    });
+    [findCase, findRegex].forEach(box => box.addEventListener('change', () => {
+        currentMatch = null;
+        findMatch(0);
+    }));
+    findInput.addEventListener('keydown', e => {
+        if (e.key === 'Enter') findMatch(e.shiftKey ? -1 : 1);
+        if (e.key === 'Escape') closeFind();
+    });
+    replaceInput.addEventListener('keydown', e => {
+        if (e.key === 'Enter') replaceOne();
+        if (e.key === 'Escape') closeFind();
+    });
 
-    // Ctrl+S / Cmd+S to save
+    // Warn before leaving with unsaved changes
+    window.addEventListener('beforeunload', e => {
+        if (isDirty()) {
+            e.preventDefault();
+            e.returnValue = '';
+        }
+    });
+    textModeBtn.addEventListener('click', () => setMode('text'));
+    treeModeBtn.addEventListener('click', () => setMode('tree'));
+    document.getElementById('diff-btn').addEventListener('click', toggleDiff);
+    document.getElementById('share-btn').addEventListener('click', openShare);
+    document.getElementById('share-create').addEventListener('click', createShareLink);
+    document.getElementById('share-close').addEventListener('click', () => shareDialog.close());
+    shareCopy.addEventListener('click', copyShareLink);
+    document.getElementById('diff-close').addEventListener('click', toggleDiff);
+    document.getElementById('diff-refresh').addEventListener('click', loadCompared);
+    document.getElementById('diff-restore').addEventListener('click', restoreCompared);
+    diffSource.addEventListener('change', () => {
+        diffRef.hidden = diffSource.value !== 'document';
+        diffRevision.hidden = diffSource.value !== 'revision';
+        if (diffRef.hidden) loadCompared();
+        else diffRef.focus();
+    });
+    diffRevision.addEventListener('change', loadCompared);
+    diffRef.addEventListener('keydown', e => {
+        if (e.key === 'Enter') loadCompared();
+    });
+
+    // Ctrl+S / Cmd+S to save, Ctrl+F to find, Ctrl+H to replace
     document.addEventListener('keydown', function(e) {
-        if ((e.ctrlKey || e.metaKey) && e.key === 's') {
+        if (!(e.ctrlKey || e.metaKey)) return;
+        if (e.key === 's') {
             e.preventDefault();
             saveDocument();
+        } else if (e.key === 'f' || e.key === 'h') {
+            e.preventDefault();
+            openFind(e.key === 'h');
         }
     });
 
     // Initialize
+    loadSchema();
     loadDocument();
 })();
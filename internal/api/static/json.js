@@ -0,0 +1,84 @@
+// JSONNodes parses JSON documents into nodes that keep the key order and
+// the original text of numbers, and writes them back. Nodes are
+// { type: 'object', entries: [{ key, node }] }, { type: 'array', items },
+// or { type, value } for strings, numbers (kept as text), booleans and null.
+window.JSONNodes = (function() {
+    function parse(text) {
+        JSON.parse(text); // reports syntax errors with their position
+        let i = 0;
+        const ws = () => { while (i < text.length && ' \t\n\r'.includes(text[i])) i++; };
+        const token = re => { re.lastIndex = i; const m = re.exec(text); i = re.lastIndex; return m[0]; };
+        const stringToken = /"(?:[^"\\]|\\.)*"/y;
+        const numberToken = /-?(?:0|[1-9]\d*)(?:\.\d+)?(?:[eE][+-]?\d+)?/y;
+
+        function value() {
+            ws();
+            const c = text[i];
+            if (c === '{') {
+                i++;
+                const node = { type: 'object', entries: [] };
+                ws();
+                if (text[i] === '}') { i++; return node; }
+                for (;;) {
+                    ws();
+                    const key = JSON.parse(token(stringToken));
+                    ws();
+                    i++; // ':'
+                    node.entries.push({ key: key, node: value() });
+                    ws();
+                    if (text[i++] === '}') return node;
+                }
+            }
+            if (c === '[') {
+                i++;
+                const node = { type: 'array', items: [] };
+                ws();
+                if (text[i] === ']') { i++; return node; }
+                for (;;) {
+                    node.items.push(value());
+                    ws();
+                    if (text[i++] === ']') return node;
+                }
+            }
+            if (c === '"') return { type: 'string', value: JSON.parse(token(stringToken)) };
+            if (text.startsWith('true', i)) { i += 4; return { type: 'boolean', value: true }; }
+            if (text.startsWith('false', i)) { i += 5; return { type: 'boolean', value: false }; }
+            if (text.startsWith('null', i)) { i += 4; return { type: 'null', value: null }; }
+            return { type: 'number', value: token(numberToken) };
+        }
+        return value();
+    }
+
+    // serialize formats nodes like JSON.stringify(value, null, 2)
+    function serialize(node, depth) {
+        const pad = '  '.repeat(depth + 1);
+        const end = '  '.repeat(depth);
+        switch (node.type) {
+        case 'object':
+            if (node.entries.length === 0) return '{}';
+            return '{\n' + node.entries.map(e => pad + JSON.stringify(e.key) + ': ' + serialize(e.node, depth + 1)).join(',\n') + '\n' + end + '}';
+        case 'array':
+            if (node.items.length === 0) return '[]';
+            return '[\n' + node.items.map(n => pad + serialize(n, depth + 1)).join(',\n') + '\n' + end + ']';
+        case 'string':
+            return JSON.stringify(node.value);
+        default:
+            return String(node.value);
+        }
+    }
+
+    function minify(node) {
+        switch (node.type) {
+        case 'object':
+            return '{' + node.entries.map(e => JSON.stringify(e.key) + ':' + minify(e.node)).join(',') + '}';
+        case 'array':
+            return '[' + node.items.map(minify).join(',') + ']';
+        case 'string':
+            return JSON.stringify(node.value);
+        default:
+            return String(node.value);
+        }
+    }
+
+    return { parse: parse, serialize: serialize, minify: minify };
+})();
@@ -0,0 +1,166 @@
+(function() {
+    const view = document.getElementById('view');
+    const status = document.getElementById('status');
+    const query = TOKEN ? '?token=' + encodeURIComponent(TOKEN) : '';
+    const apiUrl = '/' + CHANNEL + '/' + DOCUMENT + query;
+    const PAGE_SIZE = 100;
+    // Expand all stops after this many containers to keep the page responsive
+    const MAX_EXPAND = 5000;
+    let root = null;
+
+    function setStatus(msg, isError) {
+        status.textContent = msg;
+        status.className = isError ? 'error' : 'success';
+        if (!isError) setTimeout(() => status.textContent = '', 3000);
+    }
+
+    function el(tag, attrs, ...children) {
+        const node = document.createElement(tag);
+        Object.entries(attrs || {}).forEach(([k, v]) => {
+            if (k === 'class') node.className = v;
+            else if (k.startsWith('on')) node.addEventListener(k.slice(2), v);
+            else node.setAttribute(k, v);
+        });
+        children.forEach(c => {
+            if (c) node.appendChild(typeof c === 'string' ? document.createTextNode(c) : c);
+        });
+        return node;
+    }
+
+    // label shows the key or array index a node is found at
+    function label(key) {
+        if (key === null) return null;
+        if (typeof key === 'number') return el('span', { class: 'count' }, key + ': ');
+        return el('span', {}, el('span', { class: 'json-key' }, JSON.stringify(key)), ': ');
+    }
+
+    function renderValue(node) {
+        const text = node.type === 'string' ? JSON.stringify(node.value) : String(node.value);
+        return el('span', { class: 'json-' + node.type }, text);
+    }
+
+    // renderNode renders a node; containers become collapsible sections
+    // whose children are rendered when first opened
+    function renderNode(node, key, depth) {
+        if (node.type !== 'object' && node.type !== 'array') {
+            return el('div', { class: 'leaf' }, label(key), renderValue(node));
+        }
+        const isObject = node.type === 'object';
+        const size = isObject ? node.entries.length : node.items.length;
+        const summary = isObject
+            ? '{ ' + size + (size === 1 ? ' key' : ' keys') + ' }'
+            : '[ ' + size + (size === 1 ? ' item' : ' items') + ' ]';
+        if (size === 0) {
+            return el('div', { class: 'leaf' }, label(key), el('span', { class: 'count' }, isObject ? '{}' : '[]'));
+        }
+
+        const details = el('details', {}, el('summary', {}, label(key), el('span', { class: 'count' }, summary)));
+        const children = el('div', { class: 'children' });
+        details.appendChild(children);
+        let rendered = false;
+        details.renderChildren = function() {
+            if (rendered) return;
+            rendered = true;
+            renderPage(node, children, depth, 0);
+        };
+        details.addEventListener('toggle', () => {
+            if (details.open) details.renderChildren();
+        });
+        if (depth < 2) {
+            details.open = true;
+            details.renderChildren();
+        }
+        return details;
+    }
+
+    // renderPage renders the children of a container from offset on, a
+    // page at a time
+    function renderPage(node, container, depth, offset) {
+        const list = node.type === 'object' ? node.entries : node.items;
+        const end = Math.min(list.length, offset + PAGE_SIZE);
+        for (let i = offset; i < end; i++) {
+            const child = node.type === 'object' ? renderNode(list[i].node, list[i].key, depth + 1) : renderNode(list[i], i, depth + 1);
+            container.appendChild(child);
+        }
+        if (end < list.length) {
+            const more = el('button', { class: 'more' }, 'Show ' + Math.min(PAGE_SIZE, list.length - end) + ' more of ' + (list.length - end));
+            more.addEventListener('click', () => {
+                more.remove();
+                renderPage(node, container, depth, end);
+            });
+            container.appendChild(more);
+        }
+    }
+
+    function expandAll() {
+        let budget = MAX_EXPAND;
+        let closed = Array.from(view.querySelectorAll('details:not([open])'));
+        while (closed.length > 0 && budget > 0) {
+            closed.slice(0, budget).forEach(d => {
+                d.renderChildren();
+                d.open = true;
+            });
+            budget -= closed.length;
+            closed = Array.from(view.querySelectorAll('details:not([open])'));
+        }
+        if (closed.length > 0) setStatus('Document too large to expand completely', true);
+    }
+
+    function collapseAll() {
+        view.querySelectorAll('details').forEach(d => d.open = false);
+        const first = view.querySelector('details');
+        if (first) first.open = true;
+    }
+
+    function documentText() {
+        return JSONNodes.serialize(root, 0) + '\n';
+    }
+
+    async function copyDocument() {
+        try {
+            await navigator.clipboard.writeText(documentText());
+            setStatus('Copied');
+        } catch (e) {
+            setStatus('Copy failed: ' + e.message, true);
+        }
+    }
+
+    function downloadDocument() {
+        const url = URL.createObjectURL(new Blob([documentText()], { type: 'application/json' }));
+        const a = el('a', { href: url, download: DOCUMENT + '.json' });
+        document.body.appendChild(a);
+        a.click();
+        a.remove();
+        URL.revokeObjectURL(url);
+    }
+
+    async function loadDocument() {
+        try {
+            const res = await fetch(apiUrl, { credentials: 'same-origin' });
+            if (res.status === 401) {
+                view.textContent = TOKEN ? 'This share link is invalid or has expired.' : 'You are not authorized to view this document.';
+                return;
+            }
+            if (res.status === 404) {
+                view.textContent = 'Document not found.';
+                return;
+            }
+            if (!res.ok) {
+                view.textContent = 'Failed to load document: ' + res.status;
+                return;
+            }
+            root = JSONNodes.parse(await res.text());
+            view.replaceChildren(renderNode(root, null, 0));
+        } catch (e) {
+            view.textContent = 'Failed to load document: ' + e.message;
+        }
+    }
+
+    // Event listeners
+    document.getElementById('expand-btn').addEventListener('click', expandAll);
+    document.getElementById('collapse-btn').addEventListener('click', collapseAll);
+    document.getElementById('copy-btn').addEventListener('click', () => root && copyDocument());
+    document.getElementById('download-btn').addEventListener('click', () => root && downloadDocument());
+
+    loadDocument();
+})();
@@ -0,0 +1,420 @@
+package api
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/rashpile/pako-justdoc/internal/model"
+	"github.com/rashpile/pako-justdoc/internal/storage"
+)
+
+// Export and import formats
+const (
+	formatNDJSON = "ndjson"
+	formatTar    = "tar"
+)
+
+// Imports are committed in chunks so a large archive doesn't hold a single
+// write transaction for its whole duration
+const (
+	importChunkDocs  = 500
+	importChunkBytes = 32 * 1024 * 1024
+)
+
+// Exports copy documents out in chunks, each in its own short read
+// transaction, and write them to the client outside of it, so a slow
+// client never holds a transaction open
+var (
+	readChunkDocs  = 100
+	readChunkBytes = 4 * 1024 * 1024
+)
+
+// errChunkFull ends a chunk read early
+var errChunkFull = errors.New("chunk full")
+
+// docEntry is a document copied out of a read transaction
+type docEntry struct {
+	name string
+	data []byte
+	meta storage.DocumentMeta
+}
+
+// forEachDocument calls fn for every document in a channel like
+// Storage.ForEachDocument, but reads them in chunks and calls fn outside
+// the read transactions. The documents don't form a consistent snapshot:
+// writes made between chunks show up if they sort after the last document
+// read. A channel deleted after the first chunk ends the iteration.
+func (h *Handler) forEachDocument(channel string, fn func(name string, data []byte, meta storage.DocumentMeta) error) error {
+	after := ""
+	for {
+		var chunk []docEntry
+		size := 0
+		err := h.storage.ForEachDocument(channel, after, func(name string, data []byte, meta storage.DocumentMeta) error {
+			chunk = append(chunk, docEntry{name: name, data: bytes.Clone(data), meta: meta})
+			size += len(data)
+			if len(chunk) >= readChunkDocs || size >= readChunkBytes {
+				return errChunkFull
+			}
+			return nil
+		})
+		if err == storage.ErrNotFound && after != "" {
+			return nil
+		}
+		if err != nil && err != errChunkFull {
+			return err
+		}
+		for _, e := range chunk {
+			if err := fn(e.name, e.data, e.meta); err != nil {
+				return err
+			}
+		}
+		if err == nil {
+			return nil
+		}
+		after = chunk[len(chunk)-1].name
+	}
+}
+
+// ExportChannel handles GET /{channel}/_export?format=ndjson|tar
+func (h *Handler) ExportChannel(w http.ResponseWriter, r *http.Request) {
+	channel := r.PathValue("channel")
+
+	if !model.IsValidName(channel) {
+		writeError(w, http.StatusBadRequest, model.ErrCodeInvalidName, "Invalid channel name")
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = formatNDJSON
+	}
+	if format != formatNDJSON && format != formatTar {
+		writeError(w, http.StatusBadRequest, model.ErrCodeInvalidOperation, "Unsupported export format "+format)
+		return
+	}
+
+	if _, err := h.storage.ListDocuments(channel); err == storage.ErrNotFound {
+		writeError(w, http.StatusNotFound, model.ErrCodeNotFound, "Channel not found")
+		return
+	}
+
+	// Once streaming starts the status is already sent, so a failure
+	// can only show up as a truncated body
+	if format == formatTar {
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+channel+`.tar.gz"`)
+		w.WriteHeader(http.StatusOK)
+		_ = h.exportTar(w, channel)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+channel+`.ndjson"`)
+	w.WriteHeader(http.StatusOK)
+	_ = h.exportNDJSON(w, channel)
+}
+
+func (h *Handler) exportNDJSON(w io.Writer, channel string) error {
+	var line bytes.Buffer
+	return h.forEachDocument(channel, func(name string, data []byte, meta storage.DocumentMeta) error {
+		line.Reset()
+		key, _ := json.Marshal(name)
+		metaJSON, _ := json.Marshal(exportMeta(meta))
+		line.WriteString(`{"name":`)
+		line.Write(key)
+		line.WriteString(`,"doc":`)
+		// Stored documents may span several lines
+		if err := json.Compact(&line, data); err != nil {
+			return err
+		}
+		line.WriteString(`,"meta":`)
+		line.Write(metaJSON)
+		line.WriteString("}\n")
+		_, err := w.Write(line.Bytes())
+		return err
+	})
+}
+
+// exportMeta converts stored metadata to its export form
+func exportMeta(meta storage.DocumentMeta) model.ExportMeta {
+	m := model.ExportMeta{Size: meta.Size, Modified: meta.Modified}
+	for _, a := range meta.Attachments {
+		m.Attachments = append(m.Attachments, model.AttachmentMeta(a))
+	}
+	return m
+}
+
+func (h *Handler) exportTar(w io.Writer, channel string) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	err := h.forEachDocument(channel, func(name string, data []byte, meta storage.DocumentMeta) error {
+		modified := meta.Modified
+		if modified.IsZero() {
+			modified = time.Now()
+		}
+		hdr := &tar.Header{
+			Name:    name + ".json",
+			Mode:    0644,
+			Size:    int64(len(data)),
+			ModTime: modified,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// importDoc is a document read from an import stream
+type importDoc struct {
+	name string
+	data []byte
+}
+
+// importError stops an import and describes the document that caused it
+type importError struct {
+	statusCode int
+	code       string
+	message    string
+	document   string
+}
+
+func (e *importError) Error() string {
+	return e.message
+}
+
+// ImportChannel handles POST /{channel}/_import?mode=overwrite|skip|fail
+//
+// The body is NDJSON as produced by ExportChannel (Content-Type
+// application/x-ndjson) or a tar.gz archive of name.json files
+// (Content-Type application/gzip).
+func (h *Handler) ImportChannel(w http.ResponseWriter, r *http.Request) {
+	channel := r.PathValue("channel")
+
+	if !model.IsValidName(channel) {
+		writeError(w, http.StatusBadRequest, model.ErrCodeInvalidName, "Invalid channel name")
+		return
+	}
+
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = model.ImportModeOverwrite
+	}
+	if mode != model.ImportModeOverwrite && mode != model.ImportModeSkip && mode != model.ImportModeFail {
+		writeError(w, http.StatusBadRequest, model.ErrCodeInvalidOperation, "Unsupported import mode "+mode)
+		return
+	}
+
+	var next func() (*importDoc, error)
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/gzip", "application/x-gzip", "application/x-tar+gzip":
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, model.ErrCodeInvalidOperation, "Body is not a gzip archive")
+			return
+		}
+		next = tarDocuments(tar.NewReader(gz), h.maxBodySize)
+	case "", "application/x-ndjson", "application/jsonl", "application/json":
+		next = ndjsonDocuments(r.Body, h.maxBodySize)
+	default:
+		writeError(w, http.StatusUnsupportedMediaType, model.ErrCodeInvalidOperation, "Unsupported import content type "+mediaType)
+		return
+	}
+
+	schema, err := h.channelSchema(channel)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to load channel schema")
+		return
+	}
+	normalize, err := h.normalizes(channel)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", "Failed to load channel settings")
+		return
+	}
+
+	resp := model.ImportResponse{Status: "completed", Channel: channel}
+	var ierr *importError
+	for done := false; !done; {
+		var chunk []importDoc
+		size := 0
+		for len(chunk) < importChunkDocs && size < importChunkBytes {
+			doc, err := next()
+			if err == io.EOF {
+				done = true
+				break
+			}
+			if err != nil {
+				if !errors.As(err, &ierr) {
+					ierr = &importError{statusCode: http.StatusBadRequest, code: model.ErrCodeInvalidJSON, message: err.Error()}
+				}
+				break
+			}
+			chunk = append(chunk, *doc)
+			size += len(doc.data)
+		}
+
+		if err := h.importChunk(channel, chunk, mode, schema, normalize, &resp); err != nil {
+			if !errors.As(err, &ierr) {
+				writeError(w, http.StatusInternalServerError, "internal_error", "Failed to store documents")
+				return
+			}
+		}
+		if ierr != nil {
+			break
+		}
+	}
+
+	if ierr != nil {
+		resp.Status = "failed"
+		resp.Error = ierr.code
+		resp.Message = ierr.message
+		resp.Document = ierr.document
+		writeJSON(w, ierr.statusCode, resp)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// importChunk stores a chunk of documents in a single transaction and
+// adds the outcome to resp. Nothing from the chunk is stored on error.
+func (h *Handler) importChunk(channel string, chunk []importDoc, mode string, schema *model.Schema, normalize bool, resp *model.ImportResponse) error {
+	if len(chunk) == 0 {
+		return nil
+	}
+	var created, updated, skipped int
+	err := h.storage.Batch(func(tx storage.Tx) error {
+		for _, doc := range chunk {
+			reserved := model.IsReservedName(channel) || model.IsReservedName(doc.name)
+			if mode != model.ImportModeOverwrite || reserved {
+				_, err := tx.GetDocument(channel, doc.name)
+				if err == nil && mode == model.ImportModeSkip {
+					skipped++
+					continue
+				}
+				if err == nil && mode == model.ImportModeFail {
+					return &importError{statusCode: http.StatusConflict, code: model.ErrCodeConflict, message: "Document already exists", document: doc.name}
+				}
+				if err == storage.ErrNotFound && reserved {
+					return &importError{statusCode: http.StatusBadRequest, code: model.ErrCodeInvalidName, message: reservedNameMessage, document: doc.name}
+				}
+				if err != nil && err != storage.ErrNotFound {
+					return err
+				}
+			}
+			data, err := normalizeDocument(doc.data, normalize)
+			if err != nil {
+				return &importError{statusCode: http.StatusBadRequest, code: model.ErrCodeInvalidJSON, message: "Document can't be normalized: " + err.Error(), document: doc.name}
+			}
+			if schema != nil {
+				violations, err := schema.Validate(data)
+				if err != nil {
+					return err
+				}
+				if violations != nil {
+					return &importError{statusCode: http.StatusBadRequest, code: model.ErrCodeSchemaViolation, message: "Document does not match the channel schema", document: doc.name}
+				}
+			}
+			isNew, err := tx.PutDocument(channel, doc.name, data)
+			if err != nil {
+				return err
+			}
+			if isNew {
+				created++
+			} else {
+				updated++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	resp.Created += created
+	resp.Updated += updated
+	resp.Skipped += skipped
+	return nil
+}
+
+// ndjsonDocuments returns an iterator over export records
+func ndjsonDocuments(r io.Reader, limit int64) func() (*importDoc, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), int(2*limit))
+	line := 0
+	return func() (*importDoc, error) {
+		for scanner.Scan() {
+			line++
+			text := bytes.TrimSpace(scanner.Bytes())
+			if len(text) == 0 {
+				continue
+			}
+			var rec model.ExportRecord
+			if err := json.Unmarshal(text, &rec); err != nil || len(rec.Doc) == 0 {
+				return nil, fmt.Errorf("line %d: invalid export record", line)
+			}
+			return checkImportDoc(rec.Name, rec.Doc, limit)
+		}
+		if err := scanner.Err(); err != nil {
+			if err == bufio.ErrTooLong {
+				return nil, &importError{statusCode: http.StatusRequestEntityTooLarge, code: model.ErrCodePayloadTooLarge, message: fmt.Sprintf("line %d: document exceeds %s limit", line+1, formatSize(limit))}
+			}
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+}
+
+// tarDocuments returns an iterator over the name.json entries of a tar archive
+func tarDocuments(tr *tar.Reader, limit int64) func() (*importDoc, error) {
+	return func() (*importDoc, error) {
+		for {
+			hdr, err := tr.Next()
+			if err != nil {
+				return nil, err
+			}
+			if hdr.Typeflag != tar.TypeReg || !strings.HasSuffix(hdr.Name, ".json") {
+				continue
+			}
+			name := strings.TrimSuffix(path.Base(hdr.Name), ".json")
+			if hdr.Size > limit {
+				return nil, &importError{statusCode: http.StatusRequestEntityTooLarge, code: model.ErrCodePayloadTooLarge, message: "Document exceeds " + formatSize(limit) + " limit", document: name}
+			}
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				return nil, err
+			}
+			return checkImportDoc(name, data, limit)
+		}
+	}
+}
+
+func checkImportDoc(name string, data []byte, limit int64) (*importDoc, error) {
+	if !model.IsValidName(name) {
+		return nil, &importError{statusCode: http.StatusBadRequest, code: model.ErrCodeInvalidName, message: "Invalid document name", document: name}
+	}
+	if !json.Valid(data) {
+		return nil, &importError{statusCode: http.StatusBadRequest, code: model.ErrCodeInvalidJSON, message: "Invalid JSON document", document: name}
+	}
+	if int64(len(data)) > limit {
+		return nil, &importError{statusCode: http.StatusRequestEntityTooLarge, code: model.ErrCodePayloadTooLarge, message: "Document exceeds " + formatSize(limit) + " limit", document: name}
+	}
+	return &importDoc{name: name, data: data}, nil
+}
@@ -0,0 +1,295 @@
+package api
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rashpile/pako-justdoc/internal/model"
+)
+
+func exportChannel(t *testing.T, handler *Handler, channel, format string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/"+channel+"/_export?format="+format, nil)
+	req.SetPathValue("channel", channel)
+	w := httptest.NewRecorder()
+	handler.ExportChannel(w, req)
+	return w
+}
+
+func importChannel(t *testing.T, handler *Handler, channel, mode, contentType string, body []byte) (*httptest.ResponseRecorder, model.ImportResponse) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/"+channel+"/_import?mode="+mode, bytes.NewReader(body))
+	req.SetPathValue("channel", channel)
+	req.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+	handler.ImportChannel(w, req)
+
+	var resp model.ImportResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse response %q: %v", w.Body.String(), err)
+	}
+	return w, resp
+}
+
+func TestExportChannel_NDJSON(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	postDocument(t, handler, "app", "b", "{\n  \"id\": \"b\"\n}")
+	postDocument(t, handler, "app", "a", `{"id": "a"}`)
+
+	w := exportChannel(t, handler, "app", "ndjson")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("Expected Content-Type application/x-ndjson, got %q", ct)
+	}
+
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %d: %q", len(lines), w.Body.String())
+	}
+	var rec model.ExportRecord
+	if err := json.Unmarshal([]byte(lines[1]), &rec); err != nil {
+		t.Fatalf("Failed to parse line: %v", err)
+	}
+	if rec.Name != "b" || string(rec.Doc) != `{"id":"b"}` {
+		t.Errorf("Unexpected record: %s", lines[1])
+	}
+	if rec.Meta.Size != len("{\n  \"id\": \"b\"\n}") || rec.Meta.Modified.IsZero() {
+		t.Errorf("Unexpected meta: %+v", rec.Meta)
+	}
+}
+
+func TestExportChannel_NotFound(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	if w := exportChannel(t, handler, "missing", "ndjson"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+	postDocument(t, handler, "app", "a", `{}`)
+	if w := exportChannel(t, handler, "app", "zip"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d for unknown format, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestExportImport_RoundTrip(t *testing.T) {
+	for _, tc := range []struct{ format, contentType, want string }{
+		{"ndjson", "application/x-ndjson", `[1,2,3]`},
+		{"tar", "application/gzip", `[1, 2, 3]`},
+	} {
+		t.Run(tc.format, func(t *testing.T) {
+			source, cleanup := setupTestHandler(t)
+			defer cleanup()
+			target, cleanupTarget := setupTestHandler(t)
+			defer cleanupTarget()
+
+			postDocument(t, source, "app", "a", `{"id": "a"}`)
+			postDocument(t, source, "app", "b", `[1, 2, 3]`)
+
+			export := exportChannel(t, source, "app", tc.format)
+			w, resp := importChannel(t, target, "copy", "", tc.contentType, export.Body.Bytes())
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+			}
+			if resp.Created != 2 {
+				t.Errorf("Expected 2 created, got %+v", resp)
+			}
+
+			// NDJSON exports compact documents onto one line
+			data, err := target.storage.GetDocument("copy", "b")
+			if err != nil || string(data) != tc.want {
+				t.Errorf("Expected imported document %q, got %q (%v)", tc.want, data, err)
+			}
+		})
+	}
+}
+
+func TestImportChannel_Modes(t *testing.T) {
+	body := []byte(`{"name": "a", "doc": {"v": "new"}}
+{"name": "b", "doc": {"v": "new"}}
+`)
+
+	tests := []struct {
+		mode       string
+		wantCode   int
+		wantA      string
+		wantResult model.ImportResponse
+	}{
+		{"overwrite", http.StatusOK, `{"v": "new"}`, model.ImportResponse{Created: 1, Updated: 1}},
+		{"skip", http.StatusOK, `{"v": "old"}`, model.ImportResponse{Created: 1, Skipped: 1}},
+		{"fail", http.StatusConflict, `{"v": "old"}`, model.ImportResponse{Error: model.ErrCodeConflict, Document: "a"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			handler, cleanup := setupTestHandler(t)
+			defer cleanup()
+
+			postDocument(t, handler, "app", "a", `{"v": "old"}`)
+
+			w, resp := importChannel(t, handler, "app", tt.mode, "application/x-ndjson", body)
+			if w.Code != tt.wantCode {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantCode, w.Code, w.Body.String())
+			}
+			if resp.Created != tt.wantResult.Created || resp.Updated != tt.wantResult.Updated ||
+				resp.Skipped != tt.wantResult.Skipped || resp.Error != tt.wantResult.Error ||
+				resp.Document != tt.wantResult.Document {
+				t.Errorf("Unexpected result: %+v", resp)
+			}
+
+			data, _ := handler.storage.GetDocument("app", "a")
+			if string(data) != tt.wantA {
+				t.Errorf("Expected a = %s, got %s", tt.wantA, data)
+			}
+		})
+	}
+}
+
+func TestImportChannel_InvalidRecords(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	tests := []struct {
+		name string
+		body string
+		code string
+	}{
+		{"not json", "{oops\n", model.ErrCodeInvalidJSON},
+		{"missing doc", `{"name": "a"}`, model.ErrCodeInvalidJSON},
+		{"invalid name", `{"name": "a.b", "doc": {}}`, model.ErrCodeInvalidName},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, resp := importChannel(t, handler, "app", "", "application/x-ndjson", []byte(tt.body))
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+			}
+			if resp.Status != "failed" || resp.Error != tt.code {
+				t.Errorf("Expected failed import with %q, got %+v", tt.code, resp)
+			}
+		})
+	}
+}
+
+func TestImportChannel_TarSkipsOtherEntries(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range map[string]string{
+		"export/a.json": `{"id": "a"}`,
+		"README.txt":    "not a document",
+	} {
+		_ = tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))})
+		_, _ = io.WriteString(tw, content)
+	}
+	_ = tw.WriteHeader(&tar.Header{Name: "export/", Typeflag: tar.TypeDir, Mode: 0755})
+	_ = tw.Close()
+	_ = gz.Close()
+
+	w, resp := importChannel(t, handler, "app", "", "application/gzip", buf.Bytes())
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if resp.Created != 1 {
+		t.Errorf("Expected 1 created, got %+v", resp)
+	}
+}
+
+func TestExportChannel_StalledReaderDoesNotBlockCompact(t *testing.T) {
+	for _, format := range []string{"ndjson", "tar"} {
+		t.Run(format, func(t *testing.T) {
+			expectCompactNotBlocked(t, "/app/_export?format="+format, 0, (*Handler).ExportChannel)
+		})
+	}
+}
+
+func TestExportChannel_Chunks(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+	defer func(n int) { readChunkDocs = n }(readChunkDocs)
+	readChunkDocs = 2
+
+	for _, name := range []string{"e", "d", "c", "b", "a"} {
+		postDocument(t, handler, "app", name, `{"id": "`+name+`"}`)
+	}
+
+	w := exportChannel(t, handler, "app", "ndjson")
+	var names []string
+	for _, line := range strings.Split(strings.TrimSpace(w.Body.String()), "\n") {
+		var rec model.ExportRecord
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("Failed to parse line %q: %v", line, err)
+		}
+		names = append(names, rec.Name)
+	}
+	if got := strings.Join(names, ","); got != "a,b,c,d,e" {
+		t.Errorf("Expected every document once in order, got %s", got)
+	}
+}
+
+func TestExportImport_ReservedNames(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+	router := NewRouter(handler)
+
+	for _, tt := range []struct {
+		method, path string
+		status       int
+		code         string
+	}{
+		{http.MethodPost, "/app/_export", http.StatusBadRequest, model.ErrCodeInvalidName},
+		{http.MethodPatch, "/app/_import", http.StatusNotFound, model.ErrCodeNotFound},
+	} {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(`{"a": 1}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var resp model.ErrorResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != tt.status || resp.Error != tt.code {
+			t.Errorf("%s %s: expected %d %s, got %d %s", tt.method, tt.path, tt.status, tt.code, w.Code, w.Body.String())
+		}
+	}
+	if _, err := handler.storage.ListDocuments("app"); err == nil {
+		t.Error("Expected nothing to be stored")
+	}
+}
+
+func TestImportChannel_LegacyReservedNames(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+	if _, err := handler.storage.PutDocument("app", "_legacy", []byte(`{"v":1}`)); err != nil {
+		t.Fatalf("PutDocument failed: %v", err)
+	}
+
+	// Existing documents with reserved names are updated
+	w, resp := importChannel(t, handler, "app", model.ImportModeOverwrite, "application/x-ndjson",
+		[]byte(`{"name":"_legacy","doc":{"v":2}}`+"\n"))
+	if w.Code != http.StatusOK || resp.Updated != 1 {
+		t.Errorf("Expected _legacy to be updated, got %d %s", w.Code, w.Body.String())
+	}
+
+	// New ones are rejected
+	w, resp = importChannel(t, handler, "app", model.ImportModeOverwrite, "application/x-ndjson",
+		[]byte(`{"name":"a","doc":{}}`+"\n"+`{"name":"_new","doc":{}}`+"\n"))
+	if w.Code != http.StatusBadRequest || resp.Error != model.ErrCodeInvalidName || resp.Document != "_new" {
+		t.Errorf("Expected _new to be rejected, got %d %s", w.Code, w.Body.String())
+	}
+	if names, _ := handler.storage.ListDocuments("app"); strings.Join(names, ",") != "_legacy" {
+		t.Errorf("Expected the failed chunk not to be stored, got %v", names)
+	}
+}
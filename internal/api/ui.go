@@ -2,20 +2,42 @@ package api
 
 import (
 	"embed"
+	"fmt"
 	"html/template"
 	"io/fs"
 	"net/http"
+	"time"
 
 	"github.com/rashpile/pako-justdoc/internal/model"
+	"github.com/rashpile/pako-justdoc/internal/storage"
 )
 
 //go:embed static/*
 var staticFiles embed.FS
 
-var editorTemplate *template.Template
+var (
+	editorTemplate *template.Template
+	browseTemplate *template.Template
+	viewTemplate   *template.Template
+)
 
 func init() {
 	editorTemplate = template.Must(template.ParseFS(staticFiles, "static/editor.html"))
+	viewTemplate = template.Must(template.ParseFS(staticFiles, "static/view.html"))
+	browseTemplate = template.Must(template.New("browse.html").Funcs(template.FuncMap{
+		"size":     sizeLabel,
+		"rfc3339":  func(t time.Time) string { return t.UTC().Format(time.RFC3339) },
+		"datetime": func(t time.Time) string { return t.UTC().Format("2006-01-02 15:04 UTC") },
+	}).ParseFS(staticFiles, "static/browse.html"))
+}
+
+// browseData is rendered by the browse template; Channel is empty on the
+// channel list page
+type browseData struct {
+	Channel     string
+	Channels    []storage.ChannelInfo
+	Documents   []storage.DocumentInfo
+	NamePattern string
 }
 
 // ServeStatic serves embedded static files
@@ -35,14 +57,105 @@ func (h *Handler) EditorUI(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	data := struct {
+		Channel     string
+		Document    string
+		NamePattern string
+	}{
+		Channel:     channel,
+		Document:    document,
+		NamePattern: model.NamePattern,
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_ = editorTemplate.Execute(w, data)
+}
+
+// ViewUI serves the read-only document viewer. The token of a share link
+// is passed on to the page, which sends it when loading the document.
+func (h *Handler) ViewUI(w http.ResponseWriter, r *http.Request) {
+	channel := r.PathValue("channel")
+	document := r.PathValue("document")
+
+	if !model.IsValidName(channel) || !model.IsValidName(document) {
+		http.Error(w, "Invalid channel or document name", http.StatusBadRequest)
+		return
+	}
+
 	data := struct {
 		Channel  string
 		Document string
+		Token    string
 	}{
 		Channel:  channel,
 		Document: document,
+		Token:    r.URL.Query().Get("token"),
 	}
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	_ = editorTemplate.Execute(w, data)
+	_ = viewTemplate.Execute(w, data)
+}
+
+// DocsUI serves the interactive API explorer, which renders the OpenAPI
+// spec and sends requests from the browser
+func DocsUI(w http.ResponseWriter, r *http.Request) {
+	page, err := staticFiles.ReadFile("static/docs.html")
+	if err != nil {
+		http.Error(w, "Explorer not available", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write(page)
+}
+
+// ChannelsUI serves the HTML page listing all channels
+func (h *Handler) ChannelsUI(w http.ResponseWriter, r *http.Request) {
+	channels, err := h.storage.ListChannels()
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_ = browseTemplate.Execute(w, browseData{
+		Channels:    channels,
+		NamePattern: model.NewNamePattern,
+	})
+}
+
+// BrowseUI serves the HTML page listing the documents of a channel. A
+// channel that doesn't exist yet is shown empty, so its first document can
+// be created from the page.
+func (h *Handler) BrowseUI(w http.ResponseWriter, r *http.Request) {
+	channel := r.PathValue("channel")
+
+	if !model.IsValidName(channel) {
+		http.Error(w, "Invalid channel name", http.StatusBadRequest)
+		return
+	}
+
+	docs, err := h.storage.ListDocumentMeta(channel)
+	if err != nil && err != storage.ErrNotFound {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_ = browseTemplate.Execute(w, browseData{
+		Channel:     channel,
+		Documents:   docs,
+		NamePattern: model.NewNamePattern,
+	})
+}
+
+// sizeLabel formats a document size for display
+func sizeLabel(n int) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
 }
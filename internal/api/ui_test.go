@@ -64,6 +64,67 @@ func TestEditorUI_IncludesChannelAndDocument(t *testing.T) {
 	}
 }
 
+func TestEditorUI_IncludesTreeMode(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	req := httptest.NewRequest(http.MethodGet, "/myapp/settings/ui", nil)
+	req.SetPathValue("channel", "myapp")
+	req.SetPathValue("document", "settings")
+
+	w := httptest.NewRecorder()
+	handler.EditorUI(w, req)
+
+	body := w.Body.String()
+	for _, id := range []string{`id="text-mode"`, `id="tree-mode"`, `id="tree"`} {
+		if !strings.Contains(body, id) {
+			t.Errorf("Expected editor page to contain %s", id)
+		}
+	}
+}
+
+func TestEditorUI_IncludesDiffPanel(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	req := httptest.NewRequest(http.MethodGet, "/myapp/settings/ui", nil)
+	req.SetPathValue("channel", "myapp")
+	req.SetPathValue("document", "settings")
+
+	w := httptest.NewRecorder()
+	handler.EditorUI(w, req)
+
+	body := w.Body.String()
+	if !strings.Contains(body, `id="diff-panel"`) {
+		t.Error("Expected editor page to contain the diff panel")
+	}
+	if !strings.Contains(body, `id="diff-revision"`) {
+		t.Error("Expected the diff panel to offer earlier revisions")
+	}
+	if !strings.Contains(body, `window.NAME_PATTERN = "^[a-zA-Z0-9_-]{1,128}$"`) {
+		t.Error("Expected editor page to define NAME_PATTERN")
+	}
+}
+
+func TestEditorUI_IncludesTools(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	req := httptest.NewRequest(http.MethodGet, "/myapp/settings/ui", nil)
+	req.SetPathValue("channel", "myapp")
+	req.SetPathValue("document", "settings")
+
+	w := httptest.NewRecorder()
+	handler.EditorUI(w, req)
+
+	body := w.Body.String()
+	for _, id := range []string{`id="gutter"`, `id="format-btn"`, `id="minify-btn"`, `id="sort-btn"`, `id="find-bar"`, `id="syntax-error"`} {
+		if !strings.Contains(body, id) {
+			t.Errorf("Expected editor page to contain %s", id)
+		}
+	}
+}
+
 func TestEditorUI_InvalidName_Returns400(t *testing.T) {
 	handler, cleanup := setupTestHandler(t)
 	defer cleanup()
@@ -124,3 +185,209 @@ func TestServeStatic_CSS(t *testing.T) {
 		t.Error("Expected CSS to contain '#editor' selector")
 	}
 }
+
+func TestDocsUI_ReturnsExplorer(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	router := NewRouter(handler)
+	req := httptest.NewRequest(http.MethodGet, "/_/docs", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("Expected Content-Type to start with 'text/html', got %q", ct)
+	}
+
+	body := w.Body.String()
+	for _, asset := range []string{"/_/static/docs.js", "/_/static/docs.css"} {
+		if !strings.Contains(body, asset) {
+			t.Errorf("Expected page to reference %s", asset)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, asset, nil)
+		w := httptest.NewRecorder()
+		ServeStatic(w, req)
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: expected status %d, got %d", asset, http.StatusOK, w.Code)
+		}
+	}
+}
+
+func TestDocsUI_NoExternalResources(t *testing.T) {
+	// The explorer must work offline, so nothing may be loaded from a CDN
+	for _, name := range []string{"docs.html", "docs.js", "docs.css"} {
+		data, err := staticFiles.ReadFile("static/" + name)
+		if err != nil {
+			t.Fatalf("read %s: %v", name, err)
+		}
+		if strings.Contains(string(data), "http://") || strings.Contains(string(data), "https://") {
+			t.Errorf("%s references an external URL", name)
+		}
+	}
+}
+
+func TestChannelsUI_ListsChannels(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+	_, _ = handler.storage.PutDocument("myapp", "settings", []byte(`{}`))
+	_, _ = handler.storage.PutDocument("myapp", "theme", []byte(`{}`))
+	_, _ = handler.storage.PutDocument("other", "doc", []byte(`{}`))
+
+	router := NewRouter(handler)
+	req := httptest.NewRequest(http.MethodGet, "/_/", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("Expected Content-Type to start with 'text/html', got %q", ct)
+	}
+
+	body := w.Body.String()
+	for _, want := range []string{
+		`<a href="/_/browse/myapp">myapp</a>`,
+		`<a href="/_/browse/other">other</a>`,
+		`<td class="num">2</td>`,
+		`window.CHANNEL = ""`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected page to contain %q", want)
+		}
+	}
+}
+
+func TestBrowseUI_ListsDocuments(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+	_, _ = handler.storage.PutDocument("myapp", "settings", []byte(`{"theme":"dark"}`))
+	_, _ = handler.storage.PutDocument("myapp", "big", []byte(`"`+strings.Repeat("x", 2046)+`"`))
+
+	router := NewRouter(handler)
+	req := httptest.NewRequest(http.MethodGet, "/_/browse/myapp", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	body := w.Body.String()
+	for _, want := range []string{
+		"<title>myapp - JustDoc</title>",
+		`<a href="/_/edit/myapp/settings">settings</a>`,
+		`<a href="/_/edit/myapp/big">big</a>`,
+		`<td class="num">16 B</td>`,
+		`<td class="num">2.0 KB</td>`,
+		`<time datetime="`,
+		`window.CHANNEL = "myapp"`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected page to contain %q", want)
+		}
+	}
+	if strings.Index(body, ">big<") > strings.Index(body, ">settings<") {
+		t.Error("Expected documents sorted by name")
+	}
+}
+
+func TestBrowseUI_UnknownChannel(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	req := httptest.NewRequest(http.MethodGet, "/_/browse/newchannel", nil)
+	req.SetPathValue("channel", "newchannel")
+	w := httptest.NewRecorder()
+	handler.BrowseUI(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "This channel has no documents yet.") {
+		t.Error("Expected empty channel message")
+	}
+}
+
+func TestBrowseUI_InvalidName_Returns400(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	req := httptest.NewRequest(http.MethodGet, "/_/browse/bad.name", nil)
+	req.SetPathValue("channel", "bad.name")
+	w := httptest.NewRecorder()
+	handler.BrowseUI(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestEditorUI_IncludesShareDialog(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	req := httptest.NewRequest(http.MethodGet, "/_/edit/myapp/settings", nil)
+	req.SetPathValue("channel", "myapp")
+	req.SetPathValue("document", "settings")
+
+	w := httptest.NewRecorder()
+	handler.EditorUI(w, req)
+
+	body := w.Body.String()
+	for _, id := range []string{`id="share-btn"`, `id="share-dialog"`, `id="share-expiry"`, `id="share-url"`} {
+		if !strings.Contains(body, id) {
+			t.Errorf("Expected editor page to contain %s", id)
+		}
+	}
+}
+
+func TestViewUI_ReturnsViewer(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	router := NewRouter(handler)
+	req := httptest.NewRequest(http.MethodGet, "/_/view/myapp/settings?token=abc.def", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("Expected Content-Type to start with 'text/html', got %q", ct)
+	}
+
+	body := w.Body.String()
+	for _, want := range []string{
+		`window.CHANNEL = "myapp"`,
+		`window.DOCUMENT = "settings"`,
+		`window.TOKEN = "abc.def"`,
+		"/_/static/json.js",
+		"/_/static/view.js",
+		"/_/static/view.css",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected viewer page to contain %s", want)
+		}
+	}
+}
+
+func TestViewUI_InvalidName_Returns400(t *testing.T) {
+	handler, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	req := httptest.NewRequest(http.MethodGet, "/_/view/my%20app/settings", nil)
+	req.SetPathValue("channel", "my app")
+	req.SetPathValue("document", "settings")
+	w := httptest.NewRecorder()
+	handler.ViewUI(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
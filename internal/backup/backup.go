@@ -0,0 +1,150 @@
+// Package backup writes rotated database snapshots and restores them
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"go.etcd.io/bbolt"
+
+	"github.com/rashpile/pako-justdoc/internal/storage"
+)
+
+const (
+	filePrefix = "justdoc-"
+	fileSuffix = ".db"
+	timeFormat = "20060102T150405.000000000Z"
+)
+
+// ErrDatabaseInUse is returned by Restore when another process holds the database
+var ErrDatabaseInUse = errors.New("database is in use, stop the server first")
+
+// Snapshot writes a snapshot of b into dir and removes the oldest snapshots
+// so that at most keep remain (keep <= 0 keeps all of them).
+// Returns the path of the new snapshot.
+func Snapshot(b storage.Backuper, dir string, keep int) (string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+
+	name := filePrefix + time.Now().UTC().Format(timeFormat) + fileSuffix
+	path := filepath.Join(dir, name)
+	if err := WriteFile(b, path); err != nil {
+		return "", err
+	}
+
+	if keep > 0 {
+		snapshots, err := List(dir)
+		if err != nil {
+			return path, err
+		}
+		for len(snapshots) > keep {
+			if err := os.Remove(snapshots[0]); err != nil {
+				return path, err
+			}
+			snapshots = snapshots[1:]
+		}
+	}
+	return path, nil
+}
+
+// WriteFile writes a snapshot of b to path, atomically replacing any existing file
+func WriteFile(b storage.Backuper, path string) error {
+	return writeFile(path, func(w io.Writer) error {
+		_, err := b.Backup(w)
+		return err
+	})
+}
+
+// List returns the snapshot paths in dir, oldest first
+func List(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.Type().IsRegular() && strings.HasPrefix(name, filePrefix) && strings.HasSuffix(name, fileSuffix) {
+			paths = append(paths, filepath.Join(dir, name))
+		}
+	}
+	// Timestamps sort lexicographically
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// Restore replaces the database at dst with the snapshot at src.
+// The snapshot is checked first, and the server using dst must be stopped.
+func Restore(src, dst string) error {
+	snapshot, err := bbolt.Open(src, 0600, &bbolt.Options{ReadOnly: true, Timeout: time.Second})
+	if err != nil {
+		return fmt.Errorf("open snapshot: %w", err)
+	}
+	err = snapshot.View(func(tx *bbolt.Tx) error {
+		var first error
+		// Drain the channel so the checker goroutine can finish
+		for err := range tx.Check() {
+			if first == nil {
+				first = fmt.Errorf("snapshot is corrupted: %w", err)
+			}
+		}
+		return first
+	})
+	_ = snapshot.Close()
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(dst); err == nil {
+		db, err := bbolt.Open(dst, 0600, &bbolt.Options{Timeout: time.Second})
+		if err == bbolt.ErrTimeout {
+			return ErrDatabaseInUse
+		}
+		if err == nil {
+			_ = db.Close()
+		}
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+
+	return writeFile(dst, func(w io.Writer) error {
+		_, err := io.Copy(w, in)
+		return err
+	})
+}
+
+// writeFile atomically replaces path with the output of write
+func writeFile(path string, write func(w io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if err := write(tmp); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
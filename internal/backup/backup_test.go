@@ -0,0 +1,96 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rashpile/pako-justdoc/internal/storage"
+)
+
+func openStorage(t *testing.T, path string) *storage.BoltStorage {
+	t.Helper()
+	store, err := storage.NewBoltStorage(path)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	return store
+}
+
+func TestSnapshot_Rotation(t *testing.T) {
+	store := openStorage(t, filepath.Join(t.TempDir(), "test.db"))
+	defer func() { _ = store.Close() }()
+
+	dir := filepath.Join(t.TempDir(), "backups")
+	var paths []string
+	for i := 0; i < 4; i++ {
+		path, err := Snapshot(store, dir, 2)
+		if err != nil {
+			t.Fatalf("Snapshot failed: %v", err)
+		}
+		paths = append(paths, path)
+	}
+
+	snapshots, err := List(dir)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(snapshots) != 2 {
+		t.Fatalf("Expected 2 snapshots, got %v", snapshots)
+	}
+	if snapshots[0] != paths[2] || snapshots[1] != paths[3] {
+		t.Errorf("Expected newest snapshots %v, got %v", paths[2:], snapshots)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "justdoc.db")
+
+	store := openStorage(t, dbPath)
+	if _, err := store.PutDocument("app", "settings", []byte(`{"v": 1}`)); err != nil {
+		t.Fatalf("PutDocument failed: %v", err)
+	}
+	snapshot, err := Snapshot(store, filepath.Join(dir, "backups"), 0)
+	if err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+	if _, err := store.PutDocument("app", "settings", []byte(`{"v": 2}`)); err != nil {
+		t.Fatalf("PutDocument failed: %v", err)
+	}
+
+	// Restoring over an open database is refused
+	if err := Restore(snapshot, dbPath); err != ErrDatabaseInUse {
+		t.Errorf("Expected ErrDatabaseInUse, got %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	if err := Restore(snapshot, dbPath); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+
+	store = openStorage(t, dbPath)
+	defer func() { _ = store.Close() }()
+	data, err := store.GetDocument("app", "settings")
+	if err != nil || string(data) != `{"v": 1}` {
+		t.Errorf("Expected restored document, got %q (%v)", data, err)
+	}
+}
+
+func TestRestore_InvalidSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	bogus := filepath.Join(dir, "bogus.db")
+	if err := os.WriteFile(bogus, []byte("not a database"), 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	dbPath := filepath.Join(dir, "justdoc.db")
+	if err := Restore(bogus, dbPath); err == nil {
+		t.Error("Expected error restoring invalid snapshot")
+	}
+	if _, err := os.Stat(dbPath); !os.IsNotExist(err) {
+		t.Error("Expected database not to be created")
+	}
+}
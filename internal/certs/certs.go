@@ -0,0 +1,187 @@
+// Package certs loads TLS certificates for the server, reloading them when
+// the files change, and generates self-signed certificates for development.
+package certs
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// checkInterval is how often the certificate files are checked for changes
+const checkInterval = 2 * time.Second
+
+// Reloader serves a certificate and key pair from disk and picks up new
+// files, such as renewed certificates, without a restart. If the new files
+// can't be loaded the previous certificate is kept.
+type Reloader struct {
+	certFile, keyFile string
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	stamp     string
+	lastCheck time.Time
+}
+
+// NewReloader loads the certificate and key
+func NewReloader(certFile, keyFile string) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile}
+	stamp, err := r.fileStamp()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.load(stamp); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate returns the current certificate; it can be used as
+// tls.Config.GetCertificate
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.lastCheck) >= checkInterval {
+		r.lastCheck = time.Now()
+		stamp, err := r.fileStamp()
+		if err == nil && stamp != r.stamp {
+			err = r.load(stamp)
+			if err == nil {
+				log.Printf("Reloaded TLS certificate from %s", r.certFile)
+			}
+		}
+		if err != nil {
+			log.Printf("Failed to reload TLS certificate, keeping the current one: %v", err)
+		}
+	}
+	return r.cert, nil
+}
+
+// load reads the key pair; the caller holds mu or has exclusive access
+func (r *Reloader) load(stamp string) error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.cert = &cert
+	r.stamp = stamp
+	return nil
+}
+
+// fileStamp identifies the current version of both files
+func (r *Reloader) fileStamp() (string, error) {
+	var stamp string
+	for _, name := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return "", err
+		}
+		stamp += fmt.Sprintf("%d/%d;", info.ModTime().UnixNano(), info.Size())
+	}
+	return stamp, nil
+}
+
+// LoadCertPool reads PEM certificates, such as a client CA bundle
+func LoadCertPool(file string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("%s contains no PEM certificates", file)
+	}
+	return pool, nil
+}
+
+// EnsureSelfSigned writes a self-signed certificate and key to certFile
+// and keyFile unless both already exist, and reports whether it created
+// them. The certificate is valid for a year for localhost, the machine's
+// host name and hosts.
+func EnsureSelfSigned(certFile, keyFile string, hosts []string) (bool, error) {
+	_, certErr := os.Stat(certFile)
+	_, keyErr := os.Stat(keyFile)
+	if certErr == nil && keyErr == nil {
+		return false, nil
+	}
+	if certErr == nil || keyErr == nil {
+		return false, fmt.Errorf("only one of %s and %s exists; remove it to generate a new certificate", certFile, keyFile)
+	}
+	if !errors.Is(certErr, os.ErrNotExist) {
+		return false, certErr
+	}
+
+	certPEM, keyPEM, err := selfSigned(hosts, time.Now())
+	if err != nil {
+		return false, err
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		return false, err
+	}
+	if err := os.WriteFile(certFile, certPEM, 0644); err != nil {
+		_ = os.Remove(keyFile)
+		return false, err
+	}
+	return true, nil
+}
+
+func selfSigned(hosts []string, now time.Time) (certPEM, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "JustDoc self-signed", Organization: []string{"JustDoc"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	names := append([]string{"localhost", "127.0.0.1", "::1"}, hosts...)
+	if hostname, err := os.Hostname(); err == nil {
+		names = append(names, hostname)
+	}
+	for _, name := range names {
+		if ip := net.ParseIP(name); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else if name != "" {
+			tmpl.DNSNames = append(tmpl.DNSNames, name)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var certBuf, keyBuf bytes.Buffer
+	_ = pem.Encode(&certBuf, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+	_ = pem.Encode(&keyBuf, &pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	return certBuf.Bytes(), keyBuf.Bytes(), nil
+}
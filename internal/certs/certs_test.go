@@ -0,0 +1,158 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestEnsureSelfSigned(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+
+	created, err := EnsureSelfSigned(certFile, keyFile, []string{"docs.internal", "10.0.0.5"})
+	if err != nil || !created {
+		t.Fatalf("EnsureSelfSigned = %v, %v", created, err)
+	}
+	if info, err := os.Stat(keyFile); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("expected key file with mode 0600, got %v, %v", info, err)
+	}
+
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("generated pair doesn't load: %v", err)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		t.Fatalf("ParseCertificate failed: %v", err)
+	}
+	for _, name := range []string{"localhost", "docs.internal"} {
+		if !slices.Contains(cert.DNSNames, name) {
+			t.Errorf("expected DNS name %q in %v", name, cert.DNSNames)
+		}
+	}
+	if err := cert.VerifyHostname("10.0.0.5"); err != nil {
+		t.Errorf("expected certificate to cover 10.0.0.5: %v", err)
+	}
+
+	// A second start keeps the existing files
+	before, _ := os.ReadFile(certFile)
+	created, err = EnsureSelfSigned(certFile, keyFile, nil)
+	if err != nil || created {
+		t.Fatalf("second EnsureSelfSigned = %v, %v", created, err)
+	}
+	if after, _ := os.ReadFile(certFile); string(after) != string(before) {
+		t.Error("existing certificate was replaced")
+	}
+
+	// Only one file is an error rather than a silent overwrite
+	_ = os.Remove(keyFile)
+	if _, err := EnsureSelfSigned(certFile, keyFile, nil); err == nil {
+		t.Error("expected error with the key missing")
+	}
+}
+
+func writePair(t *testing.T, certFile, keyFile string, host string) {
+	t.Helper()
+	certPEM, keyPEM, err := selfSigned([]string{host}, time.Now())
+	if err != nil {
+		t.Fatalf("selfSigned failed: %v", err)
+	}
+	if err := os.WriteFile(certFile, certPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	writePair(t, certFile, keyFile, "first.test")
+
+	r, err := NewReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("NewReloader failed: %v", err)
+	}
+	first, _ := r.GetCertificate(nil)
+
+	// Renew the certificate; the files get a different modification time
+	writePair(t, certFile, keyFile, "second.test")
+	future := time.Now().Add(time.Minute)
+	_ = os.Chtimes(certFile, future, future)
+	r.lastCheck = time.Time{}
+
+	second, _ := r.GetCertificate(nil)
+	if second == first {
+		t.Fatal("certificate was not reloaded")
+	}
+	leaf, _ := x509.ParseCertificate(second.Certificate[0])
+	if !slices.Contains(leaf.DNSNames, "second.test") {
+		t.Errorf("expected the renewed certificate, got %v", leaf.DNSNames)
+	}
+
+	// A broken file keeps the current certificate
+	if err := os.WriteFile(certFile, []byte("not a certificate"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r.lastCheck = time.Time{}
+	if got, err := r.GetCertificate(nil); err != nil || got != second {
+		t.Errorf("expected the previous certificate, got %v, %v", got, err)
+	}
+}
+
+func TestReloader_ServesHTTPS(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	if _, err := EnsureSelfSigned(certFile, keyFile, nil); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Proto))
+	}))
+	srv.EnableHTTP2 = true
+	srv.TLS = &tls.Config{GetCertificate: r.GetCertificate}
+	srv.StartTLS()
+	defer srv.Close()
+
+	pool, err := LoadCertPool(certFile)
+	if err != nil {
+		t.Fatalf("LoadCertPool failed: %v", err)
+	}
+	transport := &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}, ForceAttemptHTTP2: true}
+	client := &http.Client{Transport: transport}
+	_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	resp, err := client.Get("https://localhost:" + port)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.ProtoMajor != 2 {
+		t.Errorf("expected HTTP/2, got %s", resp.Proto)
+	}
+}
+
+func TestLoadCertPool_NoCertificates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	_ = os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("x")}), 0600)
+	if _, err := LoadCertPool(path); err == nil {
+		t.Error("expected error for a file without certificates")
+	}
+}
@@ -0,0 +1,439 @@
+// Package cli implements the justdoc client subcommands. Commands talk to
+// a server over HTTP, or with --offline serve the same API in-process on
+// top of the local database.
+package cli
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rashpile/pako-justdoc/internal/api"
+	"github.com/rashpile/pako-justdoc/internal/certs"
+	"github.com/rashpile/pako-justdoc/internal/storage"
+)
+
+// Env is the environment a command runs in
+type Env struct {
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+	// OpenStorage opens the local database for --offline
+	OpenStorage func() (storage.Storage, error)
+}
+
+// options are the flags shared by all commands, plus command-specific ones
+type options struct {
+	url        string
+	apiKey     string
+	offline    bool
+	caCert     string
+	clientCert string
+	clientKey  string
+
+	raw      bool
+	format   string
+	mode     string
+	output   string
+	interval time.Duration
+}
+
+type command struct {
+	usage       string
+	description string
+	// minArgs and maxArgs bound the positional arguments
+	minArgs, maxArgs int
+	flags            func(fs *flag.FlagSet, o *options)
+	run              func(ctx context.Context, c *Client, args []string, o *options, env Env) error
+}
+
+var commands = map[string]command{
+	"get": {
+		usage:       "get <channel> <document>",
+		description: "Print a document",
+		minArgs:     2, maxArgs: 2,
+		flags: func(fs *flag.FlagSet, o *options) {
+			fs.BoolVar(&o.raw, "raw", false, "print the document as stored instead of pretty-printed")
+		},
+		run: runGet,
+	},
+	"put": {
+		usage:       "put <channel> <document> [file]",
+		description: "Store a document read from file or stdin",
+		minArgs:     2, maxArgs: 3,
+		run: runPut,
+	},
+	"patch": {
+		usage:       "patch <channel> <document> [file]",
+		description: "Apply a JSON merge patch read from file or stdin",
+		minArgs:     2, maxArgs: 3,
+		run: runPatch,
+	},
+	"delete": {
+		usage:       "delete <channel> <document>",
+		description: "Delete a document",
+		minArgs:     2, maxArgs: 2,
+		run: runDelete,
+	},
+	"ls": {
+		usage:       "ls [channel]",
+		description: "List channels, or the documents in a channel",
+		minArgs:     0, maxArgs: 1,
+		run: runList,
+	},
+	"export": {
+		usage:       "export <channel>",
+		description: "Export a channel to stdout or a file",
+		minArgs:     1, maxArgs: 1,
+		flags: func(fs *flag.FlagSet, o *options) {
+			fs.StringVar(&o.format, "format", "ndjson", "export format: ndjson or tar")
+			fs.StringVar(&o.output, "o", "", "write to `file` instead of stdout")
+		},
+		run: runExport,
+	},
+	"import": {
+		usage:       "import <channel> [file]",
+		description: "Import an export read from file or stdin",
+		minArgs:     1, maxArgs: 2,
+		flags: func(fs *flag.FlagSet, o *options) {
+			fs.StringVar(&o.format, "format", "", "input format: ndjson or tar (default: from file name, else ndjson)")
+			fs.StringVar(&o.mode, "mode", "", "existing documents: overwrite, skip or fail (default overwrite)")
+		},
+		run: runImport,
+	},
+	"watch": {
+		usage:       "watch <channel> <document>",
+		description: "Print a document each time it changes",
+		minArgs:     2, maxArgs: 2,
+		flags: func(fs *flag.FlagSet, o *options) {
+			fs.DurationVar(&o.interval, "interval", 2*time.Second, "time between checks")
+			fs.BoolVar(&o.raw, "raw", false, "print the document as stored instead of pretty-printed")
+		},
+		run: runWatch,
+	},
+}
+
+// IsCommand reports whether name is a client subcommand
+func IsCommand(name string) bool {
+	_, ok := commands[name]
+	return ok
+}
+
+// Usage writes the list of client subcommands to w
+func Usage(w io.Writer) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, name := range names {
+		_, _ = fmt.Fprintf(tw, "  justdoc %s\t%s\n", commands[name].usage, commands[name].description)
+	}
+	_ = tw.Flush()
+	_, _ = fmt.Fprintln(w, "\nCommon flags: --url (default $JUSTDOC_URL or http://localhost:8080), --api-key (default $JUSTDOC_API_KEY), --offline (use the configured storage directly), --ca-cert, --client-cert and --client-key (for TLS servers)")
+}
+
+// Run executes a client subcommand and returns the process exit code:
+// 0 on success, 1 on failure and 2 on invalid usage
+func Run(ctx context.Context, name string, args []string, env Env) int {
+	cmd, ok := commands[name]
+	if !ok {
+		_, _ = fmt.Fprintf(env.Stderr, "Unknown command %q\n", name)
+		return 2
+	}
+
+	o := &options{}
+	fs := flag.NewFlagSet("justdoc "+name, flag.ContinueOnError)
+	fs.SetOutput(env.Stderr)
+	fs.Usage = func() {
+		_, _ = fmt.Fprintf(env.Stderr, "Usage: justdoc %s [flags]\n\n%s\n\nFlags:\n", cmd.usage, cmd.description)
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&o.url, "url", envOr("JUSTDOC_URL", "http://localhost:8080"), "server `URL`")
+	fs.StringVar(&o.apiKey, "api-key", os.Getenv("JUSTDOC_API_KEY"), "API `key` sent as a bearer token")
+	fs.BoolVar(&o.offline, "offline", false, "operate on the configured local storage; the server must be stopped")
+	fs.StringVar(&o.caCert, "ca-cert", os.Getenv("JUSTDOC_CA_CERT"), "CA certificate `file` to trust for https URLs")
+	fs.StringVar(&o.clientCert, "client-cert", os.Getenv("JUSTDOC_CLIENT_CERT"), "client certificate `file` for mutual TLS")
+	fs.StringVar(&o.clientKey, "client-key", os.Getenv("JUSTDOC_CLIENT_KEY"), "client key `file` for mutual TLS")
+	if cmd.flags != nil {
+		cmd.flags(fs, o)
+	}
+
+	positional, err := parseInterspersed(fs, args)
+	if err == flag.ErrHelp {
+		return 0
+	}
+	if err != nil {
+		return 2
+	}
+	if len(positional) < cmd.minArgs || len(positional) > cmd.maxArgs {
+		fs.Usage()
+		return 2
+	}
+
+	var clientOpts []ClientOption
+	if o.caCert != "" || o.clientCert != "" || o.clientKey != "" {
+		tc, err := o.tlsConfig()
+		if err != nil {
+			_, _ = fmt.Fprintf(env.Stderr, "Error: %v\n", err)
+			return 2
+		}
+		clientOpts = append(clientOpts, WithTLSConfig(tc))
+	}
+	client := NewClient(o.url, o.apiKey, clientOpts...)
+	if o.offline {
+		store, err := env.OpenStorage()
+		if err != nil {
+			_, _ = fmt.Fprintf(env.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		defer func() { _ = store.Close() }()
+		client = NewHandlerClient(api.NewRouter(api.NewHandler(store)))
+	}
+
+	if err := cmd.run(ctx, client, positional, o, env); err != nil {
+		_, _ = fmt.Fprintf(env.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// tlsConfig builds the client TLS configuration from the certificate flags
+func (o *options) tlsConfig() (*tls.Config, error) {
+	tc := &tls.Config{MinVersion: tls.VersionTLS12}
+	if o.caCert != "" {
+		pool, err := certs.LoadCertPool(o.caCert)
+		if err != nil {
+			return nil, err
+		}
+		tc.RootCAs = pool
+	}
+	if (o.clientCert == "") != (o.clientKey == "") {
+		return nil, errors.New("--client-cert and --client-key must be given together")
+	}
+	if o.clientCert != "" {
+		cert, err := tls.LoadX509KeyPair(o.clientCert, o.clientKey)
+		if err != nil {
+			return nil, err
+		}
+		tc.Certificates = []tls.Certificate{cert}
+	}
+	return tc, nil
+}
+
+// parseInterspersed parses flags that may appear before, between or after
+// positional arguments, and returns the positional arguments
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func envOr(name, fallback string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// input returns the named file, or stdin if no file is given
+func input(args []string, index int, env Env) (io.ReadCloser, error) {
+	if len(args) <= index || args[index] == "-" {
+		return io.NopCloser(env.Stdin), nil
+	}
+	return os.Open(args[index])
+}
+
+// writeJSON writes data followed by a newline, indented unless raw is set
+func writeJSON(w io.Writer, data []byte, raw bool) error {
+	if !raw {
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, data, "", "  "); err == nil {
+			data = buf.Bytes()
+		}
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func runGet(_ context.Context, c *Client, args []string, o *options, env Env) error {
+	data, _, _, err := c.GetDocument(args[0], args[1], "")
+	if err != nil {
+		return err
+	}
+	return writeJSON(env.Stdout, data, o.raw)
+}
+
+func runPut(_ context.Context, c *Client, args []string, _ *options, env Env) error {
+	in, err := input(args, 2, env)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+
+	resp, err := c.PutDocument(args[0], args[1], in)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(env.Stdout, "%s %s/%s\n", resp.Status, resp.Channel, resp.Document)
+	return err
+}
+
+func runPatch(_ context.Context, c *Client, args []string, _ *options, env Env) error {
+	in, err := input(args, 2, env)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+
+	resp, err := c.PatchDocument(args[0], args[1], in)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(env.Stdout, "%s %s/%s\n", resp.Status, resp.Channel, resp.Document)
+	return err
+}
+
+func runDelete(_ context.Context, c *Client, args []string, _ *options, env Env) error {
+	resp, err := c.DeleteDocument(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(env.Stdout, "%s %s/%s\n", resp.Status, resp.Channel, resp.Document)
+	return err
+}
+
+func runList(_ context.Context, c *Client, args []string, _ *options, env Env) error {
+	if len(args) == 1 {
+		docs, err := c.ListDocuments(args[0])
+		if err != nil {
+			return err
+		}
+		for _, name := range docs {
+			if _, err := fmt.Fprintln(env.Stdout, name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	channels, err := c.ListChannels()
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(env.Stdout, 0, 4, 2, ' ', 0)
+	for _, ch := range channels {
+		_, _ = fmt.Fprintf(tw, "%s\t%d\n", ch.Name, ch.DocumentCount)
+	}
+	return tw.Flush()
+}
+
+func runExport(_ context.Context, c *Client, args []string, o *options, env Env) error {
+	if o.format != "ndjson" && o.format != "tar" {
+		return fmt.Errorf("unknown format %q (want ndjson or tar)", o.format)
+	}
+	if o.output == "" {
+		return c.Export(args[0], o.format, env.Stdout)
+	}
+
+	f, err := os.Create(o.output)
+	if err != nil {
+		return err
+	}
+	if err := c.Export(args[0], o.format, f); err != nil {
+		_ = f.Close()
+		_ = os.Remove(o.output)
+		return err
+	}
+	return f.Close()
+}
+
+func runImport(_ context.Context, c *Client, args []string, o *options, env Env) error {
+	format := o.format
+	if format == "" {
+		format = "ndjson"
+		if len(args) == 2 && (strings.HasSuffix(args[1], ".tar.gz") || strings.HasSuffix(args[1], ".tgz")) {
+			format = "tar"
+		}
+	}
+	if format != "ndjson" && format != "tar" {
+		return fmt.Errorf("unknown format %q (want ndjson or tar)", format)
+	}
+
+	in, err := input(args, 1, env)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+
+	resp, err := c.Import(args[0], format, o.mode, in)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(env.Stdout, "%s %s: %d created, %d updated, %d skipped\n",
+		resp.Status, resp.Channel, resp.Created, resp.Updated, resp.Skipped)
+	return err
+}
+
+// runWatch polls a document with If-None-Match and prints every new
+// version until ctx is cancelled. A missing document is waited for.
+func runWatch(ctx context.Context, c *Client, args []string, o *options, env Env) error {
+	if o.interval <= 0 {
+		return fmt.Errorf("interval must be positive")
+	}
+	ticker := time.NewTicker(o.interval)
+	defer ticker.Stop()
+
+	tag := ""
+	missing := false
+	for {
+		data, newTag, modified, err := c.GetDocument(args[0], args[1], tag)
+		var apiErr *APIError
+		switch {
+		case errors.As(err, &apiErr) && apiErr.StatusCode == 404:
+			if !missing {
+				_, _ = fmt.Fprintf(env.Stderr, "Waiting for %s/%s to be created\n", args[0], args[1])
+				missing = true
+			}
+			tag = ""
+		case err != nil:
+			return err
+		case modified:
+			missing = false
+			tag = newTag
+			if err := writeJSON(env.Stdout, data, o.raw); err != nil {
+				return err
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rashpile/pako-justdoc/internal/api"
+	"github.com/rashpile/pako-justdoc/internal/storage"
+)
+
+// runCommand runs a client command against url and returns its exit code and output
+func runCommand(t *testing.T, url, stdin string, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	env := Env{
+		Stdin:  strings.NewReader(stdin),
+		Stdout: &stdout,
+		Stderr: &stderr,
+		OpenStorage: func() (storage.Storage, error) {
+			t.Fatal("unexpected offline access")
+			return nil, nil
+		},
+	}
+	code := Run(context.Background(), args[0], append(args[1:], "--url", url), env)
+	return code, stdout.String(), stderr.String()
+}
+
+func setupServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	store := storage.NewMemoryStorage()
+	server := httptest.NewServer(api.NewRouter(api.NewHandler(store)))
+	t.Cleanup(func() {
+		server.Close()
+		_ = store.Close()
+	})
+	return server
+}
+
+func TestRun_DocumentCommands(t *testing.T) {
+	server := setupServer(t)
+
+	code, out, _ := runCommand(t, server.URL, `{"theme": "dark", "lang": "en"}`, "put", "myapp", "settings")
+	if code != 0 || out != "created myapp/settings\n" {
+		t.Fatalf("put: code %d, output %q", code, out)
+	}
+
+	code, out, _ = runCommand(t, server.URL, "", "get", "myapp", "settings")
+	if code != 0 || out != "{\n  \"theme\": \"dark\",\n  \"lang\": \"en\"\n}\n" {
+		t.Errorf("get: code %d, output %q", code, out)
+	}
+	code, out, _ = runCommand(t, server.URL, "", "get", "--raw", "myapp", "settings")
+	if code != 0 || out != `{"theme": "dark", "lang": "en"}`+"\n" {
+		t.Errorf("get --raw: code %d, output %q", code, out)
+	}
+
+	code, out, _ = runCommand(t, server.URL, `{"lang": null}`, "patch", "myapp", "settings")
+	if code != 0 || out != "updated myapp/settings\n" {
+		t.Errorf("patch: code %d, output %q", code, out)
+	}
+	_, out, _ = runCommand(t, server.URL, "", "get", "myapp", "settings", "--raw")
+	if out != `{"theme":"dark"}`+"\n" {
+		t.Errorf("Expected patched document, got %q", out)
+	}
+
+	code, out, _ = runCommand(t, server.URL, "", "ls")
+	if code != 0 || !strings.HasPrefix(out, "myapp") || !strings.Contains(out, "1") {
+		t.Errorf("ls: code %d, output %q", code, out)
+	}
+	code, out, _ = runCommand(t, server.URL, "", "ls", "myapp")
+	if code != 0 || out != "settings\n" {
+		t.Errorf("ls myapp: code %d, output %q", code, out)
+	}
+
+	code, out, _ = runCommand(t, server.URL, "", "delete", "myapp", "settings")
+	if code != 0 || out != "deleted myapp/settings\n" {
+		t.Errorf("delete: code %d, output %q", code, out)
+	}
+	code, _, errOut := runCommand(t, server.URL, "", "get", "myapp", "settings")
+	if code != 1 || !strings.Contains(errOut, "Document not found (not_found)") {
+		t.Errorf("get missing: code %d, stderr %q", code, errOut)
+	}
+}
+
+func TestRun_PutFromFile(t *testing.T) {
+	server := setupServer(t)
+
+	path := filepath.Join(t.TempDir(), "doc.json")
+	if err := os.WriteFile(path, []byte(`{"a": 1}`), 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if code, out, _ := runCommand(t, server.URL, "", "put", "myapp", "doc", path); code != 0 || out != "created myapp/doc\n" {
+		t.Errorf("put file: code %d, output %q", code, out)
+	}
+
+	code, _, errOut := runCommand(t, server.URL, `{not json`, "put", "myapp", "doc")
+	if code != 1 || !strings.Contains(errOut, "invalid_json") {
+		t.Errorf("put invalid: code %d, stderr %q", code, errOut)
+	}
+}
+
+func TestRun_ExportImport(t *testing.T) {
+	source := setupServer(t)
+	target := setupServer(t)
+
+	runCommand(t, source.URL, `{"a": 1}`, "put", "myapp", "one")
+	runCommand(t, source.URL, `{"b": 2}`, "put", "myapp", "two")
+
+	for _, format := range []string{"ndjson", "tar"} {
+		path := filepath.Join(t.TempDir(), "export."+format)
+		if format == "tar" {
+			path = filepath.Join(t.TempDir(), "export.tar.gz")
+		}
+		if code, _, errOut := runCommand(t, source.URL, "", "export", "myapp", "--format", format, "-o", path); code != 0 {
+			t.Fatalf("export %s: code %d, stderr %q", format, code, errOut)
+		}
+		code, out, errOut := runCommand(t, target.URL, "", "import", "copy-"+format, path)
+		if code != 0 || !strings.Contains(out, "2 created") {
+			t.Errorf("import %s: code %d, output %q, stderr %q", format, code, out, errOut)
+		}
+	}
+
+	// Piped through stdin
+	_, exported, _ := runCommand(t, source.URL, "", "export", "myapp")
+	code, out, _ := runCommand(t, target.URL, exported, "import", "copy-ndjson", "--mode", "skip")
+	if code != 0 || !strings.Contains(out, "2 skipped") {
+		t.Errorf("import stdin: code %d, output %q", code, out)
+	}
+}
+
+func TestRun_Watch(t *testing.T) {
+	server := setupServer(t)
+	runCommand(t, server.URL, `{"v": 1}`, "put", "myapp", "settings")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stdout := &syncBuffer{}
+	done := make(chan int)
+	go func() {
+		env := Env{Stdin: strings.NewReader(""), Stdout: stdout, Stderr: &syncBuffer{}}
+		done <- Run(ctx, "watch", []string{"myapp", "settings", "--raw", "--interval", "10ms", "--url", server.URL}, env)
+	}()
+
+	waitFor(t, func() bool { return strings.Count(stdout.String(), "\n") >= 1 })
+	runCommand(t, server.URL, `{"v": 2}`, "put", "myapp", "settings")
+	waitFor(t, func() bool { return strings.Count(stdout.String(), "\n") >= 2 })
+	cancel()
+
+	if code := <-done; code != 0 {
+		t.Errorf("watch exited with %d", code)
+	}
+	if out := stdout.String(); out != "{\"v\": 1}\n{\"v\": 2}\n" {
+		t.Errorf("Expected each version once, got %q", out)
+	}
+}
+
+func TestRun_Offline(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	run := func(stdin string, args ...string) (int, string) {
+		var stdout, stderr bytes.Buffer
+		env := Env{
+			Stdin:  strings.NewReader(stdin),
+			Stdout: &stdout,
+			Stderr: &stderr,
+			OpenStorage: func() (storage.Storage, error) {
+				return storage.NewBoltStorage(path)
+			},
+		}
+		// The URL points nowhere, so any network access would fail
+		code := Run(context.Background(), args[0], append(args[1:], "--offline", "--url", "http://127.0.0.1:1"), env)
+		return code, stdout.String()
+	}
+
+	if code, out := run(`{"a": 1}`, "put", "myapp", "doc"); code != 0 || out != "created myapp/doc\n" {
+		t.Fatalf("offline put: code %d, output %q", code, out)
+	}
+	if code, out := run("", "get", "--raw", "myapp", "doc"); code != 0 || out != `{"a": 1}`+"\n" {
+		t.Errorf("offline get: code %d, output %q", code, out)
+	}
+}
+
+func TestRun_Usage(t *testing.T) {
+	server := setupServer(t)
+
+	if code, _, _ := runCommand(t, server.URL, "", "get", "myapp"); code != 2 {
+		t.Errorf("Expected exit code 2 for missing argument, got %d", code)
+	}
+	if code, _, _ := runCommand(t, server.URL, "", "ls", "--bogus"); code != 2 {
+		t.Errorf("Expected exit code 2 for unknown flag, got %d", code)
+	}
+	if code, _, _ := runCommand(t, server.URL, "", "get", "--help"); code != 0 {
+		t.Errorf("Expected exit code 0 for --help, got %d", code)
+	}
+}
+
+func TestRun_APIKey(t *testing.T) {
+	var got string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("Authorization")
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+
+	if code, _, _ := runCommand(t, server.URL, "", "ls", "--api-key", "secret"); code != 0 {
+		t.Fatalf("ls failed with %d", code)
+	}
+	if got != "Bearer secret" {
+		t.Errorf("Expected bearer token, got %q", got)
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent use
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for condition")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
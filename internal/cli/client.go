@@ -0,0 +1,224 @@
+package cli
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	"github.com/rashpile/pako-justdoc/internal/model"
+	"github.com/rashpile/pako-justdoc/internal/storage"
+)
+
+// Client sends API requests to a JustDoc server
+type Client struct {
+	baseURL string
+	apiKey  string
+	http    *http.Client
+}
+
+// ClientOption configures a Client
+type ClientOption func(*Client)
+
+// WithTLSConfig sets the TLS configuration used for https URLs, e.g. to
+// trust a private CA or present a client certificate
+func WithTLSConfig(tc *tls.Config) ClientOption {
+	return func(c *Client) {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tc
+		c.http = &http.Client{Transport: transport}
+	}
+}
+
+// NewClient creates a client for the server at baseURL
+// apiKey is sent as a bearer token if not empty.
+func NewClient(baseURL, apiKey string, opts ...ClientOption) *Client {
+	c := &Client{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		apiKey:  apiKey,
+		http:    http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// NewHandlerClient creates a client that serves requests in-process with h
+// instead of over the network. Responses are buffered in memory.
+func NewHandlerClient(h http.Handler) *Client {
+	return &Client{
+		baseURL: "http://justdoc.local",
+		http:    &http.Client{Transport: handlerTransport{h}},
+	}
+}
+
+// handlerTransport is an http.RoundTripper that calls a handler directly
+type handlerTransport struct {
+	h http.Handler
+}
+
+func (t handlerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	w := httptest.NewRecorder()
+	t.h.ServeHTTP(w, req)
+	return w.Result(), nil
+}
+
+// APIError is an error response returned by the server
+type APIError struct {
+	StatusCode int
+	model.ErrorResponse
+}
+
+func (e *APIError) Error() string {
+	var b strings.Builder
+	if e.Message != "" {
+		fmt.Fprintf(&b, "%s (%s)", e.Message, e.ErrorResponse.Error)
+	} else {
+		fmt.Fprintf(&b, "server returned %d", e.StatusCode)
+	}
+	for _, v := range e.Violations {
+		fmt.Fprintf(&b, "\n  %s: %s", v.Location, v.Message)
+	}
+	return b.String()
+}
+
+// do sends a request and returns the response if it succeeded, or an
+// *APIError for 4xx and 5xx responses. The caller closes the body.
+func (c *Client) do(method, path string, query url.Values, body io.Reader, header http.Header) (*http.Response, error) {
+	target := c.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		defer func() { _ = resp.Body.Close() }()
+		apiErr := &APIError{StatusCode: resp.StatusCode}
+		data, _ := io.ReadAll(resp.Body)
+		_ = json.Unmarshal(data, &apiErr.ErrorResponse)
+		return nil, apiErr
+	}
+	return resp, nil
+}
+
+// doJSON sends a request and decodes the JSON response into v
+func (c *Client) doJSON(method, path string, body io.Reader, header http.Header, v any) error {
+	resp, err := c.do(method, path, nil, body, header)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func documentPath(channel, document string) string {
+	return "/" + url.PathEscape(channel) + "/" + url.PathEscape(document)
+}
+
+// GetDocument retrieves a document and its ETag. If ifNoneMatch is set and
+// still matches, it returns modified=false and no data.
+func (c *Client) GetDocument(channel, document, ifNoneMatch string) (data []byte, tag string, modified bool, err error) {
+	header := http.Header{}
+	if ifNoneMatch != "" {
+		header.Set("If-None-Match", ifNoneMatch)
+	}
+	resp, err := c.do(http.MethodGet, documentPath(channel, document), nil, nil, header)
+	if err != nil {
+		return nil, "", false, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	tag = resp.Header.Get("ETag")
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, tag, false, nil
+	}
+	data, err = io.ReadAll(resp.Body)
+	return data, tag, true, err
+}
+
+// PutDocument stores a document
+func (c *Client) PutDocument(channel, document string, body io.Reader) (model.SuccessResponse, error) {
+	var resp model.SuccessResponse
+	header := http.Header{"Content-Type": {"application/json"}}
+	err := c.doJSON(http.MethodPost, documentPath(channel, document), body, header, &resp)
+	return resp, err
+}
+
+// PatchDocument applies a JSON merge patch to a document
+func (c *Client) PatchDocument(channel, document string, patch io.Reader) (model.SuccessResponse, error) {
+	var resp model.SuccessResponse
+	header := http.Header{"Content-Type": {"application/merge-patch+json"}}
+	err := c.doJSON(http.MethodPatch, documentPath(channel, document), patch, header, &resp)
+	return resp, err
+}
+
+// DeleteDocument removes a document
+func (c *Client) DeleteDocument(channel, document string) (model.SuccessResponse, error) {
+	var resp model.SuccessResponse
+	err := c.doJSON(http.MethodDelete, documentPath(channel, document), nil, nil, &resp)
+	return resp, err
+}
+
+// ListChannels returns all channels with their document counts
+func (c *Client) ListChannels() ([]storage.ChannelInfo, error) {
+	var channels []storage.ChannelInfo
+	err := c.doJSON(http.MethodGet, "/", nil, nil, &channels)
+	return channels, err
+}
+
+// ListDocuments returns the document names in a channel
+func (c *Client) ListDocuments(channel string) ([]string, error) {
+	var docs []string
+	err := c.doJSON(http.MethodGet, "/"+url.PathEscape(channel)+"/", nil, nil, &docs)
+	return docs, err
+}
+
+// Export streams a channel export in format ("ndjson" or "tar") to w
+func (c *Client) Export(channel, format string, w io.Writer) error {
+	resp, err := c.do(http.MethodGet, "/"+url.PathEscape(channel)+"/_export", url.Values{"format": {format}}, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// Import uploads an export in format ("ndjson" or "tar") into a channel
+func (c *Client) Import(channel, format, mode string, body io.Reader) (model.ImportResponse, error) {
+	contentType := "application/x-ndjson"
+	if format == "tar" {
+		contentType = "application/gzip"
+	}
+	var query url.Values
+	if mode != "" {
+		query = url.Values{"mode": {mode}}
+	}
+	resp, err := c.do(http.MethodPost, "/"+url.PathEscape(channel)+"/_import", query, body, http.Header{"Content-Type": {contentType}})
+	if err != nil {
+		return model.ImportResponse{}, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var result model.ImportResponse
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	return result, err
+}
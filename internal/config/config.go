@@ -0,0 +1,489 @@
+// Package config loads the server configuration. Settings are merged from
+// built-in defaults, an optional YAML file, environment variables and
+// command-line flags, each overriding the previous.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/rashpile/pako-justdoc/internal/model"
+)
+
+// Config is the effective server configuration
+type Config struct {
+	// Listen is the TCP address the server listens on, e.g. ":8080"
+	Listen string `yaml:"listen"`
+	// MaxBodySize limits request bodies and imported documents
+	MaxBodySize ByteSize `yaml:"max_body_size"`
+	// MaxAttachmentSize limits binary attachments of documents
+	MaxAttachmentSize ByteSize `yaml:"max_attachment_size"`
+	// NormalizeChannels names the channels, or * for all, whose documents
+	// are stored as canonical JSON by default; see PUT /{channel}/_settings
+	NormalizeChannels []string `yaml:"normalize_channels"`
+	// HTTP2 enables HTTP/2 over TLS; H2C enables it without TLS
+	HTTP2    bool     `yaml:"http2"`
+	H2C      bool     `yaml:"h2c"`
+	TLS      TLS      `yaml:"tls"`
+	Timeouts Timeouts `yaml:"timeouts"`
+	Auth     Auth     `yaml:"auth"`
+	CORS     CORS     `yaml:"cors"`
+	Storage  Storage  `yaml:"storage"`
+	Backup   Backup   `yaml:"backup"`
+}
+
+// TLS configures HTTPS. It is enabled by a certificate or self-signed mode.
+type TLS struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// SelfSigned generates a certificate at CertFile and KeyFile on first
+	// start, for development
+	SelfSigned bool `yaml:"self_signed"`
+	// ClientCAFile enables mutual TLS with client certificates issued by
+	// these CAs
+	ClientCAFile string `yaml:"client_ca_file"`
+	// ClientAuth is "require" or "optional"
+	ClientAuth string `yaml:"client_auth"`
+}
+
+// Self-signed certificate files used when no paths are configured
+const (
+	SelfSignedCertFile = "justdoc-cert.pem"
+	SelfSignedKeyFile  = "justdoc-key.pem"
+)
+
+// Enabled reports whether the server uses TLS
+func (t TLS) Enabled() bool {
+	return t.CertFile != "" || t.KeyFile != "" || t.SelfSigned
+}
+
+// Files returns the certificate and key paths, with the self-signed
+// defaults filled in
+func (t TLS) Files() (certFile, keyFile string) {
+	certFile, keyFile = t.CertFile, t.KeyFile
+	if t.SelfSigned && certFile == "" && keyFile == "" {
+		certFile, keyFile = SelfSignedCertFile, SelfSignedKeyFile
+	}
+	return certFile, keyFile
+}
+
+// Timeouts are the HTTP server timeouts; zero means no timeout
+type Timeouts struct {
+	ReadHeader Duration `yaml:"read_header"`
+	Read       Duration `yaml:"read"`
+	Write      Duration `yaml:"write"`
+	Idle       Duration `yaml:"idle"`
+	// Shutdown is how long in-flight requests may take after SIGTERM
+	Shutdown Duration `yaml:"shutdown"`
+}
+
+// Auth configures authentication. It is disabled without API keys and
+// client principals.
+type Auth struct {
+	APIKeys []string `yaml:"api_keys"`
+	// ClientPrincipals maps client certificate identities (subject common
+	// name, DNS, email or URI names) to principal names. A request with a
+	// verified certificate for a mapped identity needs no API key.
+	ClientPrincipals map[string]string `yaml:"client_principals"`
+	// ShareSecret signs share links. Without it a random secret is
+	// generated at startup, so links stop working on restart.
+	ShareSecret string `yaml:"share_secret"`
+	// ShareMaxAge is the longest lifetime a share link may be given
+	ShareMaxAge Duration `yaml:"share_max_age"`
+}
+
+// CORS configures cross-origin requests. It is disabled without origins.
+type CORS struct {
+	// Origins may include "*", which allows any origin but never with
+	// credentials
+	Origins []string `yaml:"origins"`
+	Methods []string `yaml:"methods"`
+	Headers []string `yaml:"headers"`
+	MaxAge  Duration `yaml:"max_age"`
+}
+
+// Storage selects and configures the storage backend
+type Storage struct {
+	// Backend is bolt, sqlite, file or memory
+	Backend           string `yaml:"backend"`
+	Path              string `yaml:"path"`
+	SQLitePath        string `yaml:"sqlite_path"`
+	DataDir           string `yaml:"data_dir"`
+	MemorySnapshot    string `yaml:"memory_snapshot"`
+	CompressMinSize   int    `yaml:"compress_min_size"`
+	EncryptionKeys    string `yaml:"encryption_keys"`
+	EncryptionKeyFile string `yaml:"encryption_key_file"`
+}
+
+// Backup configures scheduled snapshots. It is disabled without a directory.
+type Backup struct {
+	Dir      string   `yaml:"dir"`
+	Interval Duration `yaml:"interval"`
+	// Keep is the number of snapshots to retain; 0 keeps all
+	Keep int `yaml:"keep"`
+}
+
+// Default returns the configuration used when nothing else is set
+func Default() *Config {
+	return &Config{
+		Listen:            ":8080",
+		MaxBodySize:       10 << 20,
+		MaxAttachmentSize: 1 << 20,
+		HTTP2:             true,
+		TLS: TLS{
+			ClientAuth: "require",
+		},
+		Timeouts: Timeouts{
+			ReadHeader: Duration(10 * time.Second),
+			Idle:       Duration(2 * time.Minute),
+			Shutdown:   Duration(10 * time.Second),
+		},
+		Auth: Auth{
+			ShareMaxAge: Duration(30 * 24 * time.Hour),
+		},
+		CORS: CORS{
+			Methods: []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+			Headers: []string{"Authorization", "Content-Type", "If-Match", "If-None-Match", "X-API-Key"},
+			MaxAge:  Duration(10 * time.Minute),
+		},
+		Storage: Storage{
+			Backend:    "bolt",
+			Path:       "justdoc.db",
+			SQLitePath: "justdoc.sqlite",
+			DataDir:    "data",
+		},
+		Backup: Backup{
+			Interval: Duration(24 * time.Hour),
+			Keep:     7,
+		},
+	}
+}
+
+// Load builds the configuration from defaults, the file named by --config
+// or JUSTDOC_CONFIG, the environment and the flags in args, and returns it
+// with the remaining positional arguments. Flag errors and help go to
+// output. The result is not validated.
+func Load(args []string, getenv func(string) string, output io.Writer) (*Config, []string, error) {
+	// The first pass only finds --config and reports flag errors
+	var path string
+	fs := newFlagSet(Default(), &path)
+	fs.SetOutput(output)
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+	if path == "" {
+		path = getenv("JUSTDOC_CONFIG")
+	}
+
+	cfg := Default()
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := cfg.loadEnv(getenv); err != nil {
+		return nil, nil, err
+	}
+
+	fs = newFlagSet(cfg, &path)
+	fs.SetOutput(io.Discard)
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+	return cfg, fs.Args(), nil
+}
+
+// Usage writes the server flags to w
+func Usage(w io.Writer) {
+	var path string
+	fs := newFlagSet(Default(), &path)
+	fs.SetOutput(w)
+	fs.PrintDefaults()
+}
+
+func newFlagSet(cfg *Config, path *string) *flag.FlagSet {
+	fs := flag.NewFlagSet("justdoc", flag.ContinueOnError)
+	fs.StringVar(path, "config", "", "YAML configuration `file` (default $JUSTDOC_CONFIG)")
+	fs.StringVar(&cfg.Listen, "listen", cfg.Listen, "listen `address`")
+	fs.Var(&cfg.MaxBodySize, "max-body-size", "maximum request body `size`, e.g. 10MB")
+	fs.Var(&cfg.MaxAttachmentSize, "max-attachment-size", "maximum attachment `size`, e.g. 1MB")
+	fs.Var(newListFlag(&cfg.NormalizeChannels), "normalize-channel", "store documents of this `channel`, or * for all, as canonical JSON (repeatable)")
+	fs.BoolVar(&cfg.HTTP2, "http2", cfg.HTTP2, "enable HTTP/2 over TLS")
+	fs.BoolVar(&cfg.H2C, "h2c", cfg.H2C, "enable HTTP/2 without TLS")
+	fs.StringVar(&cfg.TLS.CertFile, "tls-cert", cfg.TLS.CertFile, "TLS certificate `file` (PEM)")
+	fs.StringVar(&cfg.TLS.KeyFile, "tls-key", cfg.TLS.KeyFile, "TLS private key `file` (PEM)")
+	fs.BoolVar(&cfg.TLS.SelfSigned, "tls-self-signed", cfg.TLS.SelfSigned, "generate a self-signed certificate on first start")
+	fs.StringVar(&cfg.TLS.ClientCAFile, "tls-client-ca", cfg.TLS.ClientCAFile, "CA `file` for client certificates (enables mutual TLS)")
+	fs.StringVar(&cfg.TLS.ClientAuth, "tls-client-auth", cfg.TLS.ClientAuth, "client certificates: `require` or optional")
+	fs.Var(&cfg.Timeouts.ReadHeader, "read-header-timeout", "time to read request headers")
+	fs.Var(&cfg.Timeouts.Read, "read-timeout", "time to read a whole request (0 for none)")
+	fs.Var(&cfg.Timeouts.Write, "write-timeout", "time to write a response (0 for none)")
+	fs.Var(&cfg.Timeouts.Idle, "idle-timeout", "time to keep idle connections open")
+	fs.Var(&cfg.Timeouts.Shutdown, "shutdown-timeout", "time to finish requests on shutdown")
+	fs.Var(newListFlag(&cfg.Auth.APIKeys), "api-key", "accepted API `key` (repeatable)")
+	fs.Var(&cfg.Auth.ShareMaxAge, "share-max-age", "longest lifetime of share links")
+	fs.Var(newListFlag(&cfg.CORS.Origins), "cors-origin", "allowed CORS `origin`, or * (repeatable)")
+	fs.StringVar(&cfg.Storage.Backend, "storage", cfg.Storage.Backend, "storage `backend`: bolt, sqlite, file or memory")
+	fs.StringVar(&cfg.Storage.Path, "db-path", cfg.Storage.Path, "bolt database `file`")
+	fs.StringVar(&cfg.Storage.SQLitePath, "sqlite-path", cfg.Storage.SQLitePath, "SQLite database `file`")
+	fs.StringVar(&cfg.Storage.DataDir, "data-dir", cfg.Storage.DataDir, "root `directory` of the file backend")
+	fs.StringVar(&cfg.Storage.MemorySnapshot, "memory-snapshot", cfg.Storage.MemorySnapshot, "database `file` written on shutdown by the memory backend")
+	fs.IntVar(&cfg.Storage.CompressMinSize, "compress-min-size", cfg.Storage.CompressMinSize, "gzip documents of at least this many `bytes` (0 disables)")
+	fs.StringVar(&cfg.Storage.EncryptionKeyFile, "encryption-key-file", cfg.Storage.EncryptionKeyFile, "`file` with encryption keys")
+	fs.StringVar(&cfg.Backup.Dir, "backup-dir", cfg.Backup.Dir, "`directory` for scheduled snapshots")
+	fs.Var(&cfg.Backup.Interval, "backup-interval", "time between scheduled snapshots")
+	fs.IntVar(&cfg.Backup.Keep, "backup-keep", cfg.Backup.Keep, "number of snapshots to keep (0 keeps all)")
+	return fs
+}
+
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && err != io.EOF {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// loadEnv applies the environment variables that are set
+func (c *Config) loadEnv(getenv func(string) string) error {
+	if v := getenv("PORT"); v != "" {
+		c.Listen = ":" + v
+	}
+	texts := map[string]*string{
+		"LISTEN":              &c.Listen,
+		"STORAGE":             &c.Storage.Backend,
+		"DB_PATH":             &c.Storage.Path,
+		"SQLITE_PATH":         &c.Storage.SQLitePath,
+		"DATA_DIR":            &c.Storage.DataDir,
+		"MEMORY_SNAPSHOT":     &c.Storage.MemorySnapshot,
+		"ENCRYPTION_KEYS":     &c.Storage.EncryptionKeys,
+		"ENCRYPTION_KEY_FILE": &c.Storage.EncryptionKeyFile,
+		"BACKUP_DIR":          &c.Backup.Dir,
+		"TLS_CERT_FILE":       &c.TLS.CertFile,
+		"TLS_KEY_FILE":        &c.TLS.KeyFile,
+		"TLS_CLIENT_CA_FILE":  &c.TLS.ClientCAFile,
+		"TLS_CLIENT_AUTH":     &c.TLS.ClientAuth,
+		"SHARE_SECRET":        &c.Auth.ShareSecret,
+	}
+	for name, p := range texts {
+		if v := getenv(name); v != "" {
+			*p = v
+		}
+	}
+
+	lists := map[string]*[]string{
+		"API_KEYS":           &c.Auth.APIKeys,
+		"CORS_ORIGINS":       &c.CORS.Origins,
+		"NORMALIZE_CHANNELS": &c.NormalizeChannels,
+	}
+	for name, p := range lists {
+		if v := getenv(name); v != "" {
+			*p = splitList(v)
+		}
+	}
+
+	bools := map[string]*bool{
+		"HTTP2":           &c.HTTP2,
+		"H2C":             &c.H2C,
+		"TLS_SELF_SIGNED": &c.TLS.SelfSigned,
+	}
+	for name, p := range bools {
+		if v := getenv(name); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return fmt.Errorf("%s must be true or false, got %q", name, v)
+			}
+			*p = b
+		}
+	}
+
+	ints := map[string]*int{
+		"COMPRESS_MIN_SIZE": &c.Storage.CompressMinSize,
+		"BACKUP_KEEP":       &c.Backup.Keep,
+	}
+	for name, p := range ints {
+		if v := getenv(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return fmt.Errorf("%s must be a number, got %q", name, v)
+			}
+			*p = n
+		}
+	}
+
+	values := map[string]flag.Value{
+		"MAX_BODY_SIZE":       &c.MaxBodySize,
+		"MAX_ATTACHMENT_SIZE": &c.MaxAttachmentSize,
+		"READ_HEADER_TIMEOUT": &c.Timeouts.ReadHeader,
+		"READ_TIMEOUT":        &c.Timeouts.Read,
+		"WRITE_TIMEOUT":       &c.Timeouts.Write,
+		"IDLE_TIMEOUT":        &c.Timeouts.Idle,
+		"SHUTDOWN_TIMEOUT":    &c.Timeouts.Shutdown,
+		"BACKUP_INTERVAL":     &c.Backup.Interval,
+		"SHARE_MAX_AGE":       &c.Auth.ShareMaxAge,
+	}
+	for name, p := range values {
+		if v := getenv(name); v != "" {
+			if err := p.Set(v); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Validate reports all invalid settings
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Listen != "", "listen address must not be empty")
+	check(c.MaxBodySize > 0, "max_body_size must be positive")
+	check(c.MaxAttachmentSize > 0, "max_attachment_size must be positive")
+	for _, channel := range c.NormalizeChannels {
+		check(channel == "*" || model.IsValidName(channel), "normalize_channels: %q is not a valid channel name", channel)
+	}
+	t := c.Timeouts
+	check(t.ReadHeader >= 0 && t.Read >= 0 && t.Write >= 0 && t.Idle >= 0 && t.Shutdown >= 0,
+		"timeouts must not be negative")
+
+	tc := c.TLS
+	check((tc.CertFile == "") == (tc.KeyFile == ""), "tls.cert_file and tls.key_file must be set together")
+	check(tc.ClientCAFile == "" || tc.Enabled(), "tls.client_ca_file requires a TLS certificate")
+	check(tc.ClientAuth == "require" || tc.ClientAuth == "optional",
+		"tls.client_auth %q must be require or optional", tc.ClientAuth)
+	check(len(c.Auth.ClientPrincipals) == 0 || tc.ClientCAFile != "",
+		"auth.client_principals requires tls.client_ca_file")
+	for identity, principal := range c.Auth.ClientPrincipals {
+		check(identity != "" && principal != "", "auth.client_principals must map non-empty names")
+	}
+
+	for _, key := range c.Auth.APIKeys {
+		check(strings.TrimSpace(key) != "", "auth.api_keys must not contain empty keys")
+	}
+	check(c.Auth.ShareSecret == "" || len(c.Auth.ShareSecret) >= 16,
+		"auth.share_secret must be at least 16 characters")
+	check(c.Auth.ShareMaxAge > 0, "auth.share_max_age must be positive")
+	for _, origin := range c.CORS.Origins {
+		if origin == "*" {
+			continue
+		}
+		u, err := url.Parse(origin)
+		check(err == nil && u.Scheme != "" && u.Host != "" && u.Path == "",
+			"cors.origins: %q must be * or scheme://host[:port]", origin)
+	}
+	check(c.CORS.MaxAge >= 0, "cors.max_age must not be negative")
+
+	s := c.Storage
+	switch s.Backend {
+	case "bolt":
+		check(s.Path != "", "storage.path must not be empty")
+	case "sqlite":
+		check(s.SQLitePath != "", "storage.sqlite_path must not be empty")
+	case "file":
+		check(s.DataDir != "", "storage.data_dir must not be empty")
+	case "memory":
+	default:
+		errs = append(errs, fmt.Errorf("storage.backend %q must be bolt, sqlite, file or memory", s.Backend))
+	}
+	check(s.CompressMinSize >= 0, "storage.compress_min_size must not be negative")
+	check(s.EncryptionKeys == "" || s.EncryptionKeyFile == "",
+		"set only one of storage.encryption_keys and storage.encryption_key_file")
+	check(s.Backend == "bolt" || s.CompressMinSize == 0, "storage.compress_min_size requires the bolt backend")
+	check(s.Backend == "bolt" || (s.EncryptionKeys == "" && s.EncryptionKeyFile == ""),
+		"encryption requires the bolt backend")
+
+	check(c.Backup.Interval > 0, "backup.interval must be positive")
+	check(c.Backup.Keep >= 0, "backup.keep must not be negative")
+	check(c.Backup.Dir == "" || s.Backend == "bolt" || s.Backend == "memory",
+		"backup.dir requires the bolt or memory backend")
+
+	return errors.Join(errs...)
+}
+
+// Redacted returns a copy with API keys, the share secret and encryption
+// keys hidden, for printing
+func (c *Config) Redacted() *Config {
+	r := *c
+	if len(c.Auth.APIKeys) > 0 {
+		r.Auth.APIKeys = make([]string, len(c.Auth.APIKeys))
+		for i := range r.Auth.APIKeys {
+			r.Auth.APIKeys[i] = redacted
+		}
+	}
+	if r.Auth.ShareSecret != "" {
+		r.Auth.ShareSecret = redacted
+	}
+	if r.Storage.EncryptionKeys != "" {
+		r.Storage.EncryptionKeys = redacted
+	}
+	return &r
+}
+
+const redacted = "<redacted>"
+
+// Print writes the configuration as YAML, with secrets redacted
+func (c *Config) Print(w io.Writer) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(c.Redacted()); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// listFlag is a repeatable flag. The first use replaces the values from
+// the file and environment instead of appending to them.
+type listFlag struct {
+	values *[]string
+	set    bool
+}
+
+func newListFlag(values *[]string) *listFlag {
+	return &listFlag{values: values}
+}
+
+func (f *listFlag) String() string {
+	if f == nil || f.values == nil {
+		return ""
+	}
+	return strings.Join(*f.values, ",")
+}
+
+func (f *listFlag) Set(v string) error {
+	if !f.set {
+		*f.values = nil
+		f.set = true
+	}
+	*f.values = append(*f.values, splitList(v)...)
+	return nil
+}
@@ -0,0 +1,285 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func env(vars map[string]string) func(string) string {
+	return func(name string) string { return vars[name] }
+}
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "justdoc.yaml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	return path
+}
+
+func TestLoad_Defaults(t *testing.T) {
+	cfg, rest, err := Load(nil, env(nil), io.Discard)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(rest) != 0 {
+		t.Errorf("expected no arguments, got %v", rest)
+	}
+	if !reflect.DeepEqual(cfg, Default()) {
+		t.Errorf("expected defaults, got %+v", cfg)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("defaults are invalid: %v", err)
+	}
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	path := writeConfig(t, `
+listen: ":9000"
+max_body_size: 2MB
+timeouts:
+  write: 30s
+auth:
+  api_keys: [file-key]
+storage:
+  backend: sqlite
+  sqlite_path: /var/lib/justdoc.sqlite
+backup:
+  keep: 3
+`)
+	getenv := env(map[string]string{
+		"JUSTDOC_CONFIG":      path,
+		"PORT":                "9100",
+		"API_KEYS":            "env-a, env-b",
+		"BACKUP_KEEP":         "5",
+		"NORMALIZE_CHANNELS":  "myapp, other",
+		"MAX_ATTACHMENT_SIZE": "512KB",
+	})
+	cfg, rest, err := Load([]string{"--backup-keep", "9", "--api-key", "flag-key", "extra"}, getenv, io.Discard)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if cfg.Listen != ":9100" {
+		t.Errorf("env should override file listen, got %q", cfg.Listen)
+	}
+	if cfg.MaxBodySize != 2<<20 {
+		t.Errorf("expected max body size from file, got %d", cfg.MaxBodySize)
+	}
+	if cfg.MaxAttachmentSize != 512<<10 {
+		t.Errorf("expected max attachment size from env, got %d", cfg.MaxAttachmentSize)
+	}
+	if cfg.Timeouts.Write != Duration(30*time.Second) || cfg.Timeouts.Idle != Default().Timeouts.Idle {
+		t.Errorf("unexpected timeouts %+v", cfg.Timeouts)
+	}
+	if cfg.Storage.Backend != "sqlite" || cfg.Storage.SQLitePath != "/var/lib/justdoc.sqlite" || cfg.Storage.Path != "justdoc.db" {
+		t.Errorf("unexpected storage %+v", cfg.Storage)
+	}
+	if cfg.Backup.Keep != 9 {
+		t.Errorf("flag should override env keep, got %d", cfg.Backup.Keep)
+	}
+	if !reflect.DeepEqual(cfg.Auth.APIKeys, []string{"flag-key"}) {
+		t.Errorf("flag should replace the keys, got %v", cfg.Auth.APIKeys)
+	}
+	if !reflect.DeepEqual(cfg.NormalizeChannels, []string{"myapp", "other"}) {
+		t.Errorf("expected normalized channels from env, got %v", cfg.NormalizeChannels)
+	}
+	if !reflect.DeepEqual(rest, []string{"extra"}) {
+		t.Errorf("unexpected remaining arguments %v", rest)
+	}
+}
+
+func TestLoad_ConfigFlag(t *testing.T) {
+	path := writeConfig(t, "listen: 127.0.0.1:7000\n")
+	cfg, _, err := Load([]string{"--config", path}, env(nil), io.Discard)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Listen != "127.0.0.1:7000" {
+		t.Errorf("expected listen from file, got %q", cfg.Listen)
+	}
+}
+
+func TestLoad_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   []string
+		env    map[string]string
+		config string
+		want   string
+	}{
+		{name: "unknown file field", config: "listen: :80\nlisten_port: 80\n", want: "listen_port"},
+		{name: "bad file size", config: "max_body_size: ten\n", want: "invalid size"},
+		{name: "bad env duration", env: map[string]string{"IDLE_TIMEOUT": "soon"}, want: "IDLE_TIMEOUT"},
+		{name: "bad env number", env: map[string]string{"BACKUP_KEEP": "all"}, want: "BACKUP_KEEP"},
+		{name: "unknown flag", args: []string{"--nope"}, want: "not defined"},
+		{name: "missing file", args: []string{"--config", "/nonexistent.yaml"}, want: "nonexistent"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vars := tt.env
+			if tt.config != "" {
+				vars = map[string]string{"JUSTDOC_CONFIG": writeConfig(t, tt.config)}
+			}
+			_, _, err := Load(tt.args, env(vars), io.Discard)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestLoad_Help(t *testing.T) {
+	var out bytes.Buffer
+	_, _, err := Load([]string{"-h"}, env(nil), &out)
+	if err != flag.ErrHelp {
+		t.Fatalf("expected flag.ErrHelp, got %v", err)
+	}
+	if !strings.Contains(out.String(), "-max-body-size") {
+		t.Errorf("expected flag list, got %q", out.String())
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cfg := Default()
+	cfg.Listen = ""
+	cfg.MaxBodySize = 0
+	cfg.MaxAttachmentSize = -1
+	cfg.CORS.Origins = []string{"*", "https://ok.example.com", "example.com"}
+	cfg.Storage.Backend = "file"
+	cfg.Storage.EncryptionKeys = "k:abc"
+	cfg.Backup.Dir = "backups"
+	cfg.Auth.ShareSecret = "short"
+	cfg.NormalizeChannels = []string{"*", "myapp", "my app"}
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+	for _, want := range []string{
+		"listen address",
+		"max_body_size",
+		"max_attachment_size",
+		`"example.com"`,
+		"encryption requires the bolt backend",
+		"backup.dir requires",
+		"auth.share_secret",
+		`normalize_channels: "my app"`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error about %q in:\n%v", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), "ok.example.com") {
+		t.Errorf("valid origin reported:\n%v", err)
+	}
+}
+
+func TestValidate_TLS(t *testing.T) {
+	tests := []struct {
+		name string
+		tls  TLS
+		auth Auth
+		want string
+	}{
+		{name: "cert without key", tls: TLS{CertFile: "c.pem", ClientAuth: "require"}, want: "set together"},
+		{name: "client CA without TLS", tls: TLS{ClientCAFile: "ca.pem", ClientAuth: "require"}, want: "requires a TLS certificate"},
+		{name: "bad client auth", tls: TLS{SelfSigned: true, ClientAuth: "maybe"}, want: "must be require or optional"},
+		{name: "principals without CA", tls: TLS{SelfSigned: true, ClientAuth: "require"}, auth: Auth{ClientPrincipals: map[string]string{"cn": "p"}}, want: "client_principals requires"},
+		{name: "valid mutual TLS", tls: TLS{CertFile: "c.pem", KeyFile: "k.pem", ClientCAFile: "ca.pem", ClientAuth: "optional"}, auth: Auth{ClientPrincipals: map[string]string{"cn": "p"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.TLS = tt.tls
+			cfg.Auth.ClientPrincipals = tt.auth.ClientPrincipals
+			err := cfg.Validate()
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestTLS_Files(t *testing.T) {
+	cert, key := TLS{SelfSigned: true}.Files()
+	if cert != SelfSignedCertFile || key != SelfSignedKeyFile {
+		t.Errorf("expected default self-signed files, got %q, %q", cert, key)
+	}
+	cert, key = TLS{SelfSigned: true, CertFile: "a.pem", KeyFile: "b.pem"}.Files()
+	if cert != "a.pem" || key != "b.pem" {
+		t.Errorf("expected configured files, got %q, %q", cert, key)
+	}
+}
+
+func TestPrint_RedactsSecrets(t *testing.T) {
+	cfg := Default()
+	cfg.Auth.APIKeys = []string{"secret-1", "secret-2"}
+	cfg.Auth.ShareSecret = "share-secret-0123456789"
+	cfg.Storage.EncryptionKeys = "k1:c2VjcmV0"
+
+	var out bytes.Buffer
+	if err := cfg.Print(&out); err != nil {
+		t.Fatalf("Print failed: %v", err)
+	}
+	if strings.Contains(out.String(), "secret-") || strings.Contains(out.String(), "c2VjcmV0") {
+		t.Errorf("secrets printed:\n%s", out.String())
+	}
+	if len(cfg.Auth.APIKeys) != 2 || cfg.Auth.APIKeys[0] != "secret-1" {
+		t.Error("Print modified the configuration")
+	}
+
+	// The output is a valid configuration file
+	path := writeConfig(t, out.String())
+	loaded, _, err := Load([]string{"--config", path}, env(nil), io.Discard)
+	if err != nil {
+		t.Fatalf("failed to load printed config: %v\n%s", err, out.String())
+	}
+	if loaded.MaxBodySize != cfg.MaxBodySize || loaded.Timeouts != cfg.Timeouts {
+		t.Errorf("printed config differs:\n%s", out.String())
+	}
+}
+
+func TestByteSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want ByteSize
+		ok   bool
+	}{
+		{"512", 512, true},
+		{"10MB", 10 << 20, true},
+		{"64kb", 64 << 10, true},
+		{"1 GB", 1 << 30, true},
+		{"100B", 100, true},
+		{"-1", 0, false},
+		{"1.5MB", 0, false},
+		{"MB", 0, false},
+	}
+	for _, tt := range tests {
+		var b ByteSize
+		err := b.Set(tt.in)
+		if (err == nil) != tt.ok || b != tt.want {
+			t.Errorf("Set(%q) = %d, %v", tt.in, b, err)
+		}
+	}
+	if s := ByteSize(10 << 20).String(); s != "10MB" {
+		t.Errorf("expected 10MB, got %q", s)
+	}
+	if s := ByteSize(1500).String(); s != "1500B" {
+		t.Errorf("expected 1500B, got %q", s)
+	}
+}
@@ -0,0 +1,88 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Duration is a time.Duration written as a string such as "10s"
+type Duration time.Duration
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// Set parses a duration; it implements flag.Value
+func (d *Duration) Set(s string) error {
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q", s)
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// MarshalYAML writes the duration as a string
+func (d Duration) MarshalYAML() (any, error) {
+	return d.String(), nil
+}
+
+// UnmarshalYAML reads a duration string such as "1m30s"
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	return d.Set(node.Value)
+}
+
+// ByteSize is a size in bytes written as a number or with a KB, MB or GB
+// suffix (powers of 1024)
+type ByteSize int64
+
+var sizeUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"B", 1},
+}
+
+func (b ByteSize) String() string {
+	for _, u := range sizeUnits {
+		if b != 0 && int64(b)%u.size == 0 {
+			return strconv.FormatInt(int64(b)/u.size, 10) + u.suffix
+		}
+	}
+	return "0"
+}
+
+// Set parses a size such as "10MB" or "512"; it implements flag.Value
+func (b *ByteSize) Set(s string) error {
+	v := strings.ToUpper(strings.TrimSpace(s))
+	multiplier := int64(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(v, u.suffix) {
+			v, multiplier = strings.TrimSpace(strings.TrimSuffix(v, u.suffix)), u.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 || n > (1<<62)/multiplier {
+		return fmt.Errorf("invalid size %q", s)
+	}
+	*b = ByteSize(n * multiplier)
+	return nil
+}
+
+// MarshalYAML writes the size with the largest exact suffix
+func (b ByteSize) MarshalYAML() (any, error) {
+	return b.String(), nil
+}
+
+// UnmarshalYAML reads a size number or string
+func (b *ByteSize) UnmarshalYAML(node *yaml.Node) error {
+	return b.Set(node.Value)
+}
@@ -0,0 +1,106 @@
+package format
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// errTruncated is returned for binary documents that end too early
+var errTruncated = errors.New("unexpected end of data")
+
+// reader reads the binary formats, checking every length against the
+// remaining data before allocating
+type reader struct {
+	data []byte
+	pos  int
+}
+
+func (r *reader) remaining() int {
+	return len(r.data) - r.pos
+}
+
+func (r *reader) byte() (byte, error) {
+	if r.remaining() < 1 {
+		return 0, errTruncated
+	}
+	r.pos++
+	return r.data[r.pos-1], nil
+}
+
+func (r *reader) bytes(n uint64) ([]byte, error) {
+	if n > uint64(r.remaining()) {
+		return nil, errTruncated
+	}
+	b := r.data[r.pos : r.pos+int(n)]
+	r.pos += int(n)
+	return b, nil
+}
+
+// uint reads a big-endian unsigned integer of size bytes
+func (r *reader) uint(size int) (uint64, error) {
+	b, err := r.bytes(uint64(size))
+	if err != nil {
+		return 0, err
+	}
+	switch size {
+	case 1:
+		return uint64(b[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(b)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(b)), nil
+	}
+	return binary.BigEndian.Uint64(b), nil
+}
+
+// count checks that n items of at least min bytes each can follow
+func (r *reader) count(n uint64, min int) (int, error) {
+	if n > uint64(r.remaining()/min) {
+		return 0, errTruncated
+	}
+	return int(n), nil
+}
+
+// end reports data left after the document
+func (r *reader) end() error {
+	if r.remaining() > 0 {
+		return fmt.Errorf("%d unexpected bytes after the document", r.remaining())
+	}
+	return nil
+}
+
+// floatNumber converts a decoded float to a JSON number, formatted as the
+// shortest decimal that round-trips at the given precision
+func floatNumber(f float64, bits int) (json.Number, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return "", fmt.Errorf("number %v can't be represented in JSON", f)
+	}
+	var b []byte
+	if bits == 32 {
+		b, _ = json.Marshal(float32(f))
+	} else {
+		b, _ = json.Marshal(f)
+	}
+	return json.Number(b), nil
+}
+
+// integer reports whether a JSON number is written as an integer
+func integer(n json.Number) bool {
+	for _, c := range []byte(n) {
+		if c == '.' || c == 'e' || c == 'E' {
+			return false
+		}
+	}
+	return true
+}
+
+// float returns a JSON number as a double; numbers beyond its range
+// become infinities
+func float(n json.Number) float64 {
+	f, _ := strconv.ParseFloat(string(n), 64)
+	return f
+}
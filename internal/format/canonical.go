@@ -0,0 +1,162 @@
+package format
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// Canonicalize returns the RFC 8785 canonical form of a JSON document:
+// object keys sorted, no insignificant whitespace, and numbers written the
+// way ECMAScript does. Numbers are IEEE 754 doubles in that form, so
+// integers beyond 2^53 lose precision. Duplicate keys are rejected.
+func Canonicalize(data []byte) ([]byte, error) {
+	v, err := parseJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	return canonical(v)
+}
+
+func canonical(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeCanonical(&buf, v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeCanonical(buf *bytes.Buffer, v any) error {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case string:
+		writeCanonicalString(buf, v)
+	case json.Number:
+		f, err := strconv.ParseFloat(string(v), 64)
+		if err != nil {
+			return fmt.Errorf("number %s is out of range", v)
+		}
+		s, err := formatNumber(f)
+		if err != nil {
+			return err
+		}
+		buf.WriteString(s)
+	case []any:
+		buf.WriteByte('[')
+		for i, item := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeCanonical(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case object:
+		// Keys sort by their UTF-16 code units
+		keys := make([][]uint16, len(v))
+		order := make([]int, len(v))
+		for i, m := range v {
+			keys[i] = utf16.Encode([]rune(m.key))
+			order[i] = i
+		}
+		slices.SortFunc(order, func(a, b int) int { return slices.Compare(keys[a], keys[b]) })
+		buf.WriteByte('{')
+		for i, idx := range order {
+			if i > 0 {
+				if slices.Equal(keys[order[i-1]], keys[idx]) {
+					return fmt.Errorf("duplicate key %q", v[idx].key)
+				}
+				buf.WriteByte(',')
+			}
+			writeCanonicalString(buf, v[idx].key)
+			buf.WriteByte(':')
+			if err := writeCanonical(buf, v[idx].value); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	default:
+		return fmt.Errorf("unsupported value %T", v)
+	}
+	return nil
+}
+
+// writeCanonicalString escapes only quotes, backslashes and control
+// characters, using the short escapes where JSON has them
+func writeCanonicalString(buf *bytes.Buffer, s string) {
+	const hex = "0123456789abcdef"
+	buf.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case '"', '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			if c < 0x20 {
+				buf.WriteString(`\u00`)
+				buf.WriteByte(hex[c>>4])
+				buf.WriteByte(hex[c&0xf])
+			} else {
+				buf.WriteByte(c)
+			}
+		}
+	}
+	buf.WriteByte('"')
+}
+
+// formatNumber writes a double like ECMAScript's Number.prototype.toString
+func formatNumber(f float64) (string, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return "", fmt.Errorf("number %v can't be represented in JSON", f)
+	}
+	if f == 0 {
+		return "0", nil
+	}
+	sign := ""
+	if f < 0 {
+		sign = "-"
+		f = -f
+	}
+	// Shortest digits that round-trip, and the position of the decimal point
+	mantissa, exp, _ := strings.Cut(strconv.FormatFloat(f, 'e', -1, 64), "e")
+	digits := strings.Replace(mantissa, ".", "", 1)
+	e, _ := strconv.Atoi(exp)
+	k, n := len(digits), e+1
+
+	switch {
+	case k <= n && n <= 21:
+		return sign + digits + strings.Repeat("0", n-k), nil
+	case 0 < n && n <= 21:
+		return sign + digits[:n] + "." + digits[n:], nil
+	case -6 < n && n <= 0:
+		return sign + "0." + strings.Repeat("0", -n) + digits, nil
+	}
+	s := sign + digits[:1]
+	if k > 1 {
+		s += "." + digits[1:]
+	}
+	if n-1 > 0 {
+		return s + "e+" + strconv.Itoa(n-1), nil
+	}
+	return s + "e-" + strconv.Itoa(1-n), nil
+}
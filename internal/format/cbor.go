@@ -0,0 +1,331 @@
+package format
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"unicode/utf8"
+)
+
+// CBOR major types
+const (
+	cborUint   = 0
+	cborNegInt = 1
+	cborBytes  = 2
+	cborText   = 3
+	cborArray  = 4
+	cborMap    = 5
+	cborTag    = 6
+	cborSimple = 7
+)
+
+// CBOR bignum tags, simple values and the indefinite-length markers
+const (
+	cborTagBignum    = 2
+	cborTagNegBignum = 3
+
+	cborFalse     = 20
+	cborTrue      = 21
+	cborNull      = 22
+	cborUndefined = 23
+
+	cborIndefinite = 31
+	cborBreak      = 0xff
+)
+
+func encodeCBOR(v any) []byte {
+	var b []byte
+	return appendCBOR(b, v)
+}
+
+func appendCBOR(b []byte, v any) []byte {
+	switch v := v.(type) {
+	case nil:
+		return append(b, cborSimple<<5|cborNull)
+	case bool:
+		if v {
+			return append(b, cborSimple<<5|cborTrue)
+		}
+		return append(b, cborSimple<<5|cborFalse)
+	case json.Number:
+		if integer(v) {
+			return appendCBORInt(b, v)
+		}
+		f := float(v)
+		if float64(float32(f)) == f {
+			return binary.BigEndian.AppendUint32(append(b, cborSimple<<5|26), math.Float32bits(float32(f)))
+		}
+		return binary.BigEndian.AppendUint64(append(b, cborSimple<<5|27), math.Float64bits(f))
+	case string:
+		return append(appendCBORHead(b, cborText, uint64(len(v))), v...)
+	case []any:
+		b = appendCBORHead(b, cborArray, uint64(len(v)))
+		for _, item := range v {
+			b = appendCBOR(b, item)
+		}
+		return b
+	case object:
+		b = appendCBORHead(b, cborMap, uint64(len(v)))
+		for _, m := range v {
+			b = appendCBOR(b, m.key)
+			b = appendCBOR(b, m.value)
+		}
+		return b
+	}
+	panic(fmt.Sprintf("format: unexpected value %T", v))
+}
+
+// appendCBORInt writes an integer exactly, as a bignum if it doesn't fit
+// in 64 bits
+func appendCBORInt(b []byte, n json.Number) []byte {
+	if u, err := strconv.ParseUint(string(n), 10, 64); err == nil {
+		return appendCBORHead(b, cborUint, u)
+	}
+	i, _ := new(big.Int).SetString(string(n), 10)
+	major, tag := byte(cborUint), uint64(cborTagBignum)
+	if i.Sign() < 0 {
+		// Negative integers are stored as -1 - n
+		i.Neg(i).Sub(i, big.NewInt(1))
+		major, tag = cborNegInt, cborTagNegBignum
+	}
+	if i.IsUint64() {
+		return appendCBORHead(b, major, i.Uint64())
+	}
+	mag := i.Bytes()
+	b = appendCBORHead(b, cborTag, tag)
+	return append(appendCBORHead(b, cborBytes, uint64(len(mag))), mag...)
+}
+
+// appendCBORHead writes a major type with its argument in the shortest form
+func appendCBORHead(b []byte, major byte, n uint64) []byte {
+	m := major << 5
+	switch {
+	case n < 24:
+		return append(b, m|byte(n))
+	case n <= math.MaxUint8:
+		return append(b, m|24, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, m|25), uint16(n))
+	case n <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, m|26), uint32(n))
+	}
+	return binary.BigEndian.AppendUint64(append(b, m|27), n)
+}
+
+// decodeCBOR decodes a CBOR document. Byte strings become base64 strings,
+// undefined becomes null, and tags other than bignums are ignored; map
+// keys must be text strings or integers.
+func decodeCBOR(data []byte) (any, error) {
+	r := &reader{data: data}
+	v, err := cborValue(r, 0)
+	if err != nil {
+		return nil, err
+	}
+	return v, r.end()
+}
+
+// cborHead reads the major type and argument of a data item. Indefinite
+// lengths are reported with indefinite set.
+func cborHead(r *reader) (major byte, arg uint64, indefinite bool, err error) {
+	ib, err := r.byte()
+	if err != nil {
+		return 0, 0, false, err
+	}
+	major, info := ib>>5, ib&0x1f
+	switch {
+	case info < 24:
+		return major, uint64(info), false, nil
+	case info <= 27:
+		arg, err = r.uint(1 << (info - 24))
+		return major, arg, false, err
+	case info == cborIndefinite && major != cborUint && major != cborNegInt && major != cborTag:
+		return major, 0, true, nil
+	}
+	return 0, 0, false, fmt.Errorf("invalid CBOR initial byte 0x%02x", ib)
+}
+
+func cborValue(r *reader, depth int) (any, error) {
+	if depth > maxDepth {
+		return nil, depthError()
+	}
+	start := r.pos
+	major, arg, indefinite, err := cborHead(r)
+	if err != nil {
+		return nil, err
+	}
+	switch major {
+	case cborUint:
+		return json.Number(strconv.FormatUint(arg, 10)), nil
+	case cborNegInt:
+		n := new(big.Int).SetUint64(arg)
+		return json.Number(n.Neg(n).Sub(n, big.NewInt(1)).String()), nil
+	case cborBytes, cborText:
+		b, err := cborString(r, major, arg, indefinite)
+		if err != nil {
+			return nil, err
+		}
+		if major == cborBytes {
+			return base64.StdEncoding.EncodeToString(b), nil
+		}
+		if !utf8.Valid(b) {
+			return nil, errors.New("text string is not valid UTF-8")
+		}
+		return string(b), nil
+	case cborArray:
+		return cborArrayValue(r, arg, indefinite, depth)
+	case cborMap:
+		return cborMapValue(r, arg, indefinite, depth)
+	case cborTag:
+		if arg != cborTagBignum && arg != cborTagNegBignum {
+			return cborValue(r, depth+1)
+		}
+		m, size, indefinite, err := cborHead(r)
+		if err != nil {
+			return nil, err
+		}
+		if m != cborBytes {
+			return nil, errors.New("bignum content must be a byte string")
+		}
+		b, err := cborString(r, m, size, indefinite)
+		if err != nil {
+			return nil, err
+		}
+		n := new(big.Int).SetBytes(b)
+		if arg == cborTagNegBignum {
+			n.Neg(n).Sub(n, big.NewInt(1))
+		}
+		return json.Number(n.String()), nil
+	}
+
+	// Major type 7: simple values and floats
+	info := r.data[start] & 0x1f
+	switch {
+	case info == 25:
+		return floatNumber(halfToFloat(uint16(arg)), 32)
+	case info == 26:
+		return floatNumber(float64(math.Float32frombits(uint32(arg))), 32)
+	case info == 27:
+		return floatNumber(math.Float64frombits(arg), 64)
+	case arg == cborFalse:
+		return false, nil
+	case arg == cborTrue:
+		return true, nil
+	case arg == cborNull, arg == cborUndefined:
+		return nil, nil
+	case indefinite:
+		return nil, errors.New("unexpected CBOR break")
+	}
+	return nil, fmt.Errorf("unsupported CBOR simple value %d", arg)
+}
+
+// cborString reads a byte or text string, joining the chunks of an
+// indefinite-length one
+func cborString(r *reader, major byte, n uint64, indefinite bool) ([]byte, error) {
+	if !indefinite {
+		return r.bytes(n)
+	}
+	var b []byte
+	for !atBreak(r) {
+		m, n, indefinite, err := cborHead(r)
+		if err != nil {
+			return nil, err
+		}
+		if m != major || indefinite {
+			return nil, errors.New("invalid chunk in indefinite-length string")
+		}
+		chunk, err := r.bytes(n)
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, chunk...)
+	}
+	return b, nil
+}
+
+// atBreak consumes the break ending an indefinite-length item
+func atBreak(r *reader) bool {
+	if r.remaining() > 0 && r.data[r.pos] == cborBreak {
+		r.pos++
+		return true
+	}
+	return false
+}
+
+func cborArrayValue(r *reader, n uint64, indefinite bool, depth int) (any, error) {
+	count := 0
+	if !indefinite {
+		var err error
+		if count, err = r.count(n, 1); err != nil {
+			return nil, err
+		}
+	}
+	arr := make([]any, 0, count)
+	for i := 0; indefinite || i < count; i++ {
+		if indefinite && atBreak(r) {
+			break
+		}
+		v, err := cborValue(r, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		arr = append(arr, v)
+	}
+	return arr, nil
+}
+
+func cborMapValue(r *reader, n uint64, indefinite bool, depth int) (any, error) {
+	count := 0
+	if !indefinite {
+		var err error
+		if count, err = r.count(n, 2); err != nil {
+			return nil, err
+		}
+	}
+	obj := make(object, 0, count)
+	for i := 0; indefinite || i < count; i++ {
+		if indefinite && atBreak(r) {
+			break
+		}
+		k, err := cborValue(r, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := mapKey(k)
+		if !ok {
+			return nil, fmt.Errorf("map keys must be text strings or integers, got %v", k)
+		}
+		v, err := cborValue(r, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		obj = append(obj, member{key, v})
+	}
+	return obj, nil
+}
+
+// halfToFloat converts an IEEE 754 half-precision float
+func halfToFloat(h uint16) float64 {
+	exp, mant := int(h>>10&0x1f), float64(h&0x3ff)
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 0x1f:
+		if mant == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		f = -f
+	}
+	return f
+}
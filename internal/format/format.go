@@ -0,0 +1,155 @@
+// Package format converts documents between JSON and the other formats
+// the API accepts: YAML, MessagePack and CBOR. Documents in those formats
+// are stored as canonical JSON (RFC 8785).
+package format
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Media types of the supported formats
+const (
+	JSON    = "application/json"
+	YAML    = "application/yaml"
+	MsgPack = "application/msgpack"
+	CBOR    = "application/cbor"
+)
+
+// aliases maps other names in use for the formats to their media type
+var aliases = map[string]string{
+	"application/x-yaml":        YAML,
+	"text/yaml":                 YAML,
+	"text/x-yaml":               YAML,
+	"application/x-msgpack":     MsgPack,
+	"application/vnd.msgpack":   MsgPack,
+	"application/x-messagepack": MsgPack,
+}
+
+// maxDepth bounds the nesting of decoded documents, like encoding/json
+const maxDepth = 10000
+
+// ErrUnsupported is returned for media types that aren't a supported format
+var ErrUnsupported = errors.New("unsupported format")
+
+// MediaType returns the media type of the format named by mediaType, which
+// may be an alias such as application/x-yaml, or "" if there is none. JSON
+// is not reported; callers handle it without conversion.
+func MediaType(mediaType string) string {
+	mediaType = strings.ToLower(mediaType)
+	switch mediaType {
+	case YAML, MsgPack, CBOR:
+		return mediaType
+	}
+	return aliases[mediaType]
+}
+
+// ToJSON decodes a document of the given format and returns it as
+// canonical JSON
+func ToJSON(mediaType string, data []byte) ([]byte, error) {
+	var v any
+	var err error
+	switch MediaType(mediaType) {
+	case YAML:
+		v, err = decodeYAML(data)
+	case MsgPack:
+		v, err = decodeMsgPack(data)
+	case CBOR:
+		v, err = decodeCBOR(data)
+	default:
+		return nil, ErrUnsupported
+	}
+	if err != nil {
+		return nil, err
+	}
+	return canonical(v)
+}
+
+// FromJSON encodes a JSON document in the given format. Object keys keep
+// their order.
+func FromJSON(mediaType string, data []byte) ([]byte, error) {
+	mediaType = MediaType(mediaType)
+	if mediaType == "" {
+		return nil, ErrUnsupported
+	}
+	v, err := parseJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	switch mediaType {
+	case YAML:
+		return encodeYAML(v)
+	case MsgPack:
+		return encodeMsgPack(v), nil
+	default:
+		return encodeCBOR(v), nil
+	}
+}
+
+// Decoded documents are trees of nil, bool, string, json.Number, []any
+// and object values. Objects keep their keys in document order.
+type object []member
+
+type member struct {
+	key   string
+	value any
+}
+
+// parseJSON decodes a JSON document into a tree
+func parseJSON(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	v, err := parseValue(dec)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("unexpected data after the document")
+	}
+	return v, nil
+}
+
+func parseValue(dec *json.Decoder) (any, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case json.Delim('{'):
+		obj := object{}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			v, err := parseValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			obj = append(obj, member{key.(string), v})
+		}
+		_, err := dec.Token()
+		return obj, err
+	case json.Delim('['):
+		arr := []any{}
+		for dec.More() {
+			v, err := parseValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+		_, err := dec.Token()
+		return arr, err
+	}
+	return tok, nil
+}
+
+// depthError reports a document nested deeper than maxDepth
+func depthError() error {
+	return fmt.Errorf("document nested deeper than %d levels", maxDepth)
+}
@@ -0,0 +1,343 @@
+package format
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestCanonicalize(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "whitespace", in: "{ \"a\" : [ 1 , 2 ] }\n", want: `{"a":[1,2]}`},
+		{name: "sorted keys", in: `{"b":1,"a":{"d":2,"c":3}}`, want: `{"a":{"c":3,"d":2},"b":1}`},
+		// U+20AC sorts before U+1F600 by UTF-16 code units, not code points
+		{name: "utf-16 order", in: `{"😀":1,"€":2,"\r":3,"1":4}`, want: `{"\r":3,"1":4,"€":2,"😀":1}`},
+		{name: "integers", in: `[0,-0,1.0,100,1e2,-7]`, want: `[0,0,1,100,100,-7]`},
+		{name: "fractions", in: `[4.50,0.002,0.000001,1e-7,333333333.33333329]`, want: `[4.5,0.002,0.000001,1e-7,333333333.3333333]`},
+		{name: "large", in: `[1e21,1e20,1e30,-1.5e300,9007199254740993]`, want: `[1e+21,100000000000000000000,1e+30,-1.5e+300,9007199254740992]`},
+		{name: "escapes", in: `"\u000f\n\"\\ <é\/"`, want: "\"\\u000f\\n\\\"\\\\ <é/\""},
+		{name: "literals", in: `[true,false,null,"",{},[]]`, want: `[true,false,null,"",{},[]]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Canonicalize([]byte(tt.in))
+			if err != nil {
+				t.Fatalf("Canonicalize failed: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCanonicalize_Errors(t *testing.T) {
+	for _, in := range []string{`{"a":1,"a":2}`, `1e400`, `{"a":}`, `[1] [2]`, ``} {
+		if _, err := Canonicalize([]byte(in)); err == nil {
+			t.Errorf("%q: expected an error", in)
+		}
+	}
+}
+
+// Examples from RFC 8949 Appendix A
+func TestDecodeCBOR(t *testing.T) {
+	tests := []struct {
+		hex  string
+		want string
+	}{
+		{"00", `0`},
+		{"1903e8", `1000`},
+		{"3903e7", `-1000`},
+		// Canonical JSON writes numbers as doubles
+		{"1bffffffffffffffff", `18446744073709552000`},
+		{"3bffffffffffffffff", `-18446744073709552000`},
+		{"c249010000000000000000", `18446744073709552000`},
+		{"c349010000000000000000", `-18446744073709552000`},
+		{"f93c00", `1`},
+		{"f97bff", `65504`},
+		{"f90001", `5.9604645e-8`},
+		{"fa47c35000", `100000`},
+		{"fb3ff199999999999a", `1.1`},
+		{"f4", `false`},
+		{"f5", `true`},
+		{"f6", `null`},
+		{"f7", `null`},
+		{"c074323031332d30332d32315432303a30343a30305a", `"2013-03-21T20:04:00Z"`},
+		{"4401020304", `"AQIDBA=="`},
+		{"5f42010243030405ff", `"AQIDBAU="`},
+		{"7f657374726561646d696e67ff", `"streaming"`},
+		{"62c3bc", `"ü"`},
+		{"83010203", `[1,2,3]`},
+		{"9f018202039f0405ffff", `[1,[2,3],[4,5]]`},
+		{"a201020304", `{"1":2,"3":4}`},
+		{"bf61610161629f0203ffff", `{"a":1,"b":[2,3]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.hex, func(t *testing.T) {
+			data, _ := hex.DecodeString(tt.hex)
+			got, err := ToJSON(CBOR, data)
+			if err != nil {
+				t.Fatalf("ToJSON failed: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestEncodeCBOR(t *testing.T) {
+	tests := []struct {
+		json string
+		want string
+	}{
+		{`0`, "00"},
+		{`1000000`, "1a000f4240"},
+		{`-1`, "20"},
+		{`-1000`, "3903e7"},
+		{`18446744073709551616`, "c249010000000000000000"},
+		{`-18446744073709551617`, "c349010000000000000000"},
+		{`1.5`, "fa3fc00000"},
+		{`1.1`, "fb3ff199999999999a"},
+		{`"IETF"`, "6449455446"},
+		{`{"a":[true,null]}`, "a1616182f5f6"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.json, func(t *testing.T) {
+			got, err := FromJSON(CBOR, []byte(tt.json))
+			if err != nil {
+				t.Fatalf("FromJSON failed: %v", err)
+			}
+			if hex.EncodeToString(got) != tt.want {
+				t.Errorf("expected %s, got %x", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMsgPack(t *testing.T) {
+	tests := []struct {
+		json string
+		hex  string
+	}{
+		{`0`, "00"},
+		{`-1`, "ff"},
+		{`-33`, "d0df"},
+		{`200`, "ccc8"},
+		{`70000`, "ce00011170"},
+		{`-70000`, "d2fffeee90"},
+		{`18446744073709551615`, "cfffffffffffffffff"},
+		{`-9223372036854775808`, "d38000000000000000"},
+		{`1.5`, "ca3fc00000"},
+		{`1.1`, "cb3ff199999999999a"},
+		{`"a"`, "a161"},
+		{`[true,false,null]`, "93c3c2c0"},
+		{`{"a":1,"b":[]}`, "82a16101a16290"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.json, func(t *testing.T) {
+			got, err := FromJSON(MsgPack, []byte(tt.json))
+			if err != nil {
+				t.Fatalf("FromJSON failed: %v", err)
+			}
+			if hex.EncodeToString(got) != tt.hex {
+				t.Errorf("expected %s, got %x", tt.hex, got)
+			}
+			back, err := ToJSON(MsgPack, got)
+			if err != nil {
+				t.Fatalf("ToJSON failed: %v", err)
+			}
+			want, _ := Canonicalize([]byte(tt.json))
+			if string(back) != string(want) {
+				t.Errorf("expected %s, got %s", want, back)
+			}
+		})
+	}
+}
+
+func TestDecodeMsgPack(t *testing.T) {
+	tests := []struct {
+		hex  string
+		want string
+	}{
+		// str8, bin8, array16 and map16 aren't produced by the encoder
+		{"d90161", `"a"`},
+		{"c4020102", `"AQI="`},
+		{"dc0001c0", `[null]`},
+		{"de000101c3", `{"1":true}`},
+		{"d6ff00000000", `"1970-01-01T00:00:00Z"`},
+		{"d7ff0000000400000001", `"1970-01-01T00:00:01.000000001Z"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.hex, func(t *testing.T) {
+			data, _ := hex.DecodeString(tt.hex)
+			got, err := ToJSON(MsgPack, data)
+			if err != nil {
+				t.Fatalf("ToJSON failed: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestBinary_Errors(t *testing.T) {
+	tests := []struct {
+		name       string
+		mediaType  string
+		hex        string
+		wantSubstr string
+	}{
+		{name: "msgpack truncated", mediaType: MsgPack, hex: "92c0", wantSubstr: "unexpected end"},
+		{name: "msgpack huge array", mediaType: MsgPack, hex: "ddffffffff", wantSubstr: "unexpected end"},
+		{name: "msgpack trailing", mediaType: MsgPack, hex: "c0c0", wantSubstr: "unexpected bytes"},
+		{name: "msgpack never used", mediaType: MsgPack, hex: "c1", wantSubstr: "invalid"},
+		{name: "msgpack bad utf-8", mediaType: MsgPack, hex: "a1ff", wantSubstr: "UTF-8"},
+		{name: "msgpack array key", mediaType: MsgPack, hex: "819001", wantSubstr: "map keys"},
+		{name: "msgpack nan", mediaType: MsgPack, hex: "cb7ff8000000000000", wantSubstr: "JSON"},
+		{name: "msgpack extension", mediaType: MsgPack, hex: "d40100", wantSubstr: "extension"},
+		{name: "cbor truncated", mediaType: CBOR, hex: "1a0000", wantSubstr: "unexpected end"},
+		{name: "cbor unterminated", mediaType: CBOR, hex: "9f01", wantSubstr: "unexpected end"},
+		{name: "cbor stray break", mediaType: CBOR, hex: "ff", wantSubstr: "break"},
+		{name: "cbor infinity", mediaType: CBOR, hex: "f97c00", wantSubstr: "JSON"},
+		{name: "cbor simple", mediaType: CBOR, hex: "f0", wantSubstr: "simple value"},
+		{name: "cbor reserved", mediaType: CBOR, hex: "1c", wantSubstr: "initial byte"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, _ := hex.DecodeString(tt.hex)
+			_, err := ToJSON(tt.mediaType, data)
+			if err == nil || !strings.Contains(err.Error(), tt.wantSubstr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantSubstr, err)
+			}
+		})
+	}
+
+	deep := strings.Repeat("\x91", maxDepth+1) + "\xc0"
+	if _, err := ToJSON(MsgPack, []byte(deep)); err == nil || !strings.Contains(err.Error(), "nested") {
+		t.Errorf("expected depth error, got %v", err)
+	}
+}
+
+func TestYAML(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want string
+	}{
+		{name: "mapping", yaml: "name: app\nport: 8080\nratio: 0.50\ndebug: yes\nenabled: true\nnothing: ~\n", want: `{"debug":"yes","enabled":true,"name":"app","nothing":null,"port":8080,"ratio":0.5}`},
+		{name: "yaml numbers", yaml: "[0x1F, 0o17, 1_000, +5, .5, 1., -.inf2]", want: `[31,15,1000,5,0.5,1,"-.inf2"]`},
+		{name: "big integer", yaml: "12345678901234567890", want: `12345678901234567000`},
+		{name: "timestamp", yaml: "at: 2001-12-14t21:59:43.10-05:00\n", want: `{"at":"2001-12-14t21:59:43.10-05:00"}`},
+		{name: "non-string keys", yaml: "1: one\ntrue: yes\n", want: `{"1":"one","true":"yes"}`},
+		{name: "anchors and merge", yaml: "base: &b {a: 1, b: 2}\nuse:\n  <<: *b\n  b: 3\n", want: `{"base":{"a":1,"b":2},"use":{"a":1,"b":3}}`},
+		{name: "document marker", yaml: "---\n[1, 2]\n", want: `[1,2]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ToJSON(YAML, []byte(tt.yaml))
+			if err != nil {
+				t.Fatalf("ToJSON failed: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestYAML_Errors(t *testing.T) {
+	bomb := "a: &a [x, x, x, x, x, x, x, x, x, x]\n"
+	for i, prev := 'b', 'a'; i <= 'j'; i, prev = i+1, i {
+		bomb += string(i) + ": &" + string(i) + " [" + strings.Repeat("*"+string(prev)+", ", 9) + "*" + string(prev) + "]\n"
+	}
+	tests := []struct {
+		name       string
+		yaml       string
+		wantSubstr string
+	}{
+		{name: "empty", yaml: "", wantSubstr: "empty"},
+		{name: "two documents", yaml: "a: 1\n---\nb: 2\n", wantSubstr: "more than one"},
+		{name: "syntax", yaml: "a: [1, 2\n", wantSubstr: "yaml"},
+		{name: "infinity", yaml: "x: .inf\n", wantSubstr: "JSON"},
+		{name: "complex key", yaml: "? [1, 2]\n: x\n", wantSubstr: "scalars"},
+		{name: "alias bomb", yaml: bomb, wantSubstr: "too many values"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ToJSON(YAML, []byte(tt.yaml))
+			if err == nil || !strings.Contains(err.Error(), tt.wantSubstr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantSubstr, err)
+			}
+		})
+	}
+}
+
+func TestFromJSON_YAML(t *testing.T) {
+	got, err := FromJSON(YAML, []byte(`{"name":"app","tags":["a","true"],"n":1.50,"big":18446744073709551616,"none":null,"nested":{"on":false}}`))
+	if err != nil {
+		t.Fatalf("FromJSON failed: %v", err)
+	}
+	want := `name: app
+tags:
+  - a
+  - "true"
+n: 1.50
+big: 18446744073709551616
+none: null
+nested:
+  on: false
+`
+	if string(got) != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	doc := `{"s":"héllo\n","i":-12,"u":18446744073709551615,"f":0.1,"e":1e-7,"b":[true,false,null],"o":{"z":{},"a":[]},"k":"1e3"}`
+	want, err := Canonicalize([]byte(doc))
+	if err != nil {
+		t.Fatalf("Canonicalize failed: %v", err)
+	}
+	for _, mediaType := range []string{YAML, MsgPack, CBOR} {
+		t.Run(mediaType, func(t *testing.T) {
+			encoded, err := FromJSON(mediaType, []byte(doc))
+			if err != nil {
+				t.Fatalf("FromJSON failed: %v", err)
+			}
+			got, err := ToJSON(mediaType, encoded)
+			if err != nil {
+				t.Fatalf("ToJSON failed: %v", err)
+			}
+			if string(got) != string(want) {
+				t.Errorf("expected %s, got %s", want, got)
+			}
+		})
+	}
+}
+
+func TestMediaType(t *testing.T) {
+	tests := map[string]string{
+		"application/yaml":      YAML,
+		"Application/X-YAML":    YAML,
+		"text/yaml":             YAML,
+		"application/msgpack":   MsgPack,
+		"application/x-msgpack": MsgPack,
+		"application/cbor":      CBOR,
+		"application/json":      "",
+		"text/plain":            "",
+	}
+	for in, want := range tests {
+		if got := MediaType(in); got != want {
+			t.Errorf("MediaType(%q) = %q, want %q", in, got, want)
+		}
+	}
+	if _, err := ToJSON("application/xml", []byte("<a/>")); err != ErrUnsupported {
+		t.Errorf("expected ErrUnsupported, got %v", err)
+	}
+}
@@ -0,0 +1,330 @@
+package format
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// MessagePack type bytes
+const (
+	mpNil      = 0xc0
+	mpFalse    = 0xc2
+	mpTrue     = 0xc3
+	mpBin8     = 0xc4
+	mpBin16    = 0xc5
+	mpBin32    = 0xc6
+	mpExt8     = 0xc7
+	mpExt16    = 0xc8
+	mpExt32    = 0xc9
+	mpFloat32  = 0xca
+	mpFloat64  = 0xcb
+	mpUint8    = 0xcc
+	mpUint16   = 0xcd
+	mpUint32   = 0xce
+	mpUint64   = 0xcf
+	mpInt8     = 0xd0
+	mpInt16    = 0xd1
+	mpInt32    = 0xd2
+	mpInt64    = 0xd3
+	mpFixExt1  = 0xd4
+	mpFixExt16 = 0xd8
+	mpStr8     = 0xd9
+	mpStr16    = 0xda
+	mpStr32    = 0xdb
+	mpArray16  = 0xdc
+	mpArray32  = 0xdd
+	mpMap16    = 0xde
+	mpMap32    = 0xdf
+)
+
+// mpTimestamp is the extension type of MessagePack timestamps
+const mpTimestamp = -1
+
+func encodeMsgPack(v any) []byte {
+	var b []byte
+	return appendMsgPack(b, v)
+}
+
+func appendMsgPack(b []byte, v any) []byte {
+	switch v := v.(type) {
+	case nil:
+		return append(b, mpNil)
+	case bool:
+		if v {
+			return append(b, mpTrue)
+		}
+		return append(b, mpFalse)
+	case json.Number:
+		if integer(v) {
+			if i, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+				return appendMsgPackInt(b, i)
+			}
+			if u, err := strconv.ParseUint(string(v), 10, 64); err == nil {
+				return appendMsgPackUint(b, u)
+			}
+		}
+		f := float(v)
+		if float64(float32(f)) == f {
+			return binary.BigEndian.AppendUint32(append(b, mpFloat32), math.Float32bits(float32(f)))
+		}
+		return binary.BigEndian.AppendUint64(append(b, mpFloat64), math.Float64bits(f))
+	case string:
+		b = appendMsgPackHeader(b, len(v), 0xa0, 32, mpStr8, mpStr16, mpStr32)
+		return append(b, v...)
+	case []any:
+		b = appendMsgPackHeader(b, len(v), 0x90, 16, 0, mpArray16, mpArray32)
+		for _, item := range v {
+			b = appendMsgPack(b, item)
+		}
+		return b
+	case object:
+		b = appendMsgPackHeader(b, len(v), 0x80, 16, 0, mpMap16, mpMap32)
+		for _, m := range v {
+			b = appendMsgPack(b, m.key)
+			b = appendMsgPack(b, m.value)
+		}
+		return b
+	}
+	panic(fmt.Sprintf("format: unexpected value %T", v))
+}
+
+func appendMsgPackInt(b []byte, i int64) []byte {
+	switch {
+	case i >= 0:
+		return appendMsgPackUint(b, uint64(i))
+	case i >= -32:
+		return append(b, byte(i))
+	case i >= math.MinInt8:
+		return append(b, mpInt8, byte(i))
+	case i >= math.MinInt16:
+		return binary.BigEndian.AppendUint16(append(b, mpInt16), uint16(i))
+	case i >= math.MinInt32:
+		return binary.BigEndian.AppendUint32(append(b, mpInt32), uint32(i))
+	}
+	return binary.BigEndian.AppendUint64(append(b, mpInt64), uint64(i))
+}
+
+func appendMsgPackUint(b []byte, u uint64) []byte {
+	switch {
+	case u < 128:
+		return append(b, byte(u))
+	case u <= math.MaxUint8:
+		return append(b, mpUint8, byte(u))
+	case u <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, mpUint16), uint16(u))
+	case u <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, mpUint32), uint32(u))
+	}
+	return binary.BigEndian.AppendUint64(append(b, mpUint64), u)
+}
+
+// appendMsgPackHeader writes the type and length of a string, array or
+// map: fixed if n is below fixMax, else with an 8 (strings only), 16 or
+// 32-bit length
+func appendMsgPackHeader(b []byte, n int, fix byte, fixMax int, t8, t16, t32 byte) []byte {
+	switch {
+	case n < fixMax:
+		return append(b, fix|byte(n))
+	case t8 != 0 && n <= math.MaxUint8:
+		return append(b, t8, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, t16), uint16(n))
+	}
+	return binary.BigEndian.AppendUint32(append(b, t32), uint32(n))
+}
+
+// decodeMsgPack decodes a MessagePack document. Binary data becomes a
+// base64 string and timestamps RFC 3339 strings; map keys must be strings
+// or integers.
+func decodeMsgPack(data []byte) (any, error) {
+	r := &reader{data: data}
+	v, err := msgPackValue(r, 0)
+	if err != nil {
+		return nil, err
+	}
+	return v, r.end()
+}
+
+func msgPackValue(r *reader, depth int) (any, error) {
+	if depth > maxDepth {
+		return nil, depthError()
+	}
+	t, err := r.byte()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case t < 0x80:
+		return json.Number(strconv.Itoa(int(t))), nil
+	case t < 0x90:
+		return msgPackMap(r, uint64(t&0x0f), depth)
+	case t < 0xa0:
+		return msgPackArray(r, uint64(t&0x0f), depth)
+	case t < 0xc0:
+		return msgPackString(r, uint64(t&0x1f))
+	case t >= 0xe0:
+		return json.Number(strconv.Itoa(int(int8(t)))), nil
+	}
+
+	switch t {
+	case mpNil:
+		return nil, nil
+	case mpFalse:
+		return false, nil
+	case mpTrue:
+		return true, nil
+	case mpUint8, mpUint16, mpUint32, mpUint64:
+		u, err := r.uint(1 << (t - mpUint8))
+		return json.Number(strconv.FormatUint(u, 10)), err
+	case mpInt8, mpInt16, mpInt32, mpInt64:
+		size := 1 << (t - mpInt8)
+		u, err := r.uint(size)
+		// Sign-extend from the encoded width
+		shift := 64 - 8*size
+		return json.Number(strconv.FormatInt(int64(u<<shift)>>shift, 10)), err
+	case mpFloat32:
+		u, err := r.uint(4)
+		if err != nil {
+			return nil, err
+		}
+		return floatNumber(float64(math.Float32frombits(uint32(u))), 32)
+	case mpFloat64:
+		u, err := r.uint(8)
+		if err != nil {
+			return nil, err
+		}
+		return floatNumber(math.Float64frombits(u), 64)
+	case mpStr8, mpStr16, mpStr32:
+		n, err := r.uint(1 << (t - mpStr8))
+		if err != nil {
+			return nil, err
+		}
+		return msgPackString(r, n)
+	case mpBin8, mpBin16, mpBin32:
+		n, err := r.uint(1 << (t - mpBin8))
+		if err != nil {
+			return nil, err
+		}
+		b, err := r.bytes(n)
+		return base64.StdEncoding.EncodeToString(b), err
+	case mpArray16, mpArray32:
+		n, err := r.uint(2 << (t - mpArray16))
+		if err != nil {
+			return nil, err
+		}
+		return msgPackArray(r, n, depth)
+	case mpMap16, mpMap32:
+		n, err := r.uint(2 << (t - mpMap16))
+		if err != nil {
+			return nil, err
+		}
+		return msgPackMap(r, n, depth)
+	case mpExt8, mpExt16, mpExt32:
+		n, err := r.uint(1 << (t - mpExt8))
+		if err != nil {
+			return nil, err
+		}
+		return msgPackExt(r, n)
+	}
+	if t >= mpFixExt1 && t <= mpFixExt16 {
+		return msgPackExt(r, 1<<(t-mpFixExt1))
+	}
+	return nil, fmt.Errorf("invalid MessagePack type 0x%02x", t)
+}
+
+func msgPackString(r *reader, n uint64) (any, error) {
+	b, err := r.bytes(n)
+	if err != nil {
+		return nil, err
+	}
+	if !utf8.Valid(b) {
+		return nil, errors.New("string is not valid UTF-8")
+	}
+	return string(b), nil
+}
+
+func msgPackArray(r *reader, n uint64, depth int) (any, error) {
+	count, err := r.count(n, 1)
+	if err != nil {
+		return nil, err
+	}
+	arr := make([]any, 0, count)
+	for range count {
+		v, err := msgPackValue(r, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		arr = append(arr, v)
+	}
+	return arr, nil
+}
+
+func msgPackMap(r *reader, n uint64, depth int) (any, error) {
+	count, err := r.count(n, 2)
+	if err != nil {
+		return nil, err
+	}
+	obj := make(object, 0, count)
+	for range count {
+		k, err := msgPackValue(r, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := mapKey(k)
+		if !ok {
+			return nil, fmt.Errorf("map keys must be strings or integers, got %v", k)
+		}
+		v, err := msgPackValue(r, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		obj = append(obj, member{key, v})
+	}
+	return obj, nil
+}
+
+// msgPackExt decodes an extension value; only timestamps are supported
+func msgPackExt(r *reader, n uint64) (any, error) {
+	t, err := r.byte()
+	if err != nil {
+		return nil, err
+	}
+	b, err := r.bytes(n)
+	if err != nil {
+		return nil, err
+	}
+	if int8(t) != mpTimestamp {
+		return nil, fmt.Errorf("unsupported MessagePack extension type %d", int8(t))
+	}
+	var ts time.Time
+	switch len(b) {
+	case 4:
+		ts = time.Unix(int64(binary.BigEndian.Uint32(b)), 0)
+	case 8:
+		u := binary.BigEndian.Uint64(b)
+		ts = time.Unix(int64(u&(1<<34-1)), int64(u>>34))
+	case 12:
+		ts = time.Unix(int64(binary.BigEndian.Uint64(b[4:])), int64(binary.BigEndian.Uint32(b)))
+	default:
+		return nil, errors.New("invalid MessagePack timestamp")
+	}
+	return ts.UTC().Format(time.RFC3339Nano), nil
+}
+
+// mapKey returns the JSON key for a decoded map key
+func mapKey(k any) (string, bool) {
+	switch k := k.(type) {
+	case string:
+		return k, true
+	case json.Number:
+		return string(k), integer(k)
+	}
+	return "", false
+}
@@ -0,0 +1,191 @@
+package format
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+// jsonNumber matches numbers written the way JSON allows
+var jsonNumber = regexp.MustCompile(`^-?(?:0|[1-9]\d*)(?:\.\d+)?(?:[eE][+-]?\d+)?$`)
+
+// yamlDecoder converts a YAML node graph into a tree. Aliases are expanded,
+// so the number of values produced is capped to stop alias bombs.
+type yamlDecoder struct {
+	budget int
+}
+
+func decodeYAML(data []byte) (any, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	var doc yaml.Node
+	if err := dec.Decode(&doc); err != nil {
+		if err == io.EOF {
+			return nil, errors.New("empty YAML document")
+		}
+		return nil, err
+	}
+	if err := dec.Decode(new(yaml.Node)); err != io.EOF {
+		return nil, errors.New("more than one YAML document")
+	}
+	d := &yamlDecoder{budget: 16*len(data) + 1024}
+	return d.value(&doc, 0)
+}
+
+func (d *yamlDecoder) value(n *yaml.Node, depth int) (any, error) {
+	if depth > maxDepth {
+		return nil, depthError()
+	}
+	if d.budget--; d.budget < 0 {
+		return nil, errors.New("YAML document expands to too many values")
+	}
+	switch n.Kind {
+	case yaml.DocumentNode:
+		if len(n.Content) == 0 {
+			return nil, nil
+		}
+		return d.value(n.Content[0], depth)
+	case yaml.AliasNode:
+		return d.value(n.Alias, depth+1)
+	case yaml.SequenceNode:
+		arr := make([]any, 0, len(n.Content))
+		for _, c := range n.Content {
+			v, err := d.value(c, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+		return arr, nil
+	case yaml.MappingNode:
+		return d.mapping(n, depth)
+	}
+	return scalar(n)
+}
+
+// mapping converts a mapping; keys merged with << don't override keys set
+// in the mapping itself
+func (d *yamlDecoder) mapping(n *yaml.Node, depth int) (any, error) {
+	obj := object{}
+	var merged []object
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		k, v := n.Content[i], n.Content[i+1]
+		if k.Kind != yaml.ScalarNode {
+			return nil, fmt.Errorf("line %d: mapping keys must be scalars", k.Line)
+		}
+		if k.ShortTag() == "!!merge" {
+			sources := []*yaml.Node{v}
+			if v.Kind == yaml.SequenceNode {
+				sources = v.Content
+			}
+			for _, src := range sources {
+				m, err := d.value(src, depth+1)
+				if err != nil {
+					return nil, err
+				}
+				o, ok := m.(object)
+				if !ok {
+					return nil, fmt.Errorf("line %d: only mappings can be merged", k.Line)
+				}
+				merged = append(merged, o)
+			}
+			continue
+		}
+		val, err := d.value(v, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		obj = append(obj, member{k.Value, val})
+	}
+
+	seen := make(map[string]bool, len(obj))
+	for _, m := range obj {
+		seen[m.key] = true
+	}
+	for _, o := range merged {
+		for _, m := range o {
+			if !seen[m.key] {
+				seen[m.key] = true
+				obj = append(obj, m)
+			}
+		}
+	}
+	return obj, nil
+}
+
+// scalar converts a scalar by its resolved tag. Timestamps and binary
+// data have no JSON type and are kept as the strings they were written as.
+func scalar(n *yaml.Node) (any, error) {
+	switch n.ShortTag() {
+	case "!!null":
+		return nil, nil
+	case "!!bool":
+		var b bool
+		err := n.Decode(&b)
+		return b, err
+	case "!!int", "!!float":
+		if jsonNumber.MatchString(n.Value) {
+			return json.Number(n.Value), nil
+		}
+		var v any
+		if err := n.Decode(&v); err != nil {
+			return nil, err
+		}
+		if f, ok := v.(float64); ok && (math.IsNaN(f) || math.IsInf(f, 0)) {
+			return nil, fmt.Errorf("line %d: %s can't be represented in JSON", n.Line, n.Value)
+		}
+		b, err := json.Marshal(v)
+		return json.Number(b), err
+	}
+	return n.Value, nil
+}
+
+func encodeYAML(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(yamlNode(v)); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// yamlNode builds the YAML node of a tree value. Tags are only written
+// where the value would otherwise read as another type.
+func yamlNode(v any) *yaml.Node {
+	switch v := v.(type) {
+	case nil:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}
+	case bool:
+		if v {
+			return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: "true"}
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: "false"}
+	case json.Number:
+		// Untagged, so integers beyond 64 bits aren't written as !!int
+		return &yaml.Node{Kind: yaml.ScalarNode, Value: string(v)}
+	case string:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: v}
+	case []any:
+		n := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, item := range v {
+			n.Content = append(n.Content, yamlNode(item))
+		}
+		return n
+	case object:
+		n := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		for _, m := range v {
+			n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: m.key}, yamlNode(m.value))
+		}
+		return n
+	}
+	panic(fmt.Sprintf("format: unexpected value %T", v))
+}
@@ -0,0 +1,14 @@
+package model
+
+// ReencryptResponse reports the result of a key rotation
+type ReencryptResponse struct {
+	Status    string `json:"status" enum:"reencrypted"`
+	Documents int    `json:"documents" doc:"Number of documents rewritten"`
+}
+
+// CompactResponse reports the database size before and after compaction
+type CompactResponse struct {
+	Status     string `json:"status" enum:"compacted"`
+	SizeBefore int64  `json:"size_before" doc:"Database file size in bytes before compaction"`
+	SizeAfter  int64  `json:"size_after" doc:"Database file size in bytes after compaction"`
+}
@@ -0,0 +1,49 @@
+package model
+
+import "encoding/json"
+
+// Batch operation types
+const (
+	BatchOpPut    = "put"
+	BatchOpPatch  = "patch"
+	BatchOpDelete = "delete"
+)
+
+// Batch result statuses
+const (
+	BatchStatusCreated = "created"
+	BatchStatusUpdated = "updated"
+	BatchStatusDeleted = "deleted"
+	BatchStatusFailed  = "failed"
+	BatchStatusAborted = "aborted"
+)
+
+// BatchOperation is a single operation in a batch request
+type BatchOperation struct {
+	Op       string          `json:"op" enum:"put,patch,delete" doc:"Operation type"`
+	Channel  string          `json:"channel" doc:"Channel name"`
+	Document string          `json:"document" doc:"Document name"`
+	Value    json.RawMessage `json:"value,omitempty" doc:"Document for put, JSON merge patch for patch; omitted for delete"`
+	IfMatch  string          `json:"if_match,omitempty" doc:"ETag the document must currently have (\"*\" matches any existing document)"`
+}
+
+// BatchResult reports the outcome of a single batch operation
+type BatchResult struct {
+	Op         string            `json:"op"`
+	Channel    string            `json:"channel"`
+	Document   string            `json:"document"`
+	Status     string            `json:"status" enum:"created,updated,deleted,failed,aborted" doc:"Operation result; aborted operations were rolled back or never executed"`
+	ETag       string            `json:"etag,omitempty" doc:"New ETag of a written document"`
+	Error      string            `json:"error,omitempty" doc:"Error code of the failed operation"`
+	Message    string            `json:"message,omitempty"`
+	Violations []SchemaViolation `json:"violations,omitempty"`
+}
+
+// BatchResponse for POST /_/batch
+// Error and Message are set only when the batch was aborted
+type BatchResponse struct {
+	Status  string        `json:"status" enum:"committed,aborted"`
+	Error   string        `json:"error,omitempty" doc:"Error code of the failed operation (aborted batches only)"`
+	Message string        `json:"message,omitempty"`
+	Results []BatchResult `json:"results"`
+}
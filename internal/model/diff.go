@@ -0,0 +1,17 @@
+package model
+
+import "encoding/json"
+
+// JSON Patch operation types produced by the diff endpoint
+const (
+	PatchOpAdd     = "add"
+	PatchOpRemove  = "remove"
+	PatchOpReplace = "replace"
+)
+
+// PatchOperation is a single RFC 6902 JSON Patch operation
+type PatchOperation struct {
+	Op    string          `json:"op" enum:"add,remove,replace" doc:"Operation type"`
+	Path  string          `json:"path" doc:"JSON Pointer to the changed location"`
+	Value json.RawMessage `json:"value,omitempty" doc:"New value; omitted for remove"`
+}
@@ -1,8 +1,35 @@
 package model
 
 const (
-	ErrCodeInvalidJSON     = "invalid_json"
-	ErrCodeInvalidName     = "invalid_name"
-	ErrCodeNotFound        = "not_found"
-	ErrCodePayloadTooLarge = "payload_too_large"
-)
\ No newline at end of file
+	ErrCodeConflict             = "conflict"
+	ErrCodeInvalidJSON          = "invalid_json"
+	ErrCodeInvalidName          = "invalid_name"
+	ErrCodeInvalidOperation     = "invalid_operation"
+	ErrCodeInvalidSchema        = "invalid_schema"
+	ErrCodeNotAcceptable        = "not_acceptable"
+	ErrCodeNotFound             = "not_found"
+	ErrCodeNotImplemented       = "not_implemented"
+	ErrCodePayloadTooLarge      = "payload_too_large"
+	ErrCodePreconditionFailed   = "precondition_failed"
+	ErrCodeSchemaViolation      = "schema_violation"
+	ErrCodeUnauthorized         = "unauthorized"
+	ErrCodeUnsupportedMediaType = "unsupported_media_type"
+)
+
+// ErrorCodes lists every error code, for the API documentation
+var ErrorCodes = []string{
+	ErrCodeConflict,
+	ErrCodeInvalidJSON,
+	ErrCodeInvalidName,
+	ErrCodeInvalidOperation,
+	ErrCodeInvalidSchema,
+	ErrCodeNotAcceptable,
+	ErrCodeNotFound,
+	ErrCodeNotImplemented,
+	ErrCodePayloadTooLarge,
+	ErrCodePreconditionFailed,
+	ErrCodeSchemaViolation,
+	ErrCodeUnauthorized,
+	ErrCodeUnsupportedMediaType,
+	"internal_error",
+}
@@ -1,14 +1,52 @@
 package model
 
-// SuccessResponse for POST operations
+import "encoding/json"
+
+// SuccessResponse for POST, PATCH and DELETE operations
 type SuccessResponse struct {
-	Status   string `json:"status"`   // "created" or "updated"
-	Channel  string `json:"channel"`
-	Document string `json:"document"`
+	Status   string `json:"status" enum:"created,updated,deleted" doc:"Operation result"`
+	Channel  string `json:"channel" doc:"Channel name"`
+	Document string `json:"document" doc:"Document name"`
+}
+
+// AttachmentResponse for PUT /{channel}/{document}/_attachments/{name}
+type AttachmentResponse struct {
+	Status     string         `json:"status" enum:"created,updated" doc:"Operation result"`
+	Channel    string         `json:"channel" doc:"Channel name"`
+	Document   string         `json:"document" doc:"Document name"`
+	Attachment AttachmentMeta `json:"attachment" doc:"Stored attachment"`
+}
+
+// AttachmentsResponse for GET /{channel}/{document}/_attachments
+type AttachmentsResponse struct {
+	Channel     string           `json:"channel" doc:"Channel name"`
+	Document    string           `json:"document" doc:"Document name"`
+	Attachments []AttachmentMeta `json:"attachments" doc:"Attachments of the document, sorted by name"`
+}
+
+// AttachmentMeta describes a binary attachment stored alongside a document
+type AttachmentMeta struct {
+	Name        string `json:"name" doc:"Attachment name"`
+	ContentType string `json:"content_type" doc:"Media type the attachment was stored with"`
+	Size        int    `json:"size" doc:"Attachment size in bytes"`
+	Digest      string `json:"digest" doc:"SHA-256 of the attachment as sha256:<hex>"`
 }
 
 // ErrorResponse for all error cases
 type ErrorResponse struct {
-	Error   string `json:"error"`
-	Message string `json:"message"`
-}
\ No newline at end of file
+	Error      string            `json:"error" doc:"Error code"`
+	Message    string            `json:"message" doc:"Human-readable error message"`
+	Violations []SchemaViolation `json:"violations,omitempty" doc:"Schema violations (only for schema_violation errors)"`
+}
+
+// SchemaViolation describes a single JSON Schema validation failure
+type SchemaViolation struct {
+	Location string `json:"location" doc:"JSON Pointer to the offending value"`
+	Message  string `json:"message" doc:"Validation failure description"`
+}
+
+// BulkResponse is the body streamed by GET /{channel}/_bulk
+type BulkResponse struct {
+	Documents map[string]json.RawMessage `json:"documents" doc:"Documents keyed by name"`
+	NotFound  []string                   `json:"not_found" doc:"Requested names that don't exist"`
+}
@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// RevisionsResponse for GET /{channel}/{document}/_revisions
+type RevisionsResponse struct {
+	Channel   string         `json:"channel" doc:"Channel name"`
+	Document  string         `json:"document" doc:"Document name"`
+	Revisions []RevisionMeta `json:"revisions" doc:"Current and kept previous versions, newest first"`
+}
+
+// RevisionMeta describes a version of a document
+type RevisionMeta struct {
+	Revision int       `json:"revision" doc:"Revision number, counting up from 1 with every write"`
+	Modified time.Time `json:"modified,omitzero" doc:"When the version was written; omitted if unknown"`
+}
@@ -0,0 +1,99 @@
+package model
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+// schemaURL is the resource location used when compiling channel schemas
+const schemaURL = "justdoc://schema.json"
+
+// Errors returned by CompileSchema. They replace the compiler's own errors,
+// which can quote the content of the resources it tried to load.
+var (
+	ErrSchemaNotJSON     = errors.New("schema is not valid JSON")
+	ErrSchemaExternalRef = errors.New("references outside the schema are not allowed")
+	ErrSchemaInvalid     = errors.New("schema does not compile")
+)
+
+// refusingLoader fails every URL the compiler asks for, so references to
+// files or remote resources are never fetched
+type refusingLoader struct {
+	refused bool
+}
+
+func (l *refusingLoader) Load(url string) (any, error) {
+	l.refused = true
+	return nil, ErrSchemaExternalRef
+}
+
+// Schema is a compiled JSON Schema attached to a channel
+type Schema struct {
+	schema *jsonschema.Schema
+}
+
+// CompileSchema compiles a JSON Schema document.
+// Schemas without a $schema keyword are treated as draft 2020-12.
+// References outside the schema itself, such as file:// or http:// URLs,
+// are rejected with ErrSchemaExternalRef.
+func CompileSchema(data []byte) (*Schema, error) {
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrSchemaNotJSON
+	}
+	loader := &refusingLoader{}
+	c := jsonschema.NewCompiler()
+	c.UseLoader(loader)
+	c.DefaultDraft(jsonschema.Draft2020)
+	if err := c.AddResource(schemaURL, doc); err != nil {
+		return nil, ErrSchemaInvalid
+	}
+	sch, err := c.Compile(schemaURL)
+	if loader.refused {
+		return nil, ErrSchemaExternalRef
+	}
+	if err != nil {
+		return nil, ErrSchemaInvalid
+	}
+	return &Schema{schema: sch}, nil
+}
+
+// Validate checks a JSON document against the schema.
+// Returns nil if the document is valid, otherwise the list of violations
+// sorted by location.
+func (s *Schema) Validate(data []byte) ([]SchemaViolation, error) {
+	inst, err := jsonschema.UnmarshalJSON(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	err = s.schema.Validate(inst)
+	if err == nil {
+		return nil, nil
+	}
+	verr, ok := err.(*jsonschema.ValidationError)
+	if !ok {
+		return nil, err
+	}
+
+	var violations []SchemaViolation
+	for _, unit := range verr.BasicOutput().Errors {
+		if unit.Error == nil {
+			continue
+		}
+		violations = append(violations, SchemaViolation{
+			Location: unit.InstanceLocation,
+			Message:  unit.Error.String(),
+		})
+	}
+	if len(violations) == 0 {
+		violations = append(violations, SchemaViolation{Location: "", Message: fmt.Sprint(verr)})
+	}
+	sort.SliceStable(violations, func(i, j int) bool {
+		return violations[i].Location < violations[j].Location
+	})
+	return violations, nil
+}
@@ -0,0 +1,119 @@
+package model
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testSchema = `{
+	"type": "object",
+	"required": ["name"],
+	"properties": {
+		"name": {"type": "string"},
+		"tags": {"type": "array", "items": {"type": "string"}}
+	}
+}`
+
+func TestCompileSchema_Invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+	}{
+		{"not json", `{invalid`},
+		{"bad type keyword", `{"type": 42}`},
+		{"bad required keyword", `{"required": "name"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := CompileSchema([]byte(tt.schema)); err == nil {
+				t.Errorf("CompileSchema(%s) expected error, got nil", tt.schema)
+			}
+		})
+	}
+}
+
+func TestCompileSchema_ExternalRef(t *testing.T) {
+	secret := "top-secret-content"
+	path := filepath.Join(t.TempDir(), "secret.json")
+	if err := os.WriteFile(path, []byte(`{"title": "`+secret+`"}`), 0o600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		schema string
+	}{
+		{"file ref", `{"$ref": "file://` + filepath.ToSlash(path) + `"}`},
+		{"nested file ref", `{"properties": {"a": {"$ref": "file:///etc/hostname"}}}`},
+		{"http ref", `{"$ref": "http://127.0.0.1:1/schema.json"}`},
+		{"unknown metaschema", `{"$schema": "http://example.com/meta.json"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := CompileSchema([]byte(tt.schema))
+			if err != ErrSchemaExternalRef {
+				t.Fatalf("Expected ErrSchemaExternalRef, got %v", err)
+			}
+			if strings.Contains(err.Error(), secret) {
+				t.Errorf("Error reveals referenced content: %v", err)
+			}
+		})
+	}
+}
+
+func TestCompileSchema_LocalRef(t *testing.T) {
+	schema, err := CompileSchema([]byte(`{
+		"$schema": "http://json-schema.org/draft-07/schema#",
+		"definitions": {"name": {"type": "string"}},
+		"properties": {"name": {"$ref": "#/definitions/name"}}
+	}`))
+	if err != nil {
+		t.Fatalf("CompileSchema failed: %v", err)
+	}
+	violations, err := schema.Validate([]byte(`{"name": 1}`))
+	if err != nil || len(violations) != 1 {
+		t.Errorf("Expected one violation, got %v (%v)", violations, err)
+	}
+}
+
+func TestSchema_Validate(t *testing.T) {
+	schema, err := CompileSchema([]byte(testSchema))
+	if err != nil {
+		t.Fatalf("CompileSchema failed: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		doc       string
+		locations []string
+	}{
+		{"valid", `{"name": "x", "tags": ["a"]}`, nil},
+		{"missing required", `{"tags": []}`, []string{""}},
+		{"wrong nested type", `{"name": "x", "tags": ["a", 1]}`, []string{"/tags/1"}},
+		{"multiple violations", `{"name": 1, "tags": [true]}`, []string{"/name", "/tags/0"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations, err := schema.Validate([]byte(tt.doc))
+			if err != nil {
+				t.Fatalf("Validate failed: %v", err)
+			}
+			if len(violations) != len(tt.locations) {
+				t.Fatalf("Expected %d violations, got %d: %+v", len(tt.locations), len(violations), violations)
+			}
+			for i, loc := range tt.locations {
+				if violations[i].Location != loc {
+					t.Errorf("Violation %d: expected location %q, got %q", i, loc, violations[i].Location)
+				}
+				if violations[i].Message == "" {
+					t.Errorf("Violation %d: expected non-empty message", i)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,6 @@
+package model
+
+// ChannelSettings for GET and PUT /{channel}/_settings
+type ChannelSettings struct {
+	Normalize bool `json:"normalize" doc:"Store documents written to the channel as canonical JSON (RFC 8785)"`
+}
@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+// PermissionRead allows reading a shared document
+const PermissionRead = "read"
+
+// ShareRequest asks for a share link to a document
+type ShareRequest struct {
+	Channel    string `json:"channel" doc:"Channel of the shared document"`
+	Document   string `json:"document" doc:"Shared document"`
+	Permission string `json:"permission,omitempty" enum:"read" doc:"Granted permission; defaults to read"`
+	ExpiresIn  string `json:"expires_in,omitempty" doc:"Lifetime of the link as a duration such as 90m or 24h; defaults to 24h"`
+}
+
+// ShareResponse is a signed share link
+type ShareResponse struct {
+	Token      string    `json:"token" doc:"Signed token, sent as the token query parameter"`
+	URL        string    `json:"url" doc:"Path of the read-only viewer, including the token"`
+	Channel    string    `json:"channel"`
+	Document   string    `json:"document"`
+	Permission string    `json:"permission" enum:"read"`
+	Expires    time.Time `json:"expires" doc:"Time the link stops working"`
+}
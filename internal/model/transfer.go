@@ -0,0 +1,40 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Import modes
+const (
+	ImportModeOverwrite = "overwrite" // replace existing documents
+	ImportModeSkip      = "skip"      // keep existing documents
+	ImportModeFail      = "fail"      // stop at the first existing document
+)
+
+// ExportRecord is a single NDJSON line of a channel export
+type ExportRecord struct {
+	Name string          `json:"name" doc:"Document name"`
+	Doc  json.RawMessage `json:"doc" doc:"Document content"`
+	Meta ExportMeta      `json:"meta"`
+}
+
+// ExportMeta is the document metadata included in an export record
+type ExportMeta struct {
+	Size        int              `json:"size" doc:"Stored document size in bytes"`
+	Modified    time.Time        `json:"modified,omitzero" doc:"Last modification time; omitted if unknown"`
+	Attachments []AttachmentMeta `json:"attachments,omitempty" doc:"Binary attachments of the document, sorted by name"`
+}
+
+// ImportResponse for POST /{channel}/_import
+// Counts cover documents committed before an error, if any
+type ImportResponse struct {
+	Status   string `json:"status" enum:"completed,failed"`
+	Channel  string `json:"channel"`
+	Created  int    `json:"created"`
+	Updated  int    `json:"updated"`
+	Skipped  int    `json:"skipped"`
+	Error    string `json:"error,omitempty" doc:"Error code (failed imports only)"`
+	Message  string `json:"message,omitempty"`
+	Document string `json:"document,omitempty" doc:"Document that caused the failure"`
+}
@@ -1,12 +1,47 @@
 package model
 
-import "regexp"
+import (
+	"regexp"
+	"strings"
+)
 
-var validName = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,128}$`)
+// NamePattern is the regular expression valid channel and document names
+// match. It is also compatible with JavaScript, so the browser UI checks
+// names the same way.
+const NamePattern = `^[a-zA-Z0-9_-]{1,128}$`
+
+var validName = regexp.MustCompile(NamePattern)
+
+// NewNamePattern is the regular expression names of new channels and
+// documents match. Names starting with an underscore are reserved for
+// endpoints such as /{channel}/_schema and /_/docs, which would otherwise
+// shadow them. Earlier versions accepted them, so documents that already
+// have such names can still be read, updated and deleted.
+const NewNamePattern = `^[a-zA-Z0-9-][a-zA-Z0-9_-]{0,127}$`
+
+// AttachmentNamePattern is the regular expression valid attachment names
+// match. Dots are allowed so names can carry a file extension, but not at
+// the start.
+const AttachmentNamePattern = `^[a-zA-Z0-9_-][a-zA-Z0-9._-]{0,127}$`
+
+var validAttachmentName = regexp.MustCompile(AttachmentNamePattern)
 
 // IsValidName checks if a channel or document name is valid.
 // Valid names contain only alphanumeric characters, hyphens, and underscores,
 // and are between 1 and 128 characters long.
 func IsValidName(name string) bool {
 	return validName.MatchString(name)
-}
\ No newline at end of file
+}
+
+// IsReservedName reports whether a name starts with an underscore. Such
+// names are not accepted for new channels and documents; see NewNamePattern.
+func IsReservedName(name string) bool {
+	return strings.HasPrefix(name, "_")
+}
+
+// IsValidAttachmentName checks if an attachment name is valid, like
+// "logo.png". Valid names are like channel and document names but may
+// also contain dots after the first character.
+func IsValidAttachmentName(name string) bool {
+	return validAttachmentName.MatchString(name)
+}
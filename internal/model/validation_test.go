@@ -1,6 +1,10 @@
 package model
 
-import "testing"
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
 
 func TestIsValidName(t *testing.T) {
 	tests := []struct {
@@ -15,6 +19,10 @@ func TestIsValidName(t *testing.T) {
 		{"with numbers", "app123", true},
 		{"with hyphen", "my-app", true},
 		{"with underscore", "my_app", true},
+		{"trailing underscore", "my_", true},
+		{"leading hyphen", "-app", true},
+		{"leading underscore", "_schema", true},
+		{"single underscore", "_", true},
 		{"mixed special", "My-App_123", true},
 		{"single char", "a", true},
 		{"max length 128", string(make([]byte, 128)), false}, // need valid chars
@@ -57,4 +65,40 @@ func TestIsValidName_MaxLength(t *testing.T) {
 	if IsValidName(string(invalidLen)) {
 		t.Errorf("IsValidName with 129 chars should be invalid")
 	}
-}
\ No newline at end of file
+}
+
+func TestNewNamePattern(t *testing.T) {
+	// New names are valid names that aren't reserved
+	re := regexp.MustCompile(NewNamePattern)
+	for _, name := range []string{"app", "my_app", "my_", "-", "-_", "_", "_schema", "__", "a" + strings.Repeat("_", 127), strings.Repeat("a", 129), "my.app", ""} {
+		want := IsValidName(name) && !IsReservedName(name)
+		if got := re.MatchString(name); got != want {
+			t.Errorf("NewNamePattern matches %q = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestIsValidAttachmentName(t *testing.T) {
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{"logo.png", true},
+		{"report.v2.pdf", true},
+		{"README", true},
+		{"a", true},
+		{"trailing.", true},
+		{"", false},
+		{".hidden", false},
+		{"..", false},
+		{"dir/file.txt", false},
+		{"with space.txt", false},
+		{"a" + strings.Repeat("b", 127), true},
+		{"a" + strings.Repeat("b", 128), false},
+	}
+	for _, tt := range tests {
+		if got := IsValidAttachmentName(tt.input); got != tt.want {
+			t.Errorf("IsValidAttachmentName(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
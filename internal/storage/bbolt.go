@@ -1,29 +1,250 @@
 package storage
 
 import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
 	"sort"
+	"sync"
+	"time"
 
 	"go.etcd.io/bbolt"
 )
 
+// System buckets start with a dot, which is never valid in a channel name.
+const (
+	// schemaBucket holds channel schemas keyed by channel name
+	schemaBucket = ".schemas"
+	// settingsBucket holds channel settings keyed by channel name
+	settingsBucket = ".settings"
+	// metaBucket holds a nested bucket per channel with document metadata
+	metaBucket = ".meta"
+	// encryptionBucket records that encrypted documents have been written
+	encryptionBucket = ".encryption"
+	// attachmentBucket holds a nested bucket per channel, with a nested
+	// bucket per document holding its attachments keyed by name
+	attachmentBucket = ".attachments"
+	// revisionBucket holds a nested bucket per channel, with a nested bucket
+	// per document holding its previous versions keyed by revision number
+	revisionBucket = ".revisions"
+)
+
+// encryptionMarker is the key set in encryptionBucket
+var encryptionMarker = []byte("enabled")
+
+// compactTxSize is the number of bytes copied per transaction by Compact
+const compactTxSize = 64 * 1024 * 1024
+
+// reencryptChunk is the number of documents rewritten per transaction by Reencrypt
+const reencryptChunk = 500
+
+// boltMeta is the stored form of the metadata not derived from the value
+type boltMeta struct {
+	Modified time.Time `json:"modified"`
+	// Size is the plain document size, 0 for documents written before it
+	// was recorded
+	Size int `json:"size,omitempty"`
+	// Revision is 0 for documents written before revisions were tracked,
+	// which count as revision 1
+	Revision int `json:"revision,omitempty"`
+}
+
+// revision returns the revision number of the current version
+func (m boltMeta) revision() int {
+	return max(m.Revision, 1)
+}
+
+// boltAttachment is the stored form of attachment metadata. Attachments
+// are stored as the length of the JSON metadata (4 bytes, big-endian),
+// the metadata and the content, sealed if Encrypted.
+type boltAttachment struct {
+	ContentType string `json:"content_type"`
+	Size        int    `json:"size"`
+	Digest      string `json:"digest"`
+	Encrypted   bool   `json:"encrypted,omitempty"`
+}
+
 // BoltStorage implements Storage using bbolt
 type BoltStorage struct {
+	path string
+	// mu is held shared by every transaction and exclusively by Compact,
+	// which replaces db
+	mu sync.RWMutex
 	db *bbolt.DB
+	// compressMin is the smallest document size that is gzip-compressed (0 = never)
+	compressMin int
+	// keys encrypts documents when set
+	keys *Keyring
+	// timeout limits how long to wait for another process to release the file
+	timeout time.Duration
+}
+
+// BoltOption configures a BoltStorage
+type BoltOption func(*BoltStorage)
+
+// WithCompression gzip-compresses documents of at least minSize bytes when
+// they are written. Documents are always readable whatever the setting, so
+// it can be changed at any time; existing values keep their encoding until
+// they are rewritten.
+func WithCompression(minSize int) BoltOption {
+	return func(s *BoltStorage) {
+		s.compressMin = minSize
+	}
+}
+
+// WithEncryption encrypts documents written from now on with the current
+// key of keys. Documents stored earlier, in plain form or with older keys,
+// stay readable; Reencrypt rewrites them with the current key.
+func WithEncryption(keys *Keyring) BoltOption {
+	return func(s *BoltStorage) {
+		s.keys = keys
+	}
+}
+
+// WithTimeout makes opening fail with bbolt.ErrTimeout if another process
+// holds the file for longer than d, instead of waiting indefinitely
+func WithTimeout(d time.Duration) BoltOption {
+	return func(s *BoltStorage) {
+		s.timeout = d
+	}
 }
 
 // NewBoltStorage creates a new bbolt-backed storage
-func NewBoltStorage(path string) (*BoltStorage, error) {
-	db, err := bbolt.Open(path, 0600, nil)
+// It fails with ErrEncryptionKeyRequired if the database holds encrypted
+// documents and no keyring is given.
+func NewBoltStorage(path string, opts ...BoltOption) (*BoltStorage, error) {
+	s := &BoltStorage{path: path}
+	for _, opt := range opts {
+		opt(s)
+	}
+	db, err := s.open()
 	if err != nil {
 		return nil, err
 	}
-	return &BoltStorage{db: db}, nil
+	s.db = db
+
+	if s.keys == nil {
+		var encrypted bool
+		_ = db.View(func(tx *bbolt.Tx) error {
+			b := tx.Bucket([]byte(encryptionBucket))
+			encrypted = b != nil && b.Get(encryptionMarker) != nil
+			return nil
+		})
+		if encrypted {
+			_ = db.Close()
+			return nil, ErrEncryptionKeyRequired
+		}
+	}
+	return s, nil
 }
 
 // GetDocument retrieves a document from a channel
 func (s *BoltStorage) GetDocument(channel, document string) ([]byte, error) {
 	var data []byte
-	err := s.db.View(func(tx *bbolt.Tx) error {
+	err := s.view(func(tx *bbolt.Tx) error {
+		var err error
+		data, err = s.wrap(tx).GetDocument(channel, document)
+		return err
+	})
+	return data, err
+}
+
+// PutDocument stores a document in a channel
+func (s *BoltStorage) PutDocument(channel, document string, data []byte) (bool, error) {
+	var created bool
+	err := s.update(func(tx *bbolt.Tx) error {
+		var err error
+		created, err = s.wrap(tx).PutDocument(channel, document, data)
+		return err
+	})
+	return created, err
+}
+
+// DeleteDocument removes a document from a channel
+func (s *BoltStorage) DeleteDocument(channel, document string) error {
+	return s.update(func(tx *bbolt.Tx) error {
+		return s.wrap(tx).DeleteDocument(channel, document)
+	})
+}
+
+// GetAttachment retrieves a binary attachment of a document
+func (s *BoltStorage) GetAttachment(channel, document, name string) (Attachment, error) {
+	var a Attachment
+	err := s.view(func(tx *bbolt.Tx) error {
+		t := s.wrap(tx)
+		b := t.attachments(channel, document)
+		if b == nil {
+			return ErrNotFound
+		}
+		v := b.Get([]byte(name))
+		if v == nil {
+			return ErrNotFound
+		}
+		var err error
+		a, err = t.loadAttachment(channel, document, name, v)
+		return err
+	})
+	return a, err
+}
+
+// PutAttachment stores a binary attachment of a document
+func (s *BoltStorage) PutAttachment(channel, document, name, contentType string, data []byte) (bool, error) {
+	var created bool
+	err := s.update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(channel))
+		if bucket == nil || bucket.Get([]byte(document)) == nil {
+			return ErrNotFound
+		}
+		t := s.wrap(tx)
+		value, err := t.storeAttachment(channel, document, NewAttachment(name, contentType, data))
+		if err != nil {
+			return err
+		}
+		b, err := t.createAttachments(channel, document)
+		if err != nil {
+			return err
+		}
+		created = b.Get([]byte(name)) == nil
+		return b.Put([]byte(name), value)
+	})
+	return created, err
+}
+
+// ListRevisions returns the current and kept previous versions of a document
+func (s *BoltStorage) ListRevisions(channel, document string) ([]RevisionMeta, error) {
+	var revisions []RevisionMeta
+	err := s.view(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(channel))
+		if bucket == nil || bucket.Get([]byte(document)) == nil {
+			return ErrNotFound
+		}
+		t := s.wrap(tx)
+		meta := t.storedMeta(channel, []byte(document))
+		revisions = append(revisions, RevisionMeta{Revision: meta.revision(), Modified: meta.Modified})
+		b := t.revisions(channel, document)
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			modified, _, err := splitRevision(v)
+			if err != nil {
+				return fmt.Errorf("revision %s/%s@%d: %w", channel, document, revisionNumber(k), err)
+			}
+			revisions = append(revisions, RevisionMeta{Revision: revisionNumber(k), Modified: modified})
+		}
+		return nil
+	})
+	return revisions, err
+}
+
+// GetRevision retrieves a version of a document by revision number
+func (s *BoltStorage) GetRevision(channel, document string, revision int) ([]byte, error) {
+	var data []byte
+	err := s.view(func(tx *bbolt.Tx) error {
 		bucket := tx.Bucket([]byte(channel))
 		if bucket == nil {
 			return ErrNotFound
@@ -32,33 +253,150 @@ func (s *BoltStorage) GetDocument(channel, document string) ([]byte, error) {
 		if v == nil {
 			return ErrNotFound
 		}
-		// Copy the data since bbolt values are only valid during the transaction
-		data = make([]byte, len(v))
-		copy(data, v)
-		return nil
+		t := s.wrap(tx)
+		var err error
+		if revision == t.storedMeta(channel, []byte(document)).revision() {
+			data, err = t.load(channel, document, v)
+			return err
+		}
+		b := t.revisions(channel, document)
+		if b == nil || revision < 1 {
+			return ErrNotFound
+		}
+		if v = b.Get(revisionKey(revision)); v == nil {
+			return ErrNotFound
+		}
+		_, value, err := splitRevision(v)
+		if err != nil {
+			return fmt.Errorf("revision %s/%s@%d: %w", channel, document, revision, err)
+		}
+		data, err = t.load(channel, document, value)
+		return err
 	})
 	return data, err
 }
 
-// PutDocument stores a document in a channel
-func (s *BoltStorage) PutDocument(channel, document string, data []byte) (bool, error) {
-	var created bool
-	err := s.db.Update(func(tx *bbolt.Tx) error {
-		bucket, err := tx.CreateBucketIfNotExists([]byte(channel))
+// ListAttachments returns the metadata of the attachments of a document
+func (s *BoltStorage) ListAttachments(channel, document string) ([]AttachmentMeta, error) {
+	var metas []AttachmentMeta
+	err := s.view(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(channel))
+		if bucket == nil || bucket.Get([]byte(document)) == nil {
+			return ErrNotFound
+		}
+		var err error
+		metas, err = s.wrap(tx).attachmentMetas(channel, document)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if metas == nil {
+		metas = make([]AttachmentMeta, 0)
+	}
+	return metas, nil
+}
+
+// DeleteAttachment removes a binary attachment of a document
+func (s *BoltStorage) DeleteAttachment(channel, document, name string) error {
+	return s.update(func(tx *bbolt.Tx) error {
+		b := s.wrap(tx).attachments(channel, document)
+		if b == nil || b.Get([]byte(name)) == nil {
+			return ErrNotFound
+		}
+		return b.Delete([]byte(name))
+	})
+}
+
+// Batch runs fn within a single bbolt read-write transaction
+func (s *BoltStorage) Batch(fn func(tx Tx) error) error {
+	return s.update(func(tx *bbolt.Tx) error {
+		return fn(s.wrap(tx))
+	})
+}
+
+// GetDocumentEncoded retrieves a document without decompressing it
+func (s *BoltStorage) GetDocumentEncoded(channel, document string) (EncodedDocument, error) {
+	var doc EncodedDocument
+	err := s.view(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(channel))
+		if bucket == nil {
+			return ErrNotFound
+		}
+		v := bucket.Get([]byte(document))
+		if v == nil {
+			return ErrNotFound
+		}
+		inner, err := s.keys.open(channel, document, v)
 		if err != nil {
 			return err
 		}
-		existing := bucket.Get([]byte(document))
-		created = existing == nil
-		return bucket.Put([]byte(document), data)
+		doc = encodedValue(inner)
+		return nil
+	})
+	return doc, err
+}
+
+// ViewDocuments calls fn for each named document within a single read transaction
+func (s *BoltStorage) ViewDocuments(channel string, names []string, fn func(name string, data []byte) error) error {
+	return s.view(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(channel))
+		t := s.wrap(tx)
+		for _, name := range names {
+			var data []byte
+			if bucket != nil {
+				if v := bucket.Get([]byte(name)); v != nil {
+					var err error
+					if data, err = t.load(channel, name, v); err != nil {
+						return err
+					}
+				}
+			}
+			if err := fn(name, data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ForEachDocument calls fn for every document in a channel within a single read transaction
+func (s *BoltStorage) ForEachDocument(channel, after string, fn func(name string, data []byte, meta DocumentMeta) error) error {
+	return s.view(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(channel))
+		if bucket == nil {
+			return ErrNotFound
+		}
+		t := s.wrap(tx)
+		c := bucket.Cursor()
+		k, v := c.First()
+		if after != "" {
+			k, v = c.Seek([]byte(after))
+			if k != nil && string(k) == after {
+				k, v = c.Next()
+			}
+		}
+		for ; k != nil; k, v = c.Next() {
+			data, err := t.load(channel, string(k), v)
+			if err != nil {
+				return err
+			}
+			meta := t.meta(channel, k, len(data))
+			if meta.Attachments, err = t.attachmentMetas(channel, string(k)); err != nil {
+				return err
+			}
+			if err := fn(string(k), data, meta); err != nil {
+				return err
+			}
+		}
+		return nil
 	})
-	return created, err
 }
 
 // ListDocuments returns all document names in a channel (sorted alphabetically)
 func (s *BoltStorage) ListDocuments(channel string) ([]string, error) {
 	var docs []string
-	err := s.db.View(func(tx *bbolt.Tx) error {
+	err := s.view(func(tx *bbolt.Tx) error {
 		bucket := tx.Bucket([]byte(channel))
 		if bucket == nil {
 			return ErrNotFound
@@ -75,11 +413,50 @@ func (s *BoltStorage) ListDocuments(channel string) ([]string, error) {
 	return docs, nil
 }
 
+// ListDocumentMeta returns the names and metadata of all documents in a
+// channel. Sizes come from the stored metadata, so documents are only
+// decoded if they were written before their size was recorded.
+func (s *BoltStorage) ListDocumentMeta(channel string) ([]DocumentInfo, error) {
+	var infos []DocumentInfo
+	err := s.view(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(channel))
+		if bucket == nil {
+			return ErrNotFound
+		}
+		t := s.wrap(tx)
+		infos = make([]DocumentInfo, 0)
+		return bucket.ForEach(func(k, v []byte) error {
+			stored := t.storedMeta(channel, k)
+			info := DocumentInfo{Name: string(k), DocumentMeta: DocumentMeta{Size: stored.Size, Modified: stored.Modified}}
+			if info.Size == 0 {
+				data, err := t.load(channel, string(k), v)
+				if err != nil {
+					return err
+				}
+				info.Size = len(data)
+			}
+			var err error
+			if info.Attachments, err = t.attachmentMetas(channel, string(k)); err != nil {
+				return err
+			}
+			infos = append(infos, info)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return infos, nil
+}
+
 // ListChannels returns all channels with document counts (sorted alphabetically)
 func (s *BoltStorage) ListChannels() ([]ChannelInfo, error) {
 	channels := make([]ChannelInfo, 0)
-	err := s.db.View(func(tx *bbolt.Tx) error {
+	err := s.view(func(tx *bbolt.Tx) error {
 		return tx.ForEach(func(name []byte, b *bbolt.Bucket) error {
+			if isSystemBucket(name) {
+				return nil
+			}
 			count := b.Stats().KeyN
 			channels = append(channels, ChannelInfo{
 				Name:          string(name),
@@ -97,7 +474,793 @@ func (s *BoltStorage) ListChannels() ([]ChannelInfo, error) {
 	return channels, nil
 }
 
+// GetSchema retrieves the JSON Schema attached to a channel
+func (s *BoltStorage) GetSchema(channel string) ([]byte, error) {
+	return s.getChannelValue(schemaBucket, channel)
+}
+
+// PutSchema attaches a JSON Schema to a channel
+func (s *BoltStorage) PutSchema(channel string, schema []byte) error {
+	return s.putChannelValue(schemaBucket, channel, schema)
+}
+
+// DeleteSchema removes the JSON Schema attached to a channel
+func (s *BoltStorage) DeleteSchema(channel string) error {
+	return s.deleteChannelValue(schemaBucket, channel)
+}
+
+// GetSettings retrieves the settings stored for a channel
+func (s *BoltStorage) GetSettings(channel string) ([]byte, error) {
+	return s.getChannelValue(settingsBucket, channel)
+}
+
+// PutSettings stores the settings of a channel
+func (s *BoltStorage) PutSettings(channel string, settings []byte) error {
+	return s.putChannelValue(settingsBucket, channel, settings)
+}
+
+// DeleteSettings removes the settings stored for a channel
+func (s *BoltStorage) DeleteSettings(channel string) error {
+	return s.deleteChannelValue(settingsBucket, channel)
+}
+
+// getChannelValue returns a copy of the value kept for a channel in a
+// system bucket
+func (s *BoltStorage) getChannelValue(name, channel string) ([]byte, error) {
+	var data []byte
+	err := s.view(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(name))
+		if bucket == nil {
+			return ErrNotFound
+		}
+		v := bucket.Get([]byte(channel))
+		if v == nil {
+			return ErrNotFound
+		}
+		data = make([]byte, len(v))
+		copy(data, v)
+		return nil
+	})
+	return data, err
+}
+
+func (s *BoltStorage) putChannelValue(name, channel string, value []byte) error {
+	return s.update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(name))
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(channel), value)
+	})
+}
+
+func (s *BoltStorage) deleteChannelValue(name, channel string) error {
+	return s.update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(name))
+		if bucket == nil || bucket.Get([]byte(channel)) == nil {
+			return ErrNotFound
+		}
+		return bucket.Delete([]byte(channel))
+	})
+}
+
+// Backup writes a consistent copy of the database file to w
+// It runs in a read transaction, so writers are not blocked
+func (s *BoltStorage) Backup(w io.Writer) (int64, error) {
+	var n int64
+	err := s.view(func(tx *bbolt.Tx) error {
+		var err error
+		n, err = tx.WriteTo(w)
+		return err
+	})
+	return n, err
+}
+
+// Reencrypt rewrites every document not encrypted with the current key,
+// including plain ones, while the storage stays online. Documents are
+// rewritten in chunks of separate transactions, and modification times
+// are kept. Attachments are rewritten afterwards, one per transaction, and
+// aren't counted. Returns the number of documents rewritten.
+func (s *BoltStorage) Reencrypt() (int, error) {
+	if s.keys == nil {
+		return 0, ErrEncryptionDisabled
+	}
+	current := s.keys.Current()
+
+	type docRef struct{ channel, document string }
+	var stale []docRef
+	err := s.view(func(tx *bbolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bbolt.Bucket) error {
+			if isSystemBucket(name) {
+				return nil
+			}
+			return b.ForEach(func(k, v []byte) error {
+				if keyID(v) != current {
+					stale = append(stale, docRef{string(name), string(k)})
+				}
+				return nil
+			})
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	rewritten := 0
+	for start := 0; start < len(stale); start += reencryptChunk {
+		chunk := stale[start:min(start+reencryptChunk, len(stale))]
+		err := s.update(func(tx *bbolt.Tx) error {
+			t := s.wrap(tx)
+			for _, ref := range chunk {
+				bucket := tx.Bucket([]byte(ref.channel))
+				if bucket == nil {
+					continue
+				}
+				// Skip documents deleted or rewritten since the scan
+				v := bucket.Get([]byte(ref.document))
+				if v == nil || keyID(v) == current {
+					continue
+				}
+				data, err := t.load(ref.channel, ref.document, v)
+				if err != nil {
+					return err
+				}
+				value, err := t.store(ref.channel, ref.document, data)
+				if err != nil {
+					return err
+				}
+				if err := bucket.Put([]byte(ref.document), value); err != nil {
+					return err
+				}
+				rewritten++
+			}
+			return nil
+		})
+		if err != nil {
+			return rewritten, err
+		}
+	}
+	if err := s.reencryptRevisions(current); err != nil {
+		return rewritten, err
+	}
+	return rewritten, s.reencryptAttachments(current)
+}
+
+// reencryptRevisions rewrites every previous document version not
+// encrypted with the current key, one document per transaction
+func (s *BoltStorage) reencryptRevisions(current string) error {
+	type docRef struct{ channel, document string }
+	var stale []docRef
+	err := s.view(func(tx *bbolt.Tx) error {
+		return forEachRevisionBucket(tx, func(channel, document string, b *bbolt.Bucket) error {
+			c := b.Cursor()
+			for k, v := c.First(); k != nil; k, v = c.Next() {
+				if _, value, err := splitRevision(v); err != nil || keyID(value) != current {
+					stale = append(stale, docRef{channel, document})
+					break
+				}
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range stale {
+		err := s.update(func(tx *bbolt.Tx) error {
+			t := s.wrap(tx)
+			b := t.revisions(ref.channel, ref.document)
+			if b == nil {
+				return nil
+			}
+			type rewrite struct{ key, value []byte }
+			var rewrites []rewrite
+			err := b.ForEach(func(k, v []byte) error {
+				modified, value, err := splitRevision(v)
+				if err != nil {
+					return fmt.Errorf("revision %s/%s@%d: %w", ref.channel, ref.document, revisionNumber(k), err)
+				}
+				if keyID(value) == current {
+					return nil
+				}
+				data, err := t.load(ref.channel, ref.document, value)
+				if err != nil {
+					return err
+				}
+				if value, err = t.store(ref.channel, ref.document, data); err != nil {
+					return err
+				}
+				rewrites = append(rewrites, rewrite{clone(k), joinRevision(modified, value)})
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			for _, r := range rewrites {
+				if err := b.Put(r.key, r.value); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reencryptAttachments rewrites every attachment not encrypted with the
+// current key
+func (s *BoltStorage) reencryptAttachments(current string) error {
+	type attachmentRef struct{ channel, document, name string }
+	var stale []attachmentRef
+	err := s.view(func(tx *bbolt.Tx) error {
+		return forEachAttachment(tx, func(channel, document, name string, v []byte) error {
+			if stored, payload, err := splitAttachment(v); err != nil || !stored.Encrypted || keyID(payload) != current {
+				stale = append(stale, attachmentRef{channel, document, name})
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range stale {
+		err := s.update(func(tx *bbolt.Tx) error {
+			t := s.wrap(tx)
+			b := t.attachments(ref.channel, ref.document)
+			if b == nil {
+				return nil
+			}
+			v := b.Get([]byte(ref.name))
+			if v == nil {
+				return nil
+			}
+			a, err := t.loadAttachment(ref.channel, ref.document, ref.name, v)
+			if err != nil {
+				return err
+			}
+			value, err := t.storeAttachment(ref.channel, ref.document, a)
+			if err != nil {
+				return err
+			}
+			return b.Put([]byte(ref.name), value)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Compact rewrites the database into a fresh file without free pages and
+// swaps it in, shrinking the file after deletes and overwrites. Requests
+// wait until it finishes. Returns the file sizes before and after.
+func (s *BoltStorage) Compact() (before, after int64, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	before, err = fileSize(s.path)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	tmp := s.path + ".compact"
+	_ = os.Remove(tmp)
+	dst, err := bbolt.Open(tmp, 0600, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := bbolt.Compact(dst, s.db, compactTxSize); err != nil {
+		_ = dst.Close()
+		_ = os.Remove(tmp)
+		return 0, 0, fmt.Errorf("compact: %w", err)
+	}
+	if err := dst.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return 0, 0, err
+	}
+
+	// The old file must be closed before it is replaced; if the swap fails
+	// it is opened again so the storage stays usable
+	if err := s.db.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return 0, 0, err
+	}
+	swapErr := os.Rename(tmp, s.path)
+	if swapErr == nil {
+		swapErr = syncDir(filepath.Dir(s.path))
+	} else {
+		_ = os.Remove(tmp)
+	}
+	db, err := s.open()
+	if err != nil {
+		return 0, 0, fmt.Errorf("reopen after compaction: %w", err)
+	}
+	s.db = db
+	if swapErr != nil {
+		return 0, 0, swapErr
+	}
+
+	after, err = fileSize(s.path)
+	return before, after, err
+}
+
+// CheckReport summarizes a database integrity check
+type CheckReport struct {
+	Channels  int
+	Documents int
+	// Errors lists corrupted pages and documents that can't be decoded
+	Errors []string
+}
+
+// Check verifies the page structure of the database and that every
+// document can be read back, in a single read transaction
+func (s *BoltStorage) Check() (CheckReport, error) {
+	var report CheckReport
+	err := s.view(func(tx *bbolt.Tx) error {
+		// Drain the channel so the checking goroutine always finishes
+		for err := range tx.Check() {
+			report.Errors = append(report.Errors, err.Error())
+		}
+		t := s.wrap(tx)
+		return tx.ForEach(func(name []byte, b *bbolt.Bucket) error {
+			if isSystemBucket(name) {
+				return nil
+			}
+			report.Channels++
+			return b.ForEach(func(k, v []byte) error {
+				report.Documents++
+				if v == nil {
+					report.Errors = append(report.Errors, fmt.Sprintf("%s/%s: unexpected nested bucket", name, k))
+				} else if _, err := t.load(string(name), string(k), v); err != nil {
+					report.Errors = append(report.Errors, fmt.Sprintf("%s/%s: %v", name, k, err))
+				}
+				return nil
+			})
+		})
+	})
+	if err != nil {
+		return report, err
+	}
+	err = s.view(func(tx *bbolt.Tx) error {
+		t := s.wrap(tx)
+		return forEachRevisionBucket(tx, func(channel, document string, b *bbolt.Bucket) error {
+			return b.ForEach(func(k, v []byte) error {
+				_, value, err := splitRevision(v)
+				if err == nil {
+					_, err = t.load(channel, document, value)
+				}
+				if err != nil {
+					report.Errors = append(report.Errors, fmt.Sprintf("%s/%s@%d: %v", channel, document, revisionNumber(k), err))
+				}
+				return nil
+			})
+		})
+	})
+	if err != nil {
+		return report, err
+	}
+	err = s.view(func(tx *bbolt.Tx) error {
+		t := s.wrap(tx)
+		return forEachAttachment(tx, func(channel, document, name string, v []byte) error {
+			if _, err := t.loadAttachment(channel, document, name, v); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("%s/%s/_attachments/%s: %v", channel, document, name, err))
+			}
+			return nil
+		})
+	})
+	return report, err
+}
+
 // Close closes the database connection
 func (s *BoltStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	return s.db.Close()
 }
+
+func (s *BoltStorage) open() (*bbolt.DB, error) {
+	return bbolt.Open(s.path, 0600, &bbolt.Options{Timeout: s.timeout})
+}
+
+// view runs fn in a read transaction
+func (s *BoltStorage) view(fn func(tx *bbolt.Tx) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.db.View(fn)
+}
+
+// update runs fn in a read-write transaction
+func (s *BoltStorage) update(fn func(tx *bbolt.Tx) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.db.Update(fn)
+}
+
+func fileSize(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// isSystemBucket reports whether a top-level bucket holds internal data
+// rather than a channel
+func isSystemBucket(name []byte) bool {
+	return len(name) > 0 && name[0] == '.'
+}
+
+// wrap returns a Tx over a bbolt transaction using the storage settings
+func (s *BoltStorage) wrap(tx *bbolt.Tx) boltTx {
+	return boltTx{tx: tx, compressMin: s.compressMin, keys: s.keys}
+}
+
+// boltTx implements Tx on top of a bbolt transaction
+type boltTx struct {
+	tx          *bbolt.Tx
+	compressMin int
+	keys        *Keyring
+}
+
+// load returns a copy of the plain document stored as v
+func (t boltTx) load(channel, document string, v []byte) ([]byte, error) {
+	inner, err := t.keys.open(channel, document, v)
+	if err != nil {
+		return nil, err
+	}
+	return decodeValue(inner)
+}
+
+// store returns the value to store for a document, compressed and
+// encrypted according to the storage settings
+func (t boltTx) store(channel, document string, data []byte) ([]byte, error) {
+	value, err := encodeValue(data, t.compressMin)
+	if err != nil || t.keys == nil {
+		return value, err
+	}
+	if err := t.markEncrypted(); err != nil {
+		return nil, err
+	}
+	return t.keys.seal(channel, document, value)
+}
+
+// markEncrypted records that the database holds encrypted documents
+func (t boltTx) markEncrypted() error {
+	b, err := t.tx.CreateBucketIfNotExists([]byte(encryptionBucket))
+	if err != nil || b.Get(encryptionMarker) != nil {
+		return err
+	}
+	return b.Put(encryptionMarker, []byte("true"))
+}
+
+// GetDocument retrieves a document from a channel
+func (t boltTx) GetDocument(channel, document string) ([]byte, error) {
+	bucket := t.tx.Bucket([]byte(channel))
+	if bucket == nil {
+		return nil, ErrNotFound
+	}
+	v := bucket.Get([]byte(document))
+	if v == nil {
+		return nil, ErrNotFound
+	}
+	// Decoding copies the data, since bbolt values are only valid during the transaction
+	return t.load(channel, document, v)
+}
+
+// PutDocument stores a document in a channel, creating the channel if needed
+func (t boltTx) PutDocument(channel, document string, data []byte) (bool, error) {
+	created, revision := true, 1
+	if bucket := t.tx.Bucket([]byte(channel)); bucket != nil && bucket.Get([]byte(document)) != nil {
+		created, revision = false, t.storedMeta(channel, []byte(document)).revision()+1
+	}
+	return created, t.putVersion(channel, document, data, revision, time.Now().UTC())
+}
+
+// putVersion stores a version of a document with the given revision number
+// and modification time, keeping the version it replaces as a revision.
+// Copying versions oldest first recreates the history of a document from
+// another storage.
+func (t boltTx) putVersion(channel, document string, data []byte, revision int, modified time.Time) error {
+	bucket, err := t.tx.CreateBucketIfNotExists([]byte(channel))
+	if err != nil {
+		return err
+	}
+	value, err := t.store(channel, document, data)
+	if err != nil {
+		return err
+	}
+	if existing := bucket.Get([]byte(document)); existing != nil {
+		// The previous version is kept as stored, without decoding it
+		old := t.storedMeta(channel, []byte(document))
+		if err := t.pushRevision(channel, document, old.revision(), old.Modified, clone(existing)); err != nil {
+			return err
+		}
+	}
+	if err := bucket.Put([]byte(document), value); err != nil {
+		return err
+	}
+	return t.putMeta(channel, document, boltMeta{Modified: modified, Size: len(data), Revision: revision})
+}
+
+// DeleteDocument removes a document from a channel
+func (t boltTx) DeleteDocument(channel, document string) error {
+	bucket := t.tx.Bucket([]byte(channel))
+	if bucket == nil || bucket.Get([]byte(document)) == nil {
+		return ErrNotFound
+	}
+	if err := bucket.Delete([]byte(document)); err != nil {
+		return err
+	}
+	for _, name := range []string{attachmentBucket, revisionBucket} {
+		if all := t.tx.Bucket([]byte(name)); all != nil {
+			if b := all.Bucket([]byte(channel)); b != nil && b.Bucket([]byte(document)) != nil {
+				if err := b.DeleteBucket([]byte(document)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if metas := t.tx.Bucket([]byte(metaBucket)); metas != nil {
+		if b := metas.Bucket([]byte(channel)); b != nil {
+			return b.Delete([]byte(document))
+		}
+	}
+	return nil
+}
+
+// meta returns the metadata of a document with the given plain size.
+// Documents written before metadata was tracked have a zero Modified time.
+func (t boltTx) meta(channel string, document []byte, size int) DocumentMeta {
+	return DocumentMeta{Size: size, Modified: t.storedMeta(channel, document).Modified}
+}
+
+// storedMeta returns the stored metadata of a document, zero if it has none
+func (t boltTx) storedMeta(channel string, document []byte) boltMeta {
+	var stored boltMeta
+	metas := t.tx.Bucket([]byte(metaBucket))
+	if metas == nil {
+		return stored
+	}
+	b := metas.Bucket([]byte(channel))
+	if b == nil {
+		return stored
+	}
+	if v := b.Get(document); v != nil {
+		_ = json.Unmarshal(v, &stored)
+	}
+	return stored
+}
+
+func (t boltTx) putMeta(channel, document string, meta boltMeta) error {
+	metas, err := t.tx.CreateBucketIfNotExists([]byte(metaBucket))
+	if err != nil {
+		return err
+	}
+	b, err := metas.CreateBucketIfNotExists([]byte(channel))
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(document), data)
+}
+
+// revisions returns the bucket holding the previous versions of a
+// document, or nil if it has none
+func (t boltTx) revisions(channel, document string) *bbolt.Bucket {
+	all := t.tx.Bucket([]byte(revisionBucket))
+	if all == nil {
+		return nil
+	}
+	b := all.Bucket([]byte(channel))
+	if b == nil {
+		return nil
+	}
+	return b.Bucket([]byte(document))
+}
+
+// pushRevision keeps the stored value of a previous document version and
+// drops the versions beyond MaxRevisions
+func (t boltTx) pushRevision(channel, document string, revision int, modified time.Time, value []byte) error {
+	all, err := t.tx.CreateBucketIfNotExists([]byte(revisionBucket))
+	if err != nil {
+		return err
+	}
+	docs, err := all.CreateBucketIfNotExists([]byte(channel))
+	if err != nil {
+		return err
+	}
+	b, err := docs.CreateBucketIfNotExists([]byte(document))
+	if err != nil {
+		return err
+	}
+	if err := b.Put(revisionKey(revision), joinRevision(modified, value)); err != nil {
+		return err
+	}
+	c := b.Cursor()
+	for k, _ := c.First(); k != nil && revisionNumber(k) <= revision-MaxRevisions; k, _ = c.First() {
+		if err := c.Delete(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// revisionKey returns the key of a revision, ordered by number
+func revisionKey(revision int) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(revision))
+}
+
+func revisionNumber(key []byte) int {
+	if len(key) != 8 {
+		return 0
+	}
+	return int(binary.BigEndian.Uint64(key))
+}
+
+// joinRevision returns the stored form of a previous version: when it was
+// written, as Unix nanoseconds (8 bytes, big-endian, 0 if unknown),
+// followed by the value as it was stored
+func joinRevision(modified time.Time, value []byte) []byte {
+	var nanos uint64
+	if !modified.IsZero() {
+		nanos = uint64(modified.UnixNano())
+	}
+	v := binary.BigEndian.AppendUint64(make([]byte, 0, 8+len(value)), nanos)
+	return append(v, value...)
+}
+
+// splitRevision parses a stored previous version
+func splitRevision(v []byte) (time.Time, []byte, error) {
+	if len(v) < 8 {
+		return time.Time{}, nil, fmt.Errorf("corrupt revision value")
+	}
+	var modified time.Time
+	if nanos := binary.BigEndian.Uint64(v); nanos != 0 {
+		modified = time.Unix(0, int64(nanos)).UTC()
+	}
+	return modified, v[8:], nil
+}
+
+// forEachRevisionBucket calls fn with the bucket of previous versions of
+// every document that has some
+func forEachRevisionBucket(tx *bbolt.Tx, fn func(channel, document string, b *bbolt.Bucket) error) error {
+	all := tx.Bucket([]byte(revisionBucket))
+	if all == nil {
+		return nil
+	}
+	return all.ForEachBucket(func(channel []byte) error {
+		docs := all.Bucket(channel)
+		return docs.ForEachBucket(func(document []byte) error {
+			return fn(string(channel), string(document), docs.Bucket(document))
+		})
+	})
+}
+
+// attachments returns the bucket holding the attachments of a document,
+// or nil if it has none
+func (t boltTx) attachments(channel, document string) *bbolt.Bucket {
+	all := t.tx.Bucket([]byte(attachmentBucket))
+	if all == nil {
+		return nil
+	}
+	b := all.Bucket([]byte(channel))
+	if b == nil {
+		return nil
+	}
+	return b.Bucket([]byte(document))
+}
+
+// createAttachments returns the bucket holding the attachments of a
+// document, creating it if needed
+func (t boltTx) createAttachments(channel, document string) (*bbolt.Bucket, error) {
+	all, err := t.tx.CreateBucketIfNotExists([]byte(attachmentBucket))
+	if err != nil {
+		return nil, err
+	}
+	b, err := all.CreateBucketIfNotExists([]byte(channel))
+	if err != nil {
+		return nil, err
+	}
+	return b.CreateBucketIfNotExists([]byte(document))
+}
+
+// attachmentMetas returns the metadata of the attachments of a document,
+// sorted by name
+func (t boltTx) attachmentMetas(channel, document string) ([]AttachmentMeta, error) {
+	b := t.attachments(channel, document)
+	if b == nil {
+		return nil, nil
+	}
+	var metas []AttachmentMeta
+	err := b.ForEach(func(k, v []byte) error {
+		stored, _, err := splitAttachment(v)
+		if err != nil {
+			return fmt.Errorf("attachment %s/%s/%s: %w", channel, document, k, err)
+		}
+		metas = append(metas, AttachmentMeta{Name: string(k), ContentType: stored.ContentType, Size: stored.Size, Digest: stored.Digest})
+		return nil
+	})
+	return metas, err
+}
+
+// loadAttachment returns a copy of the attachment stored as v
+func (t boltTx) loadAttachment(channel, document, name string, v []byte) (Attachment, error) {
+	stored, payload, err := splitAttachment(v)
+	if err != nil {
+		return Attachment{}, fmt.Errorf("attachment %s/%s/%s: %w", channel, document, name, err)
+	}
+	data := clone(payload)
+	if stored.Encrypted {
+		if data, err = t.keys.open(channel, document+"/"+name, payload); err != nil {
+			return Attachment{}, err
+		}
+	}
+	return Attachment{
+		AttachmentMeta: AttachmentMeta{Name: name, ContentType: stored.ContentType, Size: stored.Size, Digest: stored.Digest},
+		Data:           data,
+	}, nil
+}
+
+// storeAttachment returns the value to store for an attachment, encrypted
+// according to the storage settings. Attachments are never compressed.
+func (t boltTx) storeAttachment(channel, document string, a Attachment) ([]byte, error) {
+	stored := boltAttachment{ContentType: a.ContentType, Size: a.Size, Digest: a.Digest}
+	payload := a.Data
+	if t.keys != nil {
+		if err := t.markEncrypted(); err != nil {
+			return nil, err
+		}
+		var err error
+		// The name is authenticated too, so content can't be swapped
+		// between attachments
+		if payload, err = t.keys.seal(channel, document+"/"+a.Name, payload); err != nil {
+			return nil, err
+		}
+		stored.Encrypted = true
+	}
+	meta, err := json.Marshal(stored)
+	if err != nil {
+		return nil, err
+	}
+	value := make([]byte, 4, 4+len(meta)+len(payload))
+	binary.BigEndian.PutUint32(value, uint32(len(meta)))
+	value = append(value, meta...)
+	return append(value, payload...), nil
+}
+
+// splitAttachment parses a stored attachment into its metadata and payload
+func splitAttachment(v []byte) (boltAttachment, []byte, error) {
+	var stored boltAttachment
+	if len(v) < 4 || uint64(len(v)-4) < uint64(binary.BigEndian.Uint32(v)) {
+		return stored, nil, fmt.Errorf("corrupt attachment value")
+	}
+	n := 4 + int(binary.BigEndian.Uint32(v))
+	if err := json.Unmarshal(v[4:n], &stored); err != nil {
+		return stored, nil, fmt.Errorf("corrupt attachment metadata: %w", err)
+	}
+	return stored, v[n:], nil
+}
+
+// forEachAttachment calls fn for every stored attachment
+func forEachAttachment(tx *bbolt.Tx, fn func(channel, document, name string, v []byte) error) error {
+	all := tx.Bucket([]byte(attachmentBucket))
+	if all == nil {
+		return nil
+	}
+	return all.ForEachBucket(func(channel []byte) error {
+		docs := all.Bucket(channel)
+		return docs.ForEachBucket(func(document []byte) error {
+			return docs.Bucket(document).ForEach(func(k, v []byte) error {
+				return fn(string(channel), string(document), string(k), v)
+			})
+		})
+	})
+}
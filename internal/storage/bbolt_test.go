@@ -4,6 +4,9 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
+
+	"go.etcd.io/bbolt"
 )
 
 func TestBoltStorage(t *testing.T) {
@@ -429,3 +432,303 @@ func TestListChannels_IncludesDocumentCount(t *testing.T) {
 		t.Errorf("channel2: expected document_count=1, got %d", ch2.DocumentCount)
 	}
 }
+
+// openTestStorage creates a BoltStorage in a temporary directory that is
+// removed when the test finishes
+func openTestStorage(t *testing.T) *BoltStorage {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	storage, err := NewBoltStorage(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := storage.Close(); err != nil {
+			t.Errorf("Failed to close storage: %v", err)
+		}
+	})
+	return storage
+}
+
+func TestSchema_PutGetDelete(t *testing.T) {
+	storage := openTestStorage(t)
+
+	if _, err := storage.GetSchema("users"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound before PutSchema, got %v", err)
+	}
+
+	schema := []byte(`{"type": "object"}`)
+	if err := storage.PutSchema("users", schema); err != nil {
+		t.Fatalf("PutSchema failed: %v", err)
+	}
+
+	got, err := storage.GetSchema("users")
+	if err != nil {
+		t.Fatalf("GetSchema failed: %v", err)
+	}
+	if string(got) != string(schema) {
+		t.Errorf("Got %q, want %q", string(got), string(schema))
+	}
+
+	if err := storage.DeleteSchema("users"); err != nil {
+		t.Fatalf("DeleteSchema failed: %v", err)
+	}
+	if _, err := storage.GetSchema("users"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound after DeleteSchema, got %v", err)
+	}
+	if err := storage.DeleteSchema("users"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound deleting missing schema, got %v", err)
+	}
+}
+
+func TestSchema_NotListedAsChannel(t *testing.T) {
+	storage := openTestStorage(t)
+
+	if err := storage.PutSchema("users", []byte(`{}`)); err != nil {
+		t.Fatalf("PutSchema failed: %v", err)
+	}
+
+	channels, err := storage.ListChannels()
+	if err != nil {
+		t.Fatalf("ListChannels failed: %v", err)
+	}
+	if len(channels) != 0 {
+		t.Errorf("Expected no channels, got %+v", channels)
+	}
+}
+
+func TestDeleteDocument(t *testing.T) {
+	storage := openTestStorage(t)
+
+	if err := storage.DeleteDocument("channel1", "doc1"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound for missing channel, got %v", err)
+	}
+
+	if _, err := storage.PutDocument("channel1", "doc1", []byte(`{}`)); err != nil {
+		t.Fatalf("PutDocument failed: %v", err)
+	}
+	if err := storage.DeleteDocument("channel1", "doc1"); err != nil {
+		t.Fatalf("DeleteDocument failed: %v", err)
+	}
+	if _, err := storage.GetDocument("channel1", "doc1"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound after delete, got %v", err)
+	}
+	if err := storage.DeleteDocument("channel1", "doc1"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound deleting twice, got %v", err)
+	}
+}
+
+func TestBatch_Commit(t *testing.T) {
+	storage := openTestStorage(t)
+
+	if _, err := storage.PutDocument("app", "old", []byte(`{"old": true}`)); err != nil {
+		t.Fatalf("PutDocument failed: %v", err)
+	}
+
+	err := storage.Batch(func(tx Tx) error {
+		if _, err := tx.PutDocument("app", "manifest", []byte(`{"items": 1}`)); err != nil {
+			return err
+		}
+		if _, err := tx.PutDocument("items", "item1", []byte(`{"id": 1}`)); err != nil {
+			return err
+		}
+		// Reads see earlier writes of the same transaction
+		if _, err := tx.GetDocument("items", "item1"); err != nil {
+			return err
+		}
+		return tx.DeleteDocument("app", "old")
+	})
+	if err != nil {
+		t.Fatalf("Batch failed: %v", err)
+	}
+
+	if _, err := storage.GetDocument("app", "manifest"); err != nil {
+		t.Errorf("Expected manifest to be committed, got %v", err)
+	}
+	if _, err := storage.GetDocument("items", "item1"); err != nil {
+		t.Errorf("Expected item1 to be committed, got %v", err)
+	}
+	if _, err := storage.GetDocument("app", "old"); err != ErrNotFound {
+		t.Errorf("Expected old to be deleted, got %v", err)
+	}
+}
+
+func TestBatch_Rollback(t *testing.T) {
+	storage := openTestStorage(t)
+
+	if _, err := storage.PutDocument("app", "manifest", []byte(`{"v": 1}`)); err != nil {
+		t.Fatalf("PutDocument failed: %v", err)
+	}
+
+	err := storage.Batch(func(tx Tx) error {
+		if _, err := tx.PutDocument("app", "manifest", []byte(`{"v": 2}`)); err != nil {
+			return err
+		}
+		if _, err := tx.PutDocument("items", "item1", []byte(`{}`)); err != nil {
+			return err
+		}
+		return tx.DeleteDocument("app", "missing")
+	})
+	if err != ErrNotFound {
+		t.Fatalf("Expected ErrNotFound from batch, got %v", err)
+	}
+
+	data, err := storage.GetDocument("app", "manifest")
+	if err != nil {
+		t.Fatalf("GetDocument failed: %v", err)
+	}
+	if string(data) != `{"v": 1}` {
+		t.Errorf("Expected manifest unchanged, got %q", string(data))
+	}
+	if _, err := storage.ListDocuments("items"); err != ErrNotFound {
+		t.Errorf("Expected items channel not to exist, got %v", err)
+	}
+}
+
+func TestViewDocuments(t *testing.T) {
+	storage := openTestStorage(t)
+
+	if _, err := storage.PutDocument("app", "a", []byte(`{"a": 1}`)); err != nil {
+		t.Fatalf("PutDocument failed: %v", err)
+	}
+	if _, err := storage.PutDocument("app", "c", []byte(`{"c": 3}`)); err != nil {
+		t.Fatalf("PutDocument failed: %v", err)
+	}
+
+	got := map[string]string{}
+	var order []string
+	err := storage.ViewDocuments("app", []string{"c", "b", "a"}, func(name string, data []byte) error {
+		order = append(order, name)
+		if data != nil {
+			got[name] = string(data)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ViewDocuments failed: %v", err)
+	}
+
+	if len(order) != 3 || order[0] != "c" || order[1] != "b" || order[2] != "a" {
+		t.Errorf("Expected documents in request order, got %v", order)
+	}
+	if got["a"] != `{"a": 1}` || got["c"] != `{"c": 3}` {
+		t.Errorf("Unexpected documents: %v", got)
+	}
+	if _, ok := got["b"]; ok {
+		t.Error("Expected nil data for missing document")
+	}
+
+	// Missing channel reports every document as missing
+	err = storage.ViewDocuments("missing", []string{"a"}, func(name string, data []byte) error {
+		if data != nil {
+			t.Errorf("Expected nil data for %s in missing channel", name)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ViewDocuments failed: %v", err)
+	}
+}
+
+func TestForEachDocument(t *testing.T) {
+	storage := openTestStorage(t)
+
+	if err := storage.ForEachDocument("app", "", func(string, []byte, DocumentMeta) error { return nil }); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound for missing channel, got %v", err)
+	}
+
+	before := time.Now().Add(-time.Second)
+	for _, name := range []string{"b", "a", "c"} {
+		if _, err := storage.PutDocument("app", name, []byte(`{"name": "`+name+`"}`)); err != nil {
+			t.Fatalf("PutDocument failed: %v", err)
+		}
+	}
+	if err := storage.DeleteDocument("app", "c"); err != nil {
+		t.Fatalf("DeleteDocument failed: %v", err)
+	}
+
+	var names []string
+	err := storage.ForEachDocument("app", "", func(name string, data []byte, meta DocumentMeta) error {
+		names = append(names, name)
+		if meta.Size != len(data) {
+			t.Errorf("%s: expected size %d, got %d", name, len(data), meta.Size)
+		}
+		if meta.Modified.Before(before) {
+			t.Errorf("%s: expected recent modified time, got %v", name, meta.Modified)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ForEachDocument failed: %v", err)
+	}
+	if len(names) != 2 || names[0] != "a" || names[1] != "b" {
+		t.Errorf("Expected [a b], got %v", names)
+	}
+}
+
+func TestListDocumentMeta_WithoutStoredSize(t *testing.T) {
+	storage := openTestStorage(t)
+	if _, err := storage.PutDocument("app", "doc", []byte(`{"name": "doc"}`)); err != nil {
+		t.Fatalf("PutDocument failed: %v", err)
+	}
+
+	// Documents written by earlier versions have no size in their metadata
+	err := storage.update(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(metaBucket)).Bucket([]byte("app")).Put([]byte("doc"), []byte(`{"modified":"2024-01-02T03:04:05Z"}`))
+	})
+	if err != nil {
+		t.Fatalf("Failed to rewrite metadata: %v", err)
+	}
+
+	infos, err := storage.ListDocumentMeta("app")
+	if err != nil {
+		t.Fatalf("ListDocumentMeta failed: %v", err)
+	}
+	want := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	if len(infos) != 1 || infos[0].Size != len(`{"name": "doc"}`) || !infos[0].Modified.Equal(want) {
+		t.Errorf("Expected size from the document and stored modified time, got %+v", infos)
+	}
+}
+
+func TestBackup(t *testing.T) {
+	storage := openTestStorage(t)
+
+	if _, err := storage.PutDocument("app", "settings", []byte(`{"theme": "dark"}`)); err != nil {
+		t.Fatalf("PutDocument failed: %v", err)
+	}
+
+	snapshot := filepath.Join(t.TempDir(), "snapshot.db")
+	f, err := os.Create(snapshot)
+	if err != nil {
+		t.Fatalf("Failed to create snapshot file: %v", err)
+	}
+	n, err := storage.Backup(f)
+	if err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Failed to close snapshot file: %v", err)
+	}
+	if n == 0 {
+		t.Error("Expected non-empty backup")
+	}
+
+	// Writes after the backup are not part of the snapshot
+	if _, err := storage.PutDocument("app", "later", []byte(`{}`)); err != nil {
+		t.Fatalf("PutDocument failed: %v", err)
+	}
+
+	restored, err := NewBoltStorage(snapshot)
+	if err != nil {
+		t.Fatalf("Failed to open snapshot: %v", err)
+	}
+	defer func() { _ = restored.Close() }()
+
+	data, err := restored.GetDocument("app", "settings")
+	if err != nil || string(data) != `{"theme": "dark"}` {
+		t.Errorf("Expected document in snapshot, got %q (%v)", data, err)
+	}
+	if _, err := restored.GetDocument("app", "later"); err != ErrNotFound {
+		t.Errorf("Expected later document to be missing from snapshot, got %v", err)
+	}
+}
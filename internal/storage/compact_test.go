@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"go.etcd.io/bbolt"
+)
+
+func TestBoltStorage_Compact(t *testing.T) {
+	storage := openTestStorage(t)
+
+	large := []byte(`"` + string(bytes.Repeat([]byte("x"), 1024*1024)) + `"`)
+	for i := 0; i < 8; i++ {
+		if _, err := storage.PutDocument("big", fmt.Sprintf("doc%d", i), large); err != nil {
+			t.Fatalf("PutDocument failed: %v", err)
+		}
+	}
+	for i := 1; i < 8; i++ {
+		if err := storage.DeleteDocument("big", fmt.Sprintf("doc%d", i)); err != nil {
+			t.Fatalf("DeleteDocument failed: %v", err)
+		}
+	}
+	if err := storage.PutSchema("big", []byte(`{"type": "string"}`)); err != nil {
+		t.Fatalf("PutSchema failed: %v", err)
+	}
+
+	before, after, err := storage.Compact()
+	if err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	if after >= before {
+		t.Errorf("Expected file to shrink, got %d -> %d bytes", before, after)
+	}
+
+	// The storage keeps working on the new file
+	data, err := storage.GetDocument("big", "doc0")
+	if err != nil || !bytes.Equal(data, large) {
+		t.Errorf("Expected document to survive compaction (%v)", err)
+	}
+	if _, err := storage.GetSchema("big"); err != nil {
+		t.Errorf("Expected schema to survive compaction: %v", err)
+	}
+	if _, err := storage.PutDocument("big", "new", []byte(`"x"`)); err != nil {
+		t.Errorf("PutDocument after compaction failed: %v", err)
+	}
+}
+
+func TestBoltStorage_Check(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	storage := openEncrypted(t, path, "k1:"+testKey(1))
+	defer func() { _ = storage.Close() }()
+
+	for _, name := range []string{"a", "b"} {
+		if _, err := storage.PutDocument("app", name, []byte(`{"v": 1}`)); err != nil {
+			t.Fatalf("PutDocument failed: %v", err)
+		}
+	}
+
+	report, err := storage.Check()
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if report.Channels != 1 || report.Documents != 2 || len(report.Errors) != 0 {
+		t.Fatalf("Unexpected report %+v", report)
+	}
+
+	// Tamper with an encrypted value
+	err = storage.update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket([]byte("app"))
+		v := append([]byte(nil), b.Get([]byte("b"))...)
+		v[len(v)-1] ^= 0xff
+		return b.Put([]byte("b"), v)
+	})
+	if err != nil {
+		t.Fatalf("Failed to modify value: %v", err)
+	}
+
+	report, err = storage.Check()
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if len(report.Errors) != 1 {
+		t.Errorf("Expected one problem, got %v", report.Errors)
+	}
+}
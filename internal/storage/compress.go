@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Stored values start with a codec byte when compressed. JSON documents
+// never start with a control character, so values written without
+// compression are read as they are.
+const (
+	// codecGzip is followed by the SHA-256 of the plain document and a gzip stream
+	codecGzip byte = 0x01
+)
+
+// gzipHeaderSize is the length of the codec byte and digest before the gzip stream
+const gzipHeaderSize = 1 + sha256.Size
+
+// encodeValue returns the value to store for data, gzip-compressed if it
+// is at least minSize bytes and compression makes it smaller.
+// A minSize of zero disables compression.
+func encodeValue(data []byte, minSize int) ([]byte, error) {
+	if minSize <= 0 || len(data) < minSize {
+		return data, nil
+	}
+	digest := sha256.Sum256(data)
+	var buf bytes.Buffer
+	buf.WriteByte(codecGzip)
+	buf.Write(digest[:])
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	if buf.Len() >= len(data) {
+		return data, nil
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeValue returns a copy of the plain document stored in v
+func decodeValue(v []byte) ([]byte, error) {
+	if len(v) == 0 || v[0] != codecGzip {
+		return clone(v), nil
+	}
+	if len(v) < gzipHeaderSize {
+		return nil, fmt.Errorf("corrupt compressed value")
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(v[gzipHeaderSize:]))
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, 0, valueSize(v))
+	buf := bytes.NewBuffer(data)
+	if _, err := io.Copy(buf, zr); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), zr.Close()
+}
+
+// encodedValue returns a stored value without decoding it
+func encodedValue(v []byte) EncodedDocument {
+	if len(v) < gzipHeaderSize || v[0] != codecGzip {
+		return EncodedDocument{Data: clone(v)}
+	}
+	doc := EncodedDocument{Data: clone(v[gzipHeaderSize:]), Encoding: "gzip"}
+	copy(doc.Digest[:], v[1:gzipHeaderSize])
+	return doc
+}
+
+// valueSize returns the plain document size of a stored value, read from
+// the gzip trailer for compressed values
+func valueSize(v []byte) int {
+	if len(v) < gzipHeaderSize+4 || v[0] != codecGzip {
+		return len(v)
+	}
+	return int(binary.LittleEndian.Uint32(v[len(v)-4:]))
+}
@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEncodeValue(t *testing.T) {
+	large := []byte(`{"text": "` + strings.Repeat("abc", 1000) + `"}`)
+
+	tests := []struct {
+		name       string
+		data       []byte
+		minSize    int
+		compressed bool
+	}{
+		{"disabled", large, 0, false},
+		{"below threshold", large, len(large) + 1, false},
+		{"at threshold", large, len(large), true},
+		{"incompressible", []byte(`{}`), 1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := encodeValue(tt.data, tt.minSize)
+			if err != nil {
+				t.Fatalf("encodeValue failed: %v", err)
+			}
+			if compressed := v[0] == codecGzip; compressed != tt.compressed {
+				t.Errorf("Expected compressed=%v, got %v", tt.compressed, compressed)
+			}
+			if valueSize(v) != len(tt.data) {
+				t.Errorf("valueSize = %d, want %d", valueSize(v), len(tt.data))
+			}
+			data, err := decodeValue(v)
+			if err != nil {
+				t.Fatalf("decodeValue failed: %v", err)
+			}
+			if !bytes.Equal(data, tt.data) {
+				t.Errorf("Round trip changed the document")
+			}
+		})
+	}
+}
+
+func TestBoltStorage_CompressionToggle(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	large := []byte(`{"text": "` + strings.Repeat("abc", 1000) + `"}`)
+
+	// Written without compression
+	storage, err := NewBoltStorage(path)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	if _, err := storage.PutDocument("app", "plain", large); err != nil {
+		t.Fatalf("PutDocument failed: %v", err)
+	}
+	_ = storage.Close()
+
+	storage, err = NewBoltStorage(path, WithCompression(1024))
+	if err != nil {
+		t.Fatalf("Failed to reopen storage: %v", err)
+	}
+	defer func() { _ = storage.Close() }()
+	if _, err := storage.PutDocument("app", "packed", large); err != nil {
+		t.Fatalf("PutDocument failed: %v", err)
+	}
+
+	for _, name := range []string{"plain", "packed"} {
+		data, err := storage.GetDocument("app", name)
+		if err != nil || !bytes.Equal(data, large) {
+			t.Errorf("%s: unexpected document (%v)", name, err)
+		}
+	}
+
+	plain, err := storage.GetDocumentEncoded("app", "plain")
+	if err != nil || plain.Encoding != "" || !bytes.Equal(plain.Data, large) {
+		t.Errorf("Expected legacy document unencoded, got %q (%v)", plain.Encoding, err)
+	}
+
+	packed, err := storage.GetDocumentEncoded("app", "packed")
+	if err != nil || packed.Encoding != "gzip" {
+		t.Fatalf("Expected gzip document, got %q (%v)", packed.Encoding, err)
+	}
+	if packed.Digest != sha256.Sum256(large) {
+		t.Error("Digest does not match the plain document")
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(packed.Data))
+	if err != nil {
+		t.Fatalf("Invalid gzip stream: %v", err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil || !bytes.Equal(data, large) {
+		t.Errorf("Gzip stream does not decode to the document (%v)", err)
+	}
+}
@@ -0,0 +1,70 @@
+package storage_test
+
+import (
+	"encoding/base64"
+	"path/filepath"
+	"testing"
+
+	"github.com/rashpile/pako-justdoc/internal/storage"
+	"github.com/rashpile/pako-justdoc/internal/storage/storagetest"
+)
+
+func TestBoltStorage_Conformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		s, err := storage.NewBoltStorage(filepath.Join(t.TempDir(), "test.db"))
+		if err != nil {
+			t.Fatalf("Failed to create storage: %v", err)
+		}
+		return s
+	})
+}
+
+func TestMemoryStorage_Conformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		return storage.NewMemoryStorage()
+	})
+}
+
+func TestFileStorage_Conformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		s, err := storage.NewFileStorage(t.TempDir())
+		if err != nil {
+			t.Fatalf("Failed to create storage: %v", err)
+		}
+		return s
+	})
+}
+
+func TestSQLiteStorage_Conformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		s, err := storage.NewSQLiteStorage(filepath.Join(t.TempDir(), "test.sqlite"))
+		if err != nil {
+			t.Fatalf("Failed to create storage: %v", err)
+		}
+		return s
+	})
+}
+
+func TestBoltStorage_Compressed_Conformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		s, err := storage.NewBoltStorage(filepath.Join(t.TempDir(), "test.db"), storage.WithCompression(1))
+		if err != nil {
+			t.Fatalf("Failed to create storage: %v", err)
+		}
+		return s
+	})
+}
+
+func TestBoltStorage_Encrypted_Conformance(t *testing.T) {
+	keys, err := storage.ParseKeyring("k1:" + base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	if err != nil {
+		t.Fatalf("ParseKeyring failed: %v", err)
+	}
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		s, err := storage.NewBoltStorage(filepath.Join(t.TempDir(), "test.db"), storage.WithEncryption(keys), storage.WithCompression(1))
+		if err != nil {
+			t.Fatalf("Failed to create storage: %v", err)
+		}
+		return s
+	})
+}
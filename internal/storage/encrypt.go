@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// codecAESGCM marks a value encrypted with AES-256-GCM. It is followed by
+// the key ID length, the key ID, the nonce and the sealed inner value,
+// which is itself a plain or compressed value.
+const codecAESGCM byte = 0x02
+
+// ErrEncryptionDisabled is returned by Reencrypt when no keyring is configured
+var ErrEncryptionDisabled = errors.New("encryption is not configured")
+
+// ErrEncryptionKeyRequired is returned when opening a database that
+// contains encrypted documents without a keyring
+var ErrEncryptionKeyRequired = errors.New("database contains encrypted documents but no encryption key is configured")
+
+// Keyring holds the AES-256 keys used to encrypt documents. The first key
+// encrypts new values; the others are kept to read values written before
+// a rotation.
+type Keyring struct {
+	ids   []string
+	aeads map[string]cipher.AEAD
+}
+
+// ParseKeyring parses keys in the form "id:base64key", separated by commas
+// or newlines. Blank lines and lines starting with # are ignored. Each key
+// must decode to 32 bytes.
+func ParseKeyring(spec string) (*Keyring, error) {
+	k := &Keyring{aeads: make(map[string]cipher.AEAD)}
+	for _, line := range strings.Split(spec, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		for _, entry := range strings.Split(line, ",") {
+			if err := k.add(strings.TrimSpace(entry)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(k.ids) == 0 {
+		return nil, errors.New("no encryption keys given")
+	}
+	return k, nil
+}
+
+func (k *Keyring) add(entry string) error {
+	id, encoded, ok := strings.Cut(entry, ":")
+	if !ok || id == "" || len(id) > 255 {
+		return fmt.Errorf("encryption key must be given as id:base64key")
+	}
+	if _, dup := k.aeads[id]; dup {
+		return fmt.Errorf("duplicate encryption key id %q", id)
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return fmt.Errorf("encryption key %q: %w", id, err)
+	}
+	if len(key) != 32 {
+		return fmt.Errorf("encryption key %q must be 32 bytes, got %d", id, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+	k.ids = append(k.ids, id)
+	k.aeads[id] = aead
+	return nil
+}
+
+// Current returns the ID of the key used for new values
+func (k *Keyring) Current() string {
+	return k.ids[0]
+}
+
+// seal encrypts value with the current key. The channel and document are
+// authenticated, so a value cannot be moved to another document.
+func (k *Keyring) seal(channel, document string, value []byte) ([]byte, error) {
+	id := k.Current()
+	aead := k.aeads[id]
+
+	out := make([]byte, 0, 2+len(id)+aead.NonceSize()+len(value)+aead.Overhead())
+	out = append(out, codecAESGCM, byte(len(id)))
+	out = append(out, id...)
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out = append(out, nonce...)
+	return aead.Seal(out, nonce, value, additionalData(channel, document)), nil
+}
+
+// open decrypts an encrypted value; other values are returned as they are
+func (k *Keyring) open(channel, document string, v []byte) ([]byte, error) {
+	if len(v) == 0 || v[0] != codecAESGCM {
+		return v, nil
+	}
+	id, rest, err := splitKeyID(v)
+	if err != nil {
+		return nil, err
+	}
+	if k == nil {
+		return nil, ErrEncryptionKeyRequired
+	}
+	aead, ok := k.aeads[id]
+	if !ok {
+		return nil, fmt.Errorf("document %s/%s is encrypted with unknown key %q", channel, document, id)
+	}
+	if len(rest) < aead.NonceSize() {
+		return nil, errors.New("corrupt encrypted value")
+	}
+	nonce, sealed := rest[:aead.NonceSize()], rest[aead.NonceSize():]
+	value, err := aead.Open(nil, nonce, sealed, additionalData(channel, document))
+	if err != nil {
+		return nil, fmt.Errorf("document %s/%s: %w", channel, document, err)
+	}
+	return value, nil
+}
+
+// keyID returns the ID of the key a value is encrypted with, or "" if it
+// is not encrypted
+func keyID(v []byte) string {
+	if len(v) == 0 || v[0] != codecAESGCM {
+		return ""
+	}
+	id, _, _ := splitKeyID(v)
+	return id
+}
+
+func splitKeyID(v []byte) (string, []byte, error) {
+	if len(v) < 2 || len(v) < 2+int(v[1]) {
+		return "", nil, errors.New("corrupt encrypted value")
+	}
+	n := int(v[1])
+	return string(v[2 : 2+n]), v[2+n:], nil
+}
+
+func additionalData(channel, document string) []byte {
+	return []byte(channel + "/" + document)
+}
@@ -0,0 +1,241 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/base64"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.etcd.io/bbolt"
+)
+
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, 32))
+}
+
+func TestParseKeyring(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		current string
+		wantErr bool
+	}{
+		{"single", "k1:" + testKey(1), "k1", false},
+		{"comma separated", "k2:" + testKey(2) + ", k1:" + testKey(1), "k2", false},
+		{"key file", "# rotated 2025-01-01\nk2:" + testKey(2) + "\n\nk1:" + testKey(1) + "\n", "k2", false},
+		{"empty", " \n# nothing\n", "", true},
+		{"missing id", testKey(1), "", true},
+		{"short key", "k1:" + base64.StdEncoding.EncodeToString([]byte("short")), "", true},
+		{"bad base64", "k1:not-base64!", "", true},
+		{"duplicate id", "k1:" + testKey(1) + ",k1:" + testKey(2), "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := ParseKeyring(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseKeyring error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && keys.Current() != tt.current {
+				t.Errorf("Current = %q, want %q", keys.Current(), tt.current)
+			}
+		})
+	}
+}
+
+func openEncrypted(t *testing.T, path, spec string) *BoltStorage {
+	t.Helper()
+	keys, err := ParseKeyring(spec)
+	if err != nil {
+		t.Fatalf("ParseKeyring failed: %v", err)
+	}
+	storage, err := NewBoltStorage(path, WithEncryption(keys), WithCompression(1))
+	if err != nil {
+		t.Fatalf("Failed to open storage: %v", err)
+	}
+	return storage
+}
+
+func TestBoltStorage_Encryption(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	secret := `{"ssn": "123-45-6789"}`
+
+	storage := openEncrypted(t, path, "k1:"+testKey(1))
+	if _, err := storage.PutDocument("people", "alice", []byte(secret)); err != nil {
+		t.Fatalf("PutDocument failed: %v", err)
+	}
+	data, err := storage.GetDocument("people", "alice")
+	if err != nil || string(data) != secret {
+		t.Fatalf("Expected decrypted document, got %q (%v)", data, err)
+	}
+	_ = storage.Close()
+
+	// The value is not stored in the clear
+	db, err := bbolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	_ = db.View(func(tx *bbolt.Tx) error {
+		v := tx.Bucket([]byte("people")).Get([]byte("alice"))
+		if v[0] != codecAESGCM || bytes.Contains(v, []byte("123-45-6789")) {
+			t.Errorf("Expected encrypted value, got %q", v)
+		}
+		return nil
+	})
+	_ = db.Close()
+
+	// Refuses to open without a key
+	if _, err := NewBoltStorage(path); err != ErrEncryptionKeyRequired {
+		t.Errorf("Expected ErrEncryptionKeyRequired, got %v", err)
+	}
+
+	// A wrong key is reported on read
+	storage = openEncrypted(t, path, "k2:"+testKey(2))
+	if _, err := storage.GetDocument("people", "alice"); err == nil || !strings.Contains(err.Error(), `unknown key "k1"`) {
+		t.Errorf("Expected unknown key error, got %v", err)
+	}
+	_ = storage.Close()
+}
+
+func TestBoltStorage_Reencrypt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+
+	// Documents written in plain form and with the old key
+	plain, err := NewBoltStorage(path)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	if _, err := plain.PutDocument("app", "plain", []byte(`{"v": 0}`)); err != nil {
+		t.Fatalf("PutDocument failed: %v", err)
+	}
+	_ = plain.Close()
+
+	storage := openEncrypted(t, path, "k1:"+testKey(1))
+	for _, name := range []string{"a", "b"} {
+		if _, err := storage.PutDocument("app", name, []byte(`{"v": 1}`)); err != nil {
+			t.Fatalf("PutDocument failed: %v", err)
+		}
+	}
+	_ = storage.Close()
+
+	// Rotate: new key first, old key kept for reading
+	storage = openEncrypted(t, path, "k2:"+testKey(2)+",k1:"+testKey(1))
+	if _, err := storage.PutDocument("app", "c", []byte(`{"v": 2}`)); err != nil {
+		t.Fatalf("PutDocument failed: %v", err)
+	}
+	n, err := storage.Reencrypt()
+	if err != nil {
+		t.Fatalf("Reencrypt failed: %v", err)
+	}
+	if n != 3 {
+		t.Errorf("Expected 3 documents rewritten, got %d", n)
+	}
+	if n, _ := storage.Reencrypt(); n != 0 {
+		t.Errorf("Expected nothing left to rewrite, got %d", n)
+	}
+	_ = storage.Close()
+
+	// The old key is no longer needed
+	storage = openEncrypted(t, path, "k2:"+testKey(2))
+	defer func() { _ = storage.Close() }()
+	for name, want := range map[string]string{"plain": `{"v": 0}`, "a": `{"v": 1}`, "b": `{"v": 1}`, "c": `{"v": 2}`} {
+		data, err := storage.GetDocument("app", name)
+		if err != nil || string(data) != want {
+			t.Errorf("%s: got %q (%v), want %q", name, data, err, want)
+		}
+	}
+}
+
+func TestBoltStorage_ReencryptDisabled(t *testing.T) {
+	storage := openTestStorage(t)
+	if _, err := storage.Reencrypt(); err != ErrEncryptionDisabled {
+		t.Errorf("Expected ErrEncryptionDisabled, got %v", err)
+	}
+}
+
+func TestBoltStorage_EncryptedAttachments(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	secret := []byte("scan of 123-45-6789")
+
+	storage := openEncrypted(t, path, "k1:"+testKey(1))
+	if _, err := storage.PutDocument("people", "alice", []byte(`{}`)); err != nil {
+		t.Fatalf("PutDocument failed: %v", err)
+	}
+	if _, err := storage.PutAttachment("people", "alice", "id.txt", "text/plain", secret); err != nil {
+		t.Fatalf("PutAttachment failed: %v", err)
+	}
+	_ = storage.Close()
+
+	db, err := bbolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	_ = db.View(func(tx *bbolt.Tx) error {
+		v := tx.Bucket([]byte(attachmentBucket)).Bucket([]byte("people")).Bucket([]byte("alice")).Get([]byte("id.txt"))
+		if bytes.Contains(v, []byte("123-45-6789")) {
+			t.Errorf("Expected encrypted attachment, got %q", v)
+		}
+		return nil
+	})
+	_ = db.Close()
+
+	// Rotating the key rewrites attachments too
+	storage = openEncrypted(t, path, "k2:"+testKey(2)+",k1:"+testKey(1))
+	if _, err := storage.Reencrypt(); err != nil {
+		t.Fatalf("Reencrypt failed: %v", err)
+	}
+	_ = storage.Close()
+
+	storage = openEncrypted(t, path, "k2:"+testKey(2))
+	defer func() { _ = storage.Close() }()
+	a, err := storage.GetAttachment("people", "alice", "id.txt")
+	if err != nil || !bytes.Equal(a.Data, secret) {
+		t.Errorf("Expected decrypted attachment, got %q (%v)", a.Data, err)
+	}
+	if report, err := storage.Check(); err != nil || len(report.Errors) != 0 {
+		t.Errorf("Expected a clean check, got %v (%v)", report.Errors, err)
+	}
+}
+
+func TestBoltStorage_EncryptedRevisions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+
+	storage := openEncrypted(t, path, "k1:"+testKey(1))
+	for _, data := range []string{`{"ssn":"123-45-6789"}`, `{}`} {
+		if _, err := storage.PutDocument("people", "alice", []byte(data)); err != nil {
+			t.Fatalf("PutDocument failed: %v", err)
+		}
+	}
+	_ = storage.Close()
+
+	db, err := bbolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	_ = db.View(func(tx *bbolt.Tx) error {
+		v := tx.Bucket([]byte(revisionBucket)).Bucket([]byte("people")).Bucket([]byte("alice")).Get(revisionKey(1))
+		if v == nil || bytes.Contains(v, []byte("123-45-6789")) {
+			t.Errorf("Expected encrypted revision, got %q", v)
+		}
+		return nil
+	})
+	_ = db.Close()
+
+	// Rotating the key rewrites previous versions too
+	storage = openEncrypted(t, path, "k2:"+testKey(2)+",k1:"+testKey(1))
+	if _, err := storage.Reencrypt(); err != nil {
+		t.Fatalf("Reencrypt failed: %v", err)
+	}
+	_ = storage.Close()
+
+	storage = openEncrypted(t, path, "k2:"+testKey(2))
+	defer func() { _ = storage.Close() }()
+	data, err := storage.GetRevision("people", "alice", 1)
+	if err != nil || string(data) != `{"ssn":"123-45-6789"}` {
+		t.Errorf("Expected decrypted revision, got %q (%v)", data, err)
+	}
+	if report, err := storage.Check(); err != nil || len(report.Errors) != 0 {
+		t.Errorf("Expected a clean check, got %v (%v)", report.Errors, err)
+	}
+}
@@ -0,0 +1,794 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// fileExt is the extension of document files
+	fileExt = ".json"
+	// fileSchemaDir holds channel schemas as <channel>.json
+	fileSchemaDir = ".schemas"
+	// fileSettingsDir holds channel settings as <channel>.json
+	fileSettingsDir = ".settings"
+	// fileLockName is the lock file guarding the root against other processes
+	fileLockName = ".lock"
+	// fileAttachmentDir holds the attachments of each document as
+	// <channel>/<document>/<name>, with their metadata in <channel>/<document>.json
+	fileAttachmentDir = ".attachments"
+	// fileRevisionDir holds the previous versions of each document as
+	// <channel>/<document>/<revision>.json, modified when the version was
+	// written; the current version is one past the highest kept revision
+	fileRevisionDir = ".revisions"
+)
+
+// fileAttachment is the stored form of attachment metadata
+type fileAttachment struct {
+	ContentType string `json:"content_type"`
+	Digest      string `json:"digest"`
+}
+
+// FileStorage implements Storage as a directory tree of plain JSON files,
+// one <root>/<channel>/<document>.json per document. Channel and document
+// names never contain dots or slashes, so entries starting with a dot are
+// internal. Names differing only in case collide on case-insensitive
+// filesystems.
+//
+// Each write goes to a temporary file that is synced and renamed into
+// place, so readers see either the old or the new document. A Batch is
+// staged in memory and applied once fn succeeds; a crash while applying
+// it may leave only some of its writes on disk.
+type FileStorage struct {
+	root string
+	mu   sync.RWMutex
+	lock *os.File
+}
+
+// NewFileStorage opens a file storage rooted at dir, creating it if needed.
+// The directory is locked so that only one process writes to it at a time.
+func NewFileStorage(dir string) (*FileStorage, error) {
+	for _, sub := range []string{fileSchemaDir, fileSettingsDir} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0700); err != nil {
+			return nil, err
+		}
+	}
+	lock, err := lockDir(filepath.Join(dir, fileLockName))
+	if err != nil {
+		return nil, err
+	}
+	return &FileStorage{root: dir, lock: lock}, nil
+}
+
+// GetDocument retrieves a document from a channel
+func (s *FileStorage) GetDocument(channel, document string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.tx().GetDocument(channel, document)
+}
+
+// PutDocument stores a document in a channel
+func (s *FileStorage) PutDocument(channel, document string, data []byte) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tx().PutDocument(channel, document, data)
+}
+
+// DeleteDocument removes a document from a channel
+func (s *FileStorage) DeleteDocument(channel, document string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tx().DeleteDocument(channel, document)
+}
+
+// Batch runs fn with exclusive access, writing its changes only if it succeeds
+func (s *FileStorage) Batch(fn func(tx Tx) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx := &fileTx{s: s, writes: make(map[string]map[string][]byte), dropped: make(map[string]map[string]bool)}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	// Attachments and revisions of deleted documents go first, so a
+	// document deleted and written again in the same batch starts without them
+	for _, channel := range sortedKeys(tx.dropped) {
+		for _, name := range sortedKeys(tx.dropped[channel]) {
+			if err := s.removeAttachments(channel, name); err != nil {
+				return err
+			}
+			if err := s.removeRevisions(channel, name); err != nil {
+				return err
+			}
+		}
+	}
+	for _, channel := range sortedKeys(tx.writes) {
+		docs := tx.writes[channel]
+		for _, name := range sortedKeys(docs) {
+			var err error
+			switch data := docs[name]; {
+			case data == nil:
+				err = s.remove(channel, name)
+			case tx.dropped[channel][name]:
+				err = s.write(channel, name, data)
+			default:
+				err = s.update(channel, name, data)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ListRevisions returns the current and kept previous versions of a document
+func (s *FileStorage) ListRevisions(channel, document string) ([]RevisionMeta, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	info, err := os.Stat(s.documentPath(channel, document))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	kept, err := s.listRevisions(channel, document)
+	if err != nil {
+		return nil, err
+	}
+	current := 1
+	if len(kept) > 0 {
+		current = kept[len(kept)-1] + 1
+	}
+	revisions := []RevisionMeta{{Revision: current, Modified: info.ModTime().UTC()}}
+	for i := len(kept) - 1; i >= 0; i-- {
+		info, err := os.Stat(s.revisionPath(channel, document, kept[i]))
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, RevisionMeta{Revision: kept[i], Modified: info.ModTime().UTC()})
+	}
+	return revisions, nil
+}
+
+// GetRevision retrieves a version of a document by revision number
+func (s *FileStorage) GetRevision(channel, document string, revision int) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	data, err := s.read(channel, document)
+	if err != nil {
+		return nil, err
+	}
+	kept, err := s.listRevisions(channel, document)
+	if err != nil {
+		return nil, err
+	}
+	if len(kept) == 0 && revision == 1 || len(kept) > 0 && revision == kept[len(kept)-1]+1 {
+		return data, nil
+	}
+	if revision < 1 {
+		return nil, ErrNotFound
+	}
+	return readFile(s.revisionPath(channel, document, revision))
+}
+
+// GetAttachment retrieves a binary attachment of a document
+func (s *FileStorage) GetAttachment(channel, document, name string) (Attachment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	index, err := s.readAttachments(channel, document)
+	if err != nil {
+		return Attachment{}, err
+	}
+	stored, ok := index[name]
+	if !ok {
+		return Attachment{}, ErrNotFound
+	}
+	data, err := readFile(s.attachmentPath(channel, document, name))
+	if err != nil {
+		return Attachment{}, err
+	}
+	return Attachment{
+		AttachmentMeta: AttachmentMeta{Name: name, ContentType: stored.ContentType, Size: len(data), Digest: stored.Digest},
+		Data:           data,
+	}, nil
+}
+
+// PutAttachment stores a binary attachment of a document. The content is
+// written before the metadata, so a crash in between leaves the previous
+// metadata or an unlisted file.
+func (s *FileStorage) PutAttachment(channel, document, name, contentType string, data []byte) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.read(channel, document); err != nil {
+		return false, err
+	}
+	index, err := s.readAttachments(channel, document)
+	if err != nil {
+		return false, err
+	}
+	_, exists := index[name]
+
+	a := NewAttachment(name, contentType, data)
+	if err := os.MkdirAll(s.attachmentDir(channel, document), 0700); err != nil {
+		return false, err
+	}
+	if err := writeFileAtomic(s.attachmentPath(channel, document, name), data); err != nil {
+		return false, err
+	}
+	index[name] = fileAttachment{ContentType: a.ContentType, Digest: a.Digest}
+	return !exists, s.writeAttachments(channel, document, index)
+}
+
+// ListAttachments returns the metadata of the attachments of a document
+func (s *FileStorage) ListAttachments(channel, document string) ([]AttachmentMeta, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, err := os.Stat(s.documentPath(channel, document)); errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	metas, err := s.attachmentMetas(channel, document)
+	if err != nil {
+		return nil, err
+	}
+	if metas == nil {
+		metas = make([]AttachmentMeta, 0)
+	}
+	return metas, nil
+}
+
+// DeleteAttachment removes a binary attachment of a document
+func (s *FileStorage) DeleteAttachment(channel, document, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index, err := s.readAttachments(channel, document)
+	if err != nil {
+		return err
+	}
+	if _, ok := index[name]; !ok {
+		return ErrNotFound
+	}
+	delete(index, name)
+	if err := s.writeAttachments(channel, document, index); err != nil {
+		return err
+	}
+	if err := removeFile(s.attachmentPath(channel, document, name)); err != nil && err != ErrNotFound {
+		return err
+	}
+	return nil
+}
+
+// ViewDocuments calls fn for each named document while holding a read lock
+func (s *FileStorage) ViewDocuments(channel string, names []string, fn func(name string, data []byte) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, name := range names {
+		data, err := s.read(channel, name)
+		if err != nil && err != ErrNotFound {
+			return err
+		}
+		if err := fn(name, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ForEachDocument calls fn for every document in a channel while holding a read lock
+func (s *FileStorage) ForEachDocument(channel, after string, fn func(name string, data []byte, meta DocumentMeta) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	names, err := s.listDocuments(channel)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if name <= after {
+			continue
+		}
+		path := s.documentPath(channel, name)
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		meta := DocumentMeta{Size: len(data), Modified: info.ModTime().UTC()}
+		if meta.Attachments, err = s.attachmentMetas(channel, name); err != nil {
+			return err
+		}
+		if err := fn(name, data, meta); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListDocuments returns all document names in a channel (sorted alphabetically)
+func (s *FileStorage) ListDocuments(channel string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.listDocuments(channel)
+}
+
+// ListDocumentMeta returns the names and metadata of all documents in a
+// channel from the file system, without reading the files
+func (s *FileStorage) ListDocumentMeta(channel string) ([]DocumentInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	names, err := s.listDocuments(channel)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]DocumentInfo, 0, len(names))
+	for _, name := range names {
+		stat, err := os.Stat(s.documentPath(channel, name))
+		if err != nil {
+			return nil, err
+		}
+		info := DocumentInfo{Name: name, DocumentMeta: DocumentMeta{Size: int(stat.Size()), Modified: stat.ModTime().UTC()}}
+		if info.Attachments, err = s.attachmentMetas(channel, name); err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// ListChannels returns all channels with document counts (sorted alphabetically)
+func (s *FileStorage) ListChannels() ([]ChannelInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries, err := os.ReadDir(s.root)
+	if err != nil {
+		return nil, err
+	}
+	channels := make([]ChannelInfo, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() || isInternalFile(entry.Name()) {
+			continue
+		}
+		docs, err := s.listDocuments(entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		channels = append(channels, ChannelInfo{
+			Name:          entry.Name(),
+			DocumentCount: len(docs),
+		})
+	}
+	return channels, nil
+}
+
+// GetSchema retrieves the JSON Schema attached to a channel
+func (s *FileStorage) GetSchema(channel string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return readFile(s.schemaPath(channel))
+}
+
+// PutSchema attaches a JSON Schema to a channel
+func (s *FileStorage) PutSchema(channel string, schema []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return writeFileAtomic(s.schemaPath(channel), schema)
+}
+
+// DeleteSchema removes the JSON Schema attached to a channel
+func (s *FileStorage) DeleteSchema(channel string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return removeFile(s.schemaPath(channel))
+}
+
+// GetSettings retrieves the settings stored for a channel
+func (s *FileStorage) GetSettings(channel string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return readFile(s.settingsPath(channel))
+}
+
+// PutSettings stores the settings of a channel
+func (s *FileStorage) PutSettings(channel string, settings []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return writeFileAtomic(s.settingsPath(channel), settings)
+}
+
+// DeleteSettings removes the settings stored for a channel
+func (s *FileStorage) DeleteSettings(channel string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return removeFile(s.settingsPath(channel))
+}
+
+// Close releases the directory lock
+func (s *FileStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.lock == nil {
+		return nil
+	}
+	err := unlockDir(s.lock)
+	s.lock = nil
+	return err
+}
+
+func (s *FileStorage) channelPath(channel string) string {
+	return filepath.Join(s.root, channel)
+}
+
+func (s *FileStorage) documentPath(channel, document string) string {
+	return filepath.Join(s.root, channel, document+fileExt)
+}
+
+func (s *FileStorage) schemaPath(channel string) string {
+	return filepath.Join(s.root, fileSchemaDir, channel+fileExt)
+}
+
+func (s *FileStorage) settingsPath(channel string) string {
+	return filepath.Join(s.root, fileSettingsDir, channel+fileExt)
+}
+
+func (s *FileStorage) read(channel, document string) ([]byte, error) {
+	return readFile(s.documentPath(channel, document))
+}
+
+// write stores a document, creating the channel directory if needed
+func (s *FileStorage) write(channel, document string, data []byte) error {
+	if err := os.MkdirAll(s.channelPath(channel), 0700); err != nil {
+		return err
+	}
+	return writeFileAtomic(s.documentPath(channel, document), data)
+}
+
+// update stores a document, keeping the version it replaces as a revision
+func (s *FileStorage) update(channel, document string, data []byte) error {
+	if err := s.pushRevision(channel, document); err != nil {
+		return err
+	}
+	return s.write(channel, document, data)
+}
+
+func (s *FileStorage) remove(channel, document string) error {
+	return removeFile(s.documentPath(channel, document))
+}
+
+func (s *FileStorage) revisionDir(channel, document string) string {
+	return filepath.Join(s.root, fileRevisionDir, channel, document)
+}
+
+func (s *FileStorage) revisionPath(channel, document string, revision int) string {
+	return filepath.Join(s.revisionDir(channel, document), strconv.Itoa(revision)+fileExt)
+}
+
+// listRevisions returns the kept previous revision numbers of a document
+// in ascending order
+func (s *FileStorage) listRevisions(channel, document string) ([]int, error) {
+	entries, err := os.ReadDir(s.revisionDir(channel, document))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var revisions []int
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || isInternalFile(name) || !strings.HasSuffix(name, fileExt) {
+			continue
+		}
+		if n, err := strconv.Atoi(strings.TrimSuffix(name, fileExt)); err == nil && n > 0 {
+			revisions = append(revisions, n)
+		}
+	}
+	sort.Ints(revisions)
+	return revisions, nil
+}
+
+// pushRevision copies the current version of a document into its
+// revisions, keeping its modification time, and drops the versions beyond
+// MaxRevisions. Leftover revisions of a document that doesn't exist are
+// removed, so a new document starts at revision 1.
+func (s *FileStorage) pushRevision(channel, document string) error {
+	path := s.documentPath(channel, document)
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s.removeRevisions(channel, document)
+	}
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	kept, err := s.listRevisions(channel, document)
+	if err != nil {
+		return err
+	}
+	revision := 1
+	if len(kept) > 0 {
+		revision = kept[len(kept)-1] + 1
+	}
+	if err := os.MkdirAll(s.revisionDir(channel, document), 0700); err != nil {
+		return err
+	}
+	target := s.revisionPath(channel, document, revision)
+	if err := writeFileAtomic(target, data); err != nil {
+		return err
+	}
+	if err := os.Chtimes(target, info.ModTime(), info.ModTime()); err != nil {
+		return err
+	}
+	for _, n := range kept {
+		if n > revision-MaxRevisions {
+			break
+		}
+		if err := removeFile(s.revisionPath(channel, document, n)); err != nil && err != ErrNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeRevisions removes all previous versions of a document, if it has any
+func (s *FileStorage) removeRevisions(channel, document string) error {
+	return os.RemoveAll(s.revisionDir(channel, document))
+}
+
+func (s *FileStorage) attachmentDir(channel, document string) string {
+	return filepath.Join(s.root, fileAttachmentDir, channel, document)
+}
+
+func (s *FileStorage) attachmentPath(channel, document, name string) string {
+	return filepath.Join(s.attachmentDir(channel, document), name)
+}
+
+func (s *FileStorage) attachmentIndexPath(channel, document string) string {
+	return filepath.Join(s.root, fileAttachmentDir, channel, document+fileExt)
+}
+
+// readAttachments returns the attachment metadata of a document by name,
+// or ErrNotFound if the document doesn't exist
+func (s *FileStorage) readAttachments(channel, document string) (map[string]fileAttachment, error) {
+	if _, err := os.Stat(s.documentPath(channel, document)); errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	index := make(map[string]fileAttachment)
+	data, err := readFile(s.attachmentIndexPath(channel, document))
+	if err == ErrNotFound {
+		return index, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return index, json.Unmarshal(data, &index)
+}
+
+// writeAttachments replaces the attachment metadata of a document
+func (s *FileStorage) writeAttachments(channel, document string, index map[string]fileAttachment) error {
+	if len(index) == 0 {
+		return s.removeAttachments(channel, document)
+	}
+	data, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.attachmentIndexPath(channel, document)), 0700); err != nil {
+		return err
+	}
+	return writeFileAtomic(s.attachmentIndexPath(channel, document), data)
+}
+
+// attachmentMetas returns the metadata of the attachments of a document,
+// sorted by name
+func (s *FileStorage) attachmentMetas(channel, document string) ([]AttachmentMeta, error) {
+	index, err := s.readAttachments(channel, document)
+	if err != nil {
+		return nil, err
+	}
+	var metas []AttachmentMeta
+	for _, name := range sortedKeys(index) {
+		info, err := os.Stat(s.attachmentPath(channel, document, name))
+		if err != nil {
+			return nil, err
+		}
+		metas = append(metas, AttachmentMeta{Name: name, ContentType: index[name].ContentType, Size: int(info.Size()), Digest: index[name].Digest})
+	}
+	return metas, nil
+}
+
+// removeAttachments removes all attachments of a document, if it has any.
+// The metadata goes first so no attachment is listed without content.
+func (s *FileStorage) removeAttachments(channel, document string) error {
+	if err := removeFile(s.attachmentIndexPath(channel, document)); err != nil && err != ErrNotFound {
+		return err
+	}
+	return os.RemoveAll(s.attachmentDir(channel, document))
+}
+
+// listDocuments returns the sorted document names in a channel directory.
+// Names are sorted after trimming the extension so the order matches the
+// other backends ("a" before "a-b").
+func (s *FileStorage) listDocuments(channel string) ([]string, error) {
+	entries, err := os.ReadDir(s.channelPath(channel))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || isInternalFile(name) || !strings.HasSuffix(name, fileExt) {
+			continue
+		}
+		names = append(names, strings.TrimSuffix(name, fileExt))
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// tx returns a transaction writing straight to disk
+// The caller must hold the lock.
+func (s *FileStorage) tx() *fileTx {
+	return &fileTx{s: s}
+}
+
+// fileTx implements Tx over a FileStorage. When writes is non-nil, changes
+// are staged there (nil entries mark deletions) instead of being written,
+// and dropped records the documents whose attachments must be removed.
+type fileTx struct {
+	s       *FileStorage
+	writes  map[string]map[string][]byte
+	dropped map[string]map[string]bool
+}
+
+func (t *fileTx) lookup(channel, document string) ([]byte, error) {
+	if staged, ok := t.writes[channel][document]; ok {
+		if staged == nil {
+			return nil, ErrNotFound
+		}
+		return clone(staged), nil
+	}
+	return t.s.read(channel, document)
+}
+
+// GetDocument retrieves a document from a channel
+func (t *fileTx) GetDocument(channel, document string) ([]byte, error) {
+	return t.lookup(channel, document)
+}
+
+// PutDocument stores a document in a channel, creating the channel if needed
+func (t *fileTx) PutDocument(channel, document string, data []byte) (bool, error) {
+	_, err := t.lookup(channel, document)
+	if err != nil && err != ErrNotFound {
+		return false, err
+	}
+	created := err == ErrNotFound
+
+	if t.writes == nil {
+		return created, t.s.update(channel, document, data)
+	}
+	t.stage(channel, document, clone(data))
+	return created, nil
+}
+
+// DeleteDocument removes a document from a channel
+func (t *fileTx) DeleteDocument(channel, document string) error {
+	if _, err := t.lookup(channel, document); err != nil {
+		return err
+	}
+	if t.writes == nil {
+		if err := t.s.remove(channel, document); err != nil {
+			return err
+		}
+		if err := t.s.removeRevisions(channel, document); err != nil {
+			return err
+		}
+		return t.s.removeAttachments(channel, document)
+	}
+	t.stage(channel, document, nil)
+	if t.dropped[channel] == nil {
+		t.dropped[channel] = make(map[string]bool)
+	}
+	t.dropped[channel][document] = true
+	return nil
+}
+
+func (t *fileTx) stage(channel, document string, data []byte) {
+	staged := t.writes[channel]
+	if staged == nil {
+		staged = make(map[string][]byte)
+		t.writes[channel] = staged
+	}
+	staged[document] = data
+}
+
+// isInternalFile reports whether a directory entry holds internal data
+// (locks, schemas, temporary files) rather than a channel or document
+func isInternalFile(name string) bool {
+	return strings.HasPrefix(name, ".")
+}
+
+func readFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+func removeFile(path string) error {
+	err := os.Remove(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// writeFileAtomic replaces path with data via a synced temporary file
+// in the same directory, then syncs the directory to persist the rename
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = d.Close() }()
+	return d.Sync()
+}
@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileStorage_Layout(t *testing.T) {
+	dir := t.TempDir()
+	storage, err := NewFileStorage(dir)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	defer func() { _ = storage.Close() }()
+
+	if _, err := storage.PutDocument("app", "settings", []byte(`{"theme": "dark"}`)); err != nil {
+		t.Fatalf("PutDocument failed: %v", err)
+	}
+	if err := storage.PutSchema("app", []byte(`{"type": "object"}`)); err != nil {
+		t.Fatalf("PutSchema failed: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "app", "settings.json"))
+	if err != nil {
+		t.Fatalf("Expected document file: %v", err)
+	}
+	if string(data) != `{"theme": "dark"}` {
+		t.Errorf("Unexpected file content %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".schemas", "app.json")); err != nil {
+		t.Errorf("Expected schema file: %v", err)
+	}
+
+	// No temporary files are left behind
+	entries, err := os.ReadDir(filepath.Join(dir, "app"))
+	if err != nil {
+		t.Fatalf("ReadDir failed: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Expected only settings.json, got %v", entries)
+	}
+}
+
+func TestFileStorage_IgnoresForeignFiles(t *testing.T) {
+	dir := t.TempDir()
+	storage, err := NewFileStorage(dir)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	defer func() { _ = storage.Close() }()
+
+	if _, err := storage.PutDocument("app", "settings", []byte(`{}`)); err != nil {
+		t.Fatalf("PutDocument failed: %v", err)
+	}
+	// Files a user or git may leave around
+	for _, name := range []string{".git", "README.md", filepath.Join("app", "notes.txt"), filepath.Join("app", ".settings.json.swp")} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("x"), 0600); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+	}
+
+	channels, err := storage.ListChannels()
+	if err != nil {
+		t.Fatalf("ListChannels failed: %v", err)
+	}
+	if len(channels) != 1 || channels[0].Name != "app" || channels[0].DocumentCount != 1 {
+		t.Errorf("Unexpected channels %v", channels)
+	}
+}
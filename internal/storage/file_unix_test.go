@@ -0,0 +1,26 @@
+//go:build unix
+
+package storage
+
+import "testing"
+
+func TestFileStorage_LockedByAnotherInstance(t *testing.T) {
+	dir := t.TempDir()
+	storage, err := NewFileStorage(dir)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+
+	if _, err := NewFileStorage(dir); err == nil {
+		t.Fatal("Expected second open to fail while locked")
+	}
+
+	if err := storage.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	second, err := NewFileStorage(dir)
+	if err != nil {
+		t.Fatalf("Expected open to succeed after Close: %v", err)
+	}
+	_ = second.Close()
+}
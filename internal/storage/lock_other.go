@@ -0,0 +1,15 @@
+//go:build !unix
+
+package storage
+
+import "os"
+
+// lockDir opens the lock file without locking it; platforms without flock
+// rely on the in-process lock only
+func lockDir(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+}
+
+func unlockDir(f *os.File) error {
+	return f.Close()
+}
@@ -0,0 +1,561 @@
+package storage
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// MemoryStorage implements Storage in process memory
+// Contents are lost on Close unless saved with Backup first
+type MemoryStorage struct {
+	mu       sync.RWMutex
+	channels map[string]map[string]memoryDoc
+	schemas  map[string][]byte
+	settings map[string][]byte
+}
+
+// memoryDoc is a stored document; data, attachments and history are never
+// modified after they are stored, so updates replace them
+type memoryDoc struct {
+	data        []byte
+	modified    time.Time
+	revision    int
+	attachments map[string]Attachment
+	// history holds the previous versions, oldest first
+	history []memoryRevision
+}
+
+// memoryRevision is a previous version of a document
+type memoryRevision struct {
+	revision int
+	data     []byte
+	modified time.Time
+}
+
+// NewMemoryStorage creates an empty in-memory storage
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		channels: make(map[string]map[string]memoryDoc),
+		schemas:  make(map[string][]byte),
+		settings: make(map[string][]byte),
+	}
+}
+
+// GetDocument retrieves a document from a channel
+func (s *MemoryStorage) GetDocument(channel, document string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.tx().GetDocument(channel, document)
+}
+
+// PutDocument stores a document in a channel
+func (s *MemoryStorage) PutDocument(channel, document string, data []byte) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tx().PutDocument(channel, document, data)
+}
+
+// DeleteDocument removes a document from a channel
+func (s *MemoryStorage) DeleteDocument(channel, document string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tx().DeleteDocument(channel, document)
+}
+
+// GetAttachment retrieves a binary attachment of a document
+func (s *MemoryStorage) GetAttachment(channel, document, name string) (Attachment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	a, ok := s.channels[channel][document].attachments[name]
+	if !ok {
+		return Attachment{}, ErrNotFound
+	}
+	a.Data = clone(a.Data)
+	return a, nil
+}
+
+// PutAttachment stores a binary attachment of a document
+func (s *MemoryStorage) PutAttachment(channel, document, name, contentType string, data []byte) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	doc, ok := s.channels[channel][document]
+	if !ok {
+		return false, ErrNotFound
+	}
+	_, exists := doc.attachments[name]
+	attachments := make(map[string]Attachment, len(doc.attachments)+1)
+	for k, v := range doc.attachments {
+		attachments[k] = v
+	}
+	attachments[name] = NewAttachment(name, contentType, clone(data))
+	doc.attachments = attachments
+	s.channels[channel][document] = doc
+	return !exists, nil
+}
+
+// ListRevisions returns the current and kept previous versions of a document
+func (s *MemoryStorage) ListRevisions(channel, document string) ([]RevisionMeta, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	doc, ok := s.channels[channel][document]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	revisions := []RevisionMeta{{Revision: doc.revision, Modified: doc.modified}}
+	for i := len(doc.history) - 1; i >= 0; i-- {
+		revisions = append(revisions, RevisionMeta{Revision: doc.history[i].revision, Modified: doc.history[i].modified})
+	}
+	return revisions, nil
+}
+
+// GetRevision retrieves a version of a document by revision number
+func (s *MemoryStorage) GetRevision(channel, document string, revision int) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	doc, ok := s.channels[channel][document]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if revision == doc.revision {
+		return clone(doc.data), nil
+	}
+	for _, r := range doc.history {
+		if r.revision == revision {
+			return clone(r.data), nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// ListAttachments returns the metadata of the attachments of a document
+func (s *MemoryStorage) ListAttachments(channel, document string) ([]AttachmentMeta, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	doc, ok := s.channels[channel][document]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	metas := make([]AttachmentMeta, 0, len(doc.attachments))
+	for _, name := range sortedKeys(doc.attachments) {
+		metas = append(metas, doc.attachments[name].AttachmentMeta)
+	}
+	return metas, nil
+}
+
+// DeleteAttachment removes a binary attachment of a document
+func (s *MemoryStorage) DeleteAttachment(channel, document, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	doc, ok := s.channels[channel][document]
+	if !ok {
+		return ErrNotFound
+	}
+	if _, ok := doc.attachments[name]; !ok {
+		return ErrNotFound
+	}
+	attachments := make(map[string]Attachment, len(doc.attachments))
+	for k, v := range doc.attachments {
+		if k != name {
+			attachments[k] = v
+		}
+	}
+	doc.attachments = attachments
+	s.channels[channel][document] = doc
+	return nil
+}
+
+// Batch runs fn with exclusive access, applying its writes only if it succeeds
+func (s *MemoryStorage) Batch(fn func(tx Tx) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx := &memoryTx{base: s.channels, writes: make(map[string]map[string]*memoryDoc)}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	for channel, docs := range tx.writes {
+		docsOf := s.channels[channel]
+		if docsOf == nil {
+			docsOf = make(map[string]memoryDoc)
+			s.channels[channel] = docsOf
+		}
+		for name, doc := range docs {
+			if doc == nil {
+				delete(docsOf, name)
+			} else {
+				docsOf[name] = *doc
+			}
+		}
+	}
+	return nil
+}
+
+// ViewDocuments calls fn for each named document while holding a read lock
+func (s *MemoryStorage) ViewDocuments(channel string, names []string, fn func(name string, data []byte) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	docs := s.channels[channel]
+	for _, name := range names {
+		var data []byte
+		if doc, ok := docs[name]; ok {
+			data = doc.data
+		}
+		if err := fn(name, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ForEachDocument calls fn for every document in a channel while holding a read lock
+func (s *MemoryStorage) ForEachDocument(channel, after string, fn func(name string, data []byte, meta DocumentMeta) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	docs, ok := s.channels[channel]
+	if !ok {
+		return ErrNotFound
+	}
+	for _, name := range sortedKeys(docs) {
+		if name <= after {
+			continue
+		}
+		doc := docs[name]
+		meta := DocumentMeta{Size: len(doc.data), Modified: doc.modified}
+		for _, a := range sortedKeys(doc.attachments) {
+			meta.Attachments = append(meta.Attachments, doc.attachments[a].AttachmentMeta)
+		}
+		if err := fn(name, doc.data, meta); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListDocuments returns all document names in a channel (sorted alphabetically)
+func (s *MemoryStorage) ListDocuments(channel string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	docs, ok := s.channels[channel]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return sortedKeys(docs), nil
+}
+
+// ListDocumentMeta returns the names and metadata of all documents in a channel
+func (s *MemoryStorage) ListDocumentMeta(channel string) ([]DocumentInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	docs, ok := s.channels[channel]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	infos := make([]DocumentInfo, 0, len(docs))
+	for _, name := range sortedKeys(docs) {
+		doc := docs[name]
+		info := DocumentInfo{Name: name, DocumentMeta: DocumentMeta{Size: len(doc.data), Modified: doc.modified}}
+		for _, a := range sortedKeys(doc.attachments) {
+			info.Attachments = append(info.Attachments, doc.attachments[a].AttachmentMeta)
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// ListChannels returns all channels with document counts (sorted alphabetically)
+func (s *MemoryStorage) ListChannels() ([]ChannelInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	channels := make([]ChannelInfo, 0, len(s.channels))
+	for _, name := range sortedKeys(s.channels) {
+		channels = append(channels, ChannelInfo{
+			Name:          name,
+			DocumentCount: len(s.channels[name]),
+		})
+	}
+	return channels, nil
+}
+
+// GetSchema retrieves the JSON Schema attached to a channel
+func (s *MemoryStorage) GetSchema(channel string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	schema, ok := s.schemas[channel]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return clone(schema), nil
+}
+
+// PutSchema attaches a JSON Schema to a channel
+func (s *MemoryStorage) PutSchema(channel string, schema []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.schemas[channel] = clone(schema)
+	return nil
+}
+
+// DeleteSchema removes the JSON Schema attached to a channel
+func (s *MemoryStorage) DeleteSchema(channel string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.schemas[channel]; !ok {
+		return ErrNotFound
+	}
+	delete(s.schemas, channel)
+	return nil
+}
+
+// GetSettings retrieves the settings stored for a channel
+func (s *MemoryStorage) GetSettings(channel string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	settings, ok := s.settings[channel]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return clone(settings), nil
+}
+
+// PutSettings stores the settings of a channel
+func (s *MemoryStorage) PutSettings(channel string, settings []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.settings[channel] = clone(settings)
+	return nil
+}
+
+// DeleteSettings removes the settings stored for a channel
+func (s *MemoryStorage) DeleteSettings(channel string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.settings[channel]; !ok {
+		return ErrNotFound
+	}
+	delete(s.settings, channel)
+	return nil
+}
+
+// Backup writes the contents as a bbolt database file, so a snapshot of
+// an in-memory instance can later be served with BoltStorage
+func (s *MemoryStorage) Backup(w io.Writer) (int64, error) {
+	dir, err := os.MkdirTemp(snapshotDir(w), ".justdoc-snapshot-*")
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	path := filepath.Join(dir, "snapshot.db")
+	bolt, err := NewBoltStorage(path)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.copyTo(bolt); err != nil {
+		_ = bolt.Close()
+		return 0, err
+	}
+	if err := bolt.Close(); err != nil {
+		return 0, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = f.Close() }()
+	return io.Copy(w, f)
+}
+
+// snapshotDir returns the directory Backup builds the database in before
+// copying it to w. When w is a regular file that is the file's directory,
+// so snapshots work in images without a temporary directory; otherwise it
+// is the default temporary directory.
+func snapshotDir(w io.Writer) string {
+	if f, ok := w.(*os.File); ok {
+		if info, err := f.Stat(); err == nil && info.Mode().IsRegular() {
+			return filepath.Dir(f.Name())
+		}
+	}
+	return ""
+}
+
+// copyTo writes all schemas, settings, documents and attachments into
+// dst, the documents in one transaction with their revisions and
+// modification times
+func (s *MemoryStorage) copyTo(dst *BoltStorage) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for channel, schema := range s.schemas {
+		if err := dst.PutSchema(channel, schema); err != nil {
+			return err
+		}
+	}
+	for channel, settings := range s.settings {
+		if err := dst.PutSettings(channel, settings); err != nil {
+			return err
+		}
+	}
+	err := dst.update(func(tx *bbolt.Tx) error {
+		t := dst.wrap(tx)
+		for channel, docs := range s.channels {
+			for name, doc := range docs {
+				for _, r := range doc.history {
+					if err := t.putVersion(channel, name, r.data, r.revision, r.modified); err != nil {
+						return err
+					}
+				}
+				if err := t.putVersion(channel, name, doc.data, doc.revision, doc.modified); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for channel, docs := range s.channels {
+		for name, doc := range docs {
+			for _, a := range doc.attachments {
+				if _, err := dst.PutAttachment(channel, name, a.Name, a.ContentType, a.Data); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Close releases the stored data
+func (s *MemoryStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.channels = make(map[string]map[string]memoryDoc)
+	s.schemas = make(map[string][]byte)
+	s.settings = make(map[string][]byte)
+	return nil
+}
+
+// tx returns a transaction writing straight to the storage maps
+// The caller must hold the lock.
+func (s *MemoryStorage) tx() *memoryTx {
+	return &memoryTx{base: s.channels}
+}
+
+// memoryTx implements Tx over the storage maps. When writes is non-nil,
+// changes are staged there (nil entries mark deletions) instead of being
+// applied to base.
+type memoryTx struct {
+	base   map[string]map[string]memoryDoc
+	writes map[string]map[string]*memoryDoc
+}
+
+func (t *memoryTx) lookup(channel, document string) (memoryDoc, bool) {
+	if staged, ok := t.writes[channel][document]; ok {
+		if staged == nil {
+			return memoryDoc{}, false
+		}
+		return *staged, true
+	}
+	doc, ok := t.base[channel][document]
+	return doc, ok
+}
+
+// GetDocument retrieves a document from a channel
+func (t *memoryTx) GetDocument(channel, document string) ([]byte, error) {
+	doc, ok := t.lookup(channel, document)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return clone(doc.data), nil
+}
+
+// PutDocument stores a document in a channel, creating the channel if needed
+// The attachments of an existing document are kept.
+func (t *memoryTx) PutDocument(channel, document string, data []byte) (bool, error) {
+	existing, exists := t.lookup(channel, document)
+	doc := memoryDoc{data: clone(data), modified: time.Now().UTC(), revision: 1, attachments: existing.attachments}
+	if exists {
+		doc.revision = existing.revision + 1
+		previous := memoryRevision{revision: existing.revision, data: existing.data, modified: existing.modified}
+		doc.history = append(existing.history[max(len(existing.history)-MaxRevisions+1, 0):len(existing.history):len(existing.history)], previous)
+	}
+
+	if t.writes == nil {
+		docs := t.base[channel]
+		if docs == nil {
+			docs = make(map[string]memoryDoc)
+			t.base[channel] = docs
+		}
+		docs[document] = doc
+		return !exists, nil
+	}
+
+	staged := t.writes[channel]
+	if staged == nil {
+		staged = make(map[string]*memoryDoc)
+		t.writes[channel] = staged
+	}
+	staged[document] = &doc
+	return !exists, nil
+}
+
+// DeleteDocument removes a document from a channel
+func (t *memoryTx) DeleteDocument(channel, document string) error {
+	if _, ok := t.lookup(channel, document); !ok {
+		return ErrNotFound
+	}
+
+	if t.writes == nil {
+		delete(t.base[channel], document)
+		return nil
+	}
+
+	staged := t.writes[channel]
+	if staged == nil {
+		staged = make(map[string]*memoryDoc)
+		t.writes[channel] = staged
+	}
+	staged[document] = nil
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func clone(data []byte) []byte {
+	c := make([]byte, len(data))
+	copy(c, data)
+	return c
+}
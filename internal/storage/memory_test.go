@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMemoryStorage_Backup(t *testing.T) {
+	storage := NewMemoryStorage()
+
+	if _, err := storage.PutDocument("app", "settings", []byte(`{"theme": "dark"}`)); err != nil {
+		t.Fatalf("PutDocument failed: %v", err)
+	}
+	if err := storage.PutSchema("app", []byte(`{"type": "object"}`)); err != nil {
+		t.Fatalf("PutSchema failed: %v", err)
+	}
+	if err := storage.PutSettings("app", []byte(`{"normalize":true}`)); err != nil {
+		t.Fatalf("PutSettings failed: %v", err)
+	}
+	if _, err := storage.PutAttachment("app", "settings", "logo.png", "image/png", []byte{0x89, 'P'}); err != nil {
+		t.Fatalf("PutAttachment failed: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "snapshot.db")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if _, err := storage.Backup(f); err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	bolt, err := NewBoltStorage(path)
+	if err != nil {
+		t.Fatalf("Failed to open snapshot: %v", err)
+	}
+	defer func() { _ = bolt.Close() }()
+
+	if data, err := bolt.GetDocument("app", "settings"); err != nil || string(data) != `{"theme": "dark"}` {
+		t.Errorf("Expected document in snapshot, got %q (%v)", data, err)
+	}
+	if _, err := bolt.GetSchema("app"); err != nil {
+		t.Errorf("Expected schema in snapshot, got %v", err)
+	}
+	if data, err := bolt.GetSettings("app"); err != nil || string(data) != `{"normalize":true}` {
+		t.Errorf("Expected settings in snapshot, got %q (%v)", data, err)
+	}
+	if a, err := bolt.GetAttachment("app", "settings", "logo.png"); err != nil || a.ContentType != "image/png" || string(a.Data) != "\x89P" {
+		t.Errorf("Expected attachment in snapshot, got %+v (%v)", a, err)
+	}
+}
+
+func TestMemoryStorage_BackupKeepsHistory(t *testing.T) {
+	storage := NewMemoryStorage()
+	last := MaxRevisions + 3
+	for i := 1; i <= last; i++ {
+		if _, err := storage.PutDocument("app", "settings", []byte(fmt.Sprintf(`{"v":%d}`, i))); err != nil {
+			t.Fatalf("PutDocument failed: %v", err)
+		}
+	}
+	want, err := storage.ListRevisions("app", "settings")
+	if err != nil {
+		t.Fatalf("ListRevisions failed: %v", err)
+	}
+	var modified time.Time
+	_ = storage.ForEachDocument("app", "", func(_ string, _ []byte, meta DocumentMeta) error {
+		modified = meta.Modified
+		return nil
+	})
+
+	// The copy is written later, so the times would differ if they were reset
+	time.Sleep(10 * time.Millisecond)
+	path := filepath.Join(t.TempDir(), "snapshot.db")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if _, err := storage.Backup(f); err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	bolt, err := NewBoltStorage(path)
+	if err != nil {
+		t.Fatalf("Failed to open snapshot: %v", err)
+	}
+	defer func() { _ = bolt.Close() }()
+
+	_ = bolt.ForEachDocument("app", "", func(_ string, _ []byte, meta DocumentMeta) error {
+		if !meta.Modified.Equal(modified) {
+			t.Errorf("Expected Modified %v to survive the backup, got %v", modified, meta.Modified)
+		}
+		return nil
+	})
+	got, err := bolt.ListRevisions("app", "settings")
+	if err != nil {
+		t.Fatalf("ListRevisions failed: %v", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d revisions in snapshot, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if got[i].Revision != want[i].Revision || !got[i].Modified.Equal(want[i].Modified) {
+			t.Errorf("Revision %d: expected %+v, got %+v", i, want[i], got[i])
+		}
+		data, err := bolt.GetRevision("app", "settings", want[i].Revision)
+		if w := fmt.Sprintf(`{"v":%d}`, want[i].Revision); err != nil || string(data) != w {
+			t.Errorf("GetRevision(%d) = %q (%v), want %q", want[i].Revision, data, err, w)
+		}
+	}
+}
+
+func TestMemoryStorage_BackupWithoutTempDir(t *testing.T) {
+	// Scratch images have no temporary directory; snapshots written to a
+	// file are built next to it instead
+	t.Setenv("TMPDIR", filepath.Join(t.TempDir(), "missing"))
+	storage := NewMemoryStorage()
+	if _, err := storage.PutDocument("app", "settings", []byte(`{"theme": "dark"}`)); err != nil {
+		t.Fatalf("PutDocument failed: %v", err)
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "snapshot.db")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if _, err := storage.Backup(f); err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 {
+		t.Errorf("Expected only the snapshot to be left in %s, got %v (%v)", dir, entries, err)
+	}
+	bolt, err := NewBoltStorage(path)
+	if err != nil {
+		t.Fatalf("Failed to open snapshot: %v", err)
+	}
+	defer func() { _ = bolt.Close() }()
+	data, err := bolt.GetDocument("app", "settings")
+	if err != nil || string(data) != `{"theme": "dark"}` {
+		t.Errorf("Expected document in snapshot, got %q (%v)", data, err)
+	}
+}
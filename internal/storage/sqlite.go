@@ -0,0 +1,723 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	_ "modernc.org/sqlite" // registers the CGO-free "sqlite" driver
+)
+
+// sqliteMigrations are applied in order; PRAGMA user_version records how
+// many have run. Append new steps, never edit released ones.
+var sqliteMigrations = []string{
+	`CREATE TABLE channels (
+		id   INTEGER PRIMARY KEY,
+		name TEXT NOT NULL UNIQUE
+	);
+	CREATE TABLE documents (
+		channel_id INTEGER NOT NULL REFERENCES channels (id),
+		name       TEXT NOT NULL,
+		data       BLOB NOT NULL,
+		PRIMARY KEY (channel_id, name)
+	) WITHOUT ROWID;
+	CREATE TABLE metadata (
+		channel_id INTEGER NOT NULL,
+		name       TEXT NOT NULL,
+		modified   INTEGER NOT NULL,
+		PRIMARY KEY (channel_id, name),
+		FOREIGN KEY (channel_id, name) REFERENCES documents (channel_id, name) ON DELETE CASCADE
+	) WITHOUT ROWID;
+	CREATE TABLE schemas (
+		channel TEXT PRIMARY KEY,
+		schema  BLOB NOT NULL
+	) WITHOUT ROWID;`,
+	`CREATE TABLE attachments (
+		channel_id   INTEGER NOT NULL,
+		document     TEXT NOT NULL,
+		name         TEXT NOT NULL,
+		content_type TEXT NOT NULL,
+		digest       TEXT NOT NULL,
+		data         BLOB NOT NULL,
+		PRIMARY KEY (channel_id, document, name),
+		FOREIGN KEY (channel_id, document) REFERENCES documents (channel_id, name) ON DELETE CASCADE
+	) WITHOUT ROWID;`,
+	`ALTER TABLE metadata ADD COLUMN revision INTEGER NOT NULL DEFAULT 1;
+	CREATE TABLE revisions (
+		channel_id INTEGER NOT NULL,
+		document   TEXT NOT NULL,
+		revision   INTEGER NOT NULL,
+		modified   INTEGER NOT NULL,
+		data       BLOB NOT NULL,
+		PRIMARY KEY (channel_id, document, revision),
+		FOREIGN KEY (channel_id, document) REFERENCES documents (channel_id, name) ON DELETE CASCADE
+	) WITHOUT ROWID;`,
+	`CREATE TABLE settings (
+		channel  TEXT PRIMARY KEY,
+		settings BLOB NOT NULL
+	) WITHOUT ROWID;`,
+}
+
+// SQLiteStorage implements Storage using SQLite in WAL mode, so readers
+// never wait for the writer. Writes are serialized in-process; other
+// processes writing the same file wait up to the busy timeout.
+type SQLiteStorage struct {
+	db *sql.DB
+	mu sync.Mutex // serializes write transactions
+}
+
+// NewSQLiteStorage opens or creates a SQLite database at path and brings
+// its schema up to date
+func NewSQLiteStorage(path string) (*SQLiteStorage, error) {
+	// SQLite decodes the URI path, so escape characters like ? and # that
+	// would otherwise end it
+	dsn := &url.URL{
+		Scheme: "file",
+		Opaque: (&url.URL{Path: path}).EscapedPath(),
+		RawQuery: url.Values{"_pragma": {
+			"journal_mode(WAL)",
+			"synchronous(NORMAL)",
+			"foreign_keys(ON)",
+			"busy_timeout(5000)",
+		}}.Encode(),
+	}
+	db, err := sql.Open("sqlite", dsn.String())
+	if err != nil {
+		return nil, err
+	}
+	s := &SQLiteStorage{db: db}
+	if err := s.migrate(); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// migrate applies the migrations the database has not seen yet
+func (s *SQLiteStorage) migrate() error {
+	return s.update(func(tx *sql.Tx) error {
+		var version int
+		if err := tx.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+			return err
+		}
+		if version > len(sqliteMigrations) {
+			return fmt.Errorf("database schema version %d is newer than supported version %d", version, len(sqliteMigrations))
+		}
+		for i := version; i < len(sqliteMigrations); i++ {
+			if _, err := tx.Exec(sqliteMigrations[i]); err != nil {
+				return fmt.Errorf("migration %d: %w", i+1, err)
+			}
+		}
+		// PRAGMA does not accept bound parameters
+		_, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, len(sqliteMigrations)))
+		return err
+	})
+}
+
+// GetDocument retrieves a document from a channel
+func (s *SQLiteStorage) GetDocument(channel, document string) ([]byte, error) {
+	return sqliteTx{s.db}.GetDocument(channel, document)
+}
+
+// PutDocument stores a document in a channel
+func (s *SQLiteStorage) PutDocument(channel, document string, data []byte) (bool, error) {
+	var created bool
+	err := s.update(func(tx *sql.Tx) error {
+		var err error
+		created, err = sqliteTx{tx}.PutDocument(channel, document, data)
+		return err
+	})
+	return created, err
+}
+
+// DeleteDocument removes a document from a channel
+func (s *SQLiteStorage) DeleteDocument(channel, document string) error {
+	return s.update(func(tx *sql.Tx) error {
+		return sqliteTx{tx}.DeleteDocument(channel, document)
+	})
+}
+
+// ListRevisions returns the current and kept previous versions of a document
+func (s *SQLiteStorage) ListRevisions(channel, document string) ([]RevisionMeta, error) {
+	var revisions []RevisionMeta
+	err := s.view(func(tx *sql.Tx) error {
+		id, err := channelID(tx, channel)
+		if err != nil {
+			return err
+		}
+		current, modified, err := sqliteTx{tx}.currentRevision(id, document)
+		if err != nil {
+			return err
+		}
+		revisions = append(revisions, RevisionMeta{Revision: current, Modified: unixTime(modified)})
+
+		rows, err := tx.Query(`
+			SELECT revision, modified FROM revisions
+			WHERE channel_id = ? AND document = ?
+			ORDER BY revision DESC`, id, document)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = rows.Close() }()
+
+		for rows.Next() {
+			var revision int
+			if err := rows.Scan(&revision, &modified); err != nil {
+				return err
+			}
+			revisions = append(revisions, RevisionMeta{Revision: revision, Modified: unixTime(modified)})
+		}
+		return rows.Err()
+	})
+	return revisions, err
+}
+
+// GetRevision retrieves a version of a document by revision number
+func (s *SQLiteStorage) GetRevision(channel, document string, revision int) ([]byte, error) {
+	var data []byte
+	err := s.view(func(tx *sql.Tx) error {
+		id, err := channelID(tx, channel)
+		if err != nil {
+			return err
+		}
+		current, _, err := sqliteTx{tx}.currentRevision(id, document)
+		if err != nil {
+			return err
+		}
+		if revision == current {
+			err = tx.QueryRow(`SELECT data FROM documents WHERE channel_id = ? AND name = ?`, id, document).Scan(&data)
+		} else {
+			err = tx.QueryRow(`
+				SELECT data FROM revisions
+				WHERE channel_id = ? AND document = ? AND revision = ?`, id, document, revision).Scan(&data)
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		return err
+	})
+	return data, err
+}
+
+// GetAttachment retrieves a binary attachment of a document
+func (s *SQLiteStorage) GetAttachment(channel, document, name string) (Attachment, error) {
+	a := Attachment{AttachmentMeta: AttachmentMeta{Name: name}}
+	err := s.db.QueryRow(`
+		SELECT a.content_type, a.digest, a.data FROM attachments a
+		JOIN channels c ON c.id = a.channel_id
+		WHERE c.name = ? AND a.document = ? AND a.name = ?`, channel, document, name).Scan(&a.ContentType, &a.Digest, &a.Data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Attachment{}, ErrNotFound
+	}
+	a.Size = len(a.Data)
+	return a, err
+}
+
+// PutAttachment stores a binary attachment of a document
+func (s *SQLiteStorage) PutAttachment(channel, document, name, contentType string, data []byte) (bool, error) {
+	if data == nil {
+		// A nil blob would be stored as NULL
+		data = []byte{}
+	}
+	a := NewAttachment(name, contentType, data)
+	var created bool
+	err := s.update(func(tx *sql.Tx) error {
+		id, err := channelID(tx, channel)
+		if err != nil {
+			return err
+		}
+		var exists bool
+		err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM documents WHERE channel_id = ? AND name = ?)`, id, document).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrNotFound
+		}
+		err = tx.QueryRow(`SELECT NOT EXISTS (SELECT 1 FROM attachments WHERE channel_id = ? AND document = ? AND name = ?)`,
+			id, document, name).Scan(&created)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`
+			INSERT INTO attachments (channel_id, document, name, content_type, digest, data) VALUES (?, ?, ?, ?, ?, ?)
+			ON CONFLICT (channel_id, document, name) DO UPDATE SET
+				content_type = excluded.content_type, digest = excluded.digest, data = excluded.data`,
+			id, document, name, a.ContentType, a.Digest, a.Data)
+		return err
+	})
+	return created, err
+}
+
+// ListAttachments returns the metadata of the attachments of a document
+func (s *SQLiteStorage) ListAttachments(channel, document string) ([]AttachmentMeta, error) {
+	var metas []AttachmentMeta
+	err := s.view(func(tx *sql.Tx) error {
+		var exists bool
+		err := tx.QueryRow(`
+			SELECT EXISTS (SELECT 1 FROM documents d JOIN channels c ON c.id = d.channel_id
+			WHERE c.name = ? AND d.name = ?)`, channel, document).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrNotFound
+		}
+		rows, err := tx.Query(`
+			SELECT a.name, a.content_type, length(a.data), a.digest
+			FROM attachments a
+			JOIN channels c ON c.id = a.channel_id
+			WHERE c.name = ? AND a.document = ?
+			ORDER BY a.name`, channel, document)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = rows.Close() }()
+
+		metas = make([]AttachmentMeta, 0)
+		for rows.Next() {
+			var a AttachmentMeta
+			if err := rows.Scan(&a.Name, &a.ContentType, &a.Size, &a.Digest); err != nil {
+				return err
+			}
+			metas = append(metas, a)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return metas, nil
+}
+
+// DeleteAttachment removes a binary attachment of a document
+func (s *SQLiteStorage) DeleteAttachment(channel, document, name string) error {
+	return s.update(func(tx *sql.Tx) error {
+		id, err := channelID(tx, channel)
+		if err != nil {
+			return err
+		}
+		res, err := tx.Exec(`DELETE FROM attachments WHERE channel_id = ? AND document = ? AND name = ?`, id, document, name)
+		if err != nil {
+			return err
+		}
+		return requireAffected(res)
+	})
+}
+
+// Batch runs fn within a single SQLite transaction
+func (s *SQLiteStorage) Batch(fn func(tx Tx) error) error {
+	return s.update(func(tx *sql.Tx) error {
+		return fn(sqliteTx{tx})
+	})
+}
+
+// ViewDocuments calls fn for each named document within a single read transaction
+func (s *SQLiteStorage) ViewDocuments(channel string, names []string, fn func(name string, data []byte) error) error {
+	return s.view(func(tx *sql.Tx) error {
+		for _, name := range names {
+			data, err := sqliteTx{tx}.GetDocument(channel, name)
+			if err != nil && err != ErrNotFound {
+				return err
+			}
+			if err := fn(name, data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ForEachDocument calls fn for every document in a channel within a single read transaction
+func (s *SQLiteStorage) ForEachDocument(channel, after string, fn func(name string, data []byte, meta DocumentMeta) error) error {
+	return s.view(func(tx *sql.Tx) error {
+		id, err := channelID(tx, channel)
+		if err != nil {
+			return err
+		}
+		attachments, err := channelAttachments(tx, id)
+		if err != nil {
+			return err
+		}
+		rows, err := tx.Query(`
+			SELECT d.name, d.data, COALESCE(m.modified, 0)
+			FROM documents d
+			LEFT JOIN metadata m ON m.channel_id = d.channel_id AND m.name = d.name
+			WHERE d.channel_id = ? AND d.name > ?
+			ORDER BY d.name`, id, after)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = rows.Close() }()
+
+		for rows.Next() {
+			var name string
+			var data []byte
+			var modified int64
+			if err := rows.Scan(&name, &data, &modified); err != nil {
+				return err
+			}
+			meta := DocumentMeta{Size: len(data), Modified: unixTime(modified), Attachments: attachments[name]}
+			if err := fn(name, data, meta); err != nil {
+				return err
+			}
+		}
+		return rows.Err()
+	})
+}
+
+// ListDocumentMeta returns the names and metadata of all documents in a
+// channel; SQLite reads blob lengths without loading the documents
+func (s *SQLiteStorage) ListDocumentMeta(channel string) ([]DocumentInfo, error) {
+	var infos []DocumentInfo
+	err := s.view(func(tx *sql.Tx) error {
+		id, err := channelID(tx, channel)
+		if err != nil {
+			return err
+		}
+		attachments, err := channelAttachments(tx, id)
+		if err != nil {
+			return err
+		}
+		rows, err := tx.Query(`
+			SELECT d.name, length(d.data), COALESCE(m.modified, 0)
+			FROM documents d
+			LEFT JOIN metadata m ON m.channel_id = d.channel_id AND m.name = d.name
+			WHERE d.channel_id = ?
+			ORDER BY d.name`, id)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = rows.Close() }()
+
+		infos = make([]DocumentInfo, 0)
+		for rows.Next() {
+			var info DocumentInfo
+			var modified int64
+			if err := rows.Scan(&info.Name, &info.Size, &modified); err != nil {
+				return err
+			}
+			info.Modified = unixTime(modified)
+			info.Attachments = attachments[info.Name]
+			infos = append(infos, info)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return infos, nil
+}
+
+// channelAttachments returns the metadata of the attachments in a channel
+// by document, sorted by name
+func channelAttachments(tx *sql.Tx, id int64) (map[string][]AttachmentMeta, error) {
+	rows, err := tx.Query(`
+		SELECT document, name, content_type, length(data), digest
+		FROM attachments
+		WHERE channel_id = ?
+		ORDER BY document, name`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	attachments := make(map[string][]AttachmentMeta)
+	for rows.Next() {
+		var document string
+		var a AttachmentMeta
+		if err := rows.Scan(&document, &a.Name, &a.ContentType, &a.Size, &a.Digest); err != nil {
+			return nil, err
+		}
+		attachments[document] = append(attachments[document], a)
+	}
+	return attachments, rows.Err()
+}
+
+// ListDocuments returns all document names in a channel (sorted alphabetically)
+func (s *SQLiteStorage) ListDocuments(channel string) ([]string, error) {
+	var docs []string
+	err := s.view(func(tx *sql.Tx) error {
+		id, err := channelID(tx, channel)
+		if err != nil {
+			return err
+		}
+		rows, err := tx.Query(`SELECT name FROM documents WHERE channel_id = ? ORDER BY name`, id)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = rows.Close() }()
+
+		docs = make([]string, 0)
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				return err
+			}
+			docs = append(docs, name)
+		}
+		return rows.Err()
+	})
+	return docs, err
+}
+
+// ListChannels returns all channels with document counts (sorted alphabetically)
+func (s *SQLiteStorage) ListChannels() ([]ChannelInfo, error) {
+	rows, err := s.db.Query(`
+		SELECT c.name, COUNT(d.name)
+		FROM channels c
+		LEFT JOIN documents d ON d.channel_id = c.id
+		GROUP BY c.id
+		ORDER BY c.name`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	channels := make([]ChannelInfo, 0)
+	for rows.Next() {
+		var info ChannelInfo
+		if err := rows.Scan(&info.Name, &info.DocumentCount); err != nil {
+			return nil, err
+		}
+		channels = append(channels, info)
+	}
+	return channels, rows.Err()
+}
+
+// GetSchema retrieves the JSON Schema attached to a channel
+func (s *SQLiteStorage) GetSchema(channel string) ([]byte, error) {
+	var schema []byte
+	err := s.db.QueryRow(`SELECT schema FROM schemas WHERE channel = ?`, channel).Scan(&schema)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return schema, err
+}
+
+// PutSchema attaches a JSON Schema to a channel
+func (s *SQLiteStorage) PutSchema(channel string, schema []byte) error {
+	return s.update(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+			INSERT INTO schemas (channel, schema) VALUES (?, ?)
+			ON CONFLICT (channel) DO UPDATE SET schema = excluded.schema`, channel, schema)
+		return err
+	})
+}
+
+// DeleteSchema removes the JSON Schema attached to a channel
+func (s *SQLiteStorage) DeleteSchema(channel string) error {
+	return s.update(func(tx *sql.Tx) error {
+		res, err := tx.Exec(`DELETE FROM schemas WHERE channel = ?`, channel)
+		if err != nil {
+			return err
+		}
+		return requireAffected(res)
+	})
+}
+
+// GetSettings retrieves the settings stored for a channel
+func (s *SQLiteStorage) GetSettings(channel string) ([]byte, error) {
+	var settings []byte
+	err := s.db.QueryRow(`SELECT settings FROM settings WHERE channel = ?`, channel).Scan(&settings)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return settings, err
+}
+
+// PutSettings stores the settings of a channel
+func (s *SQLiteStorage) PutSettings(channel string, settings []byte) error {
+	return s.update(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+			INSERT INTO settings (channel, settings) VALUES (?, ?)
+			ON CONFLICT (channel) DO UPDATE SET settings = excluded.settings`, channel, settings)
+		return err
+	})
+}
+
+// DeleteSettings removes the settings stored for a channel
+func (s *SQLiteStorage) DeleteSettings(channel string) error {
+	return s.update(func(tx *sql.Tx) error {
+		res, err := tx.Exec(`DELETE FROM settings WHERE channel = ?`, channel)
+		if err != nil {
+			return err
+		}
+		return requireAffected(res)
+	})
+}
+
+// Close closes the database
+func (s *SQLiteStorage) Close() error {
+	return s.db.Close()
+}
+
+// view runs fn in a read transaction, which sees a consistent snapshot
+func (s *SQLiteStorage) view(fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	return fn(tx)
+}
+
+// update runs fn in a write transaction, committing only if fn succeeds
+func (s *SQLiteStorage) update(fn func(tx *sql.Tx) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// sqlQuerier is the subset of *sql.DB and *sql.Tx used by sqliteTx
+type sqlQuerier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// sqliteTx implements Tx over a transaction, or over the database for single reads
+type sqliteTx struct {
+	q sqlQuerier
+}
+
+// GetDocument retrieves a document from a channel
+func (t sqliteTx) GetDocument(channel, document string) ([]byte, error) {
+	var data []byte
+	err := t.q.QueryRow(`
+		SELECT d.data FROM documents d
+		JOIN channels c ON c.id = d.channel_id
+		WHERE c.name = ? AND d.name = ?`, channel, document).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+// PutDocument stores a document in a channel, creating the channel if needed
+func (t sqliteTx) PutDocument(channel, document string, data []byte) (bool, error) {
+	if _, err := t.q.Exec(`INSERT INTO channels (name) VALUES (?) ON CONFLICT (name) DO NOTHING`, channel); err != nil {
+		return false, err
+	}
+	id, err := channelID(t.q, channel)
+	if err != nil {
+		return false, err
+	}
+
+	var previous []byte
+	err = t.q.QueryRow(`SELECT data FROM documents WHERE channel_id = ? AND name = ?`, id, document).Scan(&previous)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, err
+	}
+	exists := err == nil
+
+	revision := 1
+	if exists {
+		current, modified, err := t.currentRevision(id, document)
+		if err != nil {
+			return false, err
+		}
+		if err := t.pushRevision(id, document, current, modified, previous); err != nil {
+			return false, err
+		}
+		revision = current + 1
+	}
+
+	if _, err := t.q.Exec(`
+		INSERT INTO documents (channel_id, name, data) VALUES (?, ?, ?)
+		ON CONFLICT (channel_id, name) DO UPDATE SET data = excluded.data`, id, document, data); err != nil {
+		return false, err
+	}
+	if _, err := t.q.Exec(`
+		INSERT INTO metadata (channel_id, name, modified, revision) VALUES (?, ?, ?, ?)
+		ON CONFLICT (channel_id, name) DO UPDATE SET modified = excluded.modified, revision = excluded.revision`,
+		id, document, time.Now().UnixNano(), revision); err != nil {
+		return false, err
+	}
+	return !exists, nil
+}
+
+// currentRevision returns the revision number and modification time (Unix
+// nanoseconds, 0 if unknown) of the current version of a document
+func (t sqliteTx) currentRevision(id int64, document string) (int, int64, error) {
+	var revision int
+	var modified int64
+	err := t.q.QueryRow(`
+		SELECT COALESCE(m.revision, 1), COALESCE(m.modified, 0)
+		FROM documents d
+		LEFT JOIN metadata m ON m.channel_id = d.channel_id AND m.name = d.name
+		WHERE d.channel_id = ? AND d.name = ?`, id, document).Scan(&revision, &modified)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, 0, ErrNotFound
+	}
+	return revision, modified, err
+}
+
+// pushRevision keeps a previous document version and drops the versions
+// beyond MaxRevisions
+func (t sqliteTx) pushRevision(id int64, document string, revision int, modified int64, data []byte) error {
+	if _, err := t.q.Exec(`
+		INSERT INTO revisions (channel_id, document, revision, modified, data) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (channel_id, document, revision) DO UPDATE SET modified = excluded.modified, data = excluded.data`,
+		id, document, revision, modified, data); err != nil {
+		return err
+	}
+	_, err := t.q.Exec(`DELETE FROM revisions WHERE channel_id = ? AND document = ? AND revision <= ?`,
+		id, document, revision-MaxRevisions)
+	return err
+}
+
+// DeleteDocument removes a document from a channel; its metadata,
+// revisions and attachments are removed by the foreign key cascade
+func (t sqliteTx) DeleteDocument(channel, document string) error {
+	id, err := channelID(t.q, channel)
+	if err != nil {
+		return err
+	}
+	res, err := t.q.Exec(`DELETE FROM documents WHERE channel_id = ? AND name = ?`, id, document)
+	if err != nil {
+		return err
+	}
+	return requireAffected(res)
+}
+
+// channelID returns the id of a channel, or ErrNotFound if it does not exist
+func channelID(q sqlQuerier, channel string) (int64, error) {
+	var id int64
+	err := q.QueryRow(`SELECT id FROM channels WHERE name = ?`, channel).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrNotFound
+	}
+	return id, err
+}
+
+// unixTime converts stored Unix nanoseconds, zero if unknown
+func unixTime(nanos int64) time.Time {
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos).UTC()
+}
+
+// requireAffected returns ErrNotFound if a statement changed no rows
+func requireAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
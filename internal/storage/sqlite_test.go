@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSQLiteStorage_Reopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.sqlite")
+
+	storage, err := NewSQLiteStorage(path)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	if _, err := storage.PutDocument("app", "settings", []byte(`{"theme": "dark"}`)); err != nil {
+		t.Fatalf("PutDocument failed: %v", err)
+	}
+	var mode string
+	if err := storage.db.QueryRow(`PRAGMA journal_mode`).Scan(&mode); err != nil || mode != "wal" {
+		t.Errorf("Expected WAL journal mode, got %q (%v)", mode, err)
+	}
+	if err := storage.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// Reopening runs no migrations again and keeps the data
+	storage, err = NewSQLiteStorage(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen storage: %v", err)
+	}
+	defer func() { _ = storage.Close() }()
+
+	var version int
+	if err := storage.db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil || version != len(sqliteMigrations) {
+		t.Errorf("Expected schema version %d, got %d (%v)", len(sqliteMigrations), version, err)
+	}
+	data, err := storage.GetDocument("app", "settings")
+	if err != nil || string(data) != `{"theme": "dark"}` {
+		t.Errorf("Expected document after reopen, got %q (%v)", data, err)
+	}
+}
+
+func TestSQLiteStorage_PathWithURICharacters(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "data?mode=ro#1%20.sqlite")
+
+	storage, err := NewSQLiteStorage(path)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	if _, err := storage.PutDocument("app", "settings", []byte(`{"theme": "dark"}`)); err != nil {
+		t.Fatalf("PutDocument failed: %v", err)
+	}
+	var mode string
+	if err := storage.db.QueryRow(`PRAGMA journal_mode`).Scan(&mode); err != nil || mode != "wal" {
+		t.Errorf("Expected WAL journal mode, got %q (%v)", mode, err)
+	}
+	if err := storage.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// The database lives at exactly the given path, not a truncated one
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("Expected database at %q: %v", path, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "data")); !os.IsNotExist(err) {
+		t.Errorf("Expected no database at the truncated path, got %v", err)
+	}
+
+	storage, err = NewSQLiteStorage(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen storage: %v", err)
+	}
+	defer func() { _ = storage.Close() }()
+	data, err := storage.GetDocument("app", "settings")
+	if err != nil || string(data) != `{"theme": "dark"}` {
+		t.Errorf("Expected document after reopen, got %q (%v)", data, err)
+	}
+}
+
+func TestSQLiteStorage_NewerSchemaVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.sqlite")
+
+	storage, err := NewSQLiteStorage(path)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	if _, err := storage.db.Exec(`PRAGMA user_version = 999`); err != nil {
+		t.Fatalf("Failed to set version: %v", err)
+	}
+	_ = storage.Close()
+
+	if _, err := NewSQLiteStorage(path); err == nil {
+		t.Error("Expected error opening a database from a newer version")
+	}
+}
+
+func TestSQLiteStorage_DeleteRemovesMetadata(t *testing.T) {
+	storage, err := NewSQLiteStorage(filepath.Join(t.TempDir(), "test.sqlite"))
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	defer func() { _ = storage.Close() }()
+
+	if _, err := storage.PutDocument("app", "settings", []byte(`{}`)); err != nil {
+		t.Fatalf("PutDocument failed: %v", err)
+	}
+	if err := storage.DeleteDocument("app", "settings"); err != nil {
+		t.Fatalf("DeleteDocument failed: %v", err)
+	}
+	var n int
+	if err := storage.db.QueryRow(`SELECT COUNT(*) FROM metadata`).Scan(&n); err != nil || n != 0 {
+		t.Errorf("Expected metadata to be removed, got %d rows (%v)", n, err)
+	}
+}
@@ -1,14 +1,73 @@
 package storage
 
-import "errors"
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"time"
+)
 
 // ErrNotFound is returned when a document or channel is not found
 var ErrNotFound = errors.New("not found")
 
+// MaxRevisions is the number of previous versions kept for each document
+const MaxRevisions = 10
+
 // ChannelInfo represents a channel with its document count
 type ChannelInfo struct {
-	Name          string `json:"name"`
-	DocumentCount int    `json:"document_count"`
+	Name          string `json:"name" doc:"Channel name"`
+	DocumentCount int    `json:"document_count" doc:"Number of documents in the channel"`
+}
+
+// DocumentMeta holds metadata maintained by the storage for each document
+type DocumentMeta struct {
+	Size     int       `json:"size" doc:"Stored document size in bytes"`
+	Modified time.Time `json:"modified,omitzero" doc:"Last modification time; omitted if unknown"`
+	// Attachments are sorted by name
+	Attachments []AttachmentMeta `json:"attachments,omitempty" doc:"Binary attachments of the document, sorted by name"`
+}
+
+// DocumentInfo represents a document with its metadata
+type DocumentInfo struct {
+	Name string
+	DocumentMeta
+}
+
+// RevisionMeta describes a version of a document. Revisions are numbered
+// from 1 when the document is created and count up with every write.
+type RevisionMeta struct {
+	Revision int
+	// Modified is when the version was written, zero if unknown
+	Modified time.Time
+}
+
+// AttachmentMeta describes a binary attachment stored alongside a document
+type AttachmentMeta struct {
+	Name        string `json:"name" doc:"Attachment name"`
+	ContentType string `json:"content_type" doc:"Media type the attachment was stored with"`
+	Size        int    `json:"size" doc:"Attachment size in bytes"`
+	Digest      string `json:"digest" doc:"SHA-256 of the attachment as sha256:<hex>"`
+}
+
+// Attachment is a binary attachment with its content
+type Attachment struct {
+	AttachmentMeta
+	Data []byte
+}
+
+// NewAttachment builds an attachment, computing its size and digest
+func NewAttachment(name, contentType string, data []byte) Attachment {
+	sum := sha256.Sum256(data)
+	return Attachment{
+		AttachmentMeta: AttachmentMeta{
+			Name:        name,
+			ContentType: contentType,
+			Size:        len(data),
+			Digest:      "sha256:" + hex.EncodeToString(sum[:]),
+		},
+		Data: data,
+	}
 }
 
 // Storage defines the document storage interface
@@ -22,13 +81,150 @@ type Storage interface {
 	// Returns created=true if document was new, false if updated
 	PutDocument(channel, document string, data []byte) (created bool, err error)
 
+	// DeleteDocument removes a document and its attachments from a channel
+	// Returns ErrNotFound if channel or document doesn't exist
+	DeleteDocument(channel, document string) error
+
+	// ListRevisions returns the current and the kept previous versions of a
+	// document, newest first; deleting a document discards its revisions
+	// Returns ErrNotFound if channel or document doesn't exist
+	ListRevisions(channel, document string) ([]RevisionMeta, error)
+
+	// GetRevision retrieves a version of a document by revision number
+	// Returns ErrNotFound if the document doesn't exist or the revision is
+	// not kept
+	GetRevision(channel, document string, revision int) ([]byte, error)
+
+	// GetAttachment retrieves a binary attachment of a document
+	// Returns ErrNotFound if the document or attachment doesn't exist
+	GetAttachment(channel, document, name string) (Attachment, error)
+
+	// PutAttachment stores a binary attachment of a document, replacing any
+	// existing one with the same name; attachments outlive document updates
+	// Returns created=true if the attachment was new, or ErrNotFound if the
+	// document doesn't exist
+	PutAttachment(channel, document, name, contentType string, data []byte) (created bool, err error)
+
+	// DeleteAttachment removes a binary attachment of a document
+	// Returns ErrNotFound if the document or attachment doesn't exist
+	DeleteAttachment(channel, document, name string) error
+
+	// ListAttachments returns the metadata of the attachments of a document
+	// (sorted by name) without reading their content
+	// Returns ErrNotFound if the document doesn't exist
+	ListAttachments(channel, document string) ([]AttachmentMeta, error)
+
+	// ViewDocuments calls fn for each named document within a single read transaction
+	// data is nil if the document doesn't exist and is only valid until fn returns
+	// Iteration stops at the first error returned by fn
+	ViewDocuments(channel string, names []string, fn func(name string, data []byte) error) error
+
+	// ForEachDocument calls fn for every document in a channel (sorted alphabetically)
+	// whose name sorts after "after", or for all of them if after is empty,
+	// within a single read transaction; data is only valid until fn returns
+	// Iteration stops at the first error returned by fn
+	// Returns ErrNotFound if channel doesn't exist
+	ForEachDocument(channel, after string, fn func(name string, data []byte, meta DocumentMeta) error) error
+
 	// ListDocuments returns all document names in a channel (sorted alphabetically)
 	// Returns ErrNotFound if channel doesn't exist
 	ListDocuments(channel string) ([]string, error)
 
+	// ListDocumentMeta returns the names and metadata of all documents in a
+	// channel (sorted alphabetically) without reading the documents
+	// Returns ErrNotFound if channel doesn't exist
+	ListDocumentMeta(channel string) ([]DocumentInfo, error)
+
 	// ListChannels returns all channels with document counts (sorted alphabetically)
 	ListChannels() ([]ChannelInfo, error)
 
+	// GetSchema retrieves the JSON Schema attached to a channel
+	// Returns ErrNotFound if the channel has no schema
+	GetSchema(channel string) ([]byte, error)
+
+	// PutSchema attaches a JSON Schema to a channel, replacing any existing one
+	// The channel itself doesn't need to exist
+	PutSchema(channel string, schema []byte) error
+
+	// DeleteSchema removes the JSON Schema attached to a channel
+	// Returns ErrNotFound if the channel has no schema
+	DeleteSchema(channel string) error
+
+	// GetSettings retrieves the settings stored for a channel
+	// Returns ErrNotFound if the channel has no settings
+	GetSettings(channel string) ([]byte, error)
+
+	// PutSettings stores the settings of a channel, replacing any existing ones
+	// The channel itself doesn't need to exist
+	PutSettings(channel string, settings []byte) error
+
+	// DeleteSettings removes the settings stored for a channel
+	// Returns ErrNotFound if the channel has no settings
+	DeleteSettings(channel string) error
+
+	// Batch runs fn within a single read-write transaction
+	// Changes made through tx are committed together if fn returns nil and
+	// discarded otherwise; the error returned by fn is passed through as is
+	Batch(fn func(tx Tx) error) error
+
 	// Close closes the storage connection
 	Close() error
 }
+
+// Tx is a read-write view of the storage used inside Batch
+// Reads observe writes made earlier in the same transaction
+type Tx interface {
+	// GetDocument retrieves a document from a channel
+	// Returns ErrNotFound if channel or document doesn't exist
+	GetDocument(channel, document string) ([]byte, error)
+
+	// PutDocument stores a document in a channel
+	// Returns created=true if document was new, false if updated
+	PutDocument(channel, document string, data []byte) (created bool, err error)
+
+	// DeleteDocument removes a document and its attachments from a channel
+	// Returns ErrNotFound if channel or document doesn't exist
+	DeleteDocument(channel, document string) error
+}
+
+// Backuper is implemented by storages that can stream a consistent snapshot
+// of their entire contents
+type Backuper interface {
+	// Backup writes a consistent snapshot to w without blocking writers
+	// Returns the number of bytes written
+	Backup(w io.Writer) (int64, error)
+}
+
+// EncodedDocument is a document in the form it is stored at rest
+type EncodedDocument struct {
+	// Data is the document in Encoding
+	Data []byte
+	// Encoding is an HTTP content coding such as "gzip", or empty if Data
+	// is the plain document
+	Encoding string
+	// Digest is the SHA-256 of the plain document, set when Encoding is not empty
+	Digest [32]byte
+}
+
+// EncodedGetter is implemented by storages that may keep documents
+// compressed and can return them without decoding
+type EncodedGetter interface {
+	// GetDocumentEncoded retrieves a document as stored
+	// Returns ErrNotFound if channel or document doesn't exist
+	GetDocumentEncoded(channel, document string) (EncodedDocument, error)
+}
+
+// Reencrypter is implemented by storages that encrypt documents at rest
+type Reencrypter interface {
+	// Reencrypt rewrites all documents not encrypted with the current key
+	// Returns the number of documents rewritten, or ErrEncryptionDisabled
+	// if no key is configured
+	Reencrypt() (int, error)
+}
+
+// Compacter is implemented by storages whose files don't shrink by themselves
+type Compacter interface {
+	// Compact rewrites the storage to reclaim unused space
+	// Returns the size in bytes before and after
+	Compact() (before, after int64, err error)
+}
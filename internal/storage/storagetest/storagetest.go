@@ -0,0 +1,825 @@
+// Package storagetest provides a conformance suite for storage.Storage
+// implementations. Backends call Run from their tests:
+//
+//	func TestMyStorage(t *testing.T) {
+//		storagetest.Run(t, func(t *testing.T) storage.Storage {
+//			return NewMyStorage(t.TempDir())
+//		})
+//	}
+package storagetest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rashpile/pako-justdoc/internal/storage"
+)
+
+// Factory returns a new, empty storage for a single subtest
+// The suite closes the storage when the subtest ends.
+type Factory func(t *testing.T) storage.Storage
+
+// Run runs the conformance suite against the storage returned by newStorage
+func Run(t *testing.T, newStorage Factory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s storage.Storage)
+	}{
+		{"GetDocument_NotFound", testGetNotFound},
+		{"PutDocument_CreateAndUpdate", testPutCreateAndUpdate},
+		{"PutDocument_CopiesData", testPutCopiesData},
+		{"DeleteDocument", testDeleteDocument},
+		{"ListDocuments_Order", testListDocumentsOrder},
+		{"ListDocuments_NotFound", testListDocumentsNotFound},
+		{"ListChannels", testListChannels},
+		{"ListChannels_Empty", testListChannelsEmpty},
+		{"NameEdgeCases", testNameEdgeCases},
+		{"Schemas", testSchemas},
+		{"Settings", testSettings},
+		{"Batch_Commit", testBatchCommit},
+		{"Batch_Rollback", testBatchRollback},
+		{"ViewDocuments", testViewDocuments},
+		{"ForEachDocument", testForEachDocument},
+		{"ListDocumentMeta", testListDocumentMeta},
+		{"ConcurrentWriters", testConcurrentWriters},
+		{"LargeValue", testLargeValue},
+		{"Attachments", testAttachments},
+		{"Attachments_RemovedWithDocument", testAttachmentsRemovedWithDocument},
+		{"Revisions", testRevisions},
+		{"Revisions_Pruned", testRevisionsPruned},
+		{"Revisions_Batch", testRevisionsBatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newStorage(t)
+			t.Cleanup(func() {
+				if err := s.Close(); err != nil {
+					t.Errorf("Close failed: %v", err)
+				}
+			})
+			tt.fn(t, s)
+		})
+	}
+}
+
+func put(t *testing.T, s storage.Storage, channel, document, data string) {
+	t.Helper()
+	if _, err := s.PutDocument(channel, document, []byte(data)); err != nil {
+		t.Fatalf("PutDocument(%s, %s) failed: %v", channel, document, err)
+	}
+}
+
+func expectDocument(t *testing.T, s storage.Storage, channel, document, want string) {
+	t.Helper()
+	got, err := s.GetDocument(channel, document)
+	if err != nil {
+		t.Fatalf("GetDocument(%s, %s) failed: %v", channel, document, err)
+	}
+	if string(got) != want {
+		t.Errorf("GetDocument(%s, %s) = %q, want %q", channel, document, got, want)
+	}
+}
+
+func expectNotFound(t *testing.T, err error) {
+	t.Helper()
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func testGetNotFound(t *testing.T, s storage.Storage) {
+	_, err := s.GetDocument("nochannel", "doc")
+	expectNotFound(t, err)
+
+	put(t, s, "channel", "doc", `{}`)
+	_, err = s.GetDocument("channel", "other")
+	expectNotFound(t, err)
+}
+
+func testPutCreateAndUpdate(t *testing.T, s storage.Storage) {
+	created, err := s.PutDocument("channel", "doc", []byte(`{"v": 1}`))
+	if err != nil {
+		t.Fatalf("PutDocument failed: %v", err)
+	}
+	if !created {
+		t.Error("Expected created=true for new document")
+	}
+
+	created, err = s.PutDocument("channel", "doc", []byte(`{"v": 2}`))
+	if err != nil {
+		t.Fatalf("PutDocument failed: %v", err)
+	}
+	if created {
+		t.Error("Expected created=false for existing document")
+	}
+	expectDocument(t, s, "channel", "doc", `{"v": 2}`)
+}
+
+func testPutCopiesData(t *testing.T, s storage.Storage) {
+	data := []byte(`{"v": 1}`)
+	put(t, s, "channel", "doc", string(data))
+	if _, err := s.PutDocument("channel", "doc2", data); err != nil {
+		t.Fatalf("PutDocument failed: %v", err)
+	}
+	data[0] = '['
+
+	got, err := s.GetDocument("channel", "doc2")
+	if err != nil {
+		t.Fatalf("GetDocument failed: %v", err)
+	}
+	if string(got) != `{"v": 1}` {
+		t.Errorf("Stored document changed with caller's slice: %q", got)
+	}
+	got[0] = '['
+	expectDocument(t, s, "channel", "doc2", `{"v": 1}`)
+}
+
+func testDeleteDocument(t *testing.T, s storage.Storage) {
+	expectNotFound(t, s.DeleteDocument("channel", "doc"))
+
+	put(t, s, "channel", "doc", `{}`)
+	put(t, s, "channel", "keep", `{}`)
+	if err := s.DeleteDocument("channel", "doc"); err != nil {
+		t.Fatalf("DeleteDocument failed: %v", err)
+	}
+	_, err := s.GetDocument("channel", "doc")
+	expectNotFound(t, err)
+	expectNotFound(t, s.DeleteDocument("channel", "doc"))
+
+	docs, err := s.ListDocuments("channel")
+	if err != nil {
+		t.Fatalf("ListDocuments failed: %v", err)
+	}
+	if len(docs) != 1 || docs[0] != "keep" {
+		t.Errorf("Expected [keep], got %v", docs)
+	}
+}
+
+func testListDocumentsOrder(t *testing.T, s storage.Storage) {
+	names := []string{"zebra", "alpha", "Beta", "_hidden", "-dash", "10", "9", "alpha-2", "alpha_2"}
+	for _, name := range names {
+		put(t, s, "channel", name, `{}`)
+	}
+
+	want := append([]string(nil), names...)
+	sort.Strings(want)
+
+	got, err := s.ListDocuments("channel")
+	if err != nil {
+		t.Fatalf("ListDocuments failed: %v", err)
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("ListDocuments = %v, want %v", got, want)
+	}
+}
+
+func testListDocumentsNotFound(t *testing.T, s storage.Storage) {
+	_, err := s.ListDocuments("nochannel")
+	expectNotFound(t, err)
+}
+
+func testListChannels(t *testing.T, s storage.Storage) {
+	put(t, s, "zebra", "a", `{}`)
+	put(t, s, "zebra", "b", `{}`)
+	put(t, s, "alpha", "a", `{}`)
+	put(t, s, "Beta", "a", `{}`)
+	put(t, s, "Beta", "b", `{}`)
+	put(t, s, "Beta", "c", `{}`)
+	// Schemas don't create channels
+	if err := s.PutSchema("schemaonly", []byte(`{}`)); err != nil {
+		t.Fatalf("PutSchema failed: %v", err)
+	}
+
+	got, err := s.ListChannels()
+	if err != nil {
+		t.Fatalf("ListChannels failed: %v", err)
+	}
+	want := []storage.ChannelInfo{
+		{Name: "Beta", DocumentCount: 3},
+		{Name: "alpha", DocumentCount: 1},
+		{Name: "zebra", DocumentCount: 2},
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("ListChannels = %v, want %v", got, want)
+	}
+}
+
+func testListChannelsEmpty(t *testing.T, s storage.Storage) {
+	got, err := s.ListChannels()
+	if err != nil {
+		t.Fatalf("ListChannels failed: %v", err)
+	}
+	if got == nil || len(got) != 0 {
+		t.Errorf("Expected empty non-nil slice, got %#v", got)
+	}
+}
+
+// testNameEdgeCases covers names valid under model.IsValidName that are
+// easy to mishandle: case differences, prefixes of each other, the maximum
+// length, and names made only of punctuation or digits
+func testNameEdgeCases(t *testing.T, s storage.Storage) {
+	long := strings.Repeat("a", 128)
+	names := []string{"doc", "Doc", "DOC", "doc-", "doc_", "d", "-", "_", "0", long}
+	for i, name := range names {
+		put(t, s, "case", name, fmt.Sprintf(`{"i": %d}`, i))
+	}
+	for i, name := range names {
+		expectDocument(t, s, "case", name, fmt.Sprintf(`{"i": %d}`, i))
+	}
+
+	// Channels with similar names are distinct
+	put(t, s, "Case", "doc", `{"other": true}`)
+	put(t, s, long, long, `{}`)
+	expectDocument(t, s, "case", "doc", `{"i": 0}`)
+	expectDocument(t, s, "Case", "doc", `{"other": true}`)
+	expectDocument(t, s, long, long, `{}`)
+
+	docs, err := s.ListDocuments("Case")
+	if err != nil {
+		t.Fatalf("ListDocuments failed: %v", err)
+	}
+	if len(docs) != 1 {
+		t.Errorf("Expected 1 document in Case, got %v", docs)
+	}
+}
+
+func testSchemas(t *testing.T, s storage.Storage) {
+	_, err := s.GetSchema("channel")
+	expectNotFound(t, err)
+	expectNotFound(t, s.DeleteSchema("channel"))
+
+	if err := s.PutSchema("channel", []byte(`{"type": "object"}`)); err != nil {
+		t.Fatalf("PutSchema failed: %v", err)
+	}
+	if err := s.PutSchema("channel", []byte(`{"type": "array"}`)); err != nil {
+		t.Fatalf("PutSchema failed: %v", err)
+	}
+	got, err := s.GetSchema("channel")
+	if err != nil {
+		t.Fatalf("GetSchema failed: %v", err)
+	}
+	if string(got) != `{"type": "array"}` {
+		t.Errorf("GetSchema = %q, want the latest schema", got)
+	}
+
+	if err := s.DeleteSchema("channel"); err != nil {
+		t.Fatalf("DeleteSchema failed: %v", err)
+	}
+	_, err = s.GetSchema("channel")
+	expectNotFound(t, err)
+}
+
+func testSettings(t *testing.T, s storage.Storage) {
+	_, err := s.GetSettings("channel")
+	expectNotFound(t, err)
+	expectNotFound(t, s.DeleteSettings("channel"))
+
+	if err := s.PutSettings("channel", []byte(`{"normalize":true}`)); err != nil {
+		t.Fatalf("PutSettings failed: %v", err)
+	}
+	if err := s.PutSettings("channel", []byte(`{"normalize":false}`)); err != nil {
+		t.Fatalf("PutSettings failed: %v", err)
+	}
+	got, err := s.GetSettings("channel")
+	if err != nil {
+		t.Fatalf("GetSettings failed: %v", err)
+	}
+	if string(got) != `{"normalize":false}` {
+		t.Errorf("GetSettings = %q, want the latest settings", got)
+	}
+	if _, err := s.GetSchema("channel"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Expected settings to be kept apart from schemas, got %v", err)
+	}
+	if channels, _ := s.ListChannels(); len(channels) != 0 {
+		t.Errorf("Expected settings not to create a channel, got %v", channels)
+	}
+
+	if err := s.DeleteSettings("channel"); err != nil {
+		t.Fatalf("DeleteSettings failed: %v", err)
+	}
+	_, err = s.GetSettings("channel")
+	expectNotFound(t, err)
+}
+
+func testBatchCommit(t *testing.T, s storage.Storage) {
+	put(t, s, "app", "old", `{}`)
+
+	err := s.Batch(func(tx storage.Tx) error {
+		created, err := tx.PutDocument("app", "manifest", []byte(`{"v": 1}`))
+		if err != nil {
+			return err
+		}
+		if !created {
+			t.Error("Expected created=true inside batch")
+		}
+		if created, err = tx.PutDocument("app", "manifest", []byte(`{"v": 2}`)); err != nil {
+			return err
+		}
+		if created {
+			t.Error("Expected created=false for a document written earlier in the batch")
+		}
+		data, err := tx.GetDocument("app", "manifest")
+		if err != nil {
+			return err
+		}
+		if string(data) != `{"v": 2}` {
+			t.Errorf("Expected batch to read its own write, got %q", data)
+		}
+		if _, err := tx.PutDocument("items", "item1", []byte(`{}`)); err != nil {
+			return err
+		}
+		return tx.DeleteDocument("app", "old")
+	})
+	if err != nil {
+		t.Fatalf("Batch failed: %v", err)
+	}
+
+	expectDocument(t, s, "app", "manifest", `{"v": 2}`)
+	expectDocument(t, s, "items", "item1", `{}`)
+	_, err = s.GetDocument("app", "old")
+	expectNotFound(t, err)
+}
+
+func testBatchRollback(t *testing.T, s storage.Storage) {
+	put(t, s, "app", "manifest", `{"v": 1}`)
+	put(t, s, "app", "keep", `{}`)
+
+	errAbort := errors.New("abort")
+	err := s.Batch(func(tx storage.Tx) error {
+		if _, err := tx.PutDocument("app", "manifest", []byte(`{"v": 2}`)); err != nil {
+			return err
+		}
+		if err := tx.DeleteDocument("app", "keep"); err != nil {
+			return err
+		}
+		if _, err := tx.PutDocument("newchannel", "doc", []byte(`{}`)); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if err != errAbort {
+		t.Fatalf("Expected Batch to return the callback error, got %v", err)
+	}
+
+	expectDocument(t, s, "app", "manifest", `{"v": 1}`)
+	expectDocument(t, s, "app", "keep", `{}`)
+	_, err = s.ListDocuments("newchannel")
+	expectNotFound(t, err)
+}
+
+func testViewDocuments(t *testing.T, s storage.Storage) {
+	put(t, s, "app", "a", `{"a": 1}`)
+	put(t, s, "app", "c", `{"c": 3}`)
+
+	var seen []string
+	err := s.ViewDocuments("app", []string{"c", "b", "a"}, func(name string, data []byte) error {
+		seen = append(seen, fmt.Sprintf("%s=%s", name, data))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ViewDocuments failed: %v", err)
+	}
+	want := []string{`c={"c": 3}`, `b=`, `a={"a": 1}`}
+	if strings.Join(seen, " ") != strings.Join(want, " ") {
+		t.Errorf("ViewDocuments saw %v, want %v", seen, want)
+	}
+
+	err = s.ViewDocuments("nochannel", []string{"a"}, func(name string, data []byte) error {
+		if data != nil {
+			t.Errorf("Expected nil data in missing channel, got %q", data)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ViewDocuments failed: %v", err)
+	}
+
+	errStop := errors.New("stop")
+	calls := 0
+	err = s.ViewDocuments("app", []string{"a", "c"}, func(string, []byte) error {
+		calls++
+		return errStop
+	})
+	if err != errStop || calls != 1 {
+		t.Errorf("Expected iteration to stop with callback error, got %v after %d calls", err, calls)
+	}
+}
+
+func testForEachDocument(t *testing.T, s storage.Storage) {
+	err := s.ForEachDocument("nochannel", "", func(string, []byte, storage.DocumentMeta) error { return nil })
+	expectNotFound(t, err)
+
+	before := time.Now().Add(-time.Second)
+	put(t, s, "app", "b", `{"b": 2}`)
+	put(t, s, "app", "a", `{"a": 1}`)
+
+	var names []string
+	err = s.ForEachDocument("app", "", func(name string, data []byte, meta storage.DocumentMeta) error {
+		names = append(names, name)
+		if meta.Size != len(data) {
+			t.Errorf("%s: meta size %d, data size %d", name, meta.Size, len(data))
+		}
+		if meta.Modified.Before(before) {
+			t.Errorf("%s: modified time %v is too old", name, meta.Modified)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ForEachDocument failed: %v", err)
+	}
+	if strings.Join(names, ",") != "a,b" {
+		t.Errorf("ForEachDocument order = %v, want [a b]", names)
+	}
+
+	// Iteration resumes after the given name, whether or not it exists
+	put(t, s, "app", "c", `{"c": 3}`)
+	for after, want := range map[string]string{"a": "b,c", "aa": "b,c", "c": "", "0": "a,b,c"} {
+		names = nil
+		err = s.ForEachDocument("app", after, func(name string, _ []byte, _ storage.DocumentMeta) error {
+			names = append(names, name)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("ForEachDocument after %q failed: %v", after, err)
+		}
+		if got := strings.Join(names, ","); got != want {
+			t.Errorf("ForEachDocument after %q = %q, want %q", after, got, want)
+		}
+	}
+
+	// Iteration stops at the first callback error
+	errStop := errors.New("stop")
+	calls := 0
+	err = s.ForEachDocument("app", "", func(string, []byte, storage.DocumentMeta) error {
+		calls++
+		return errStop
+	})
+	if err != errStop || calls != 1 {
+		t.Errorf("Expected iteration to stop with callback error, got %v after %d calls", err, calls)
+	}
+}
+
+// testListDocumentMeta checks that the metadata-only listing agrees with
+// the metadata ForEachDocument reports alongside the documents
+func testListDocumentMeta(t *testing.T, s storage.Storage) {
+	_, err := s.ListDocumentMeta("nochannel")
+	expectNotFound(t, err)
+
+	put(t, s, "app", "b", `{"b": 2}`)
+	put(t, s, "app", "a", `{"a": "`+strings.Repeat("x", 4096)+`"}`)
+	put(t, s, "app", "a", `{"a": "`+strings.Repeat("y", 2048)+`"}`)
+	if _, err := s.PutAttachment("app", "b", "logo.png", "image/png", []byte("png")); err != nil {
+		t.Fatalf("PutAttachment failed: %v", err)
+	}
+
+	var want []storage.DocumentInfo
+	err = s.ForEachDocument("app", "", func(name string, _ []byte, meta storage.DocumentMeta) error {
+		want = append(want, storage.DocumentInfo{Name: name, DocumentMeta: meta})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ForEachDocument failed: %v", err)
+	}
+	got, err := s.ListDocumentMeta("app")
+	if err != nil {
+		t.Fatalf("ListDocumentMeta failed: %v", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("ListDocumentMeta = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i].Name != want[i].Name || got[i].Size != want[i].Size || !got[i].Modified.Equal(want[i].Modified) ||
+			!reflect.DeepEqual(got[i].Attachments, want[i].Attachments) {
+			t.Errorf("ListDocumentMeta[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func testConcurrentWriters(t *testing.T, s storage.Storage) {
+	const writers, docs = 8, 25
+
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < docs; i++ {
+				data := fmt.Sprintf(`{"writer": %d, "i": %d}`, w, i)
+				if _, err := s.PutDocument("shared", fmt.Sprintf("w%d-d%d", w, i), []byte(data)); err != nil {
+					errs <- err
+					return
+				}
+				// Every writer also updates a common document
+				if _, err := s.PutDocument("shared", "common", []byte(data)); err != nil {
+					errs <- err
+					return
+				}
+				if _, err := s.GetDocument("shared", "common"); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("Concurrent write failed: %v", err)
+	}
+
+	got, err := s.ListDocuments("shared")
+	if err != nil {
+		t.Fatalf("ListDocuments failed: %v", err)
+	}
+	if len(got) != writers*docs+1 {
+		t.Errorf("Expected %d documents, got %d", writers*docs+1, len(got))
+	}
+	channels, err := s.ListChannels()
+	if err != nil {
+		t.Fatalf("ListChannels failed: %v", err)
+	}
+	if len(channels) != 1 || channels[0].DocumentCount != writers*docs+1 {
+		t.Errorf("Unexpected channels: %v", channels)
+	}
+}
+
+func testLargeValue(t *testing.T, s storage.Storage) {
+	// A 10MB JSON string, the largest document the API accepts
+	const size = 10 * 1024 * 1024
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = 'a' + byte(i%26)
+	}
+	data[0], data[size-1] = '"', '"'
+
+	if _, err := s.PutDocument("big", "doc", data); err != nil {
+		t.Fatalf("PutDocument failed: %v", err)
+	}
+	got, err := s.GetDocument("big", "doc")
+	if err != nil {
+		t.Fatalf("GetDocument failed: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("Large document corrupted: got %d bytes", len(got))
+	}
+}
+
+func putAttachment(t *testing.T, s storage.Storage, channel, document, name, contentType string, data []byte) bool {
+	t.Helper()
+	created, err := s.PutAttachment(channel, document, name, contentType, data)
+	if err != nil {
+		t.Fatalf("PutAttachment(%s, %s, %s) failed: %v", channel, document, name, err)
+	}
+	return created
+}
+
+func testAttachments(t *testing.T, s storage.Storage) {
+	_, err := s.PutAttachment("app", "doc", "logo.png", "image/png", []byte{1})
+	expectNotFound(t, err)
+	_, err = s.GetAttachment("app", "doc", "logo.png")
+	expectNotFound(t, err)
+
+	_, err = s.ListAttachments("app", "doc")
+	expectNotFound(t, err)
+
+	put(t, s, "app", "doc", `{"v": 1}`)
+	_, err = s.GetAttachment("app", "doc", "logo.png")
+	expectNotFound(t, err)
+	expectNotFound(t, s.DeleteAttachment("app", "doc", "logo.png"))
+	if metas, err := s.ListAttachments("app", "doc"); err != nil || metas == nil || len(metas) != 0 {
+		t.Errorf("Expected an empty non-nil list without attachments, got %#v (%v)", metas, err)
+	}
+
+	// Every byte value must survive, including ones that look like codecs
+	data := make([]byte, 256)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	if !putAttachment(t, s, "app", "doc", "logo.png", "image/png", data) {
+		t.Error("Expected created=true for a new attachment")
+	}
+	data[0] = 0xff
+	if putAttachment(t, s, "app", "doc", "logo.png", "image/png", []byte{0x02, 0x00, 'x'}) {
+		t.Error("Expected created=false when replacing an attachment")
+	}
+	putAttachment(t, s, "app", "doc", "a.txt", "text/plain", []byte("hello"))
+	putAttachment(t, s, "app", "doc", "empty", "application/octet-stream", nil)
+
+	got, err := s.GetAttachment("app", "doc", "a.txt")
+	if err != nil {
+		t.Fatalf("GetAttachment failed: %v", err)
+	}
+	want := storage.AttachmentMeta{
+		Name:        "a.txt",
+		ContentType: "text/plain",
+		Size:        5,
+		Digest:      "sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+	}
+	if got.AttachmentMeta != want || string(got.Data) != "hello" {
+		t.Errorf("GetAttachment = %+v %q, want %+v %q", got.AttachmentMeta, got.Data, want, "hello")
+	}
+	if got, _ := s.GetAttachment("app", "doc", "logo.png"); !bytes.Equal(got.Data, []byte{0x02, 0x00, 'x'}) || got.Size != 3 {
+		t.Errorf("GetAttachment = %+v %v, want the replaced content", got.AttachmentMeta, got.Data)
+	}
+	if got, err := s.GetAttachment("app", "doc", "empty"); err != nil || len(got.Data) != 0 || got.Size != 0 {
+		t.Errorf("GetAttachment of an empty attachment = %+v %v (%v)", got.AttachmentMeta, got.Data, err)
+	}
+
+	// Attachments are kept when the document is updated
+	put(t, s, "app", "doc", `{"v": 2}`)
+	var listed []string
+	err = s.ForEachDocument("app", "", func(name string, data []byte, meta storage.DocumentMeta) error {
+		for _, a := range meta.Attachments {
+			listed = append(listed, fmt.Sprintf("%s:%s:%d", a.Name, a.ContentType, a.Size))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ForEachDocument failed: %v", err)
+	}
+	if got := strings.Join(listed, ","); got != "a.txt:text/plain:5,empty:application/octet-stream:0,logo.png:image/png:3" {
+		t.Errorf("ForEachDocument attachments = %s", got)
+	}
+	metas, err := s.ListAttachments("app", "doc")
+	if err != nil {
+		t.Fatalf("ListAttachments failed: %v", err)
+	}
+	if len(metas) != 3 || metas[0] != want || metas[1].Name != "empty" || metas[2].Name != "logo.png" || metas[2].Size != 3 {
+		t.Errorf("ListAttachments = %+v", metas)
+	}
+
+	if err := s.DeleteAttachment("app", "doc", "a.txt"); err != nil {
+		t.Fatalf("DeleteAttachment failed: %v", err)
+	}
+	_, err = s.GetAttachment("app", "doc", "a.txt")
+	expectNotFound(t, err)
+	expectNotFound(t, s.DeleteAttachment("app", "doc", "a.txt"))
+	if _, err := s.GetAttachment("app", "doc", "logo.png"); err != nil {
+		t.Errorf("Expected other attachments to remain, got %v", err)
+	}
+	// Attachments don't count as documents
+	if docs, _ := s.ListDocuments("app"); len(docs) != 1 {
+		t.Errorf("ListDocuments = %v, want [doc]", docs)
+	}
+	if channels, _ := s.ListChannels(); len(channels) != 1 {
+		t.Errorf("ListChannels = %v, want only app", channels)
+	}
+}
+
+func testAttachmentsRemovedWithDocument(t *testing.T, s storage.Storage) {
+	put(t, s, "app", "a", `{}`)
+	put(t, s, "app", "b", `{}`)
+	put(t, s, "app", "c", `{}`)
+	putAttachment(t, s, "app", "a", "file", "text/plain", []byte("a"))
+	putAttachment(t, s, "app", "b", "file", "text/plain", []byte("b"))
+	putAttachment(t, s, "app", "c", "file", "text/plain", []byte("c"))
+
+	if err := s.DeleteDocument("app", "a"); err != nil {
+		t.Fatalf("DeleteDocument failed: %v", err)
+	}
+	err := s.Batch(func(tx storage.Tx) error {
+		if err := tx.DeleteDocument("app", "b"); err != nil {
+			return err
+		}
+		// Writing a deleted document again doesn't bring its attachments back
+		_, err := tx.PutDocument("app", "b", []byte(`{}`))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Batch failed: %v", err)
+	}
+
+	put(t, s, "app", "a", `{}`)
+	for _, document := range []string{"a", "b"} {
+		_, err := s.GetAttachment("app", document, "file")
+		expectNotFound(t, err)
+	}
+	if got, err := s.GetAttachment("app", "c", "file"); err != nil || string(got.Data) != "c" {
+		t.Errorf("Expected attachments of other documents to remain, got %q (%v)", got.Data, err)
+	}
+}
+
+// expectRevisions checks the revision numbers listed for a document, newest
+// first, and that every version can be retrieved with its content
+func expectRevisions(t *testing.T, s storage.Storage, channel, document string, want []int, data func(revision int) string) {
+	t.Helper()
+	revisions, err := s.ListRevisions(channel, document)
+	if err != nil {
+		t.Fatalf("ListRevisions(%s, %s) failed: %v", channel, document, err)
+	}
+	got := make([]int, len(revisions))
+	for i, r := range revisions {
+		got[i] = r.Revision
+		if r.Modified.IsZero() {
+			t.Errorf("Revision %d: expected a modification time", r.Revision)
+		}
+		if i > 0 && r.Modified.After(revisions[i-1].Modified) {
+			t.Errorf("Revision %d: modified %v after newer revision %v", r.Revision, r.Modified, revisions[i-1].Modified)
+		}
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("ListRevisions(%s, %s) = %v, want %v", channel, document, got, want)
+	}
+	for _, revision := range want {
+		content, err := s.GetRevision(channel, document, revision)
+		if err != nil {
+			t.Errorf("GetRevision(%s, %s, %d) failed: %v", channel, document, revision, err)
+		} else if string(content) != data(revision) {
+			t.Errorf("GetRevision(%s, %s, %d) = %q, want %q", channel, document, revision, content, data(revision))
+		}
+	}
+}
+
+func versionData(revision int) string {
+	return fmt.Sprintf(`{"v":%d}`, revision)
+}
+
+func testRevisions(t *testing.T, s storage.Storage) {
+	_, err := s.ListRevisions("app", "doc")
+	expectNotFound(t, err)
+
+	for i := 1; i <= 3; i++ {
+		put(t, s, "app", "doc", versionData(i))
+	}
+	put(t, s, "app", "other", `{}`)
+	expectRevisions(t, s, "app", "doc", []int{3, 2, 1}, versionData)
+	expectRevisions(t, s, "app", "other", []int{1}, func(int) string { return `{}` })
+	expectDocument(t, s, "app", "doc", versionData(3))
+
+	for _, revision := range []int{0, -1, 4} {
+		_, err := s.GetRevision("app", "doc", revision)
+		expectNotFound(t, err)
+	}
+	_, err = s.GetRevision("app", "missing", 1)
+	expectNotFound(t, err)
+	_, err = s.GetRevision("missing", "doc", 1)
+	expectNotFound(t, err)
+
+	// Deleting a document discards its history, so it starts over
+	if err := s.DeleteDocument("app", "doc"); err != nil {
+		t.Fatalf("DeleteDocument failed: %v", err)
+	}
+	_, err = s.ListRevisions("app", "doc")
+	expectNotFound(t, err)
+	_, err = s.GetRevision("app", "doc", 1)
+	expectNotFound(t, err)
+	put(t, s, "app", "doc", versionData(1))
+	expectRevisions(t, s, "app", "doc", []int{1}, versionData)
+}
+
+func testRevisionsPruned(t *testing.T, s storage.Storage) {
+	last := storage.MaxRevisions + 5
+	for i := 1; i <= last; i++ {
+		put(t, s, "app", "doc", versionData(i))
+	}
+	var want []int
+	for i := last; i >= last-storage.MaxRevisions; i-- {
+		want = append(want, i)
+	}
+	expectRevisions(t, s, "app", "doc", want, versionData)
+
+	_, err := s.GetRevision("app", "doc", last-storage.MaxRevisions-1)
+	expectNotFound(t, err)
+}
+
+func testRevisionsBatch(t *testing.T, s storage.Storage) {
+	put(t, s, "app", "a", versionData(1))
+	put(t, s, "app", "b", `{"old":true}`)
+	err := s.Batch(func(tx storage.Tx) error {
+		if _, err := tx.PutDocument("app", "a", []byte(versionData(2))); err != nil {
+			return err
+		}
+		if err := tx.DeleteDocument("app", "b"); err != nil {
+			return err
+		}
+		// A document deleted and written again starts a new history
+		_, err := tx.PutDocument("app", "b", []byte(versionData(1)))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Batch failed: %v", err)
+	}
+	expectRevisions(t, s, "app", "a", []int{2, 1}, versionData)
+	expectRevisions(t, s, "app", "b", []int{1}, versionData)
+
+	// A rolled back batch leaves the history alone
+	err = s.Batch(func(tx storage.Tx) error {
+		if _, err := tx.PutDocument("app", "a", []byte(versionData(3))); err != nil {
+			return err
+		}
+		return errors.New("rollback")
+	})
+	if err == nil {
+		t.Fatal("Expected Batch to fail")
+	}
+	expectRevisions(t, s, "app", "a", []int{2, 1}, versionData)
+}